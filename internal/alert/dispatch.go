@@ -0,0 +1,300 @@
+package alert
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// notifyTimeout bounds a single delivery attempt
+const notifyTimeout = 30 * time.Second
+
+// Dispatcher routes firing and resolved alerts to receivers, grouped so a
+// receiver gets one notification per group rather than one per alert.
+// Each receiver delivers on its own goroutine and retries with exponential
+// backoff, so a slow destination holds up neither the others nor the
+// collection loop.
+type Dispatcher struct {
+	mu        sync.Mutex
+	cfg       NotifyConfig
+	routes    map[string][]string
+	receivers map[string]*receiver
+	groups    map[string]*group
+	wg        sync.WaitGroup
+
+	// RetryBackoff is the wait before the first retry, doubling after
+	// each further failure
+	RetryBackoff time.Duration
+}
+
+type receiver struct {
+	name         string
+	notifier     Notifier
+	sendResolved bool
+	queue        chan Notification
+}
+
+// group is the state of the notifications one receiver gets for one rule
+// and set of group_by label values
+type group struct {
+	key      string
+	receiver string
+	rule     string
+	labels   map[string]string
+	alerts   map[string]Alert
+	created  time.Time
+	lastSent time.Time
+	sent     bool
+	changed  bool
+}
+
+// NewDispatcher creates the receivers of cfg and checks that every rule
+// routes to receivers that exist
+func NewDispatcher(cfg NotifyConfig, rules []Rule) (*Dispatcher, error) {
+	if cfg.GroupWait <= 0 {
+		cfg.GroupWait = Duration(DefaultGroupWait)
+	}
+	if cfg.GroupInterval <= 0 {
+		cfg.GroupInterval = Duration(DefaultGroupInterval)
+	}
+	if cfg.RepeatInterval <= 0 {
+		cfg.RepeatInterval = Duration(DefaultRepeatInterval)
+	}
+	if cfg.Retries == nil {
+		retries := DefaultNotifyRetries
+		cfg.Retries = &retries
+	}
+
+	d := &Dispatcher{
+		cfg:          cfg,
+		routes:       make(map[string][]string),
+		receivers:    make(map[string]*receiver),
+		groups:       make(map[string]*group),
+		RetryBackoff: time.Second,
+	}
+	for _, rc := range cfg.Receivers {
+		if rc.Name == "" {
+			return nil, errors.New("receiver without a name")
+		}
+		if _, ok := d.receivers[rc.Name]; ok {
+			return nil, fmt.Errorf("duplicate receiver %q", rc.Name)
+		}
+		notifier, err := newNotifier(rc)
+		if err != nil {
+			return nil, fmt.Errorf("receiver %q: %w", rc.Name, err)
+		}
+		d.receivers[rc.Name] = &receiver{
+			name:         rc.Name,
+			notifier:     notifier,
+			sendResolved: rc.SendResolved == nil || *rc.SendResolved,
+		}
+	}
+
+	if err := d.checkReceivers("default_receivers", cfg.DefaultReceivers); err != nil {
+		return nil, err
+	}
+	for _, r := range rules {
+		if err := d.checkReceivers(fmt.Sprintf("rule %q", r.Name), r.Receivers); err != nil {
+			return nil, err
+		}
+		if len(r.Receivers) > 0 {
+			d.routes[r.Name] = r.Receivers
+		}
+	}
+
+	for _, r := range d.receivers {
+		r.queue = make(chan Notification, 100)
+		d.wg.Add(1)
+		go d.deliver(r)
+	}
+	return d, nil
+}
+
+func (d *Dispatcher) checkReceivers(what string, names []string) error {
+	for _, name := range names {
+		if _, ok := d.receivers[name]; !ok {
+			return fmt.Errorf("%s: unknown receiver %q", what, name)
+		}
+	}
+	return nil
+}
+
+// Update takes the engine's alerts as of now and sends the notifications
+// that are due. Pending alerts are ignored; a resolved alert is sent once
+// to the groups that were told it fired. A silenced alert is dropped from
+// its groups without notice and notified afresh once unmuted.
+func (d *Dispatcher) Update(now time.Time, alerts []Alert) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, a := range alerts {
+		if a.State != StateFiring && a.State != StateResolved {
+			continue
+		}
+		receivers, ok := d.routes[a.Rule]
+		if !ok {
+			receivers = d.cfg.DefaultReceivers
+		}
+		for _, name := range receivers {
+			d.add(now, d.receivers[name], a)
+		}
+	}
+
+	for key, g := range d.groups {
+		if len(g.alerts) > 0 && d.due(now, g) {
+			d.send(now, g)
+		}
+		if len(g.alerts) == 0 {
+			delete(d.groups, key)
+		}
+	}
+}
+
+// add records an alert in its group for a receiver
+func (d *Dispatcher) add(now time.Time, r *receiver, a Alert) {
+	labels := make(map[string]string)
+	for _, name := range d.cfg.GroupBy {
+		if v, ok := a.Labels[name]; ok {
+			labels[name] = v
+		}
+	}
+	key := r.name + "\x00" + a.Rule + "\x00" + labelsKey(labels)
+	alertKey := labelsKey(a.Labels)
+
+	g := d.groups[key]
+	if a.State == StateFiring && a.Silenced() {
+		if g != nil {
+			delete(g.alerts, alertKey)
+		}
+		return
+	}
+	if a.State == StateFiring {
+		if g == nil {
+			g = &group{
+				key:      groupKey(a.Rule, labels),
+				receiver: r.name,
+				rule:     a.Rule,
+				labels:   labels,
+				alerts:   make(map[string]Alert),
+				created:  now,
+			}
+			d.groups[key] = g
+		}
+		if prev, ok := g.alerts[alertKey]; !ok || prev.State != StateFiring {
+			g.changed = true
+		}
+		g.alerts[alertKey] = a
+		return
+	}
+
+	// Only the resolution of the episode the group knows as firing counts;
+	// the alert may since have fired again
+	if g == nil {
+		return
+	}
+	prev, ok := g.alerts[alertKey]
+	if !ok || prev.State != StateFiring || !prev.FiredAt.Equal(*a.FiredAt) {
+		return
+	}
+	if r.sendResolved && g.sent {
+		g.alerts[alertKey] = a
+		g.changed = true
+	} else {
+		delete(g.alerts, alertKey)
+	}
+}
+
+// due reports whether a group should be sent now
+func (d *Dispatcher) due(now time.Time, g *group) bool {
+	switch {
+	case !g.sent:
+		return now.Sub(g.created) >= time.Duration(d.cfg.GroupWait)
+	case g.changed:
+		return now.Sub(g.lastSent) >= time.Duration(d.cfg.GroupInterval)
+	default:
+		return now.Sub(g.lastSent) >= time.Duration(d.cfg.RepeatInterval)
+	}
+}
+
+// send queues a notification of a group and forgets its resolved alerts
+func (d *Dispatcher) send(now time.Time, g *group) {
+	n := Notification{
+		Receiver: g.receiver,
+		Status:   StateResolved,
+		GroupKey: g.key,
+		Rule:     g.rule,
+		Labels:   g.labels,
+	}
+	for key, a := range g.alerts {
+		n.Alerts = append(n.Alerts, a)
+		if a.State == StateFiring {
+			n.Status = StateFiring
+		} else {
+			delete(g.alerts, key)
+		}
+	}
+	if n.Status != StateFiring && !g.sent {
+		// Resolved before anyone was told it fired
+		return
+	}
+	sortAlerts(n.Alerts)
+	g.sent, g.changed, g.lastSent = true, false, now
+
+	select {
+	case d.receivers[g.receiver].queue <- n:
+	default:
+		log.Printf("Alert receiver %s: queue full, dropping notification for %s", g.receiver, g.key)
+	}
+}
+
+// deliver sends a receiver's notifications in order, retrying failures
+func (d *Dispatcher) deliver(r *receiver) {
+	defer d.wg.Done()
+	for n := range r.queue {
+		backoff := d.RetryBackoff
+		for attempt := 0; ; attempt++ {
+			ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+			err := r.notifier.Notify(ctx, n)
+			cancel()
+			if err == nil {
+				break
+			}
+			if attempt >= *d.cfg.Retries {
+				log.Printf("Alert receiver %s: giving up on %s after %d attempts: %v", r.name, n.GroupKey, attempt+1, err)
+				break
+			}
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+}
+
+// Close delivers the queued notifications and stops the receivers
+func (d *Dispatcher) Close() {
+	d.mu.Lock()
+	for _, r := range d.receivers {
+		close(r.queue)
+	}
+	d.mu.Unlock()
+	d.wg.Wait()
+}
+
+// groupKey describes a group, e.g. DiskFull{mountpoint="/"}
+func groupKey(rule string, labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = fmt.Sprintf("%s=%q", name, labels[name])
+	}
+	return rule + "{" + strings.Join(pairs, ",") + "}"
+}
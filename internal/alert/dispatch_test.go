@@ -0,0 +1,196 @@
+package alert
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder is a Notifier that records what it is sent and fails the first
+// fail attempts
+type recorder struct {
+	mu       sync.Mutex
+	fail     int
+	attempts int
+	sent     []Notification
+}
+
+func (r *recorder) Notify(ctx context.Context, n Notification) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.attempts++
+	if r.attempts <= r.fail {
+		return errors.New("unavailable")
+	}
+	r.sent = append(r.sent, n)
+	return nil
+}
+
+func (r *recorder) notifications() []Notification {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Notification(nil), r.sent...)
+}
+
+func newTestDispatcher(t *testing.T, cfg NotifyConfig, rules []Rule, receivers map[string]*recorder) *Dispatcher {
+	t.Helper()
+	for name := range receivers {
+		cfg.Receivers = append(cfg.Receivers, ReceiverConfig{Name: name, Syslog: &SyslogConfig{}})
+	}
+	d, err := NewDispatcher(cfg, rules)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for name, r := range receivers {
+		d.receivers[name].notifier = r
+	}
+	d.RetryBackoff = time.Millisecond
+	return d
+}
+
+func testAlert(rule, mountpoint string, state State, fired time.Time) Alert {
+	a := Alert{Rule: rule, Labels: map[string]string{"mountpoint": mountpoint}, State: state, FiredAt: &fired}
+	if state == StateResolved {
+		a.ResolvedAt = &fired
+	}
+	return a
+}
+
+func TestDispatcherGrouping(t *testing.T) {
+	ops := &recorder{}
+	d := newTestDispatcher(t, NotifyConfig{
+		DefaultReceivers: []string{"ops"},
+		GroupWait:        Duration(30 * time.Second),
+		GroupInterval:    Duration(5 * time.Minute),
+		RepeatInterval:   Duration(time.Hour),
+	}, nil, map[string]*recorder{"ops": ops})
+
+	at := func(d time.Duration) time.Time { return testStart.Add(d) }
+	root := testAlert("DiskFull", "/", StateFiring, at(0))
+	data := testAlert("DiskFull", "/data", StateFiring, at(10*time.Second))
+
+	d.Update(at(0), []Alert{root})
+	d.Update(at(10*time.Second), []Alert{root, data})
+	// Group wait collects both alerts into one notification
+	d.Update(at(30*time.Second), []Alert{root, data})
+	// Nothing changed: not sent again before the repeat interval
+	d.Update(at(10*time.Minute), []Alert{root, data})
+
+	// /data resolves, sent after the group interval
+	dataResolved := testAlert("DiskFull", "/data", StateResolved, at(10*time.Second))
+	d.Update(at(11*time.Minute), []Alert{root, dataResolved})
+	d.Update(at(30*time.Second+5*time.Minute+5*time.Minute), []Alert{root, dataResolved})
+
+	// Still firing: repeated after the repeat interval
+	d.Update(at(2*time.Hour), []Alert{root})
+
+	// / resolves too
+	rootResolved := testAlert("DiskFull", "/", StateResolved, at(0))
+	d.Update(at(3*time.Hour), []Alert{rootResolved})
+	d.Close()
+
+	sent := ops.notifications()
+	want := []struct {
+		status State
+		alerts int
+	}{
+		{StateFiring, 2},
+		{StateFiring, 2},
+		{StateFiring, 1},
+		{StateResolved, 1},
+	}
+	if len(sent) != len(want) {
+		t.Fatalf("Expected %d notifications, got %d: %+v", len(want), len(sent), sent)
+	}
+	for i, w := range want {
+		if sent[i].Status != w.status || len(sent[i].Alerts) != w.alerts {
+			t.Errorf("Notification %d: expected %s with %d alerts, got %s with %d", i, w.status, w.alerts, sent[i].Status, len(sent[i].Alerts))
+		}
+	}
+	if sent[1].Alerts[0].State != StateFiring || sent[1].Alerts[1].State != StateResolved {
+		t.Errorf("Expected the second notification to carry the resolution, got %+v", sent[1].Alerts)
+	}
+	if len(d.groups) != 0 {
+		t.Errorf("Expected the group to be forgotten once resolved, got %d", len(d.groups))
+	}
+}
+
+func TestDispatcherRouting(t *testing.T) {
+	ops, dba := &recorder{}, &recorder{}
+	rules := []Rule{{Name: "DiskFull", Receivers: []string{"dba"}}, {Name: "HighCPU"}}
+	d := newTestDispatcher(t, NotifyConfig{DefaultReceivers: []string{"ops"}, GroupBy: []string{"mountpoint"}}, rules, map[string]*recorder{"ops": ops, "dba": dba})
+
+	d.Update(testStart, []Alert{
+		testAlert("DiskFull", "/", StateFiring, testStart),
+		testAlert("DiskFull", "/data", StateFiring, testStart),
+		testAlert("HighCPU", "", StateFiring, testStart),
+	})
+	d.Update(testStart.Add(time.Minute), nil)
+	d.Close()
+
+	if sent := dba.notifications(); len(sent) != 2 || sent[0].Rule != "DiskFull" {
+		t.Errorf("Expected a DiskFull notification per mountpoint to dba, got %+v", sent)
+	}
+	if sent := ops.notifications(); len(sent) != 1 || sent[0].Rule != "HighCPU" {
+		t.Errorf("Expected only HighCPU to reach the default receiver, got %+v", sent)
+	}
+
+	if _, err := NewDispatcher(NotifyConfig{}, []Rule{{Name: "A", Receivers: []string{"missing"}}}); err == nil {
+		t.Error("Expected a route to an unknown receiver to be rejected")
+	}
+}
+
+func TestDispatcherResolvedBeforeSent(t *testing.T) {
+	ops := &recorder{}
+	d := newTestDispatcher(t, NotifyConfig{DefaultReceivers: []string{"ops"}}, nil, map[string]*recorder{"ops": ops})
+
+	d.Update(testStart, []Alert{testAlert("DiskFull", "/", StateFiring, testStart)})
+	d.Update(testStart.Add(10*time.Second), []Alert{testAlert("DiskFull", "/", StateResolved, testStart)})
+	d.Update(testStart.Add(time.Minute), nil)
+	d.Close()
+
+	if sent := ops.notifications(); len(sent) != 0 {
+		t.Errorf("Expected an alert resolved within the group wait not to be sent, got %+v", sent)
+	}
+}
+
+func TestDispatcherRetry(t *testing.T) {
+	ops := &recorder{fail: 2}
+	d := newTestDispatcher(t, NotifyConfig{DefaultReceivers: []string{"ops"}}, nil, map[string]*recorder{"ops": ops})
+
+	a := testAlert("DiskFull", "/", StateFiring, testStart)
+	d.Update(testStart, []Alert{a})
+	d.Update(testStart.Add(time.Minute), []Alert{a})
+	d.Close()
+
+	if sent := ops.notifications(); len(sent) != 1 || ops.attempts != 3 {
+		t.Errorf("Expected delivery on the third attempt, got %d notifications after %d attempts", len(sent), ops.attempts)
+	}
+}
+
+func TestDispatcherSilenced(t *testing.T) {
+	ops := &recorder{}
+	d := newTestDispatcher(t, NotifyConfig{DefaultReceivers: []string{"ops"}, GroupWait: Duration(time.Minute)}, nil, map[string]*recorder{"ops": ops})
+
+	a := testAlert("DiskFull", "/", StateFiring, testStart)
+	muted := a
+	muted.SilencedBy = []string{"maintenance:reboot"}
+
+	d.Update(testStart, []Alert{muted})
+	d.Update(testStart.Add(time.Minute), []Alert{muted})
+	// Silenced after the group was created but before it was sent
+	d.Update(testStart.Add(2*time.Minute), []Alert{a})
+	d.Update(testStart.Add(2*time.Minute+30*time.Second), []Alert{muted})
+	d.Update(testStart.Add(4*time.Minute), []Alert{muted})
+	// Unmuted: notified after a fresh group wait
+	d.Update(testStart.Add(5*time.Minute), []Alert{a})
+	d.Update(testStart.Add(6*time.Minute), []Alert{a})
+	d.Close()
+
+	sent := ops.notifications()
+	if len(sent) != 1 || sent[0].Status != StateFiring {
+		t.Errorf("Expected one notification once the alert was unmuted, got %+v", sent)
+	}
+}
@@ -0,0 +1,146 @@
+package alert
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// EmailConfig configures delivery through an SMTP relay. The connection is
+// upgraded with STARTTLS when the relay offers it; credentials are only
+// sent over TLS or to localhost.
+type EmailConfig struct {
+	// Relay is the host:port of the SMTP server, usually port 25 or 587
+	Relay    string   `json:"relay"`
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+	Username string   `json:"username,omitempty"`
+	Password string   `json:"password,omitempty"`
+}
+
+// EmailNotifier sends notifications as plain-text email
+type EmailNotifier struct {
+	cfg  EmailConfig
+	auth smtp.Auth
+}
+
+// NewEmailNotifier validates cfg
+func NewEmailNotifier(cfg EmailConfig) (*EmailNotifier, error) {
+	host, _, err := net.SplitHostPort(cfg.Relay)
+	if err != nil {
+		return nil, fmt.Errorf("email relay: %w", err)
+	}
+	if cfg.From == "" || len(cfg.To) == 0 {
+		return nil, errors.New("email needs from and to addresses")
+	}
+
+	n := &EmailNotifier{cfg: cfg}
+	if cfg.Username != "" {
+		n.auth = smtp.PlainAuth("", cfg.Username, cfg.Password, host)
+	}
+	return n, nil
+}
+
+func (e *EmailNotifier) Notify(ctx context.Context, n Notification) error {
+	msg := emailMessage(e.cfg.From, e.cfg.To, n, time.Now())
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", e.cfg.Relay)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// net/smtp has no context support, so the connection's deadline bounds
+	// the exchange. Nothing is left running once Notify returns, so a retry
+	// cannot race a message still being sent.
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	host, _, _ := net.SplitHostPort(e.cfg.Relay)
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if e.auth != nil {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return errors.New("email relay does not support authentication")
+		}
+		if err := c.Auth(e.auth); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(e.cfg.From); err != nil {
+		return err
+	}
+	for _, to := range e.cfg.To {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// emailMessage formats a notification as an RFC 5322 message
+func emailMessage(from string, to []string, n Notification, now time.Time) []byte {
+	var b strings.Builder
+	b.WriteString("From: " + from + "\r\n")
+	b.WriteString("To: " + strings.Join(to, ", ") + "\r\n")
+	b.WriteString("Subject: " + n.Title() + "\r\n")
+	b.WriteString("Date: " + now.Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+
+	for _, a := range n.Alerts {
+		b.WriteString(strings.ToUpper(string(a.State)) + ": " + a.Rule + "\r\n")
+		if a.Summary != "" {
+			b.WriteString("  " + a.Summary + "\r\n")
+		}
+		b.WriteString(fmt.Sprintf("  %s = %g\r\n", a.Expr, a.Value))
+		names := make([]string, 0, len(a.Labels))
+		for name := range a.Labels {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			b.WriteString("  " + name + ": " + a.Labels[name] + "\r\n")
+		}
+		if a.FiredAt != nil {
+			b.WriteString("  Firing since " + a.FiredAt.Format(time.RFC3339) + "\r\n")
+		}
+		if a.ResolvedAt != nil {
+			b.WriteString("  Resolved at " + a.ResolvedAt.Format(time.RFC3339) + "\r\n")
+		}
+		b.WriteString("\r\n")
+	}
+	return []byte(b.String())
+}
@@ -0,0 +1,309 @@
+package alert
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/kennethfeh/system-monitor/internal/models"
+)
+
+// State is the lifecycle stage of an alert. An alert is pending while its
+// condition has held for less than the rule's for duration, firing after
+// that, and resolved once the condition clears.
+type State string
+
+const (
+	StatePending  State = "pending"
+	StateFiring   State = "firing"
+	StateResolved State = "resolved"
+)
+
+// DefaultResolvedRetention is how long resolved alerts stay listed
+const DefaultResolvedRetention = 15 * time.Minute
+
+// maxResolved bounds the resolved alerts kept for listing
+const maxResolved = 100
+
+// Alert is one series of a rule that is or was in alert
+type Alert struct {
+	Rule       string            `json:"rule"`
+	Expr       string            `json:"expr"`
+	Labels     map[string]string `json:"labels"`
+	State      State             `json:"state"`
+	Value      float64           `json:"value"`
+	Severity   string            `json:"severity,omitempty"`
+	Summary    string            `json:"summary,omitempty"`
+	ActiveAt   time.Time         `json:"active_at"`
+	FiredAt    *time.Time        `json:"fired_at,omitempty"`
+	ResolvedAt *time.Time        `json:"resolved_at,omitempty"`
+	UpdatedAt  time.Time         `json:"updated_at"`
+	// SilencedBy lists the silence IDs and maintenance windows muting the
+	// alert; muted alerts are not notified
+	SilencedBy []string `json:"silenced_by,omitempty"`
+}
+
+// Silenced reports whether a silence or maintenance window mutes the alert
+func (a Alert) Silenced() bool {
+	return len(a.SilencedBy) > 0
+}
+
+// Engine evaluates rules against each collected snapshot and tracks the
+// alerts they raise. Time is taken from the snapshots.
+type Engine struct {
+	mu       sync.Mutex
+	rules    []compiledRule
+	active   map[string]*Alert
+	resolved []Alert
+	windows  []MaintenanceWindow
+
+	// ResolvedRetention is how long resolved alerts are listed
+	ResolvedRetention time.Duration
+	// Silences, when set, mute the alerts they match
+	Silences *Silences
+}
+
+type compiledRule struct {
+	Rule
+	summary *template.Template
+}
+
+// NewEngine validates rules and returns an engine with no alerts
+func NewEngine(rules []Rule) (*Engine, error) {
+	rules = append([]Rule(nil), rules...)
+	if err := compileRules(rules); err != nil {
+		return nil, err
+	}
+
+	e := &Engine{active: make(map[string]*Alert), ResolvedRetention: DefaultResolvedRetention}
+	for _, r := range rules {
+		cr := compiledRule{Rule: r}
+		if err := checkClear(r); err != nil {
+			return nil, fmt.Errorf("rule %q: %w", r.Name, err)
+		}
+		if r.Summary != "" {
+			t, err := template.New(r.Name).Option("missingkey=zero").Parse(r.Summary)
+			if err != nil {
+				return nil, fmt.Errorf("rule %q summary: %w", r.Name, err)
+			}
+			cr.summary = t
+		}
+		e.rules = append(e.rules, cr)
+	}
+	return e, nil
+}
+
+// checkClear makes sure a clear threshold lies on the near side of the
+// threshold, so that a firing alert can resolve
+func checkClear(r Rule) error {
+	if r.Clear == nil {
+		return nil
+	}
+	clear, threshold := *r.Clear, r.expr.Threshold
+	switch r.expr.Op {
+	case OpGreater, OpGreaterEqual:
+		if clear > threshold {
+			return fmt.Errorf("clear %g must not be above the threshold %g", clear, threshold)
+		}
+	case OpLess, OpLessEqual:
+		if clear < threshold {
+			return fmt.Errorf("clear %g must not be below the threshold %g", clear, threshold)
+		}
+	default:
+		return fmt.Errorf("clear does not apply to %s", r.expr.Op)
+	}
+	return nil
+}
+
+// SetMaintenance validates the maintenance windows that mute alerts
+func (e *Engine) SetMaintenance(windows []MaintenanceWindow) error {
+	windows = append([]MaintenanceWindow(nil), windows...)
+	if err := compileMaintenance(windows); err != nil {
+		return err
+	}
+	e.mu.Lock()
+	e.windows = windows
+	e.mu.Unlock()
+	return nil
+}
+
+// Rules returns the rules being evaluated
+func (e *Engine) Rules() []Rule {
+	rules := make([]Rule, len(e.rules))
+	for i, r := range e.rules {
+		rules[i] = r.Rule
+	}
+	return rules
+}
+
+// Evaluate applies every rule to a snapshot and returns the alerts that
+// started firing or resolved
+func (e *Engine) Evaluate(m models.SystemMetrics) []Alert {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := m.Timestamp
+	samples := samplesOf(m)
+	var changed []Alert
+
+	for _, r := range e.rules {
+		seen := make(map[string]bool)
+		for _, s := range samples[r.expr.Metric] {
+			if !matchesAll(r.expr.Matchers, s.Labels) {
+				continue
+			}
+			key := r.Name + "\x00" + labelsKey(s.Labels)
+			seen[key] = true
+
+			a := e.active[key]
+			if a == nil {
+				if !r.expr.Op.Compare(s.Value, r.expr.Threshold) {
+					continue
+				}
+				a = &Alert{
+					Rule:     r.Name,
+					Expr:     r.expr.String(),
+					Labels:   mergeLabels(s.Labels, r.Labels),
+					State:    StatePending,
+					Severity: r.Severity,
+					ActiveAt: now,
+				}
+				e.active[key] = a
+			}
+			a.Value, a.UpdatedAt = s.Value, now
+			a.Summary = r.render(a)
+			a.SilencedBy = e.mutedBy(*a, now)
+
+			switch a.State {
+			case StatePending:
+				if !r.expr.Op.Compare(s.Value, r.expr.Threshold) {
+					delete(e.active, key)
+				} else if now.Sub(a.ActiveAt) >= r.expr.For {
+					a.State, a.FiredAt = StateFiring, timePtr(now)
+					changed = append(changed, *a)
+				}
+			case StateFiring:
+				clear := r.expr.Threshold
+				if r.Clear != nil {
+					clear = *r.Clear
+				}
+				if !r.expr.Op.Compare(s.Value, clear) {
+					changed = append(changed, e.resolve(key, now))
+				}
+			}
+		}
+
+		// Series that disappeared, e.g. an unmounted filesystem, no longer
+		// satisfy the rule
+		for key, a := range e.active {
+			if a.Rule != r.Name || seen[key] {
+				continue
+			}
+			if a.State == StateFiring {
+				changed = append(changed, e.resolve(key, now))
+			} else {
+				delete(e.active, key)
+			}
+		}
+	}
+
+	e.expire(now)
+	sortAlerts(changed)
+	return changed
+}
+
+// mutedBy names the silences and maintenance windows muting an alert
+func (e *Engine) mutedBy(a Alert, now time.Time) []string {
+	var by []string
+	if e.Silences != nil {
+		by = e.Silences.MutedBy(a, now)
+	}
+	for _, w := range e.windows {
+		if w.Mutes(a, now) {
+			by = append(by, "maintenance:"+w.Name)
+		}
+	}
+	return by
+}
+
+// resolve moves a firing alert to the resolved list
+func (e *Engine) resolve(key string, now time.Time) Alert {
+	a := e.active[key]
+	delete(e.active, key)
+	a.State, a.ResolvedAt, a.UpdatedAt = StateResolved, timePtr(now), now
+	e.resolved = append(e.resolved, *a)
+	return *a
+}
+
+// expire drops resolved alerts past their retention
+func (e *Engine) expire(now time.Time) {
+	cutoff := now.Add(-e.ResolvedRetention)
+	i := 0
+	for i < len(e.resolved) && (e.resolved[i].ResolvedAt.Before(cutoff) || len(e.resolved)-i > maxResolved) {
+		i++
+	}
+	e.resolved = e.resolved[i:]
+}
+
+// Alerts returns the pending and firing alerts followed by the recently
+// resolved ones, each group ordered by rule and labels
+func (e *Engine) Alerts() []Alert {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	alerts := make([]Alert, 0, len(e.active)+len(e.resolved))
+	for _, a := range e.active {
+		alerts = append(alerts, *a)
+	}
+	sortAlerts(alerts)
+
+	resolved := append([]Alert(nil), e.resolved...)
+	sortAlerts(resolved)
+	return append(alerts, resolved...)
+}
+
+func (r compiledRule) render(a *Alert) string {
+	if r.summary == nil {
+		return ""
+	}
+	var b strings.Builder
+	if err := r.summary.Execute(&b, a); err != nil {
+		return r.Rule.Summary
+	}
+	return b.String()
+}
+
+func matchesAll(matchers []Matcher, labels map[string]string) bool {
+	for _, m := range matchers {
+		if !m.Matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// mergeLabels combines a sample's labels with a rule's, the rule's taking
+// precedence
+func mergeLabels(sample, rule map[string]string) map[string]string {
+	labels := copyLabels(sample)
+	for k, v := range rule {
+		labels[k] = v
+	}
+	return labels
+}
+
+func sortAlerts(alerts []Alert) {
+	sort.SliceStable(alerts, func(i, j int) bool {
+		if alerts[i].Rule != alerts[j].Rule {
+			return alerts[i].Rule < alerts[j].Rule
+		}
+		return labelsKey(alerts[i].Labels) < labelsKey(alerts[j].Labels)
+	})
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
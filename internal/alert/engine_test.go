@@ -0,0 +1,228 @@
+package alert
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kennethfeh/system-monitor/internal/models"
+)
+
+var testStart = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func diskSnapshot(minute int, used float64) models.SystemMetrics {
+	return models.SystemMetrics{
+		Timestamp: testStart.Add(time.Duration(minute) * time.Minute),
+		Disk: []models.DiskMetrics{
+			{Device: "/dev/sda1", Mountpoint: "/", UsedPercent: used},
+			{Device: "/dev/sdb1", Mountpoint: "/data", UsedPercent: 99},
+		},
+	}
+}
+
+func TestSamplesOf(t *testing.T) {
+	m := diskSnapshot(0, 50)
+	m.CPU = models.CPUMetrics{UsagePercent: []float64{10, 20}, Cores: 2, Unavailable: true}
+	m.SectionTimestamps = map[string]time.Time{"cpu": testStart, "disk": testStart}
+	samples := samplesOf(m)
+
+	if disks := samples["disk.used_percent"]; len(disks) != 2 || len(disks[0].Labels) != 1 || disks[0].Labels["mountpoint"] != "/" {
+		t.Errorf("Expected a sample per filesystem labelled by its mountpoint, got %v", disks)
+	}
+	if _, ok := samples["cpu.usage_percent"]; ok {
+		t.Error("Expected no CPU utilisation while unavailable")
+	}
+	if cores := samples["cpu.cores"]; len(cores) != 1 || cores[0].Value != 2 {
+		t.Errorf("Expected cpu.cores, got %v", cores)
+	}
+	if _, ok := samples["memory.used_percent"]; ok {
+		t.Error("Expected no memory samples without a memory section")
+	}
+
+	m.CPU.Unavailable = false
+	if usage := samplesOf(m)["cpu.usage_percent"]; len(usage) != 2 || usage[1].Labels["index"] != "1" || usage[1].Value != 20 {
+		t.Errorf("Expected per-core samples labelled by index, got %v", usage)
+	}
+}
+
+func TestEngineLifecycle(t *testing.T) {
+	clear := 85.0
+	e, err := NewEngine([]Rule{{
+		Name:     "DiskFull",
+		Expr:     `disk.used_percent{mountpoint="/"} > 90 for 5m`,
+		Clear:    &clear,
+		Severity: "critical",
+		Summary:  "{{ .Labels.mountpoint }} is {{ .Value }}% full",
+	}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	steps := []struct {
+		minute  int
+		used    float64
+		state   State // "" when there is no active alert
+		changed bool
+	}{
+		{0, 80, "", false},
+		{1, 95, StatePending, false},
+		{3, 92, StatePending, false},
+		{6, 93, StateFiring, true},
+		// Below the threshold but above clear: still firing
+		{7, 88, StateFiring, false},
+		{8, 84, "", true},
+		// A pending alert that clears never fires
+		{9, 95, StatePending, false},
+		{10, 50, "", false},
+	}
+	for _, step := range steps {
+		changed := e.Evaluate(diskSnapshot(step.minute, step.used))
+		if (len(changed) > 0) != step.changed {
+			t.Errorf("Minute %d: expected changed=%v, got %v", step.minute, step.changed, changed)
+		}
+
+		var state State
+		for _, a := range e.Alerts() {
+			if a.State != StateResolved {
+				state = a.State
+			}
+		}
+		if state != step.state {
+			t.Errorf("Minute %d: expected state %q, got %q", step.minute, step.state, state)
+		}
+	}
+
+	alerts := e.Alerts()
+	if len(alerts) != 1 || alerts[0].State != StateResolved {
+		t.Fatalf("Expected the resolved alert to be listed, got %v", alerts)
+	}
+	a := alerts[0]
+	if !a.ActiveAt.Equal(testStart.Add(time.Minute)) || !a.FiredAt.Equal(testStart.Add(6*time.Minute)) || !a.ResolvedAt.Equal(testStart.Add(8*time.Minute)) {
+		t.Errorf("Unexpected times: active %v, fired %v, resolved %v", a.ActiveAt, a.FiredAt, a.ResolvedAt)
+	}
+	if a.Summary != "/ is 84% full" || a.Severity != "critical" {
+		t.Errorf("Unexpected summary %q or severity %q", a.Summary, a.Severity)
+	}
+
+	// Resolved alerts are listed for a while only
+	e.Evaluate(diskSnapshot(30, 50))
+	if alerts := e.Alerts(); len(alerts) != 0 {
+		t.Errorf("Expected the resolved alert to expire, got %v", alerts)
+	}
+}
+
+func TestEngineProcessStateChange(t *testing.T) {
+	e, err := NewEngine([]Rule{{Name: "BusyProcess", Expr: "processes.cpu_percent > 90 for 2m"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	snapshot := func(minute int, state string) models.SystemMetrics {
+		return models.SystemMetrics{
+			Timestamp: testStart.Add(time.Duration(minute) * time.Minute),
+			Processes: []models.ProcessMetrics{
+				{PID: 42, Name: "worker", State: state, Cmdline: "worker --busy", CPUPercent: 95},
+				{PID: 43, Name: "worker", State: "S", Cmdline: "worker", CPUPercent: 1},
+			},
+		}
+	}
+
+	e.Evaluate(snapshot(0, "R"))
+	// A process flipping state is still the same series
+	e.Evaluate(snapshot(1, "S"))
+	changed := e.Evaluate(snapshot(2, "R"))
+	if len(changed) != 1 || changed[0].State != StateFiring || len(changed[0].Labels) != 1 || changed[0].Labels["pid"] != "42" {
+		t.Fatalf("Expected pid 42 to fire after 2m, got %v", changed)
+	}
+	if alerts := e.Alerts(); len(alerts) != 1 {
+		t.Errorf("Expected one alert, got %v", alerts)
+	}
+}
+
+func TestEngineSeriesDisappears(t *testing.T) {
+	e, err := NewEngine([]Rule{{Name: "DiskFull", Expr: "disk.used_percent > 90", Labels: map[string]string{"team": "ops"}}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	changed := e.Evaluate(diskSnapshot(0, 50))
+	if len(changed) != 1 || changed[0].State != StateFiring || changed[0].Labels["mountpoint"] != "/data" || changed[0].Labels["team"] != "ops" {
+		t.Fatalf("Expected /data to fire at once, got %v", changed)
+	}
+
+	m := diskSnapshot(1, 50)
+	m.Disk = m.Disk[:1]
+	changed = e.Evaluate(m)
+	if len(changed) != 1 || changed[0].State != StateResolved {
+		t.Errorf("Expected the alert of an unmounted filesystem to resolve, got %v", changed)
+	}
+}
+
+func TestEngineInvalidClear(t *testing.T) {
+	clear := 95.0
+	if _, err := NewEngine([]Rule{{Name: "A", Expr: "cpu.total_percent > 90", Clear: &clear}}); err == nil {
+		t.Error("Expected a clear threshold beyond the threshold to be rejected")
+	}
+	if _, err := NewEngine([]Rule{{Name: "A", Expr: "cpu.total_percent == 90", Clear: &clear}}); err == nil {
+		t.Error("Expected clear to be rejected for ==")
+	}
+}
+
+func TestEngineSilences(t *testing.T) {
+	e, err := NewEngine([]Rule{{Name: "DiskFull", Expr: "disk.used_percent > 90"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	e.Silences, _ = OpenSilences("")
+	silence, err := e.Silences.Add(Silence{Matchers: `mountpoint="/data"`, EndsAt: testStart.Add(10 * time.Minute), CreatedBy: "ops"}, testStart)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// Monday 00:30 for an hour, covering minutes 30 to 89
+	if err := e.SetMaintenance([]MaintenanceWindow{{Name: "reboot", Start: "00:30", Duration: Duration(time.Hour), Timezone: "UTC"}}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	changed := e.Evaluate(diskSnapshot(0, 95))
+	if len(changed) != 2 {
+		t.Fatalf("Expected both filesystems to fire, got %v", changed)
+	}
+	if changed[0].Silenced() || len(changed[1].SilencedBy) != 1 || changed[1].SilencedBy[0] != silence.ID {
+		t.Errorf("Expected only /data to be silenced, got %v and %v", changed[0].SilencedBy, changed[1].SilencedBy)
+	}
+
+	e.Evaluate(diskSnapshot(20, 95))
+	for _, a := range e.Alerts() {
+		if a.Silenced() {
+			t.Errorf("Expected no alert silenced once the silence ended, got %v", a)
+		}
+	}
+
+	e.Evaluate(diskSnapshot(45, 95))
+	for _, a := range e.Alerts() {
+		if len(a.SilencedBy) != 1 || a.SilencedBy[0] != "maintenance:reboot" {
+			t.Errorf("Expected the maintenance window to mute every alert, got %v", a.SilencedBy)
+		}
+	}
+}
+
+func TestEngineDiskForecast(t *testing.T) {
+	e, err := NewEngine([]Rule{{Name: "DiskFillingUp", Expr: `disk_forecast.hours_to_full{mountpoint="/"} < 24`}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	hours := 10.0
+	m := diskSnapshot(0, 50)
+	m.DiskForecast = []models.DiskForecast{{Mountpoint: "/", Confidence: 0.9, HoursToFull: &hours}, {Mountpoint: "/data", Confidence: 1}}
+	changed := e.Evaluate(m)
+	if len(changed) != 1 || changed[0].Labels["mountpoint"] != "/" || changed[0].Value != 10 {
+		t.Fatalf("Expected / to be predicted full within 24h, got %v", changed)
+	}
+
+	// The trend flattened, so there is no longer a time until full
+	m = diskSnapshot(1, 50)
+	m.DiskForecast = []models.DiskForecast{{Mountpoint: "/", Confidence: 1}}
+	if changed := e.Evaluate(m); len(changed) != 1 || changed[0].State != StateResolved {
+		t.Errorf("Expected the prediction to resolve, got %v", changed)
+	}
+}
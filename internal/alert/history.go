@@ -0,0 +1,194 @@
+package alert
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultHistoryLimit is how many history entries are kept
+const DefaultHistoryLimit = 1000
+
+// History events besides the alert states
+const (
+	EventSilenceCreated = "silence_created"
+	EventSilenceExpired = "silence_expired"
+)
+
+// HistoryEntry records an alert firing or resolving, or a silence being
+// created or expired. Event is the alert's state or one of the silence
+// events.
+type HistoryEntry struct {
+	Time    time.Time `json:"time"`
+	Event   string    `json:"event"`
+	Alert   *Alert    `json:"alert,omitempty"`
+	Silence *Silence  `json:"silence,omitempty"`
+}
+
+// History keeps the most recent entries, appended as JSON lines to a file
+// when opened with a path
+type History struct {
+	mu        sync.Mutex
+	path      string
+	file      *os.File
+	limit     int
+	entries   []HistoryEntry
+	fileLines int
+}
+
+// OpenHistory loads the entries saved at path, which may not exist yet,
+// and keeps at most limit of them. With an empty path the history is kept
+// in memory only.
+func OpenHistory(path string, limit int) (*History, error) {
+	if limit <= 0 {
+		limit = DefaultHistoryLimit
+	}
+	h := &History{path: path, limit: limit}
+	if path == "" {
+		return h, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			var e HistoryEntry
+			if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+				// A line cut short by a crash
+				continue
+			}
+			h.entries = append(h.entries, e)
+			h.fileLines++
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if len(h.entries) > limit {
+			h.entries = h.entries[len(h.entries)-limit:]
+		}
+	}
+
+	if err := h.open(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (h *History) open() error {
+	f, err := os.OpenFile(h.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	h.file = f
+	return nil
+}
+
+// RecordAlert adds an entry for an alert that changed state
+func (h *History) RecordAlert(a Alert) error {
+	return h.add(HistoryEntry{Time: a.UpdatedAt, Event: string(a.State), Alert: &a})
+}
+
+// RecordSilence adds a silence event
+func (h *History) RecordSilence(event string, s Silence, t time.Time) error {
+	return h.add(HistoryEntry{Time: t, Event: event, Silence: &s})
+}
+
+func (h *History) add(e HistoryEntry) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.entries = append(h.entries, e)
+	if len(h.entries) > h.limit {
+		h.entries = h.entries[len(h.entries)-h.limit:]
+	}
+	if h.file == nil {
+		return nil
+	}
+
+	// Rewrite the file once it holds twice the entries kept, rather than
+	// letting it grow forever
+	if h.fileLines >= 2*h.limit {
+		return h.compact()
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if _, err := h.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	h.fileLines++
+	return nil
+}
+
+// compact replaces the file with the entries kept
+func (h *History) compact() error {
+	tmp := h.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, e := range h.entries {
+		if err = enc.Encode(e); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, h.path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	h.file.Close()
+	h.fileLines = len(h.entries)
+	return h.open()
+}
+
+// Entries returns the entries at or after since, oldest first. With a
+// rule, only that rule's alert events are returned.
+func (h *History) Entries(since time.Time, rule string) []HistoryEntry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	entries := []HistoryEntry{}
+	for _, e := range h.entries {
+		if e.Time.Before(since) {
+			continue
+		}
+		if rule != "" && (e.Alert == nil || e.Alert.Rule != rule) {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// Close closes the history file
+func (h *History) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.file == nil {
+		return nil
+	}
+	err := h.file.Close()
+	h.file = nil
+	return err
+}
@@ -0,0 +1,63 @@
+package alert
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	history, err := OpenHistory(path, 3)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for i := 0; i < 7; i++ {
+		at := testStart.Add(time.Duration(i) * time.Minute)
+		rule := "DiskFull"
+		if i%2 == 1 {
+			rule = "HighCPU"
+		}
+		if err := history.RecordAlert(Alert{Rule: rule, State: StateFiring, UpdatedAt: at}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	silence := Silence{ID: "abc", Matchers: `rule="HighCPU"`, CreatedBy: "alice"}
+	if err := history.RecordSilence(EventSilenceCreated, silence, testStart.Add(10*time.Minute)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := history.Close(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The file was compacted instead of holding every entry
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines > 6 {
+		t.Errorf("Expected the file to be compacted, got %d lines", lines)
+	}
+
+	history, err = OpenHistory(path, 3)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer history.Close()
+	entries := history.Entries(time.Time{}, "")
+	if len(entries) != 3 || entries[2].Event != EventSilenceCreated || entries[2].Silence.CreatedBy != "alice" {
+		t.Fatalf("Expected the last 3 entries after reopening, got %+v", entries)
+	}
+	if entries[0].Event != string(StateFiring) || !entries[0].Time.Equal(testStart.Add(5*time.Minute)) {
+		t.Errorf("Unexpected first entry %+v", entries[0])
+	}
+	if got := history.Entries(testStart.Add(6*time.Minute), ""); len(got) != 2 {
+		t.Errorf("Expected 2 entries since minute 6, got %d", len(got))
+	}
+	if got := history.Entries(time.Time{}, "DiskFull"); len(got) != 1 || got[0].Alert.Rule != "DiskFull" {
+		t.Errorf("Expected only the DiskFull alert entries, got %+v", got)
+	}
+}
@@ -0,0 +1,126 @@
+package alert
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// maxMaintenanceDuration bounds a maintenance window to the week it recurs in
+const maxMaintenanceDuration = 7 * 24 * time.Hour
+
+// MaintenanceWindow is a recurring period, configured in the rules file,
+// during which the alerts it selects are muted, e.g. every Sunday from
+// 02:00 for two hours:
+//
+//	{"name": "patching", "days": ["sun"], "start": "02:00", "duration": "2h"}
+//
+// Without matchers every alert is muted; without days the window recurs
+// daily.
+type MaintenanceWindow struct {
+	Name     string   `json:"name"`
+	Matchers string   `json:"matchers,omitempty"`
+	Days     []string `json:"days,omitempty"`
+	Start    string   `json:"start"`
+	Duration Duration `json:"duration"`
+	// Timezone is the IANA zone Start is in; defaults to local time
+	Timezone string `json:"timezone,omitempty"`
+
+	matchers []Matcher
+	days     map[time.Weekday]bool
+	start    time.Time
+	location *time.Location
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// parseWeekday parses a day by its English name or its first three letters,
+// in any case
+func parseWeekday(day string) (time.Weekday, bool) {
+	day = strings.ToLower(day)
+	if d, ok := weekdays[day]; ok {
+		return d, true
+	}
+	for _, d := range weekdays {
+		if day == strings.ToLower(d.String()) {
+			return d, true
+		}
+	}
+	return 0, false
+}
+
+// compileMaintenance validates maintenance windows and parses their fields
+func compileMaintenance(windows []MaintenanceWindow) error {
+	seen := make(map[string]bool)
+	for i := range windows {
+		w := &windows[i]
+		if w.Name == "" {
+			return fmt.Errorf("maintenance window %d has no name", i+1)
+		}
+		if seen[w.Name] {
+			return fmt.Errorf("duplicate maintenance window %q", w.Name)
+		}
+		seen[w.Name] = true
+		if err := w.compile(); err != nil {
+			return fmt.Errorf("maintenance window %q: %w", w.Name, err)
+		}
+	}
+	return nil
+}
+
+func (w *MaintenanceWindow) compile() error {
+	var err error
+	if w.matchers, err = ParseSelector(w.Matchers); err != nil {
+		return err
+	}
+
+	w.days = make(map[time.Weekday]bool)
+	for _, day := range w.Days {
+		d, ok := parseWeekday(day)
+		if !ok {
+			return fmt.Errorf("unknown day %q", day)
+		}
+		w.days[d] = true
+	}
+
+	if w.start, err = time.Parse("15:04", w.Start); err != nil {
+		return fmt.Errorf("start %q is not HH:MM", w.Start)
+	}
+
+	if w.Duration <= 0 || time.Duration(w.Duration) > maxMaintenanceDuration {
+		return errors.New("duration must be positive and at most a week")
+	}
+
+	w.location = time.Local
+	if w.Timezone != "" {
+		if w.location, err = time.LoadLocation(w.Timezone); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Active reports whether t falls in an occurrence of the window
+func (w MaintenanceWindow) Active(t time.Time) bool {
+	t = t.In(w.location)
+	// An occurrence that started up to a week ago may still be running
+	for back := 0; back <= 7; back++ {
+		start := time.Date(t.Year(), t.Month(), t.Day()-back, w.start.Hour(), w.start.Minute(), 0, 0, w.location)
+		if len(w.days) > 0 && !w.days[start.Weekday()] {
+			continue
+		}
+		if !t.Before(start) && t.Before(start.Add(time.Duration(w.Duration))) {
+			return true
+		}
+	}
+	return false
+}
+
+// Mutes reports whether the window is active at t and selects the alert
+func (w MaintenanceWindow) Mutes(a Alert, t time.Time) bool {
+	return w.Active(t) && matchesAlert(w.matchers, a)
+}
@@ -0,0 +1,72 @@
+package alert
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMaintenanceWindow(t *testing.T) {
+	windows := []MaintenanceWindow{
+		// Sunday 23:00 into Monday 02:00; testStart is a Monday
+		{Name: "patching", Matchers: `mountpoint="/"`, Days: []string{"Sunday"}, Start: "23:00", Duration: Duration(3 * time.Hour), Timezone: "UTC"},
+		{Name: "backup", Start: "04:30", Duration: Duration(30 * time.Minute), Timezone: "UTC"},
+	}
+	if err := compileMaintenance(windows); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	patching, backup := windows[0], windows[1]
+
+	tests := []struct {
+		window MaintenanceWindow
+		at     time.Duration
+		active bool
+	}{
+		{patching, -61 * time.Minute, false},
+		{patching, -time.Hour, true},
+		{patching, 90 * time.Minute, true},
+		{patching, 2 * time.Hour, false},
+		{patching, 6*24*time.Hour - time.Minute, false},
+		{patching, 6*24*time.Hour + 23*time.Hour, true},
+		{backup, 4*time.Hour + 30*time.Minute, true},
+		{backup, 3*24*time.Hour + 4*time.Hour + 59*time.Minute, true},
+		{backup, 5 * time.Hour, false},
+	}
+	for _, tt := range tests {
+		if got := tt.window.Active(testStart.Add(tt.at)); got != tt.active {
+			t.Errorf("%s at %s: expected active %v, got %v", tt.window.Name, testStart.Add(tt.at), tt.active, got)
+		}
+	}
+
+	root := Alert{Rule: "DiskFull", Labels: map[string]string{"mountpoint": "/"}}
+	data := Alert{Rule: "DiskFull", Labels: map[string]string{"mountpoint": "/data"}}
+	if !patching.Mutes(root, testStart) || patching.Mutes(data, testStart) {
+		t.Error("Expected the window to mute only the alerts it selects")
+	}
+	if !backup.Mutes(data, testStart.Add(4*time.Hour+45*time.Minute)) {
+		t.Error("Expected a window without matchers to mute every alert")
+	}
+
+	for _, bad := range []MaintenanceWindow{
+		{Start: "02:00", Duration: Duration(time.Hour)},
+		{Name: "a", Days: []string{"someday"}, Start: "02:00", Duration: Duration(time.Hour)},
+		{Name: "a", Days: []string{"sunflower"}, Start: "02:00", Duration: Duration(time.Hour)},
+		{Name: "a", Days: []string{"ẞ"}, Start: "02:00", Duration: Duration(time.Hour)},
+		{Name: "a", Start: "2am", Duration: Duration(time.Hour)},
+		{Name: "a", Start: "02:00"},
+		{Name: "a", Start: "02:00", Duration: Duration(8 * 24 * time.Hour)},
+		{Name: "a", Start: "02:00", Duration: Duration(time.Hour), Timezone: "Nowhere/Special"},
+		{Name: "a", Matchers: `rule=`, Start: "02:00", Duration: Duration(time.Hour)},
+	} {
+		if err := compileMaintenance([]MaintenanceWindow{bad}); err == nil {
+			t.Errorf("Expected %+v to be rejected", bad)
+		}
+	}
+
+	days := []MaintenanceWindow{{Name: "a", Days: []string{"mon", "TUESDAY", "Wed"}, Start: "02:00", Duration: Duration(time.Hour)}}
+	if err := compileMaintenance(days); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if d := days[0].days; len(d) != 3 || !d[time.Monday] || !d[time.Tuesday] || !d[time.Wednesday] {
+		t.Errorf("Expected Monday to Wednesday, got %v", d)
+	}
+}
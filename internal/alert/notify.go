@@ -0,0 +1,169 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Notification is what a receiver is sent about a group of alerts. Status
+// is firing while any alert of the group fires and resolved otherwise.
+type Notification struct {
+	Receiver string            `json:"receiver"`
+	Status   State             `json:"status"`
+	GroupKey string            `json:"group_key"`
+	Rule     string            `json:"rule"`
+	Labels   map[string]string `json:"group_labels,omitempty"`
+	Alerts   []Alert           `json:"alerts"`
+}
+
+// Firing returns the alerts of the notification that are firing
+func (n Notification) Firing() []Alert {
+	var firing []Alert
+	for _, a := range n.Alerts {
+		if a.State == StateFiring {
+			firing = append(firing, a)
+		}
+	}
+	return firing
+}
+
+// Title summarises a notification in one line, e.g. "[FIRING:2] DiskFull"
+func (n Notification) Title() string {
+	if n.Status == StateFiring {
+		return fmt.Sprintf("[FIRING:%d] %s", len(n.Firing()), n.Rule)
+	}
+	return fmt.Sprintf("[RESOLVED] %s", n.Rule)
+}
+
+// Notifier delivers notifications to one destination
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// Duration is a time.Duration written as a Go duration string in JSON
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Notification defaults
+const (
+	DefaultGroupWait      = 30 * time.Second
+	DefaultGroupInterval  = 5 * time.Minute
+	DefaultRepeatInterval = 4 * time.Hour
+	DefaultNotifyRetries  = 3
+)
+
+// NotifyConfig is the notification section of the rules file. Alerts are
+// routed to the receivers their rule names, or to DefaultReceivers, and
+// grouped per receiver by rule and the GroupBy labels.
+type NotifyConfig struct {
+	Receivers        []ReceiverConfig `json:"receivers"`
+	DefaultReceivers []string         `json:"default_receivers,omitempty"`
+	GroupBy          []string         `json:"group_by,omitempty"`
+	// GroupWait delays the first notification of a group so alerts
+	// raised together are sent together
+	GroupWait Duration `json:"group_wait,omitempty"`
+	// GroupInterval is the least time between notifications of a group
+	// whose alerts changed
+	GroupInterval Duration `json:"group_interval,omitempty"`
+	// RepeatInterval is how often a group that is still firing is sent
+	// again
+	RepeatInterval Duration `json:"repeat_interval,omitempty"`
+	// Retries is how many times a failed delivery is retried
+	Retries *int `json:"retries,omitempty"`
+}
+
+// ReceiverConfig names a destination and configures exactly one of its
+// channels
+type ReceiverConfig struct {
+	Name    string         `json:"name"`
+	Webhook *WebhookConfig `json:"webhook,omitempty"`
+	Email   *EmailConfig   `json:"email,omitempty"`
+	Syslog  *SyslogConfig  `json:"syslog,omitempty"`
+	// SendResolved also notifies when alerts resolve; defaults to true
+	SendResolved *bool `json:"send_resolved,omitempty"`
+}
+
+// SyslogConfig configures syslog delivery. Without a network the local
+// syslog daemon is used.
+type SyslogConfig struct {
+	Network string `json:"network,omitempty"`
+	Address string `json:"address,omitempty"`
+	Tag     string `json:"tag,omitempty"`
+}
+
+// syslogLine formats an alert as one log line
+func syslogLine(a Alert) string {
+	var b strings.Builder
+	b.WriteString(strings.ToUpper(string(a.State)) + " " + a.Rule)
+	if a.Summary != "" {
+		b.WriteString(": " + a.Summary)
+	}
+	b.WriteString(" (value=" + strconv.FormatFloat(a.Value, 'g', -1, 64))
+	names := make([]string, 0, len(a.Labels))
+	for name := range a.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		b.WriteString(" " + name + "=" + strconv.Quote(a.Labels[name]))
+	}
+	b.WriteString(")")
+	return b.String()
+}
+
+// newNotifier creates the notifier a receiver configures
+func newNotifier(cfg ReceiverConfig) (Notifier, error) {
+	var notifiers []Notifier
+	if cfg.Webhook != nil {
+		n, err := NewWebhookNotifier(*cfg.Webhook)
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, n)
+	}
+	if cfg.Email != nil {
+		n, err := NewEmailNotifier(*cfg.Email)
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, n)
+	}
+	if cfg.Syslog != nil {
+		n, err := NewSyslogNotifier(*cfg.Syslog)
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, n)
+	}
+
+	switch len(notifiers) {
+	case 0:
+		return nil, errors.New("no webhook, email or syslog configured")
+	case 1:
+		return notifiers[0], nil
+	default:
+		return nil, errors.New("configures more than one of webhook, email and syslog")
+	}
+}
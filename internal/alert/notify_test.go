@@ -0,0 +1,244 @@
+package alert
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testNotification() Notification {
+	fired := testStart.Add(5 * time.Minute)
+	return Notification{
+		Receiver: "ops",
+		Status:   StateFiring,
+		GroupKey: `DiskFull{mountpoint="/"}`,
+		Rule:     "DiskFull",
+		Alerts: []Alert{{
+			Rule:     "DiskFull",
+			Expr:     "disk.used_percent > 90",
+			Labels:   map[string]string{"mountpoint": "/", "device": "/dev/sda1"},
+			State:    StateFiring,
+			Value:    95,
+			Severity: "critical",
+			Summary:  "/ is 95% full",
+			FiredAt:  &fired,
+		}},
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var mu sync.Mutex
+	var body []byte
+	var signature string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		body, _ = io.ReadAll(r.Body)
+		signature = r.Header.Get(SignatureHeader)
+	}))
+	defer server.Close()
+
+	n, err := NewWebhookNotifier(WebhookConfig{URL: server.URL, Secret: "s3cret"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := n.Notify(context.Background(), testNotification()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if signature != Sign("s3cret", body) || !strings.HasPrefix(signature, "sha256=") {
+		t.Errorf("Expected the body's HMAC, got %q", signature)
+	}
+	var got Notification
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatalf("Invalid JSON body: %v", err)
+	}
+	if got.Status != StateFiring || len(got.Alerts) != 1 || got.Alerts[0].Labels["mountpoint"] != "/" {
+		t.Errorf("Unexpected notification %+v", got)
+	}
+
+	if _, err := NewWebhookNotifier(WebhookConfig{URL: "ftp://example.com"}); err == nil {
+		t.Error("Expected a non-HTTP URL to be rejected")
+	}
+}
+
+// smtpServer is a stand-in SMTP relay that records the messages it gets
+type smtpServer struct {
+	ln       net.Listener
+	mu       sync.Mutex
+	messages []string
+	rcpts    []string
+}
+
+func newSMTPServer(t *testing.T) *smtpServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	s := &smtpServer{ln: ln}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *smtpServer) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+
+	reply("220 localhost ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			s.mu.Lock()
+			s.rcpts = append(s.rcpts, strings.TrimSpace(line[len("RCPT TO:"):]))
+			s.mu.Unlock()
+			reply("250 OK")
+		case cmd == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var msg strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				msg.WriteString(line)
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, msg.String())
+			s.mu.Unlock()
+			reply("250 OK")
+		case cmd == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func TestEmailNotifier(t *testing.T) {
+	s := newSMTPServer(t)
+	n, err := NewEmailNotifier(EmailConfig{Relay: s.ln.Addr().String(), From: "monitor@example.com", To: []string{"ops@example.com", "dev@example.com"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := n.Notify(context.Background(), testNotification()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.messages) != 1 || len(s.rcpts) != 2 {
+		t.Fatalf("Expected 1 message to 2 recipients, got %d to %v", len(s.messages), s.rcpts)
+	}
+	msg := s.messages[0]
+	for _, want := range []string{"Subject: [FIRING:1] DiskFull\r\n", "To: ops@example.com, dev@example.com\r\n", "/ is 95% full", "mountpoint: /"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("Expected %q in message:\n%s", want, msg)
+		}
+	}
+
+	if _, err := NewEmailNotifier(EmailConfig{Relay: "localhost:25", From: "monitor@example.com"}); err == nil {
+		t.Error("Expected an email receiver without recipients to be rejected")
+	}
+}
+
+func TestEmailNotifierTimeout(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer ln.Close()
+	// A relay that accepts the connection and never greets
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		if conn, err := ln.Accept(); err == nil {
+			accepted <- conn
+		}
+	}()
+
+	n, err := NewEmailNotifier(EmailConfig{Relay: ln.Addr().String(), From: "monitor@example.com", To: []string{"ops@example.com"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := n.Notify(ctx, testNotification()); err == nil {
+		t.Fatal("Expected the stalled relay to time out")
+	}
+
+	// The attempt is over once Notify returns, so a retry cannot duplicate it
+	conn := <-accepted
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("Expected the connection to be closed, got %v", err)
+	}
+}
+
+func TestSyslogNotifier(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer conn.Close()
+
+	n, err := NewSyslogNotifier(SyslogConfig{Network: "udp", Address: conn.LocalAddr().String()})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// Both alerts go in one message, at the priority of the critical one
+	notification := testNotification()
+	notification.Alerts = append(notification.Alerts, Alert{Rule: "DiskFull", State: StateFiring, Value: 91, Severity: "warning", Summary: "/home is 91% full"})
+	if err := n.Notify(context.Background(), notification); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	buf := make([]byte, 2048)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	size, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	line := string(buf[:size])
+	// daemon.crit is facility 3, severity 2
+	if !strings.HasPrefix(line, "<26>") || !strings.Contains(line, "system-monitor") || !strings.Contains(line, `FIRING DiskFull: / is 95% full (value=95 device="/dev/sda1" mountpoint="/")`) {
+		t.Errorf("Unexpected syslog message %q", line)
+	}
+	if !strings.Contains(line, "; FIRING DiskFull: /home is 91% full (value=91)") {
+		t.Errorf("Expected the second alert in the same message, got %q", line)
+	}
+	conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, _, err := conn.ReadFrom(buf); err == nil {
+		t.Error("Expected a single syslog message")
+	}
+}
@@ -0,0 +1,364 @@
+package alert
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Rule is an alerting rule as written in the rules file. Expr compares a
+// metric with a threshold and may require it to hold for a while, e.g.
+//
+//	disk.used_percent{mountpoint="/"} > 90 for 5m
+//
+// A firing alert resolves once the comparison no longer holds against
+// Clear, when set, rather than the threshold, so a value hovering around
+// the threshold does not flap.
+type Rule struct {
+	Name     string            `json:"name"`
+	Expr     string            `json:"expr"`
+	Clear    *float64          `json:"clear,omitempty"`
+	Severity string            `json:"severity,omitempty"`
+	Summary  string            `json:"summary,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	// Receivers route the rule's alerts, overriding the default receivers
+	Receivers []string `json:"receivers,omitempty"`
+
+	expr *Expr
+}
+
+// RuleFile is the format of the rules file
+type RuleFile struct {
+	Rules       []Rule              `json:"rules"`
+	Notify      *NotifyConfig       `json:"notify,omitempty"`
+	Maintenance []MaintenanceWindow `json:"maintenance,omitempty"`
+}
+
+// LoadFile reads a rules file and validates its rules
+func LoadFile(path string) (*RuleFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file RuleFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := compileRules(file.Rules); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := compileMaintenance(file.Maintenance); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &file, nil
+}
+
+// LoadRules reads and validates the rules in a JSON file
+func LoadRules(path string) ([]Rule, error) {
+	file, err := LoadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return file.Rules, nil
+}
+
+// compileRules parses the expression of each rule
+func compileRules(rules []Rule) error {
+	seen := make(map[string]bool)
+	for i := range rules {
+		r := &rules[i]
+		if r.Name == "" {
+			return fmt.Errorf("rule %d has no name", i+1)
+		}
+		if seen[r.Name] {
+			return fmt.Errorf("duplicate rule %q", r.Name)
+		}
+		seen[r.Name] = true
+
+		expr, err := ParseExpr(r.Expr)
+		if err != nil {
+			return fmt.Errorf("rule %q: %w", r.Name, err)
+		}
+		r.expr = expr
+	}
+	return nil
+}
+
+// Operator compares a value with a threshold
+type Operator string
+
+const (
+	OpGreater      Operator = ">"
+	OpGreaterEqual Operator = ">="
+	OpLess         Operator = "<"
+	OpLessEqual    Operator = "<="
+	OpEqual        Operator = "=="
+	OpNotEqual     Operator = "!="
+)
+
+// Compare reports whether value op threshold holds
+func (op Operator) Compare(value, threshold float64) bool {
+	switch op {
+	case OpGreater:
+		return value > threshold
+	case OpGreaterEqual:
+		return value >= threshold
+	case OpLess:
+		return value < threshold
+	case OpLessEqual:
+		return value <= threshold
+	case OpEqual:
+		return value == threshold
+	case OpNotEqual:
+		return value != threshold
+	}
+	return false
+}
+
+// Matcher selects samples by one label
+type Matcher struct {
+	Name  string
+	Op    string
+	Value string
+	re    *regexp.Regexp
+}
+
+// Matches reports whether a label set satisfies the matcher. A missing
+// label matches as the empty string.
+func (m Matcher) Matches(labels map[string]string) bool {
+	v := labels[m.Name]
+	switch m.Op {
+	case "=":
+		return v == m.Value
+	case "!=":
+		return v != m.Value
+	case "=~":
+		return m.re.MatchString(v)
+	case "!~":
+		return !m.re.MatchString(v)
+	}
+	return false
+}
+
+// Expr is a parsed rule expression
+type Expr struct {
+	Metric    string
+	Matchers  []Matcher
+	Op        Operator
+	Threshold float64
+	For       time.Duration
+}
+
+// ParseExpr parses metric{label="value",...} op threshold [for duration].
+// Label values may be in double or single quotes; =~ and !~ take regular
+// expressions that must match the whole value.
+func ParseExpr(s string) (*Expr, error) {
+	p := &exprParser{s: s}
+	expr := &Expr{}
+
+	expr.Metric = p.ident(true)
+	if expr.Metric == "" {
+		return nil, p.errorf("expected a metric name")
+	}
+	if p.consume("{") {
+		for !p.consume("}") {
+			m, err := p.matcher()
+			if err != nil {
+				return nil, err
+			}
+			expr.Matchers = append(expr.Matchers, m)
+			if !p.consume(",") && !p.peek("}") {
+				return nil, p.errorf("expected , or }")
+			}
+		}
+	}
+
+	for _, op := range []Operator{OpGreaterEqual, OpLessEqual, OpEqual, OpNotEqual, OpGreater, OpLess} {
+		if p.consume(string(op)) {
+			expr.Op = op
+			break
+		}
+	}
+	if expr.Op == "" {
+		return nil, p.errorf("expected a comparison operator")
+	}
+
+	threshold, err := strconv.ParseFloat(p.word(), 64)
+	if err != nil {
+		return nil, p.errorf("expected a numeric threshold")
+	}
+	expr.Threshold = threshold
+
+	if word := p.word(); word != "" {
+		if word != "for" {
+			return nil, p.errorf("expected for, got %q", word)
+		}
+		if expr.For, err = time.ParseDuration(p.word()); err != nil || expr.For < 0 {
+			return nil, p.errorf("expected a duration after for")
+		}
+	}
+	if p.skipSpace(); p.pos < len(p.s) {
+		return nil, p.errorf("unexpected %q", p.s[p.pos:])
+	}
+	return expr, nil
+}
+
+// String formats the expression in the syntax ParseExpr accepts
+func (e *Expr) String() string {
+	var b strings.Builder
+	b.WriteString(e.Metric)
+	if len(e.Matchers) > 0 {
+		b.WriteByte('{')
+		for i, m := range e.Matchers {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(m.Name + m.Op + quoteValue(m.Value))
+		}
+		b.WriteByte('}')
+	}
+	b.WriteString(" " + string(e.Op) + " " + strconv.FormatFloat(e.Threshold, 'g', -1, 64))
+	if e.For > 0 {
+		b.WriteString(" for " + e.For.String())
+	}
+	return b.String()
+}
+
+// quoteValue puts a label value between the quotes the parser reads it
+// back from. Values are taken verbatim, so a value holding a double quote
+// is put in single quotes instead.
+func quoteValue(v string) string {
+	if strings.ContainsRune(v, '"') {
+		return "'" + v + "'"
+	}
+	return `"` + v + `"`
+}
+
+// ParseSelector parses a list of label matchers in the syntax of an
+// expression's, e.g. {rule="DiskFull",mountpoint=~"/var/.*"}. The braces
+// are optional.
+func ParseSelector(s string) ([]Matcher, error) {
+	p := &exprParser{s: s}
+	braced := p.consume("{")
+	var matchers []Matcher
+	for {
+		if braced && p.consume("}") {
+			break
+		}
+		if p.skipSpace(); !braced && p.pos == len(p.s) {
+			break
+		}
+		m, err := p.matcher()
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, m)
+		if p.consume(",") {
+			continue
+		}
+		if braced && !p.consume("}") {
+			return nil, p.errorf("expected , or }")
+		}
+		break
+	}
+	if p.skipSpace(); p.pos < len(p.s) {
+		return nil, p.errorf("unexpected %q", p.s[p.pos:])
+	}
+	return matchers, nil
+}
+
+type exprParser struct {
+	s   string
+	pos int
+}
+
+func (p *exprParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("expr %q at offset %d: %s", p.s, p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *exprParser) skipSpace() {
+	for p.pos < len(p.s) && unicode.IsSpace(rune(p.s[p.pos])) {
+		p.pos++
+	}
+}
+
+func (p *exprParser) peek(tok string) bool {
+	p.skipSpace()
+	return strings.HasPrefix(p.s[p.pos:], tok)
+}
+
+func (p *exprParser) consume(tok string) bool {
+	if p.peek(tok) {
+		p.pos += len(tok)
+		return true
+	}
+	return false
+}
+
+// ident reads a name of letters, digits and underscores, plus dots in
+// metric names
+func (p *exprParser) ident(dots bool) string {
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		if c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || dots && c == '.' {
+			p.pos++
+			continue
+		}
+		break
+	}
+	return p.s[start:p.pos]
+}
+
+// word reads up to the next space
+func (p *exprParser) word() string {
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.s) && !unicode.IsSpace(rune(p.s[p.pos])) {
+		p.pos++
+	}
+	return p.s[start:p.pos]
+}
+
+func (p *exprParser) matcher() (Matcher, error) {
+	m := Matcher{Name: p.ident(false)}
+	if m.Name == "" {
+		return m, p.errorf("expected a label name")
+	}
+	for _, op := range []string{"=~", "!~", "!=", "="} {
+		if p.consume(op) {
+			m.Op = op
+			break
+		}
+	}
+	if m.Op == "" {
+		return m, p.errorf("expected =, !=, =~ or !~")
+	}
+
+	p.skipSpace()
+	if p.pos >= len(p.s) || p.s[p.pos] != '"' && p.s[p.pos] != '\'' {
+		return m, p.errorf("expected a quoted label value")
+	}
+	quote := p.s[p.pos]
+	end := strings.IndexByte(p.s[p.pos+1:], quote)
+	if end < 0 {
+		return m, p.errorf("unterminated label value")
+	}
+	m.Value = p.s[p.pos+1 : p.pos+1+end]
+	p.pos += end + 2
+
+	if m.Op == "=~" || m.Op == "!~" {
+		re, err := regexp.Compile("^(?:" + m.Value + ")$")
+		if err != nil {
+			return m, p.errorf("invalid regular expression: %v", err)
+		}
+		m.re = re
+	}
+	return m, nil
+}
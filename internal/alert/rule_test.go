@@ -0,0 +1,111 @@
+package alert
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseExpr(t *testing.T) {
+	expr, err := ParseExpr(`disk.used_percent{mountpoint="/", device=~'/dev/sd.*'} > 90 for 5m`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expr.Metric != "disk.used_percent" || expr.Op != OpGreater || expr.Threshold != 90 || expr.For != 5*time.Minute {
+		t.Errorf("Unexpected expression %+v", expr)
+	}
+	if len(expr.Matchers) != 2 {
+		t.Fatalf("Expected 2 matchers, got %d", len(expr.Matchers))
+	}
+	if !expr.Matchers[1].Matches(map[string]string{"device": "/dev/sda1"}) || expr.Matchers[1].Matches(map[string]string{"device": "/dev/nvme0n1"}) {
+		t.Error("Expected the regular expression to match the whole value")
+	}
+	if got := expr.String(); got != `disk.used_percent{mountpoint="/",device=~"/dev/sd.*"} > 90 for 5m0s` {
+		t.Errorf("Unexpected string %q", got)
+	}
+
+	// Values are read verbatim, so String must not escape them
+	for _, s := range []string{
+		`disk_io.busy_percent{device=~"sd[a-z]\d+"} > 90`,
+		`disk.used_percent{mountpoint='/mnt/"quoted"'} > 90`,
+	} {
+		expr, err := ParseExpr(s)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", s, err)
+		}
+		again, err := ParseExpr(expr.String())
+		if err != nil {
+			t.Fatalf("%q: unexpected error reparsing %q: %v", s, expr.String(), err)
+		}
+		if again.Matchers[0].Value != expr.Matchers[0].Value || again.String() != expr.String() {
+			t.Errorf("%q: expected %q to round-trip, got %q", s, expr.String(), again.String())
+		}
+	}
+
+	expr, err = ParseExpr("memory.available<=1e9")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expr.Op != OpLessEqual || expr.Threshold != 1e9 || expr.For != 0 {
+		t.Errorf("Unexpected expression %+v", expr)
+	}
+
+	for _, bad := range []string{
+		"",
+		"cpu.total_percent",
+		"cpu.total_percent > high",
+		"cpu.total_percent > 90 during 5m",
+		"cpu.total_percent > 90 for soon",
+		`disk.used_percent{mountpoint=/} > 90`,
+		`disk.used_percent{mountpoint="/" > 90`,
+		`disk.used_percent{device=~"("} > 90`,
+		"cpu.total_percent > 90 for 5m extra",
+	} {
+		if _, err := ParseExpr(bad); err == nil {
+			t.Errorf("Expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestParseSelector(t *testing.T) {
+	for _, s := range []string{`{rule="DiskFull", mountpoint=~'/var.*'}`, `rule="DiskFull",mountpoint=~"/var.*",`} {
+		matchers, err := ParseSelector(s)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", s, err)
+		}
+		labels := map[string]string{"rule": "DiskFull", "mountpoint": "/var/log"}
+		if len(matchers) != 2 || !matchesAll(matchers, labels) {
+			t.Errorf("%q: unexpected matchers %+v", s, matchers)
+		}
+	}
+	if matchers, err := ParseSelector(" {} "); err != nil || len(matchers) != 0 {
+		t.Errorf("Expected no matchers, got %v, %v", matchers, err)
+	}
+	for _, bad := range []string{`{rule="A"`, `rule="A" mountpoint="/"`, `{rule="A"} extra`, `rule`} {
+		if _, err := ParseSelector(bad); err == nil {
+			t.Errorf("Expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestLoadRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	os.WriteFile(path, []byte(`{"rules": [
+		{"name": "HighCPU", "expr": "cpu.total_percent > 90 for 5m", "clear": 80, "severity": "warning"},
+		{"name": "RootFull", "expr": "disk.used_percent{mountpoint='/'} > 95"}
+	]}`), 0o644)
+
+	rules, err := LoadRules(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(rules) != 2 || rules[0].expr.For != 5*time.Minute || *rules[0].Clear != 80 {
+		t.Errorf("Unexpected rules %+v", rules)
+	}
+
+	os.WriteFile(path, []byte(`{"rules": [{"name": "A", "expr": "x > 1"}, {"name": "A", "expr": "y > 1"}]}`), 0o644)
+	if _, err := LoadRules(path); err == nil {
+		t.Error("Expected duplicate rule names to be rejected")
+	}
+}
@@ -0,0 +1,138 @@
+package alert
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kennethfeh/system-monitor/internal/models"
+	"github.com/kennethfeh/system-monitor/internal/storage"
+)
+
+// Sample is one numeric value of a snapshot. Elements of a list are
+// labelled by the field that identifies them in stored series, e.g. a
+// filesystem by mountpoint, and processes by pid; elements without one are
+// labelled by their index.
+type Sample struct {
+	Labels map[string]string
+	Value  float64
+}
+
+// skipFields lists snapshot fields that are not metrics
+var skipFields = map[string]bool{
+	"timestamp":          true,
+	"errors":             true,
+	"section_timestamps": true,
+	"mountpoints":        true,
+}
+
+// structSections are the snapshot sections that are zero values rather than
+// empty when their source did not run
+var structSections = []string{"cpu", "memory", "system"}
+
+// cpuUsageFields hold CPU utilisation, which is not meaningful while
+// unavailable
+var cpuUsageFields = []string{"usage_percent", "total_percent", "modes", "core_modes"}
+
+// samplesOf turns a snapshot into samples keyed by their JSON path, e.g.
+// "memory.used_percent", "disk.used_percent" with a mountpoint label or
+// "psi.cpu.some.avg10"
+func samplesOf(m models.SystemMetrics) map[string][]Sample {
+	samples := make(map[string][]Sample)
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return samples
+	}
+	var tree map[string]interface{}
+	if err := json.Unmarshal(data, &tree); err != nil {
+		return samples
+	}
+
+	if m.SectionTimestamps != nil {
+		for _, section := range structSections {
+			if _, ok := m.SectionTimestamps[section]; !ok {
+				delete(tree, section)
+			}
+		}
+	}
+	if cpu, ok := tree["cpu"].(map[string]interface{}); ok && m.CPU.Unavailable {
+		for _, field := range cpuUsageFields {
+			delete(cpu, field)
+		}
+	}
+
+	walk("", tree, nil, samples)
+	return samples
+}
+
+func walk(path string, v interface{}, labels map[string]string, samples map[string][]Sample) {
+	switch v := v.(type) {
+	case float64:
+		samples[path] = append(samples[path], Sample{Labels: labels, Value: v})
+	case map[string]interface{}:
+		for key, child := range v {
+			if !skipFields[key] {
+				walk(join(path, key), child, labels, samples)
+			}
+		}
+	case []interface{}:
+		for i, child := range v {
+			element := copyLabels(labels)
+			if field, id, ok := elementID(path, child); ok {
+				element[field] = id
+			} else {
+				element["index"] = strconv.Itoa(i)
+			}
+			walk(path, child, element, samples)
+		}
+	}
+}
+
+// elementID returns the label identifying a list element. Processes are
+// identified by pid: their names repeat, and their other strings, such as
+// state, change from one sample to the next.
+func elementID(path string, element interface{}) (field, id string, ok bool) {
+	if path == "processes" {
+		obj, _ := element.(map[string]interface{})
+		if pid, ok := obj["pid"].(float64); ok {
+			return "pid", strconv.FormatFloat(pid, 'f', -1, 64), true
+		}
+		return "", "", false
+	}
+	return storage.SeriesKey(element)
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func copyLabels(labels map[string]string) map[string]string {
+	out := make(map[string]string, len(labels)+1)
+	for k, v := range labels {
+		out[k] = v
+	}
+	return out
+}
+
+// labelsKey identifies a label set
+func labelsKey(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString(name)
+		b.WriteByte(0)
+		b.WriteString(labels[name])
+		b.WriteByte(0)
+	}
+	return b.String()
+}
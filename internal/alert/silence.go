@@ -0,0 +1,235 @@
+package alert
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SilenceState is where a silence is in its time window
+type SilenceState string
+
+const (
+	SilencePending SilenceState = "pending"
+	SilenceActive  SilenceState = "active"
+	SilenceExpired SilenceState = "expired"
+)
+
+// DefaultSilenceRetention is how long expired silences stay listed
+const DefaultSilenceRetention = 7 * 24 * time.Hour
+
+// ErrSilenceNotFound is returned for an unknown silence ID
+var ErrSilenceNotFound = errors.New("silence not found")
+
+// Silence mutes the alerts its matchers select from StartsAt until EndsAt.
+// The matchers apply to an alert's labels and to rule, its rule's name.
+type Silence struct {
+	ID        string       `json:"id"`
+	Matchers  string       `json:"matchers"`
+	StartsAt  time.Time    `json:"starts_at"`
+	EndsAt    time.Time    `json:"ends_at"`
+	CreatedBy string       `json:"created_by"`
+	Comment   string       `json:"comment,omitempty"`
+	CreatedAt time.Time    `json:"created_at"`
+	ExpiredBy string       `json:"expired_by,omitempty"`
+	State     SilenceState `json:"state,omitempty"`
+
+	matchers []Matcher
+}
+
+// StateAt returns the state of the silence at t
+func (s Silence) StateAt(t time.Time) SilenceState {
+	switch {
+	case t.Before(s.StartsAt):
+		return SilencePending
+	case t.Before(s.EndsAt):
+		return SilenceActive
+	default:
+		return SilenceExpired
+	}
+}
+
+// Mutes reports whether the silence is active at t and selects the alert
+func (s Silence) Mutes(a Alert, t time.Time) bool {
+	return s.StateAt(t) == SilenceActive && matchesAlert(s.matchers, a)
+}
+
+// matchesAlert applies matchers to an alert's labels and its rule name
+func matchesAlert(matchers []Matcher, a Alert) bool {
+	labels := copyLabels(a.Labels)
+	labels["rule"] = a.Rule
+	return matchesAll(matchers, labels)
+}
+
+// Silences holds the silences created through the API, persisted to a JSON
+// file when opened with a path
+type Silences struct {
+	mu       sync.Mutex
+	path     string
+	silences []Silence
+
+	// Retention is how long expired silences are kept
+	Retention time.Duration
+}
+
+// OpenSilences loads the silences saved at path, which may not exist yet.
+// With an empty path silences are kept in memory only.
+func OpenSilences(path string) (*Silences, error) {
+	s := &Silences{path: path, Retention: DefaultSilenceRetention}
+	if path == "" {
+		return s, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.silences); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for i := range s.silences {
+		if s.silences[i].matchers, err = ParseSelector(s.silences[i].Matchers); err != nil {
+			return nil, fmt.Errorf("%s: silence %s: %w", path, s.silences[i].ID, err)
+		}
+	}
+	return s, nil
+}
+
+// Add validates a new silence, assigns its ID and saves it. A silence
+// without a start time starts now.
+func (s *Silences) Add(sil Silence, now time.Time) (Silence, error) {
+	matchers, err := ParseSelector(sil.Matchers)
+	if err != nil {
+		return Silence{}, err
+	}
+	if len(matchers) == 0 {
+		return Silence{}, errors.New("a silence needs at least one matcher")
+	}
+	if sil.CreatedBy == "" {
+		return Silence{}, errors.New("created_by is required")
+	}
+	if sil.StartsAt.IsZero() {
+		sil.StartsAt = now
+	}
+	if !sil.EndsAt.After(sil.StartsAt) || !sil.EndsAt.After(now) {
+		return Silence{}, errors.New("ends_at must be after starts_at and in the future")
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return Silence{}, err
+	}
+	sil.ID, sil.CreatedAt, sil.ExpiredBy, sil.matchers = hex.EncodeToString(id), now, "", matchers
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	silences := append(append([]Silence(nil), s.silences...), sil)
+	if err := s.save(silences, now); err != nil {
+		return Silence{}, err
+	}
+	sil.State = sil.StateAt(now)
+	return sil, nil
+}
+
+// Expire ends a silence now, recording who expired it
+func (s *Silences) Expire(id, by string, now time.Time) (Silence, error) {
+	if by == "" {
+		return Silence{}, errors.New("by is required")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.silences {
+		if s.silences[i].ID != id {
+			continue
+		}
+		if s.silences[i].StateAt(now) == SilenceExpired {
+			return Silence{}, fmt.Errorf("silence %s already expired", id)
+		}
+		silences := append([]Silence(nil), s.silences...)
+		sil := &silences[i]
+		if sil.StartsAt.After(now) {
+			sil.StartsAt = now
+		}
+		sil.EndsAt, sil.ExpiredBy = now, by
+		expired := *sil
+		if err := s.save(silences, now); err != nil {
+			return Silence{}, err
+		}
+		expired.State = SilenceExpired
+		return expired, nil
+	}
+	return Silence{}, ErrSilenceNotFound
+}
+
+// List returns the silences with their state at now, active ones first,
+// then pending, then expired, each ordered by end time
+func (s *Silences) List(now time.Time) []Silence {
+	s.mu.Lock()
+	silences := append([]Silence{}, s.silences...)
+	s.mu.Unlock()
+
+	order := map[SilenceState]int{SilenceActive: 0, SilencePending: 1, SilenceExpired: 2}
+	for i := range silences {
+		silences[i].State = silences[i].StateAt(now)
+	}
+	sort.SliceStable(silences, func(i, j int) bool {
+		if oi, oj := order[silences[i].State], order[silences[j].State]; oi != oj {
+			return oi < oj
+		}
+		return silences[i].EndsAt.Before(silences[j].EndsAt)
+	})
+	return silences
+}
+
+// MutedBy returns the IDs of the silences muting an alert at t
+func (s *Silences) MutedBy(a Alert, t time.Time) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ids []string
+	for _, sil := range s.silences {
+		if sil.Mutes(a, t) {
+			ids = append(ids, sil.ID)
+		}
+	}
+	return ids
+}
+
+// save drops the silences expired past the retention and writes the rest,
+// replacing the file atomically. They become the silences held only once
+// written.
+func (s *Silences) save(silences []Silence, now time.Time) error {
+	cutoff := now.Add(-s.Retention)
+	kept := silences[:0]
+	for _, sil := range silences {
+		if sil.EndsAt.After(cutoff) {
+			kept = append(kept, sil)
+		}
+	}
+
+	if s.path != "" {
+		data, err := json.MarshalIndent(kept, "", "  ")
+		if err != nil {
+			return err
+		}
+		tmp := s.path + ".tmp"
+		if err := os.WriteFile(tmp, data, 0o644); err != nil {
+			os.Remove(tmp)
+			return err
+		}
+		if err := os.Rename(tmp, s.path); err != nil {
+			os.Remove(tmp)
+			return err
+		}
+	}
+	s.silences = kept
+	return nil
+}
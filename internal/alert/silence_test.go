@@ -0,0 +1,118 @@
+package alert
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSilences(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "silences.json")
+	silences, err := OpenSilences(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, bad := range []Silence{
+		{Matchers: "", CreatedBy: "ops", EndsAt: testStart.Add(time.Hour)},
+		{Matchers: `mountpoint="/"`, EndsAt: testStart.Add(time.Hour)},
+		{Matchers: `mountpoint="/"`, CreatedBy: "ops", EndsAt: testStart.Add(-time.Minute)},
+		{Matchers: `mountpoint=/`, CreatedBy: "ops", EndsAt: testStart.Add(time.Hour)},
+	} {
+		if _, err := silences.Add(bad, testStart); err == nil {
+			t.Errorf("Expected %+v to be rejected", bad)
+		}
+	}
+
+	deploy, err := silences.Add(Silence{
+		Matchers:  `{rule="DiskFull", mountpoint=~"/data.*"}`,
+		EndsAt:    testStart.Add(time.Hour),
+		CreatedBy: "alice",
+		Comment:   "deploy",
+	}, testStart)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if deploy.ID == "" || !deploy.StartsAt.Equal(testStart) || deploy.State != SilenceActive {
+		t.Errorf("Unexpected silence %+v", deploy)
+	}
+	later, err := silences.Add(Silence{
+		Matchers:  `rule="HighCPU"`,
+		StartsAt:  testStart.Add(time.Hour),
+		EndsAt:    testStart.Add(2 * time.Hour),
+		CreatedBy: "bob",
+	}, testStart)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	data := Alert{Rule: "DiskFull", Labels: map[string]string{"mountpoint": "/data"}}
+	root := Alert{Rule: "DiskFull", Labels: map[string]string{"mountpoint": "/"}}
+	cpu := Alert{Rule: "HighCPU", Labels: map[string]string{}}
+	if ids := silences.MutedBy(data, testStart.Add(time.Minute)); len(ids) != 1 || ids[0] != deploy.ID {
+		t.Errorf("Expected /data to be muted by %s, got %v", deploy.ID, ids)
+	}
+	if ids := silences.MutedBy(root, testStart.Add(time.Minute)); len(ids) != 0 {
+		t.Errorf("Expected / not to be muted, got %v", ids)
+	}
+	if ids := silences.MutedBy(cpu, testStart.Add(time.Minute)); len(ids) != 0 {
+		t.Errorf("Expected a pending silence not to mute, got %v", ids)
+	}
+	if ids := silences.MutedBy(cpu, testStart.Add(90*time.Minute)); len(ids) != 1 {
+		t.Errorf("Expected HighCPU to be muted once the silence starts, got %v", ids)
+	}
+
+	expired, err := silences.Expire(deploy.ID, "carol", testStart.Add(10*time.Minute))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expired.State != SilenceExpired || expired.ExpiredBy != "carol" || !expired.EndsAt.Equal(testStart.Add(10*time.Minute)) {
+		t.Errorf("Unexpected expired silence %+v", expired)
+	}
+	if _, err := silences.Expire(deploy.ID, "carol", testStart.Add(11*time.Minute)); err == nil {
+		t.Error("Expected expiring an expired silence to fail")
+	}
+	if _, err := silences.Expire("missing", "carol", testStart); !errors.Is(err, ErrSilenceNotFound) {
+		t.Errorf("Expected ErrSilenceNotFound, got %v", err)
+	}
+	if _, err := silences.Expire(later.ID, "", testStart.Add(10*time.Minute)); err == nil {
+		t.Error("Expected expiring without saying who to fail")
+	}
+
+	reopened, err := OpenSilences(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	list := reopened.List(testStart.Add(time.Hour))
+	if len(list) != 2 || list[0].ID != later.ID || list[0].State != SilenceActive || list[1].ID != deploy.ID || list[1].State != SilenceExpired {
+		t.Errorf("Expected the active silence then the expired one after reopening, got %+v", list)
+	}
+	if ids := reopened.MutedBy(cpu, testStart.Add(90*time.Minute)); len(ids) != 1 {
+		t.Errorf("Expected reopened silences to mute, got %v", ids)
+	}
+
+	// Adding prunes silences expired past the retention
+	reopened.Retention = 90 * time.Minute
+	if _, err := reopened.Add(Silence{Matchers: `rule="A"`, EndsAt: testStart.Add(24 * time.Hour), CreatedBy: "ops"}, testStart.Add(3*time.Hour)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if list := reopened.List(testStart.Add(3 * time.Hour)); len(list) != 2 || list[1].ID != later.ID {
+		t.Errorf("Expected the old expired silence to be pruned, got %+v", list)
+	}
+}
+
+func TestSilencesSaveFailure(t *testing.T) {
+	// The directory of the file does not exist, so every save fails
+	silences, err := OpenSilences(filepath.Join(t.TempDir(), "missing", "silences.json"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if _, err := silences.Add(Silence{Matchers: `rule="A"`, EndsAt: testStart.Add(time.Hour), CreatedBy: "ops"}, testStart); err == nil {
+		t.Fatal("Expected the save to fail")
+	}
+	if list := silences.List(testStart); len(list) != 0 {
+		t.Errorf("Expected a silence that was not saved not to be kept, got %+v", list)
+	}
+}
@@ -0,0 +1,88 @@
+//go:build !windows && !plan9
+
+package alert
+
+import (
+	"context"
+	"log/syslog"
+	"strings"
+)
+
+// SyslogNotifier writes each notification to syslog as one message, its
+// alerts separated by "; ", at the priority of the most severe alert.
+// Keeping a notification to a single write means a retry cannot repeat
+// alerts that were already logged.
+type SyslogNotifier struct {
+	cfg    SyslogConfig
+	writer *syslog.Writer
+}
+
+// NewSyslogNotifier validates cfg. The connection is made on the first
+// notification.
+func NewSyslogNotifier(cfg SyslogConfig) (*SyslogNotifier, error) {
+	if cfg.Tag == "" {
+		cfg.Tag = "system-monitor"
+	}
+	return &SyslogNotifier{cfg: cfg}, nil
+}
+
+func (s *SyslogNotifier) Notify(ctx context.Context, n Notification) error {
+	if len(n.Alerts) == 0 {
+		return nil
+	}
+	if s.writer == nil {
+		w, err := syslog.Dial(s.cfg.Network, s.cfg.Address, syslog.LOG_DAEMON|syslog.LOG_NOTICE, s.cfg.Tag)
+		if err != nil {
+			return err
+		}
+		s.writer = w
+	}
+
+	lines := make([]string, len(n.Alerts))
+	priority := syslog.LOG_INFO
+	for i, a := range n.Alerts {
+		lines[i] = syslogLine(a)
+		// Lower priorities are more severe
+		if p := alertPriority(a); p < priority {
+			priority = p
+		}
+	}
+	if err := s.write(priority, strings.Join(lines, "; ")); err != nil {
+		s.writer.Close()
+		s.writer = nil
+		return err
+	}
+	return nil
+}
+
+// alertPriority derives an alert's syslog severity from its rule's
+func alertPriority(a Alert) syslog.Priority {
+	if a.State == StateResolved {
+		return syslog.LOG_INFO
+	}
+	switch strings.ToLower(a.Severity) {
+	case "critical", "crit":
+		return syslog.LOG_CRIT
+	case "error", "err":
+		return syslog.LOG_ERR
+	case "warning", "warn":
+		return syslog.LOG_WARNING
+	default:
+		return syslog.LOG_NOTICE
+	}
+}
+
+func (s *SyslogNotifier) write(priority syslog.Priority, msg string) error {
+	switch priority {
+	case syslog.LOG_CRIT:
+		return s.writer.Crit(msg)
+	case syslog.LOG_ERR:
+		return s.writer.Err(msg)
+	case syslog.LOG_WARNING:
+		return s.writer.Warning(msg)
+	case syslog.LOG_INFO:
+		return s.writer.Info(msg)
+	default:
+		return s.writer.Notice(msg)
+	}
+}
@@ -0,0 +1,20 @@
+//go:build windows || plan9
+
+package alert
+
+import (
+	"context"
+	"errors"
+)
+
+// SyslogNotifier is not available on this platform
+type SyslogNotifier struct{}
+
+// NewSyslogNotifier reports that syslog is not available
+func NewSyslogNotifier(cfg SyslogConfig) (*SyslogNotifier, error) {
+	return nil, errors.New("syslog is not supported on this platform")
+}
+
+func (s *SyslogNotifier) Notify(ctx context.Context, n Notification) error {
+	return errors.New("syslog is not supported on this platform")
+}
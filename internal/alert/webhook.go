@@ -0,0 +1,83 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// SignatureHeader carries the HMAC-SHA256 of a webhook body, as
+// "sha256=<hex>", when the webhook has a secret
+const SignatureHeader = "X-Signature-256"
+
+// WebhookConfig configures a JSON webhook
+type WebhookConfig struct {
+	URL string `json:"url"`
+	// Secret signs each body so the receiver can verify its origin
+	Secret  string            `json:"secret,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Timeout Duration          `json:"timeout,omitempty"`
+}
+
+// WebhookNotifier posts notifications as JSON
+type WebhookNotifier struct {
+	cfg    WebhookConfig
+	client *http.Client
+}
+
+// NewWebhookNotifier validates cfg
+func NewWebhookNotifier(cfg WebhookConfig) (*WebhookNotifier, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("webhook URL %q must be an http or https URL", cfg.URL)
+	}
+	timeout := time.Duration(cfg.Timeout)
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	return &WebhookNotifier{cfg: cfg, client: &http.Client{Timeout: timeout}}, nil
+}
+
+// Sign returns the signature header value of body for secret
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (w *WebhookNotifier) Notify(ctx context.Context, n Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range w.cfg.Headers {
+		req.Header.Set(name, value)
+	}
+	if w.cfg.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(w.cfg.Secret, body))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
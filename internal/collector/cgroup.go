@@ -0,0 +1,436 @@
+package collector
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kennethfeh/system-monitor/internal/models"
+)
+
+// DefaultCgroupDepth limits the walk to e.g. /system.slice/foo.service
+const DefaultCgroupDepth = 2
+
+// cgroupV1Controllers are the v1 hierarchies read by the fallback path
+var cgroupV1Controllers = []string{"cpuacct", "cpu", "memory", "blkio", "pids"}
+
+// cgroupV1Unlimited is the threshold above which a v1 limit means "no limit";
+// the kernel reports PAGE_COUNTER_MAX rounded to the page size.
+const cgroupV1Unlimited = 1 << 62
+
+var errCgroupsUnavailable = fmt.Errorf("cgroup filesystem: %w", ErrNotSupported)
+
+// CgroupOptions configures the cgroup collector. Root is the cgroup
+// filesystem mount point, <sys>/fs/cgroup when empty, and MaxDepth how
+// many levels below it are walked;
+// depth 0 reports only the root cgroup.
+type CgroupOptions struct {
+	Root     string
+	MaxDepth int
+}
+
+// cgroupSample holds the cumulative counters used to derive cgroup rates
+type cgroupSample struct {
+	cpuUsageMicros uint64
+	ioReadBytes    uint64
+	ioWriteBytes   uint64
+}
+
+// SetCgroupOptions configures the cgroup collector
+func (c *Collector) SetCgroupOptions(opts CgroupOptions) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.cgroupOptions = opts
+}
+
+func (c *Collector) cgroupOpts() CgroupOptions {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	opts := c.cgroupOptions
+	if opts.Root == "" {
+		opts.Root = filepath.Join(c.paths.Sys, "fs", "cgroup")
+	}
+	return opts
+}
+
+// CollectCgroups walks the cgroup hierarchy and reports CPU, memory, I/O
+// and pids accounting for every cgroup down to the configured depth. The
+// v2 unified hierarchy is used when mounted, otherwise the v1 controller
+// hierarchies are merged by path. Rates are computed against the previous
+// call, apart from the baseline of the cgroups source.
+func (c *Collector) CollectCgroups() ([]models.CgroupMetrics, error) {
+	return c.collectCgroups(&c.apiCgroupBase)
+}
+
+// collectCgroups computes rates against base and replaces it
+func (c *Collector) collectCgroups(base *cgroupBaseline) ([]models.CgroupMetrics, error) {
+	opts := c.cgroupOpts()
+
+	var cgroups []models.CgroupMetrics
+	var err error
+	if isCgroupV2(opts.Root) {
+		cgroups, err = collectCgroupsV2(opts.Root, opts.MaxDepth)
+	} else {
+		cgroups, err = collectCgroupsV1(opts.Root, opts.MaxDepth)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c.applyCgroupRates(cgroups, base, time.Now())
+	return cgroups, nil
+}
+
+// cgroupBaseline is the previous sample that cgroup rates are computed
+// against
+type cgroupBaseline struct {
+	stats map[string]cgroupSample
+	time  time.Time
+}
+
+// applyCgroupRates fills in CPU and I/O rates from the previous sample and
+// replaces the baseline. Cgroups seen for the first time report zero rates.
+func (c *Collector) applyCgroupRates(cgroups []models.CgroupMetrics, base *cgroupBaseline, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elapsed := now.Sub(base.time)
+	samples := make(map[string]cgroupSample, len(cgroups))
+
+	for i := range cgroups {
+		cg := &cgroups[i]
+		cur := cgroupSample{
+			cpuUsageMicros: cg.CPU.UsageMicros,
+			ioReadBytes:    cg.IO.ReadBytes,
+			ioWriteBytes:   cg.IO.WriteBytes,
+		}
+		samples[cg.Path] = cur
+
+		prev, ok := base.stats[cg.Path]
+		if !ok || elapsed <= 0 {
+			continue
+		}
+		if delta, ok := counterDelta(prev.cpuUsageMicros, cur.cpuUsageMicros); ok {
+			cg.CPU.UsagePercent = float64(delta) / float64(elapsed.Microseconds()) * 100
+		}
+		if delta, ok := counterDelta(prev.ioReadBytes, cur.ioReadBytes); ok {
+			cg.IO.ReadBytesPerSec = float64(delta) / elapsed.Seconds()
+		}
+		if delta, ok := counterDelta(prev.ioWriteBytes, cur.ioWriteBytes); ok {
+			cg.IO.WriteBytesPerSec = float64(delta) / elapsed.Seconds()
+		}
+	}
+
+	*base = cgroupBaseline{stats: samples, time: now}
+}
+
+func isCgroupV2(root string) bool {
+	_, err := os.Stat(filepath.Join(root, "cgroup.controllers"))
+	return err == nil
+}
+
+// walkCgroupDirs returns the paths, relative to root and in cgroup notation
+// ("/", "/system.slice", ...), of every cgroup directory within maxDepth.
+// A symlinked root, such as a v1 cpu hierarchy linked to cpu,cpuacct, is
+// followed.
+func walkCgroupDirs(root string, maxDepth int) ([]string, error) {
+	root, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Cgroups can vanish mid-walk; skip them rather than abort
+			if p != root {
+				return nil
+			}
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		depth := 0
+		if rel != "." {
+			depth = strings.Count(rel, string(filepath.Separator)) + 1
+		}
+		if depth > maxDepth {
+			return filepath.SkipDir
+		}
+
+		paths = append(paths, path.Join("/", filepath.ToSlash(rel)))
+		return nil
+	})
+	return paths, err
+}
+
+func collectCgroupsV2(root string, maxDepth int) ([]models.CgroupMetrics, error) {
+	paths, err := walkCgroupDirs(root, maxDepth)
+	if err != nil {
+		return nil, err
+	}
+
+	cgroups := make([]models.CgroupMetrics, 0, len(paths))
+	for _, p := range paths {
+		dir := filepath.Join(root, filepath.FromSlash(p))
+		cg := models.CgroupMetrics{Path: p}
+
+		if stat, err := readKeyValueFile(filepath.Join(dir, "cpu.stat")); err == nil {
+			cg.CPU.UsageMicros = stat["usage_usec"]
+			cg.CPU.Periods = stat["nr_periods"]
+			cg.CPU.ThrottledPeriods = stat["nr_throttled"]
+			cg.CPU.ThrottledMicros = stat["throttled_usec"]
+		}
+
+		if v, err := readCgroupValue(filepath.Join(dir, "memory.current")); err == nil {
+			cg.Memory.Current = v
+		}
+		if v, err := readCgroupValue(filepath.Join(dir, "memory.max")); err == nil {
+			cg.Memory.Max = v
+		}
+		if events, err := readKeyValueFile(filepath.Join(dir, "memory.events")); err == nil {
+			cg.Memory.Events = models.CgroupMemoryEvents{
+				Low:     events["low"],
+				High:    events["high"],
+				Max:     events["max"],
+				OOM:     events["oom"],
+				OOMKill: events["oom_kill"],
+			}
+		}
+
+		if ioStat, err := readCgroupIOStat(filepath.Join(dir, "io.stat")); err == nil {
+			cg.IO = ioStat
+		}
+
+		if v, err := readCgroupValue(filepath.Join(dir, "pids.current")); err == nil {
+			cg.Pids.Current = v
+		}
+		if v, err := readCgroupValue(filepath.Join(dir, "pids.max")); err == nil {
+			cg.Pids.Max = v
+		}
+
+		cg.Pressure = readCgroupPressure(dir)
+		cgroups = append(cgroups, cg)
+	}
+
+	return cgroups, nil
+}
+
+func collectCgroupsV1(root string, maxDepth int) ([]models.CgroupMetrics, error) {
+	// Merge the cgroup paths of every mounted controller hierarchy
+	seen := make(map[string]bool)
+	for _, controller := range cgroupV1Controllers {
+		paths, err := walkCgroupDirs(filepath.Join(root, controller), maxDepth)
+		if err != nil {
+			continue
+		}
+		for _, p := range paths {
+			seen[p] = true
+		}
+	}
+	if len(seen) == 0 {
+		return nil, errCgroupsUnavailable
+	}
+
+	paths := make([]string, 0, len(seen))
+	for p := range seen {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	controllerDir := func(controller, p string) string {
+		return filepath.Join(root, controller, filepath.FromSlash(p))
+	}
+
+	cgroups := make([]models.CgroupMetrics, 0, len(paths))
+	for _, p := range paths {
+		cg := models.CgroupMetrics{Path: p}
+
+		if v, err := readCgroupValue(filepath.Join(controllerDir("cpuacct", p), "cpuacct.usage")); err == nil {
+			cg.CPU.UsageMicros = v / 1000
+		}
+		if stat, err := readKeyValueFile(filepath.Join(controllerDir("cpu", p), "cpu.stat")); err == nil {
+			cg.CPU.Periods = stat["nr_periods"]
+			cg.CPU.ThrottledPeriods = stat["nr_throttled"]
+			cg.CPU.ThrottledMicros = stat["throttled_time"] / 1000
+		}
+
+		memDir := controllerDir("memory", p)
+		if v, err := readCgroupValue(filepath.Join(memDir, "memory.usage_in_bytes")); err == nil {
+			cg.Memory.Current = v
+		}
+		if v, err := readCgroupValue(filepath.Join(memDir, "memory.limit_in_bytes")); err == nil && v < cgroupV1Unlimited {
+			cg.Memory.Max = v
+		}
+		if v, err := readCgroupValue(filepath.Join(memDir, "memory.failcnt")); err == nil {
+			cg.Memory.Events.Max = v
+		}
+		if oom, err := readKeyValueFile(filepath.Join(memDir, "memory.oom_control")); err == nil {
+			cg.Memory.Events.OOMKill = oom["oom_kill"]
+		}
+
+		blkioDir := controllerDir("blkio", p)
+		if bytes, err := readBlkioFile(filepath.Join(blkioDir, "blkio.throttle.io_service_bytes")); err == nil {
+			cg.IO.ReadBytes = bytes["Read"]
+			cg.IO.WriteBytes = bytes["Write"]
+		}
+		if ops, err := readBlkioFile(filepath.Join(blkioDir, "blkio.throttle.io_serviced")); err == nil {
+			cg.IO.ReadOps = ops["Read"]
+			cg.IO.WriteOps = ops["Write"]
+		}
+
+		pidsDir := controllerDir("pids", p)
+		if v, err := readCgroupValue(filepath.Join(pidsDir, "pids.current")); err == nil {
+			cg.Pids.Current = v
+		}
+		if v, err := readCgroupValue(filepath.Join(pidsDir, "pids.max")); err == nil {
+			cg.Pids.Max = v
+		}
+
+		cgroups = append(cgroups, cg)
+	}
+
+	return cgroups, nil
+}
+
+// readCgroupValue reads a single-value cgroup file. The literal "max" means
+// unlimited and is reported as zero.
+func readCgroupValue(p string) (uint64, error) {
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return 0, err
+	}
+
+	value := strings.TrimSpace(string(data))
+	if value == "max" {
+		return 0, nil
+	}
+	return strconv.ParseUint(value, 10, 64)
+}
+
+// readKeyValueFile reads flat-keyed files such as cpu.stat or memory.events
+// where every line is "key value". Lines that do not parse are skipped.
+func readKeyValueFile(p string) (map[string]uint64, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	values := make(map[string]uint64)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		if v, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+			values[fields[0]] = v
+		}
+	}
+	return values, scanner.Err()
+}
+
+// readCgroupIOStat sums the per-device counters of a v2 io.stat file:
+//
+//	8:0 rbytes=1459200 wbytes=314773504 rios=192 wios=353 dbytes=0 dios=0
+func readCgroupIOStat(p string) (models.CgroupIO, error) {
+	var ioStat models.CgroupIO
+
+	f, err := os.Open(p)
+	if err != nil {
+		return ioStat, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		for _, field := range fields[1:] {
+			key, value, ok := strings.Cut(field, "=")
+			if !ok {
+				continue
+			}
+			v, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				continue
+			}
+			switch key {
+			case "rbytes":
+				ioStat.ReadBytes += v
+			case "wbytes":
+				ioStat.WriteBytes += v
+			case "rios":
+				ioStat.ReadOps += v
+			case "wios":
+				ioStat.WriteOps += v
+			}
+		}
+	}
+	return ioStat, scanner.Err()
+}
+
+// readBlkioFile sums a v1 blkio throttle file by operation:
+//
+//	8:0 Read 1459200
+//	8:0 Write 314773504
+//	Total 316232704
+func readBlkioFile(p string) (map[string]uint64, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	totals := make(map[string]uint64)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 {
+			continue
+		}
+		if v, err := strconv.ParseUint(fields[2], 10, 64); err == nil {
+			totals[fields[1]] += v
+		}
+	}
+	return totals, scanner.Err()
+}
+
+// readCgroupPressure reads the v2 per-cgroup PSI files, returning nil when
+// none are present
+func readCgroupPressure(dir string) *models.PSIMetrics {
+	psi := &models.PSIMetrics{}
+	found := false
+	for name, dst := range map[string]*models.PSIResource{
+		"cpu.pressure":    &psi.CPU,
+		"memory.pressure": &psi.Memory,
+		"io.pressure":     &psi.IO,
+	} {
+		if resource, err := readPSIFile(filepath.Join(dir, name)); err == nil {
+			*dst = resource
+			found = true
+		}
+	}
+	if !found {
+		return nil
+	}
+	return psi
+}
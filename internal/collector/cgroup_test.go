@@ -0,0 +1,205 @@
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kennethfeh/system-monitor/internal/models"
+)
+
+// writeFixture creates files under root from a path -> content map
+func writeFixture(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func findCgroup(cgroups []models.CgroupMetrics, path string) *models.CgroupMetrics {
+	for i := range cgroups {
+		if cgroups[i].Path == path {
+			return &cgroups[i]
+		}
+	}
+	return nil
+}
+
+func TestCollectCgroupsV2(t *testing.T) {
+	root := t.TempDir()
+	writeFixture(t, root, map[string]string{
+		"cgroup.controllers":                 "cpu io memory pids\n",
+		"cpu.stat":                           "usage_usec 5000000\nuser_usec 3000000\nsystem_usec 2000000\n",
+		"system.slice/cpu.stat":              "usage_usec 1000\nnr_periods 10\nnr_throttled 4\nthrottled_usec 250\n",
+		"system.slice/memory.current":        "104857600\n",
+		"system.slice/memory.max":            "max\n",
+		"system.slice/memory.events":         "low 0\nhigh 3\nmax 2\noom 1\noom_kill 1\n",
+		"system.slice/io.stat":               "8:0 rbytes=1000 wbytes=2000 rios=10 wios=20 dbytes=0 dios=0\n8:16 rbytes=500 wbytes=0 rios=5 wios=0 dbytes=0 dios=0\n",
+		"system.slice/pids.current":          "12\n",
+		"system.slice/pids.max":              "4096\n",
+		"system.slice/cpu.pressure":          "some avg10=1.00 avg60=0.50 avg300=0.25 total=100\nfull avg10=0.00 avg60=0.00 avg300=0.00 total=0\n",
+		"system.slice/app.service/cpu.stat":  "usage_usec 10\n",
+		"system.slice/app.service/deep/leaf": "",
+	})
+
+	c := NewCollector()
+	c.SetCgroupOptions(CgroupOptions{Root: root, MaxDepth: 2})
+
+	cgroups, err := c.CollectCgroups()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(cgroups) != 3 {
+		t.Fatalf("Expected 3 cgroups within depth 2, got %d", len(cgroups))
+	}
+	if findCgroup(cgroups, "/system.slice/app.service/deep") != nil {
+		t.Error("Expected cgroups below the depth limit to be skipped")
+	}
+
+	slice := findCgroup(cgroups, "/system.slice")
+	if slice == nil {
+		t.Fatal("Expected /system.slice to be reported")
+	}
+	if slice.CPU.ThrottledPeriods != 4 || slice.CPU.Periods != 10 || slice.CPU.ThrottledMicros != 250 {
+		t.Errorf("Unexpected CPU stats: %+v", slice.CPU)
+	}
+	if slice.Memory.Current != 104857600 || slice.Memory.Max != 0 {
+		t.Errorf("Unexpected memory stats: %+v", slice.Memory)
+	}
+	if slice.Memory.Events.OOMKill != 1 || slice.Memory.Events.High != 3 {
+		t.Errorf("Unexpected memory events: %+v", slice.Memory.Events)
+	}
+	if slice.IO.ReadBytes != 1500 || slice.IO.WriteBytes != 2000 || slice.IO.ReadOps != 15 {
+		t.Errorf("Unexpected IO stats: %+v", slice.IO)
+	}
+	if slice.Pids.Current != 12 || slice.Pids.Max != 4096 {
+		t.Errorf("Unexpected pids stats: %+v", slice.Pids)
+	}
+	if slice.Pressure == nil || slice.Pressure.CPU.Some.Avg10 != 1 {
+		t.Errorf("Expected cgroup CPU pressure to be read, got %+v", slice.Pressure)
+	}
+
+	if root := findCgroup(cgroups, "/"); root == nil || root.CPU.UsageMicros != 5000000 {
+		t.Errorf("Expected root cgroup usage to be read, got %+v", root)
+	}
+}
+
+func TestCollectCgroupsV1(t *testing.T) {
+	root := t.TempDir()
+	writeFixture(t, root, map[string]string{
+		"cpuacct/docker/cpuacct.usage":                 "3000000000\n",
+		"cpu/docker/cpu.stat":                          "nr_periods 100\nnr_throttled 7\nthrottled_time 5000000\n",
+		"memory/docker/memory.usage_in_bytes":          "2048\n",
+		"memory/docker/memory.limit_in_bytes":          "9223372036854771712\n",
+		"memory/docker/memory.failcnt":                 "3\n",
+		"memory/docker/memory.oom_control":             "oom_kill_disable 0\nunder_oom 0\noom_kill 2\n",
+		"blkio/docker/blkio.throttle.io_service_bytes": "8:0 Read 4096\n8:0 Write 8192\n8:0 Total 12288\nTotal 12288\n",
+		"blkio/docker/blkio.throttle.io_serviced":      "8:0 Read 1\n8:0 Write 2\n",
+		"pids/docker/pids.current":                     "5\n",
+		"pids/docker/pids.max":                         "max\n",
+		"memory/docker/memory.use_hierarchy":           "1\n",
+		"memory/system.slice/memory.usage_in_bytes":    "1024\n",
+		"memory/system.slice/memory.limit_in_bytes":    "4096\n",
+	})
+
+	c := NewCollector()
+	c.SetCgroupOptions(CgroupOptions{Root: root, MaxDepth: 1})
+
+	cgroups, err := c.CollectCgroups()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	docker := findCgroup(cgroups, "/docker")
+	if docker == nil {
+		t.Fatal("Expected /docker to be merged from the controller hierarchies")
+	}
+	if docker.CPU.UsageMicros != 3000000 || docker.CPU.ThrottledPeriods != 7 || docker.CPU.ThrottledMicros != 5000 {
+		t.Errorf("Unexpected CPU stats: %+v", docker.CPU)
+	}
+	if docker.Memory.Current != 2048 || docker.Memory.Max != 0 {
+		t.Errorf("Expected unlimited v1 memory limit to be reported as 0, got %+v", docker.Memory)
+	}
+	if docker.Memory.Events.OOMKill != 2 || docker.Memory.Events.Max != 3 {
+		t.Errorf("Unexpected memory events: %+v", docker.Memory.Events)
+	}
+	if docker.IO.ReadBytes != 4096 || docker.IO.WriteBytes != 8192 || docker.IO.WriteOps != 2 {
+		t.Errorf("Unexpected IO stats: %+v", docker.IO)
+	}
+	if docker.Pids.Current != 5 || docker.Pids.Max != 0 {
+		t.Errorf("Unexpected pids stats: %+v", docker.Pids)
+	}
+
+	if slice := findCgroup(cgroups, "/system.slice"); slice == nil || slice.Memory.Max != 4096 {
+		t.Errorf("Expected /system.slice with a 4096 byte limit, got %+v", slice)
+	}
+}
+
+func TestCollectCgroupsV1SymlinkedControllers(t *testing.T) {
+	// cpu and cpuacct are usually links to a co-mounted cpu,cpuacct
+	root := t.TempDir()
+	writeFixture(t, root, map[string]string{
+		"cpu,cpuacct/docker/cpuacct.usage": "3000000000\n",
+		"cpu,cpuacct/docker/cpu.stat":      "nr_periods 100\nnr_throttled 7\nthrottled_time 5000000\n",
+	})
+	for _, controller := range []string{"cpu", "cpuacct"} {
+		if err := os.Symlink("cpu,cpuacct", filepath.Join(root, controller)); err != nil {
+			t.Skipf("Symlinks unavailable: %v", err)
+		}
+	}
+
+	c := NewCollector()
+	c.SetCgroupOptions(CgroupOptions{Root: root, MaxDepth: 1})
+
+	cgroups, err := c.CollectCgroups()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	docker := findCgroup(cgroups, "/docker")
+	if docker == nil || docker.CPU.UsageMicros != 3000000 || docker.CPU.ThrottledPeriods != 7 {
+		t.Errorf("Expected /docker CPU accounting through the symlinked hierarchies, got %+v", docker)
+	}
+}
+
+func TestCollectCgroupsMissingRoot(t *testing.T) {
+	c := NewCollector()
+	c.SetCgroupOptions(CgroupOptions{Root: filepath.Join(t.TempDir(), "missing")})
+
+	if _, err := c.CollectCgroups(); err == nil {
+		t.Error("Expected error for missing cgroup root")
+	}
+}
+
+func TestApplyCgroupRates(t *testing.T) {
+	c := NewCollector()
+	start := time.Now()
+
+	first := []models.CgroupMetrics{{Path: "/a", CPU: models.CgroupCPU{UsageMicros: 1000000}}}
+	c.applyCgroupRates(first, &c.cgroupBase, start)
+
+	// A poll of /api/cgroups in between uses its own baseline
+	poll := []models.CgroupMetrics{{Path: "/a", CPU: models.CgroupCPU{UsageMicros: 1900000}}}
+	c.applyCgroupRates(poll, &c.apiCgroupBase, start.Add(1900*time.Millisecond))
+
+	second := []models.CgroupMetrics{{
+		Path: "/a",
+		CPU:  models.CgroupCPU{UsageMicros: 2000000},
+		IO:   models.CgroupIO{ReadBytes: 4000},
+	}}
+	c.applyCgroupRates(second, &c.cgroupBase, start.Add(2*time.Second))
+
+	if second[0].CPU.UsagePercent != 50 {
+		t.Errorf("Expected 50%% CPU, got %f", second[0].CPU.UsagePercent)
+	}
+	if second[0].IO.ReadBytesPerSec != 2000 {
+		t.Errorf("Expected 2000 B/s read, got %f", second[0].IO.ReadBytesPerSec)
+	}
+}
@@ -1,7 +1,12 @@
 package collector
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
 	"runtime"
+	"sync"
 	"time"
 
 	"github.com/kennethfeh/system-monitor/internal/models"
@@ -16,73 +21,103 @@ import (
 
 // Collector handles system metrics collection
 type Collector struct {
+	mu               sync.Mutex
 	lastNetworkStats map[string]models.NetworkMetrics
+	lastNetworkTime  time.Time
+	lastDiskStats    map[string]diskstatsSample
+	lastDiskIOTime   time.Time
+	lastCPUTimes     []cpu.TimesStat
+	lastCPUTime      time.Time
+	lastCPUPercent   []float64
+	lastCPUModes     []models.CPUModeMetrics
+	procBase         procBaseline
+	apiProcBase      procBaseline
+	processOptions   ProcessOptions
+	cgroupBase       cgroupBaseline
+	apiCgroupBase    cgroupBaseline
+	cgroupOptions    CgroupOptions
+	paths            Paths
+	ctx              context.Context
+	registry         *Registry
+	status           *statusTracker
 	lastCollectTime  time.Time
+	defaultInterval  time.Duration
+
+	// collectMu serialises collection passes and guards the assembled
+	// snapshot and the per-source schedule
+	collectMu    sync.Mutex
+	snapshot     models.SystemMetrics
+	sourceStates map[string]*sourceState
 }
 
 // NewCollector creates a new metrics collector
 func NewCollector() *Collector {
-	return &Collector{
+	paths := DefaultPaths()
+	c := &Collector{
 		lastNetworkStats: make(map[string]models.NetworkMetrics),
+		lastDiskStats:    make(map[string]diskstatsSample),
 		lastCollectTime:  time.Now(),
-	}
-}
-
-// Collect gathers all system metrics
-func (c *Collector) Collect() (models.SystemMetrics, error) {
-	metrics := models.SystemMetrics{
-		Timestamp: time.Now(),
-	}
-
-	// Collect CPU metrics
-	if cpuMetrics, err := c.collectCPU(); err == nil {
-		metrics.CPU = cpuMetrics
-	} else {
-		// Provide fallback CPU metrics
-		metrics.CPU = models.CPUMetrics{
-			TotalPercent: 0,
-			Cores:        runtime.NumCPU(),
-		}
+		cgroupOptions:    CgroupOptions{MaxDepth: DefaultCgroupDepth},
+		paths:            paths,
+		ctx:              paths.context(),
+		registry:         NewRegistry(),
+		status:           newStatusTracker(),
+		defaultInterval:  DefaultInterval,
+		snapshot:         models.SystemMetrics{Custom: make(map[string]interface{})},
+		sourceStates:     make(map[string]*sourceState),
 	}
 
-	// Collect Memory metrics
-	if memMetrics, err := c.collectMemory(); err == nil {
-		metrics.Memory = memMetrics
-	}
+	c.registerBuiltinSources()
+	c.primeCPU()
+	return c
+}
 
-	// Collect Disk metrics
-	if diskMetrics, err := c.collectDisk(); err == nil {
-		metrics.Disk = diskMetrics
-	}
+// primeCPU takes an initial CPU sample so the first Collect has a baseline
+func (c *Collector) primeCPU() {
+	_, ctx := c.hostPaths()
+	times, err := cpu.TimesWithContext(ctx, true)
 
-	// Collect Network metrics
-	if netMetrics, err := c.collectNetwork(); err == nil {
-		metrics.Network = netMetrics
-	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	// Collect System info
-	if sysInfo, err := c.collectSystem(); err == nil {
-		metrics.System = sysInfo
+	c.lastCPUPercent = nil
+	c.lastCPUModes = nil
+	c.lastCPUTimes = nil
+	if err == nil {
+		c.lastCPUTimes = times
+		c.lastCPUTime = time.Now()
 	}
+}
 
-	// Collect Temperature (if available)
-	if tempMetrics, err := c.collectTemperature(); err == nil && len(tempMetrics) > 0 {
-		metrics.Temperature = tempMetrics
-	}
+// Registry returns the collector's metric sources, for enabling, disabling
+// or adding sources
+func (c *Collector) Registry() *Registry {
+	return c.registry
+}
 
-	c.lastCollectTime = time.Now()
-	return metrics, nil
+// Register adds a third-party metric source, run after the built-in ones
+func (c *Collector) Register(source MetricSource) error {
+	return c.registry.Register(source)
 }
 
 func (c *Collector) collectCPU() (models.CPUMetrics, error) {
 	cpuMetrics := models.CPUMetrics{}
+	_, ctx := c.hostPaths()
 
-	// Get CPU usage per core
-	cpuPercent, err := cpu.Percent(time.Second, true)
+	// Get CPU usage per core from the delta since the previous sample,
+	// rather than sleeping inside cpu.Percent
+	cpuTimes, err := cpu.TimesWithContext(ctx, true)
 	if err != nil {
 		return cpuMetrics, err
 	}
+	// gopsutil reports an unreadable /proc/stat as an empty result
+	if len(cpuTimes) == 0 {
+		return cpuMetrics, errors.New("no per-core CPU times available")
+	}
+	cpuPercent, cpuModes := c.cpuUsage(cpuTimes, time.Now())
 	cpuMetrics.UsagePercent = cpuPercent
+	cpuMetrics.CoreModes = cpuModes
+	cpuMetrics.Modes = averageCPUModes(cpuModes)
 
 	// Calculate total CPU usage
 	if len(cpuPercent) > 0 {
@@ -94,14 +129,14 @@ func (c *Collector) collectCPU() (models.CPUMetrics, error) {
 	}
 
 	// Get CPU core count
-	cpuCount, err := cpu.Counts(true)
+	cpuCount, err := cpu.CountsWithContext(ctx, true)
 	if err == nil {
 		cpuMetrics.Cores = cpuCount
 	}
 
 	// Get load average (Unix-like systems)
 	if runtime.GOOS != "windows" {
-		if loadAvg, err := load.Avg(); err == nil {
+		if loadAvg, err := load.AvgWithContext(ctx); err == nil {
 			cpuMetrics.LoadAvg = []float64{loadAvg.Load1, loadAvg.Load5, loadAvg.Load15}
 		}
 	}
@@ -111,9 +146,10 @@ func (c *Collector) collectCPU() (models.CPUMetrics, error) {
 
 func (c *Collector) collectMemory() (models.MemoryMetrics, error) {
 	memMetrics := models.MemoryMetrics{}
+	_, ctx := c.hostPaths()
 
 	// Virtual memory
-	vmStat, err := mem.VirtualMemory()
+	vmStat, err := mem.VirtualMemoryWithContext(ctx)
 	if err != nil {
 		return memMetrics, err
 	}
@@ -125,7 +161,7 @@ func (c *Collector) collectMemory() (models.MemoryMetrics, error) {
 	memMetrics.UsedPercent = vmStat.UsedPercent
 
 	// Swap memory
-	swapStat, err := mem.SwapMemory()
+	swapStat, err := mem.SwapMemoryWithContext(ctx)
 	if err == nil {
 		memMetrics.SwapTotal = swapStat.Total
 		memMetrics.SwapUsed = swapStat.Used
@@ -136,22 +172,32 @@ func (c *Collector) collectMemory() (models.MemoryMetrics, error) {
 	return memMetrics, nil
 }
 
+// collectDisk returns the usage of every mounted partition. Partitions that
+// cannot be read are left out and their errors returned, joined, along with
+// the partitions that could.
 func (c *Collector) collectDisk() ([]models.DiskMetrics, error) {
 	var diskMetrics []models.DiskMetrics
+	paths, ctx := c.hostPaths()
 
-	partitions, err := disk.Partitions(false)
+	partitions, err := disk.PartitionsWithContext(ctx, false)
 	if err != nil {
 		return diskMetrics, err
 	}
 
+	var errs []error
 	for _, partition := range partitions {
 		// Skip special filesystems
 		if shouldSkipFilesystem(partition.Fstype) {
 			continue
 		}
 
-		usage, err := disk.Usage(partition.Mountpoint)
-		if err != nil || usage.Total == 0 {
+		// Mountpoints are host paths; stat them through the host root
+		usage, err := disk.UsageWithContext(ctx, paths.hostPath(partition.Mountpoint))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", partition.Mountpoint, err))
+			continue
+		}
+		if usage.Total == 0 {
 			continue
 		}
 
@@ -166,13 +212,14 @@ func (c *Collector) collectDisk() ([]models.DiskMetrics, error) {
 		})
 	}
 
-	return diskMetrics, nil
+	return diskMetrics, errors.Join(errs...)
 }
 
 func (c *Collector) collectNetwork() ([]models.NetworkMetrics, error) {
 	var netMetrics []models.NetworkMetrics
+	_, ctx := c.hostPaths()
 
-	netIO, err := net.IOCounters(true)
+	netIO, err := net.IOCountersWithContext(ctx, true)
 	if err != nil {
 		return netMetrics, err
 	}
@@ -198,13 +245,86 @@ func (c *Collector) collectNetwork() ([]models.NetworkMetrics, error) {
 		netMetrics = append(netMetrics, metric)
 	}
 
+	c.applyNetworkRates(netMetrics, time.Now())
 	return netMetrics, nil
 }
 
+// applyNetworkRates fills in the rate fields of each interface from the
+// previous sample and records the current counters as the new baseline.
+// Interfaces seen for the first time, or whose counters were reset, report
+// zero rates for this sample.
+func (c *Collector) applyNetworkRates(netMetrics []models.NetworkMetrics, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elapsed := now.Sub(c.lastNetworkTime).Seconds()
+	current := make(map[string]models.NetworkMetrics, len(netMetrics))
+
+	for i := range netMetrics {
+		metric := &netMetrics[i]
+		if prev, ok := c.lastNetworkStats[metric.Name]; ok && elapsed > 0 {
+			setNetworkRates(metric, prev, elapsed)
+		}
+		current[metric.Name] = *metric
+	}
+
+	// Replacing the map drops interfaces that have disappeared
+	c.lastNetworkStats = current
+	c.lastNetworkTime = now
+}
+
+// setNetworkRates computes per-second rates for metric relative to prev.
+// If any counter went backwards in a way that cannot be explained by a
+// 32-bit wrap the interface is assumed to have been reset and all rates
+// are left at zero.
+func setNetworkRates(metric *models.NetworkMetrics, prev models.NetworkMetrics, elapsed float64) {
+	pairs := []struct {
+		prev, cur uint64
+		rate      *float64
+	}{
+		{prev.BytesSent, metric.BytesSent, &metric.BytesSentRate},
+		{prev.BytesRecv, metric.BytesRecv, &metric.BytesRecvRate},
+		{prev.PacketsSent, metric.PacketsSent, &metric.PacketsSentRate},
+		{prev.PacketsRecv, metric.PacketsRecv, &metric.PacketsRecvRate},
+		{prev.Errin, metric.Errin, &metric.ErrinRate},
+		{prev.Errout, metric.Errout, &metric.ErroutRate},
+		{prev.Dropin, metric.Dropin, &metric.DropinRate},
+		{prev.Dropout, metric.Dropout, &metric.DropoutRate},
+	}
+
+	deltas := make([]uint64, len(pairs))
+	for i, p := range pairs {
+		delta, ok := counterDelta(p.prev, p.cur)
+		if !ok {
+			return
+		}
+		deltas[i] = delta
+	}
+
+	for i, p := range pairs {
+		*p.rate = float64(deltas[i]) / elapsed
+	}
+}
+
+// counterDelta returns the increase of a monotonic counter between two
+// samples. A decrease is treated as a 32-bit wrap when the previous value
+// was in the upper half of the 32-bit range (as on 32-bit kernels);
+// anything else is a reset and ok is false.
+func counterDelta(prev, cur uint64) (delta uint64, ok bool) {
+	if cur >= prev {
+		return cur - prev, true
+	}
+	if prev <= math.MaxUint32 && prev > math.MaxUint32/2 && cur <= math.MaxUint32/2 {
+		return cur + (math.MaxUint32 - prev) + 1, true
+	}
+	return 0, false
+}
+
 func (c *Collector) collectSystem() (models.SystemInfo, error) {
 	sysInfo := models.SystemInfo{}
+	paths, ctx := c.hostPaths()
 
-	hostInfo, err := host.Info()
+	hostInfo, err := host.InfoWithContext(ctx)
 	if err != nil {
 		return sysInfo, err
 	}
@@ -217,8 +337,16 @@ func (c *Collector) collectSystem() (models.SystemInfo, error) {
 	sysInfo.Uptime = hostInfo.Uptime
 	sysInfo.BootTime = hostInfo.BootTime
 
+	// The kernel reports this process's own UTS hostname; when watching a
+	// host from a container prefer the host's /etc/hostname
+	if paths.Etc != DefaultPaths().Etc {
+		if hostname, err := readHostname(paths.Etc); err == nil && hostname != "" {
+			sysInfo.Hostname = hostname
+		}
+	}
+
 	// Get process count
-	processes, err := process.Processes()
+	processes, err := process.PidsWithContext(ctx)
 	if err == nil {
 		sysInfo.Processes = uint64(len(processes))
 	}
@@ -228,11 +356,14 @@ func (c *Collector) collectSystem() (models.SystemInfo, error) {
 
 func (c *Collector) collectTemperature() ([]models.TempMetrics, error) {
 	var tempMetrics []models.TempMetrics
+	_, ctx := c.hostPaths()
 
 	// Temperature sensors are platform-specific
 	// This is a simplified version - real implementation would need platform-specific code
-	temps, err := host.SensorsTemperatures()
-	if err != nil {
+	// gopsutil reports unreadable sensors as warnings alongside the
+	// readable ones; only fail when nothing could be read
+	temps, err := host.SensorsTemperaturesWithContext(ctx)
+	if err != nil && len(temps) == 0 {
 		return tempMetrics, err
 	}
 
@@ -1,8 +1,14 @@
 package collector
 
 import (
+	"math"
+	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/kennethfeh/system-monitor/internal/models"
 )
 
 func TestNewCollector(t *testing.T) {
@@ -208,4 +214,116 @@ func TestShouldSkipFilesystem(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+func TestCounterDelta(t *testing.T) {
+	tests := []struct {
+		name   string
+		prev   uint64
+		cur    uint64
+		delta  uint64
+		wantOK bool
+	}{
+		{"Increase", 100, 250, 150, true},
+		{"Unchanged", 42, 42, 0, true},
+		{"32-bit wrap", math.MaxUint32 - 9, 5, 15, true},
+		{"Reset to zero", 1000, 0, 0, false},
+		{"64-bit decrease", math.MaxUint32 * 4, 10, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delta, ok := counterDelta(tt.prev, tt.cur)
+			if ok != tt.wantOK {
+				t.Fatalf("counterDelta(%d, %d) ok = %v, want %v", tt.prev, tt.cur, ok, tt.wantOK)
+			}
+			if delta != tt.delta {
+				t.Errorf("counterDelta(%d, %d) = %d, want %d", tt.prev, tt.cur, delta, tt.delta)
+			}
+		})
+	}
+}
+
+func TestApplyNetworkRates(t *testing.T) {
+	c := NewCollector()
+	start := time.Now()
+
+	first := []models.NetworkMetrics{
+		{Name: "eth0", BytesSent: 1000, BytesRecv: 2000, PacketsSent: 10, PacketsRecv: 20},
+		{Name: "eth1", BytesSent: 5000, BytesRecv: 5000},
+	}
+	c.applyNetworkRates(first, start)
+
+	if first[0].BytesSentRate != 0 || first[0].BytesRecvRate != 0 {
+		t.Error("Expected zero rates on first sample")
+	}
+
+	second := []models.NetworkMetrics{
+		{Name: "eth0", BytesSent: 3000, BytesRecv: 6000, PacketsSent: 30, PacketsRecv: 60, Errin: 2},
+		{Name: "eth1", BytesSent: 10, BytesRecv: 20},
+		{Name: "wlan0", BytesSent: 100, BytesRecv: 100},
+	}
+	c.applyNetworkRates(second, start.Add(2*time.Second))
+
+	eth0 := second[0]
+	if eth0.BytesSentRate != 1000 || eth0.BytesRecvRate != 2000 {
+		t.Errorf("Unexpected byte rates: sent=%f recv=%f", eth0.BytesSentRate, eth0.BytesRecvRate)
+	}
+	if eth0.PacketsSentRate != 10 || eth0.PacketsRecvRate != 20 {
+		t.Errorf("Unexpected packet rates: sent=%f recv=%f", eth0.PacketsSentRate, eth0.PacketsRecvRate)
+	}
+	if eth0.ErrinRate != 1 {
+		t.Errorf("Expected errin rate 1, got %f", eth0.ErrinRate)
+	}
+
+	// eth1 counters went backwards: treated as an interface reset
+	if second[1].BytesSentRate != 0 || second[1].BytesRecvRate != 0 {
+		t.Error("Expected zero rates after interface reset")
+	}
+
+	// wlan0 is new: no baseline yet
+	if second[2].BytesSentRate != 0 {
+		t.Error("Expected zero rates for newly appeared interface")
+	}
+
+	third := []models.NetworkMetrics{
+		{Name: "eth1", BytesSent: 1010, BytesRecv: 20},
+	}
+	c.applyNetworkRates(third, start.Add(3*time.Second))
+
+	if third[0].BytesSentRate != 1000 {
+		t.Errorf("Expected rate from reset baseline to be 1000, got %f", third[0].BytesSentRate)
+	}
+	if _, ok := c.lastNetworkStats["eth0"]; ok {
+		t.Error("Expected vanished interface to be dropped from baseline")
+	}
+}
+
+func TestCollectDiskPartitionError(t *testing.T) {
+	// / is the fixture root itself; /gone does not exist under it
+	root := t.TempDir()
+	writeFixture(t, root, map[string]string{
+		"proc/1/mountinfo": "1 0 8:1 / / rw - ext4 /dev/sda1 rw\n" +
+			"2 1 8:2 / /gone rw - ext4 /dev/sda2 rw\n",
+		"proc/filesystems": "\text4\n",
+	})
+
+	c := NewCollector()
+	c.SetPaths(Paths{Proc: filepath.Join(root, "proc"), Root: root})
+	for _, info := range c.Registry().Describe() {
+		c.Registry().SetEnabled(info.Name, info.Name == SourceDisk)
+	}
+
+	// The only source ran partially, which counts as a failed run
+	m, _ := c.Collect()
+	if len(m.Disk) != 1 || m.Disk[0].Mountpoint != "/" {
+		t.Errorf("Expected the readable partition to be kept, got %+v", m.Disk)
+	}
+	if len(m.Errors) != 1 || m.Errors[0].Source != SourceDisk || !strings.Contains(m.Errors[0].Error, "/gone") {
+		t.Errorf("Expected the unreadable partition to be reported, got %+v", m.Errors)
+	}
+	for _, status := range c.Status() {
+		if status.Name == SourceDisk && !strings.Contains(status.LastError, "/gone") {
+			t.Errorf("Expected the disk status to carry the error, got %+v", status)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package collector
+
+import (
+	"runtime"
+	"time"
+
+	"github.com/kennethfeh/system-monitor/internal/models"
+	"github.com/shirou/gopsutil/v3/cpu"
+)
+
+// minCPUSampleWindow is the shortest interval over which CPU utilisation is
+// computed. Callers arriving sooner than this after the previous sample get
+// the previous result instead of a noisy reading over a few clock ticks.
+const minCPUSampleWindow = 100 * time.Millisecond
+
+// cpuUsage returns per-core utilisation and per-mode breakdown computed from
+// the delta between times and the stored baseline, then makes times the new
+// baseline.
+func (c *Collector) cpuUsage(times []cpu.TimesStat, now time.Time) ([]float64, []models.CPUModeMetrics) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.lastCPUPercent != nil && len(c.lastCPUTimes) == len(times) &&
+		now.Sub(c.lastCPUTime) < minCPUSampleWindow {
+		return append([]float64(nil), c.lastCPUPercent...),
+			append([]models.CPUModeMetrics(nil), c.lastCPUModes...)
+	}
+
+	percents := make([]float64, len(times))
+	modes := make([]models.CPUModeMetrics, len(times))
+	if len(c.lastCPUTimes) == len(times) {
+		for i := range times {
+			percents[i] = cpuBusyPercent(c.lastCPUTimes[i], times[i])
+			modes[i] = cpuModePercents(c.lastCPUTimes[i], times[i])
+		}
+	}
+
+	c.lastCPUTimes = times
+	c.lastCPUTime = now
+	c.lastCPUPercent = percents
+	c.lastCPUModes = modes
+	return append([]float64(nil), percents...), append([]models.CPUModeMetrics(nil), modes...)
+}
+
+// cpuTotalAndBusy returns the total and non-idle time of a sample. On Linux
+// guest time is already accounted for in user and nice, so it is removed
+// from the total to avoid counting it twice.
+func cpuTotalAndBusy(t cpu.TimesStat) (total, busy float64) {
+	total = t.User + t.System + t.Idle + t.Nice + t.Iowait + t.Irq +
+		t.Softirq + t.Steal + t.Guest + t.GuestNice
+	if runtime.GOOS == "linux" {
+		total -= t.Guest + t.GuestNice
+	}
+	busy = total - t.Idle - t.Iowait
+	return total, busy
+}
+
+// cpuBusyPercent returns the share of time between two samples that the
+// CPU spent doing work, clamped to [0, 100].
+func cpuBusyPercent(prev, cur cpu.TimesStat) float64 {
+	prevTotal, prevBusy := cpuTotalAndBusy(prev)
+	curTotal, curBusy := cpuTotalAndBusy(cur)
+
+	if curBusy <= prevBusy {
+		return 0
+	}
+	if curTotal <= prevTotal {
+		return 100
+	}
+
+	percent := (curBusy - prevBusy) / (curTotal - prevTotal) * 100
+	if percent > 100 {
+		return 100
+	}
+	return percent
+}
+
+// cpuModePercents splits the time between two samples into the share spent
+// in each CPU mode. Guest time is reported on its own but, being part of
+// user time on Linux, is not an additional slice of the total.
+func cpuModePercents(prev, cur cpu.TimesStat) models.CPUModeMetrics {
+	prevTotal, _ := cpuTotalAndBusy(prev)
+	curTotal, _ := cpuTotalAndBusy(cur)
+
+	total := curTotal - prevTotal
+	if total <= 0 {
+		return models.CPUModeMetrics{}
+	}
+
+	share := func(prev, cur float64) float64 {
+		if cur <= prev {
+			return 0
+		}
+		return (cur - prev) / total * 100
+	}
+
+	return models.CPUModeMetrics{
+		User:    share(prev.User, cur.User),
+		Nice:    share(prev.Nice, cur.Nice),
+		System:  share(prev.System, cur.System),
+		Idle:    share(prev.Idle, cur.Idle),
+		Iowait:  share(prev.Iowait, cur.Iowait),
+		Irq:     share(prev.Irq, cur.Irq),
+		Softirq: share(prev.Softirq, cur.Softirq),
+		Steal:   share(prev.Steal, cur.Steal),
+		Guest:   share(prev.Guest+prev.GuestNice, cur.Guest+cur.GuestNice),
+	}
+}
+
+// averageCPUModes returns the machine-wide breakdown as the mean of the
+// per-core breakdowns, matching how TotalPercent is derived.
+func averageCPUModes(modes []models.CPUModeMetrics) models.CPUModeMetrics {
+	var avg models.CPUModeMetrics
+	if len(modes) == 0 {
+		return avg
+	}
+
+	for _, m := range modes {
+		avg.User += m.User
+		avg.Nice += m.Nice
+		avg.System += m.System
+		avg.Idle += m.Idle
+		avg.Iowait += m.Iowait
+		avg.Irq += m.Irq
+		avg.Softirq += m.Softirq
+		avg.Steal += m.Steal
+		avg.Guest += m.Guest
+	}
+
+	n := float64(len(modes))
+	avg.User /= n
+	avg.Nice /= n
+	avg.System /= n
+	avg.Idle /= n
+	avg.Iowait /= n
+	avg.Irq /= n
+	avg.Softirq /= n
+	avg.Steal /= n
+	avg.Guest /= n
+	return avg
+}
@@ -0,0 +1,130 @@
+package collector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kennethfeh/system-monitor/internal/models"
+	"github.com/shirou/gopsutil/v3/cpu"
+)
+
+func TestCPUBusyPercent(t *testing.T) {
+	tests := []struct {
+		name     string
+		prev     cpu.TimesStat
+		cur      cpu.TimesStat
+		expected float64
+	}{
+		{
+			"Half busy",
+			cpu.TimesStat{User: 10, System: 10, Idle: 80},
+			cpu.TimesStat{User: 15, System: 15, Idle: 90},
+			50,
+		},
+		{
+			"Iowait counts as idle",
+			cpu.TimesStat{User: 10, Idle: 80, Iowait: 10},
+			cpu.TimesStat{User: 12, Idle: 84, Iowait: 14},
+			20,
+		},
+		{
+			"No progress",
+			cpu.TimesStat{User: 10, Idle: 80},
+			cpu.TimesStat{User: 10, Idle: 80},
+			0,
+		},
+		{
+			"Fully busy",
+			cpu.TimesStat{User: 10, Steal: 5, Idle: 80},
+			cpu.TimesStat{User: 15, Steal: 10, Idle: 80},
+			100,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := cpuBusyPercent(tt.prev, tt.cur)
+			if result != tt.expected {
+				t.Errorf("cpuBusyPercent() = %f, want %f", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCPUUsageReusesRecentSample(t *testing.T) {
+	c := &Collector{}
+	start := time.Now()
+
+	c.cpuUsage([]cpu.TimesStat{{User: 0, Idle: 0}}, start)
+
+	first, _ := c.cpuUsage([]cpu.TimesStat{{User: 1, Idle: 1}}, start.Add(time.Second))
+	if first[0] != 50 {
+		t.Fatalf("Expected 50%% busy, got %f", first[0])
+	}
+
+	// A caller arriving within the minimum window gets the cached result
+	cached, _ := c.cpuUsage([]cpu.TimesStat{{User: 1, Idle: 1.01}}, start.Add(time.Second+10*time.Millisecond))
+	if cached[0] != 50 {
+		t.Errorf("Expected cached 50%% busy, got %f", cached[0])
+	}
+
+	later, _ := c.cpuUsage([]cpu.TimesStat{{User: 1, Idle: 2}}, start.Add(2*time.Second))
+	if later[0] != 0 {
+		t.Errorf("Expected 0%% busy against the original baseline, got %f", later[0])
+	}
+}
+
+func TestCollectCPUDoesNotBlock(t *testing.T) {
+	c := NewCollector()
+
+	start := time.Now()
+	if _, err := c.collectCPU(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected collectCPU to return promptly, took %v", elapsed)
+	}
+}
+
+func TestCPUModePercents(t *testing.T) {
+	prev := cpu.TimesStat{User: 100, System: 50, Idle: 800, Iowait: 20, Steal: 30, Guest: 10}
+	cur := cpu.TimesStat{User: 130, System: 60, Idle: 820, Iowait: 40, Steal: 50, Guest: 15}
+
+	modes := cpuModePercents(prev, cur)
+
+	expected := map[string][2]float64{
+		"user":   {modes.User, 30},
+		"system": {modes.System, 10},
+		"idle":   {modes.Idle, 20},
+		"iowait": {modes.Iowait, 20},
+		"steal":  {modes.Steal, 20},
+		"guest":  {modes.Guest, 5},
+	}
+	for name, v := range expected {
+		if v[0] != v[1] {
+			t.Errorf("Expected %s to be %f%%, got %f%%", name, v[1], v[0])
+		}
+	}
+
+	sum := modes.User + modes.Nice + modes.System + modes.Idle + modes.Iowait +
+		modes.Irq + modes.Softirq + modes.Steal
+	if sum < 99.999 || sum > 100.001 {
+		t.Errorf("Expected modes excluding guest to sum to 100, got %f", sum)
+	}
+}
+
+func TestAverageCPUModes(t *testing.T) {
+	avg := averageCPUModes([]models.CPUModeMetrics{
+		{User: 20, Iowait: 10, Idle: 70},
+		{User: 40, Steal: 30, Idle: 30},
+	})
+
+	if avg.User != 30 || avg.Iowait != 5 || avg.Steal != 15 || avg.Idle != 50 {
+		t.Errorf("Unexpected average breakdown: %+v", avg)
+	}
+
+	if empty := averageCPUModes(nil); empty != (models.CPUModeMetrics{}) {
+		t.Errorf("Expected zero breakdown for no cores, got %+v", empty)
+	}
+}
@@ -0,0 +1,206 @@
+package collector
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kennethfeh/system-monitor/internal/models"
+)
+
+// diskstatsSectorSize is the unit of the sector counters in /proc/diskstats,
+// which the kernel always reports in 512-byte sectors regardless of the
+// device's physical sector size.
+const diskstatsSectorSize = 512
+
+// diskstatsSample holds the raw counters of one /proc/diskstats line
+type diskstatsSample struct {
+	ReadsCompleted  uint64
+	SectorsRead     uint64
+	ReadTimeMs      uint64
+	WritesCompleted uint64
+	SectorsWritten  uint64
+	WriteTimeMs     uint64
+	InProgress      uint64
+	IOTimeMs        uint64
+	WeightedIOMs    uint64
+}
+
+// collectDiskIO reads /proc/diskstats and turns the counter deltas since the
+// previous call into per-device throughput, IOPS, latency and utilisation.
+// Devices are annotated with the mountpoints of the given partitions.
+func (c *Collector) collectDiskIO(disks []models.DiskMetrics) ([]models.DiskIOMetrics, error) {
+	paths, _ := c.hostPaths()
+
+	f, err := os.Open(filepath.Join(paths.Proc, "diskstats"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("diskstats: %w", ErrNotSupported)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	samples, err := parseDiskstats(f)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.applyDiskIORates(samples, diskMountpoints(paths.Root, disks), time.Now()), nil
+}
+
+// applyDiskIORates builds DiskIOMetrics from the current samples and the
+// stored baseline, then replaces the baseline. Devices seen for the first
+// time or whose counters were reset report zero rates.
+func (c *Collector) applyDiskIORates(samples map[string]diskstatsSample, mountpoints map[string][]string, now time.Time) []models.DiskIOMetrics {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elapsed := now.Sub(c.lastDiskIOTime)
+	names := make([]string, 0, len(samples))
+	for name := range samples {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var ioMetrics []models.DiskIOMetrics
+	for _, name := range names {
+		cur := samples[name]
+		metric := models.DiskIOMetrics{
+			Device:      name,
+			Mountpoints: mountpoints[name],
+			InProgress:  cur.InProgress,
+		}
+		if prev, ok := c.lastDiskStats[name]; ok && elapsed > 0 {
+			setDiskIORates(&metric, prev, cur, elapsed)
+		}
+		ioMetrics = append(ioMetrics, metric)
+	}
+
+	c.lastDiskStats = samples
+	c.lastDiskIOTime = now
+	return ioMetrics
+}
+
+// setDiskIORates derives the iostat-style figures for one device. A counter
+// that cannot be explained by a wrap means the device was reset, in which
+// case the metric is left with zero rates.
+func setDiskIORates(metric *models.DiskIOMetrics, prev, cur diskstatsSample, elapsed time.Duration) {
+	var d diskstatsSample
+	deltas := []struct {
+		prev, cur uint64
+		out       *uint64
+	}{
+		{prev.ReadsCompleted, cur.ReadsCompleted, &d.ReadsCompleted},
+		{prev.SectorsRead, cur.SectorsRead, &d.SectorsRead},
+		{prev.ReadTimeMs, cur.ReadTimeMs, &d.ReadTimeMs},
+		{prev.WritesCompleted, cur.WritesCompleted, &d.WritesCompleted},
+		{prev.SectorsWritten, cur.SectorsWritten, &d.SectorsWritten},
+		{prev.WriteTimeMs, cur.WriteTimeMs, &d.WriteTimeMs},
+		{prev.IOTimeMs, cur.IOTimeMs, &d.IOTimeMs},
+		{prev.WeightedIOMs, cur.WeightedIOMs, &d.WeightedIOMs},
+	}
+	for _, delta := range deltas {
+		v, ok := counterDelta(delta.prev, delta.cur)
+		if !ok {
+			return
+		}
+		*delta.out = v
+	}
+
+	seconds := elapsed.Seconds()
+	elapsedMs := float64(elapsed) / float64(time.Millisecond)
+
+	metric.ReadBytesPerSec = float64(d.SectorsRead*diskstatsSectorSize) / seconds
+	metric.WriteBytesPerSec = float64(d.SectorsWritten*diskstatsSectorSize) / seconds
+	metric.ReadOpsPerSec = float64(d.ReadsCompleted) / seconds
+	metric.WriteOpsPerSec = float64(d.WritesCompleted) / seconds
+
+	if d.ReadsCompleted > 0 {
+		metric.ReadAwaitMs = float64(d.ReadTimeMs) / float64(d.ReadsCompleted)
+	}
+	if d.WritesCompleted > 0 {
+		metric.WriteAwaitMs = float64(d.WriteTimeMs) / float64(d.WritesCompleted)
+	}
+	if ops := d.ReadsCompleted + d.WritesCompleted; ops > 0 {
+		metric.AwaitMs = float64(d.ReadTimeMs+d.WriteTimeMs) / float64(ops)
+	}
+
+	metric.QueueDepth = float64(d.WeightedIOMs) / elapsedMs
+	metric.BusyPercent = float64(d.IOTimeMs) / elapsedMs * 100
+	if metric.BusyPercent > 100 {
+		metric.BusyPercent = 100
+	}
+}
+
+// parseDiskstats parses the contents of /proc/diskstats, skipping virtual
+// devices that never carry real I/O (loop and ram disks) and devices that
+// have not done any I/O since boot.
+func parseDiskstats(r io.Reader) (map[string]diskstatsSample, error) {
+	samples := make(map[string]diskstatsSample)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 14 {
+			continue
+		}
+
+		name := fields[2]
+		if strings.HasPrefix(name, "loop") || strings.HasPrefix(name, "ram") {
+			continue
+		}
+
+		values := make([]uint64, 11)
+		for i := range values {
+			v, err := strconv.ParseUint(fields[3+i], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("diskstats %s field %d: %w", name, i+4, err)
+			}
+			values[i] = v
+		}
+
+		sample := diskstatsSample{
+			ReadsCompleted:  values[0],
+			SectorsRead:     values[2],
+			ReadTimeMs:      values[3],
+			WritesCompleted: values[4],
+			SectorsWritten:  values[6],
+			WriteTimeMs:     values[7],
+			InProgress:      values[8],
+			IOTimeMs:        values[9],
+			WeightedIOMs:    values[10],
+		}
+		if sample.ReadsCompleted == 0 && sample.WritesCompleted == 0 {
+			continue
+		}
+		samples[name] = sample
+	}
+
+	return samples, scanner.Err()
+}
+
+// diskMountpoints maps kernel block device names (as used in /proc/diskstats)
+// to the mountpoints of the partitions backed by them. Symlinked device
+// paths such as /dev/mapper/* or /dev/disk/by-uuid/* are resolved first,
+// relative to the host root filesystem.
+func diskMountpoints(root string, disks []models.DiskMetrics) map[string][]string {
+	mountpoints := make(map[string][]string)
+	for _, d := range disks {
+		device := d.Device
+		if resolved, err := filepath.EvalSymlinks(filepath.Join(root, device)); err == nil {
+			device = resolved
+		}
+		name := filepath.Base(device)
+		mountpoints[name] = append(mountpoints[name], d.Mountpoint)
+	}
+	return mountpoints
+}
@@ -0,0 +1,116 @@
+package collector
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kennethfeh/system-monitor/internal/models"
+)
+
+const diskstatsFixture = `   7       0 loop0 120 0 960 4 0 0 0 0 0 8 4 0 0 0 0
+   8       0 sda 1000 10 20000 500 2000 20 40000 1500 1 1800 2000 0 0 0 0
+   8       1 sda1 900 10 18000 450 2000 20 40000 1500 1 1700 1950 0 0 0 0
+   8      16 sdb 0 0 0 0 0 0 0 0 0 0 0
+ 253       0 dm-0 50 0 400 10 0 0 0 0 0 10 10
+`
+
+func TestParseDiskstats(t *testing.T) {
+	samples, err := parseDiskstats(strings.NewReader(diskstatsFixture))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if _, ok := samples["loop0"]; ok {
+		t.Error("Expected loop devices to be skipped")
+	}
+
+	if _, ok := samples["sdb"]; ok {
+		t.Error("Expected idle devices to be skipped")
+	}
+
+	sda, ok := samples["sda"]
+	if !ok {
+		t.Fatal("Expected sda to be parsed")
+	}
+
+	if sda.ReadsCompleted != 1000 || sda.SectorsRead != 20000 || sda.WritesCompleted != 2000 {
+		t.Errorf("Unexpected sda counters: %+v", sda)
+	}
+
+	if sda.IOTimeMs != 1800 || sda.WeightedIOMs != 2000 || sda.InProgress != 1 {
+		t.Errorf("Unexpected sda timing counters: %+v", sda)
+	}
+
+	if _, ok := samples["dm-0"]; !ok {
+		t.Error("Expected dm-0 with the short field layout to be parsed")
+	}
+}
+
+func TestApplyDiskIORates(t *testing.T) {
+	c := NewCollector()
+	start := time.Now()
+	mountpoints := map[string][]string{"sda1": {"/"}}
+
+	first := map[string]diskstatsSample{
+		"sda1": {ReadsCompleted: 100, SectorsRead: 1000, ReadTimeMs: 100, WritesCompleted: 100, SectorsWritten: 2000, WriteTimeMs: 200, IOTimeMs: 100, WeightedIOMs: 300},
+	}
+	metrics := c.applyDiskIORates(first, mountpoints, start)
+	if len(metrics) != 1 || metrics[0].ReadBytesPerSec != 0 {
+		t.Fatalf("Expected one device with zero rates on first sample, got %+v", metrics)
+	}
+
+	second := map[string]diskstatsSample{
+		"sda1": {ReadsCompleted: 300, SectorsRead: 5000, ReadTimeMs: 500, WritesCompleted: 200, SectorsWritten: 4000, WriteTimeMs: 400, IOTimeMs: 1100, WeightedIOMs: 2300, InProgress: 2},
+	}
+	metrics = c.applyDiskIORates(second, mountpoints, start.Add(2*time.Second))
+	sda1 := metrics[0]
+
+	if len(sda1.Mountpoints) != 1 || sda1.Mountpoints[0] != "/" {
+		t.Errorf("Expected sda1 to map to /, got %v", sda1.Mountpoints)
+	}
+	if sda1.ReadBytesPerSec != 4000*512/2 || sda1.WriteBytesPerSec != 2000*512/2 {
+		t.Errorf("Unexpected throughput: read=%f write=%f", sda1.ReadBytesPerSec, sda1.WriteBytesPerSec)
+	}
+	if sda1.ReadOpsPerSec != 100 || sda1.WriteOpsPerSec != 50 {
+		t.Errorf("Unexpected IOPS: read=%f write=%f", sda1.ReadOpsPerSec, sda1.WriteOpsPerSec)
+	}
+	if sda1.ReadAwaitMs != 2 || sda1.WriteAwaitMs != 2 || sda1.AwaitMs != 2 {
+		t.Errorf("Unexpected await: read=%f write=%f total=%f", sda1.ReadAwaitMs, sda1.WriteAwaitMs, sda1.AwaitMs)
+	}
+	if sda1.BusyPercent != 50 {
+		t.Errorf("Expected busy percent 50, got %f", sda1.BusyPercent)
+	}
+	if sda1.QueueDepth != 1 {
+		t.Errorf("Expected queue depth 1, got %f", sda1.QueueDepth)
+	}
+	if sda1.InProgress != 2 {
+		t.Errorf("Expected 2 in-flight requests, got %d", sda1.InProgress)
+	}
+
+	// Counters going backwards indicate a reset: no rates for this sample
+	reset := map[string]diskstatsSample{
+		"sda1": {ReadsCompleted: 5, SectorsRead: 40},
+	}
+	metrics = c.applyDiskIORates(reset, mountpoints, start.Add(3*time.Second))
+	if metrics[0].ReadOpsPerSec != 0 || metrics[0].BusyPercent != 0 {
+		t.Errorf("Expected zero rates after reset, got %+v", metrics[0])
+	}
+}
+
+func TestDiskMountpoints(t *testing.T) {
+	disks := []models.DiskMetrics{
+		{Device: "/dev/sda1", Mountpoint: "/"},
+		{Device: "/dev/sda1", Mountpoint: "/var/lib/docker"},
+		{Device: "/dev/nvme0n1p2", Mountpoint: "/home"},
+	}
+
+	mountpoints := diskMountpoints("/", disks)
+
+	if len(mountpoints["sda1"]) != 2 {
+		t.Errorf("Expected 2 mountpoints for sda1, got %v", mountpoints["sda1"])
+	}
+	if len(mountpoints["nvme0n1p2"]) != 1 || mountpoints["nvme0n1p2"][0] != "/home" {
+		t.Errorf("Expected /home for nvme0n1p2, got %v", mountpoints["nvme0n1p2"])
+	}
+}
@@ -0,0 +1,126 @@
+package collector
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kennethfeh/system-monitor/internal/models"
+	"github.com/shirou/gopsutil/v3/common"
+)
+
+// Paths locates the host filesystems the collector reads from. Overriding
+// them lets the monitor run in a container with the host's /proc, /sys,
+// /etc and root filesystem bind-mounted elsewhere, or lets tests point the
+// collector at a fixture tree.
+type Paths struct {
+	Proc string
+	Sys  string
+	Etc  string
+	Root string
+}
+
+// DefaultPaths returns the paths of the running system
+func DefaultPaths() Paths {
+	return Paths{
+		Proc: "/proc",
+		Sys:  "/sys",
+		Etc:  "/etc",
+		Root: "/",
+	}
+}
+
+// PathsFromEnv returns DefaultPaths overridden by the HOST_PROC, HOST_SYS,
+// HOST_ETC and HOST_ROOT environment variables, the same variables
+// gopsutil itself honours.
+func PathsFromEnv() Paths {
+	paths := DefaultPaths()
+	if v := os.Getenv("HOST_PROC"); v != "" {
+		paths.Proc = v
+	}
+	if v := os.Getenv("HOST_SYS"); v != "" {
+		paths.Sys = v
+	}
+	if v := os.Getenv("HOST_ETC"); v != "" {
+		paths.Etc = v
+	}
+	if v := os.Getenv("HOST_ROOT"); v != "" {
+		paths.Root = v
+	}
+	return paths
+}
+
+// withDefaults fills empty fields from DefaultPaths
+func (p Paths) withDefaults() Paths {
+	defaults := DefaultPaths()
+	if p.Proc == "" {
+		p.Proc = defaults.Proc
+	}
+	if p.Sys == "" {
+		p.Sys = defaults.Sys
+	}
+	if p.Etc == "" {
+		p.Etc = defaults.Etc
+	}
+	if p.Root == "" {
+		p.Root = defaults.Root
+	}
+	return p
+}
+
+// context returns a context that directs gopsutil's *WithContext calls at
+// these paths
+func (p Paths) context() context.Context {
+	return context.WithValue(context.Background(), common.EnvKey, common.EnvMap{
+		common.HostProcEnvKey: p.Proc,
+		common.HostSysEnvKey:  p.Sys,
+		common.HostEtcEnvKey:  p.Etc,
+		common.HostRootEnvKey: p.Root,
+	})
+}
+
+// hostPath maps an absolute path on the monitored host, such as a
+// mountpoint, to where it is visible to this process
+func (p Paths) hostPath(path string) string {
+	return filepath.Join(p.Root, path)
+}
+
+// SetPaths directs every collector at the given host filesystem paths.
+// Empty fields keep their defaults.
+func (c *Collector) SetPaths(paths Paths) {
+	paths = paths.withDefaults()
+
+	c.mu.Lock()
+	c.paths = paths
+	c.ctx = paths.context()
+
+	// Baselines taken from the old paths are meaningless for the new ones
+	c.lastNetworkStats = make(map[string]models.NetworkMetrics)
+	c.lastDiskStats = make(map[string]diskstatsSample)
+	c.procBase, c.apiProcBase = procBaseline{}, procBaseline{}
+	c.cgroupBase, c.apiCgroupBase = cgroupBaseline{}, cgroupBaseline{}
+	c.mu.Unlock()
+
+	c.resetSnapshot()
+	c.primeCPU()
+}
+
+// hostPaths returns the configured paths and the matching gopsutil context
+func (c *Collector) hostPaths() (Paths, context.Context) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.paths, c.ctx
+}
+
+// readHostname returns the monitored host's name from <etc>/hostname. It is
+// only consulted when /etc is overridden, since inside a container the
+// kernel reports the container's own UTS hostname.
+func readHostname(etc string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(etc, "hostname"))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
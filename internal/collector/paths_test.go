@@ -0,0 +1,98 @@
+package collector
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestPathsFromEnv(t *testing.T) {
+	t.Setenv("HOST_PROC", "/host/proc")
+	t.Setenv("HOST_ROOT", "/host")
+	t.Setenv("HOST_SYS", "")
+	t.Setenv("HOST_ETC", "")
+
+	paths := PathsFromEnv()
+
+	expected := Paths{Proc: "/host/proc", Sys: "/sys", Etc: "/etc", Root: "/host"}
+	if paths != expected {
+		t.Errorf("PathsFromEnv() = %+v, want %+v", paths, expected)
+	}
+}
+
+func TestHostPath(t *testing.T) {
+	tests := []struct {
+		root       string
+		mountpoint string
+		expected   string
+	}{
+		{"/", "/", "/"},
+		{"/", "/home", "/home"},
+		{"/host", "/", "/host"},
+		{"/host", "/var/lib", "/host/var/lib"},
+	}
+
+	for _, tt := range tests {
+		paths := Paths{Root: tt.root}
+		if result := paths.hostPath(tt.mountpoint); result != tt.expected {
+			t.Errorf("hostPath(%q) with root %q = %q, want %q", tt.mountpoint, tt.root, result, tt.expected)
+		}
+	}
+}
+
+func TestCollectorHonoursPaths(t *testing.T) {
+	root := t.TempDir()
+	writeFixture(t, root, map[string]string{
+		"proc/stat": "cpu  200 0 100 700 0 0 0 0 0 0\n" +
+			"cpu0 100 0 50 350 0 0 0 0 0 0\n" +
+			"cpu1 100 0 50 350 0 0 0 0 0 0\n",
+		"proc/diskstats":                       "   8       0 vdz 10 0 80 5 20 0 160 10 0 15 15\n",
+		"proc/pressure/memory":                 "some avg10=12.50 avg60=0.00 avg300=0.00 total=99\n",
+		"sys/fs/cgroup/cgroup.controllers":     "cpu memory\n",
+		"sys/fs/cgroup/fixture.slice/cpu.stat": "usage_usec 123\n",
+		"etc/hostname":                         "fixture-host\n",
+	})
+
+	c := NewCollector()
+	c.SetPaths(Paths{
+		Proc: filepath.Join(root, "proc"),
+		Sys:  filepath.Join(root, "sys"),
+		Etc:  filepath.Join(root, "etc"),
+		Root: root,
+	})
+
+	cpuMetrics, err := c.collectCPU()
+	if err != nil {
+		t.Fatalf("Unexpected CPU error: %v", err)
+	}
+	if len(cpuMetrics.UsagePercent) != 2 {
+		t.Errorf("Expected 2 cores from fixture /proc/stat, got %d", len(cpuMetrics.UsagePercent))
+	}
+
+	diskIO, err := c.collectDiskIO(nil)
+	if err != nil {
+		t.Fatalf("Unexpected disk I/O error: %v", err)
+	}
+	if len(diskIO) != 1 || diskIO[0].Device != "vdz" {
+		t.Errorf("Expected fixture device vdz, got %+v", diskIO)
+	}
+
+	psi, err := c.collectPSI()
+	if err != nil {
+		t.Fatalf("Unexpected PSI error: %v", err)
+	}
+	if psi.Memory.Some.Avg10 != 12.5 {
+		t.Errorf("Expected fixture memory pressure 12.5, got %f", psi.Memory.Some.Avg10)
+	}
+
+	cgroups, err := c.CollectCgroups()
+	if err != nil {
+		t.Fatalf("Unexpected cgroup error: %v", err)
+	}
+	if findCgroup(cgroups, "/fixture.slice") == nil {
+		t.Errorf("Expected fixture cgroup, got %+v", cgroups)
+	}
+
+	if hostname, err := readHostname(filepath.Join(root, "etc")); err != nil || hostname != "fixture-host" {
+		t.Errorf("Expected fixture hostname, got %q (%v)", hostname, err)
+	}
+}
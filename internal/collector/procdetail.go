@@ -0,0 +1,239 @@
+package collector
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/kennethfeh/system-monitor/internal/models"
+	"github.com/shirou/gopsutil/v3/net"
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// ErrProcessNotFound is returned when the requested PID does not exist
+var ErrProcessNotFound = errors.New("process not found")
+
+// rlimitNames maps gopsutil resource identifiers to the names used in
+// /proc/<pid>/limits and setrlimit(2)
+var rlimitNames = map[int32]string{
+	process.RLIMIT_CPU:        "cpu",
+	process.RLIMIT_FSIZE:      "fsize",
+	process.RLIMIT_DATA:       "data",
+	process.RLIMIT_STACK:      "stack",
+	process.RLIMIT_CORE:       "core",
+	process.RLIMIT_RSS:        "rss",
+	process.RLIMIT_NPROC:      "nproc",
+	process.RLIMIT_NOFILE:     "nofile",
+	process.RLIMIT_MEMLOCK:    "memlock",
+	process.RLIMIT_AS:         "as",
+	process.RLIMIT_LOCKS:      "locks",
+	process.RLIMIT_SIGPENDING: "sigpending",
+	process.RLIMIT_MSGQUEUE:   "msgqueue",
+	process.RLIMIT_NICE:       "nice",
+	process.RLIMIT_RTPRIO:     "rtprio",
+	process.RLIMIT_RTTIME:     "rttime",
+}
+
+// ProcessDetail returns detailed information about a single process. The
+// process environment is deliberately never read. Fields the monitor is not
+// permitted to read are left empty.
+func (c *Collector) ProcessDetail(pid int32) (models.ProcessDetail, error) {
+	detail := models.ProcessDetail{PID: pid}
+	paths, ctx := c.hostPaths()
+
+	p, err := process.NewProcessWithContext(ctx, pid)
+	if err != nil {
+		if errors.Is(err, process.ErrorProcessNotRunning) {
+			return detail, ErrProcessNotFound
+		}
+		return detail, err
+	}
+
+	var summary models.ProcessMetrics
+	fillProcessDetails(ctx, p, &summary)
+	detail.PPID = summary.PPID
+	detail.Name = summary.Name
+	detail.Cmdline = summary.Cmdline
+	detail.Username = summary.Username
+	detail.State = summary.State
+	detail.Threads = summary.Threads
+	detail.OpenFiles = summary.OpenFDs
+
+	if exe, err := p.ExeWithContext(ctx); err == nil {
+		detail.Exe = exe
+	}
+	if cwd, err := p.CwdWithContext(ctx); err == nil {
+		detail.Cwd = cwd
+	}
+	if createTime, err := p.CreateTimeWithContext(ctx); err == nil {
+		detail.StartTime = time.UnixMilli(createTime)
+	}
+	if cgroups, err := readProcessCgroups(paths.Proc, pid); err == nil {
+		detail.Cgroups = cgroups
+	}
+	if limits, err := p.RlimitWithContext(ctx); err == nil {
+		detail.Limits = convertRlimits(limits)
+	}
+	if conns, err := p.ConnectionsWithContext(ctx); err == nil {
+		detail.ListeningSockets = listeningSockets(conns)
+	}
+
+	parents, err := processParents(ctx)
+	if err == nil {
+		detail.Children = childrenOf(parents, pid)
+	}
+
+	return detail, nil
+}
+
+// ProcessTree returns the parent/child hierarchy of all processes. Processes
+// whose parent is not visible (init, kthreadd, or parents that exited while
+// the tree was being built) become roots.
+func (c *Collector) ProcessTree() ([]*models.ProcessNode, error) {
+	_, ctx := c.hostPaths()
+	procs, err := process.ProcessesWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make(map[int32]*models.ProcessNode, len(procs))
+	parents := make(map[int32]int32, len(procs))
+	for _, p := range procs {
+		node := &models.ProcessNode{PID: p.Pid}
+		if name, err := p.NameWithContext(ctx); err == nil {
+			node.Name = name
+		}
+		if ppid, err := p.PpidWithContext(ctx); err == nil {
+			parents[p.Pid] = ppid
+		}
+		nodes[p.Pid] = node
+	}
+
+	return buildProcessTree(nodes, parents), nil
+}
+
+// buildProcessTree links nodes to their parents and returns the roots.
+// Roots and children are ordered by PID.
+func buildProcessTree(nodes map[int32]*models.ProcessNode, parents map[int32]int32) []*models.ProcessNode {
+	pids := make([]int32, 0, len(nodes))
+	for pid := range nodes {
+		pids = append(pids, pid)
+	}
+	sort.Slice(pids, func(i, j int) bool { return pids[i] < pids[j] })
+
+	var roots []*models.ProcessNode
+	for _, pid := range pids {
+		node := nodes[pid]
+		parent, ok := nodes[parents[pid]]
+		if !ok || parents[pid] == pid {
+			roots = append(roots, node)
+			continue
+		}
+		parent.Children = append(parent.Children, node)
+	}
+
+	return roots
+}
+
+// processParents returns the parent PID of every running process
+func processParents(ctx context.Context) (map[int32]int32, error) {
+	procs, err := process.ProcessesWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	parents := make(map[int32]int32, len(procs))
+	for _, p := range procs {
+		if ppid, err := p.PpidWithContext(ctx); err == nil {
+			parents[p.Pid] = ppid
+		}
+	}
+	return parents, nil
+}
+
+// childrenOf returns the sorted PIDs whose parent is pid
+func childrenOf(parents map[int32]int32, pid int32) []int32 {
+	var children []int32
+	for child, parent := range parents {
+		if parent == pid && child != pid {
+			children = append(children, child)
+		}
+	}
+	sort.Slice(children, func(i, j int) bool { return children[i] < children[j] })
+	return children
+}
+
+// readProcessCgroups returns the cgroup membership lines of a process as
+// found in /proc/<pid>/cgroup, e.g. "0::/system.slice/sshd.service".
+func readProcessCgroups(proc string, pid int32) ([]string, error) {
+	f, err := os.Open(filepath.Join(proc, strconv.Itoa(int(pid)), "cgroup"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return parseProcessCgroups(f)
+}
+
+func parseProcessCgroups(r io.Reader) ([]string, error) {
+	var cgroups []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			cgroups = append(cgroups, line)
+		}
+	}
+	return cgroups, scanner.Err()
+}
+
+func convertRlimits(limits []process.RlimitStat) []models.ProcessLimit {
+	result := make([]models.ProcessLimit, 0, len(limits))
+	for _, l := range limits {
+		name, ok := rlimitNames[l.Resource]
+		if !ok {
+			name = fmt.Sprintf("resource_%d", l.Resource)
+		}
+		result = append(result, models.ProcessLimit{
+			Resource: name,
+			Soft:     l.Soft,
+			Hard:     l.Hard,
+		})
+	}
+	return result
+}
+
+// listeningSockets keeps TCP sockets in the LISTEN state and UDP sockets
+// bound without a remote peer.
+func listeningSockets(conns []net.ConnectionStat) []models.ListeningSocket {
+	var sockets []models.ListeningSocket
+	for _, conn := range conns {
+		var protocol string
+		switch {
+		case conn.Type == syscall.SOCK_STREAM && conn.Status == "LISTEN":
+			protocol = "tcp"
+		case conn.Type == syscall.SOCK_DGRAM && conn.Raddr.IP == "":
+			protocol = "udp"
+		default:
+			continue
+		}
+		if conn.Family == syscall.AF_INET6 {
+			protocol += "6"
+		}
+
+		sockets = append(sockets, models.ListeningSocket{
+			Protocol: protocol,
+			Address:  conn.Laddr.IP,
+			Port:     conn.Laddr.Port,
+		})
+	}
+	return sockets
+}
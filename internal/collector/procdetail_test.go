@@ -0,0 +1,126 @@
+package collector
+
+import (
+	"errors"
+	"math"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/kennethfeh/system-monitor/internal/models"
+	"github.com/shirou/gopsutil/v3/net"
+)
+
+func TestBuildProcessTree(t *testing.T) {
+	nodes := map[int32]*models.ProcessNode{
+		1:  {PID: 1, Name: "init"},
+		2:  {PID: 2, Name: "kthreadd"},
+		10: {PID: 10, Name: "sshd"},
+		11: {PID: 11, Name: "bash"},
+		12: {PID: 12, Name: "cron"},
+		20: {PID: 20, Name: "kworker"},
+		30: {PID: 30, Name: "orphan"},
+	}
+	parents := map[int32]int32{1: 0, 2: 0, 10: 1, 11: 10, 12: 1, 20: 2, 30: 999}
+
+	roots := buildProcessTree(nodes, parents)
+
+	if len(roots) != 3 {
+		t.Fatalf("Expected 3 roots, got %d", len(roots))
+	}
+	if roots[0].PID != 1 || roots[1].PID != 2 || roots[2].PID != 30 {
+		t.Errorf("Unexpected roots: %d, %d, %d", roots[0].PID, roots[1].PID, roots[2].PID)
+	}
+
+	initNode := roots[0]
+	if len(initNode.Children) != 2 || initNode.Children[0].PID != 10 || initNode.Children[1].PID != 12 {
+		t.Fatalf("Expected init to have children 10 and 12, got %+v", initNode.Children)
+	}
+	if len(initNode.Children[0].Children) != 1 || initNode.Children[0].Children[0].Name != "bash" {
+		t.Error("Expected bash to be a child of sshd")
+	}
+}
+
+func TestChildrenOf(t *testing.T) {
+	parents := map[int32]int32{1: 0, 5: 1, 3: 1, 4: 3}
+
+	children := childrenOf(parents, 1)
+	if len(children) != 2 || children[0] != 3 || children[1] != 5 {
+		t.Errorf("Expected children [3 5], got %v", children)
+	}
+
+	if children := childrenOf(parents, 4); len(children) != 0 {
+		t.Errorf("Expected no children, got %v", children)
+	}
+}
+
+func TestParseProcessCgroups(t *testing.T) {
+	input := "12:memory:/user.slice\n0::/user.slice/user-1000.slice/session-2.scope\n\n"
+
+	cgroups, err := parseProcessCgroups(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(cgroups) != 2 || cgroups[1] != "0::/user.slice/user-1000.slice/session-2.scope" {
+		t.Errorf("Unexpected cgroups: %v", cgroups)
+	}
+}
+
+func TestListeningSockets(t *testing.T) {
+	conns := []net.ConnectionStat{
+		{Family: syscall.AF_INET, Type: syscall.SOCK_STREAM, Status: "LISTEN", Laddr: net.Addr{IP: "0.0.0.0", Port: 8080}},
+		{Family: syscall.AF_INET, Type: syscall.SOCK_STREAM, Status: "ESTABLISHED", Laddr: net.Addr{IP: "10.0.0.1", Port: 8080}, Raddr: net.Addr{IP: "10.0.0.2", Port: 5000}},
+		{Family: syscall.AF_INET6, Type: syscall.SOCK_DGRAM, Laddr: net.Addr{IP: "::", Port: 53}},
+	}
+
+	sockets := listeningSockets(conns)
+
+	if len(sockets) != 2 {
+		t.Fatalf("Expected 2 listening sockets, got %d", len(sockets))
+	}
+	if sockets[0].Protocol != "tcp" || sockets[0].Port != 8080 {
+		t.Errorf("Unexpected TCP socket: %+v", sockets[0])
+	}
+	if sockets[1].Protocol != "udp6" || sockets[1].Port != 53 {
+		t.Errorf("Unexpected UDP socket: %+v", sockets[1])
+	}
+}
+
+func TestProcessDetail(t *testing.T) {
+	c := NewCollector()
+	pid := int32(os.Getpid())
+
+	detail, err := c.ProcessDetail(pid)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if detail.PID != pid || detail.Name == "" {
+		t.Errorf("Expected own process details, got %+v", detail)
+	}
+	if detail.StartTime.IsZero() {
+		t.Error("Expected start time to be set")
+	}
+	if detail.Threads == 0 {
+		t.Error("Expected thread count to be set")
+	}
+
+	if _, err := c.ProcessDetail(math.MaxInt32); !errors.Is(err, ErrProcessNotFound) {
+		t.Errorf("Expected ErrProcessNotFound for unknown pid, got %v", err)
+	}
+}
+
+func TestProcessTree(t *testing.T) {
+	c := NewCollector()
+
+	roots, err := c.ProcessTree()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(roots) == 0 {
+		t.Error("Expected at least one root process")
+	}
+}
@@ -0,0 +1,227 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kennethfeh/system-monitor/internal/models"
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// ProcessSortKey selects the ordering of the top-N process table
+type ProcessSortKey string
+
+const (
+	SortByCPU    ProcessSortKey = "cpu"
+	SortByMemory ProcessSortKey = "memory"
+	SortByIO     ProcessSortKey = "io"
+)
+
+// DefaultProcessLimit is the number of processes reported when no limit is given
+const DefaultProcessLimit = 10
+
+// ParseProcessSortKey validates a sort key from user input
+func ParseProcessSortKey(s string) (ProcessSortKey, error) {
+	switch key := ProcessSortKey(strings.ToLower(s)); key {
+	case SortByCPU, SortByMemory, SortByIO:
+		return key, nil
+	case "":
+		return SortByCPU, nil
+	default:
+		return "", fmt.Errorf("unknown process sort key %q (want cpu, memory or io)", s)
+	}
+}
+
+// ProcessOptions configures the top-N process collector. Zero values fall
+// back to DefaultProcessLimit and SortByCPU.
+type ProcessOptions struct {
+	Limit  int
+	SortBy ProcessSortKey
+}
+
+// procKey identifies a process across samples; the start time guards
+// against PID reuse.
+type procKey struct {
+	pid        int32
+	createTime int64
+}
+
+// procSample holds the cumulative counters of a process at one point in time
+type procSample struct {
+	cpuSeconds float64
+	readBytes  uint64
+	writeBytes uint64
+}
+
+// procBaseline is the previous sample that process rates are computed
+// against
+type procBaseline struct {
+	stats map[procKey]procSample
+	time  time.Time
+}
+
+// procEntry is a ranked candidate for the process table
+type procEntry struct {
+	proc   *process.Process
+	key    procKey
+	metric models.ProcessMetrics
+}
+
+// SetProcessOptions configures the process table embedded in SystemMetrics
+// when the processes source is enabled.
+func (c *Collector) SetProcessOptions(opts ProcessOptions) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.processOptions = opts
+}
+
+// CollectProcesses returns the top processes ordered by opts.SortBy. Rates
+// are computed against the previous call; processes seen for the first
+// time report zero CPU and I/O rates. The embedded process table keeps its
+// own baseline, so calls do not disturb its rates.
+func (c *Collector) CollectProcesses(opts ProcessOptions) ([]models.ProcessMetrics, error) {
+	return c.collectProcesses(opts, &c.apiProcBase)
+}
+
+// collectProcesses computes rates against base and replaces it
+func (c *Collector) collectProcesses(opts ProcessOptions, base *procBaseline) ([]models.ProcessMetrics, error) {
+	if opts.Limit <= 0 {
+		opts.Limit = DefaultProcessLimit
+	}
+	if opts.SortBy == "" {
+		opts.SortBy = SortByCPU
+	}
+
+	_, ctx := c.hostPaths()
+	procs, err := process.ProcessesWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	samples := make(map[procKey]procSample, len(procs))
+	entries := make([]procEntry, 0, len(procs))
+
+	for _, p := range procs {
+		createTime, err := p.CreateTimeWithContext(ctx)
+		if err != nil {
+			continue
+		}
+
+		var sample procSample
+		if times, err := p.TimesWithContext(ctx); err == nil {
+			sample.cpuSeconds = times.User + times.System
+		}
+		if io, err := p.IOCountersWithContext(ctx); err == nil {
+			sample.readBytes = io.ReadBytes
+			sample.writeBytes = io.WriteBytes
+		}
+
+		metric := models.ProcessMetrics{PID: p.Pid}
+		if memInfo, err := p.MemoryInfoWithContext(ctx); err == nil {
+			metric.RSS = memInfo.RSS
+		}
+
+		key := procKey{pid: p.Pid, createTime: createTime}
+		samples[key] = sample
+		entries = append(entries, procEntry{proc: p, key: key, metric: metric})
+	}
+
+	c.mu.Lock()
+	elapsed := now.Sub(base.time).Seconds()
+	if elapsed > 0 {
+		for i := range entries {
+			e := &entries[i]
+			if prev, ok := base.stats[e.key]; ok {
+				setProcessRates(&e.metric, prev, samples[e.key], elapsed)
+			}
+		}
+	}
+	*base = procBaseline{stats: samples, time: now}
+	c.mu.Unlock()
+
+	top := rankProcesses(entries, opts.SortBy, opts.Limit)
+
+	// Only the processes that made the cut get the more expensive details
+	result := make([]models.ProcessMetrics, 0, len(top))
+	for _, e := range top {
+		fillProcessDetails(ctx, e.proc, &e.metric)
+		result = append(result, e.metric)
+	}
+
+	return result, nil
+}
+
+// setProcessRates derives CPU and I/O rates between two samples. CPU
+// percent is relative to a single core, as in top, so a multi-threaded
+// process can exceed 100%.
+func setProcessRates(metric *models.ProcessMetrics, prev, cur procSample, elapsed float64) {
+	if cur.cpuSeconds > prev.cpuSeconds {
+		metric.CPUPercent = (cur.cpuSeconds - prev.cpuSeconds) / elapsed * 100
+	}
+	if delta, ok := counterDelta(prev.readBytes, cur.readBytes); ok {
+		metric.ReadBytesPerSec = float64(delta) / elapsed
+	}
+	if delta, ok := counterDelta(prev.writeBytes, cur.writeBytes); ok {
+		metric.WriteBytesPerSec = float64(delta) / elapsed
+	}
+}
+
+// rankProcesses sorts entries by the given key, highest first, and returns
+// at most limit of them. Ties are broken by PID for a stable ordering.
+func rankProcesses(entries []procEntry, sortBy ProcessSortKey, limit int) []procEntry {
+	value := func(m models.ProcessMetrics) float64 {
+		switch sortBy {
+		case SortByMemory:
+			return float64(m.RSS)
+		case SortByIO:
+			return m.ReadBytesPerSec + m.WriteBytesPerSec
+		default:
+			return m.CPUPercent
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		vi, vj := value(entries[i].metric), value(entries[j].metric)
+		if vi != vj {
+			return vi > vj
+		}
+		return entries[i].metric.PID < entries[j].metric.PID
+	})
+
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries
+}
+
+// fillProcessDetails populates the descriptive fields of a process. Each
+// field is best-effort: processes owned by other users or that exit
+// mid-collection simply leave the field empty.
+func fillProcessDetails(ctx context.Context, p *process.Process, metric *models.ProcessMetrics) {
+	if ppid, err := p.PpidWithContext(ctx); err == nil {
+		metric.PPID = ppid
+	}
+	if name, err := p.NameWithContext(ctx); err == nil {
+		metric.Name = name
+	}
+	if cmdline, err := p.CmdlineWithContext(ctx); err == nil {
+		metric.Cmdline = cmdline
+	}
+	if username, err := p.UsernameWithContext(ctx); err == nil {
+		metric.Username = username
+	}
+	if status, err := p.StatusWithContext(ctx); err == nil && len(status) > 0 {
+		metric.State = status[0]
+	}
+	if threads, err := p.NumThreadsWithContext(ctx); err == nil {
+		metric.Threads = threads
+	}
+	if fds, err := p.NumFDsWithContext(ctx); err == nil {
+		metric.OpenFDs = fds
+	}
+}
@@ -0,0 +1,123 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/kennethfeh/system-monitor/internal/models"
+)
+
+func TestParseProcessSortKey(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected ProcessSortKey
+		wantErr  bool
+	}{
+		{"cpu", SortByCPU, false},
+		{"MEMORY", SortByMemory, false},
+		{"io", SortByIO, false},
+		{"", SortByCPU, false},
+		{"pid", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			key, err := ParseProcessSortKey(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseProcessSortKey(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if key != tt.expected {
+				t.Errorf("ParseProcessSortKey(%q) = %q, want %q", tt.input, key, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRankProcesses(t *testing.T) {
+	newEntries := func() []procEntry {
+		return []procEntry{
+			{metric: models.ProcessMetrics{PID: 1, CPUPercent: 5, RSS: 300, ReadBytesPerSec: 10}},
+			{metric: models.ProcessMetrics{PID: 2, CPUPercent: 50, RSS: 100, WriteBytesPerSec: 500}},
+			{metric: models.ProcessMetrics{PID: 3, CPUPercent: 20, RSS: 200}},
+			{metric: models.ProcessMetrics{PID: 4, CPUPercent: 20, RSS: 50, ReadBytesPerSec: 1000}},
+		}
+	}
+
+	tests := []struct {
+		sortBy   ProcessSortKey
+		limit    int
+		expected []int32
+	}{
+		{SortByCPU, 3, []int32{2, 3, 4}},
+		{SortByMemory, 2, []int32{1, 3}},
+		{SortByIO, 10, []int32{4, 2, 1, 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.sortBy), func(t *testing.T) {
+			top := rankProcesses(newEntries(), tt.sortBy, tt.limit)
+			if len(top) != len(tt.expected) {
+				t.Fatalf("Expected %d processes, got %d", len(tt.expected), len(top))
+			}
+			for i, pid := range tt.expected {
+				if top[i].metric.PID != pid {
+					t.Errorf("Position %d: expected PID %d, got %d", i, pid, top[i].metric.PID)
+				}
+			}
+		})
+	}
+}
+
+func TestSetProcessRates(t *testing.T) {
+	var metric models.ProcessMetrics
+	prev := procSample{cpuSeconds: 10, readBytes: 1000, writeBytes: 0}
+	cur := procSample{cpuSeconds: 13, readBytes: 5000, writeBytes: 2000}
+
+	setProcessRates(&metric, prev, cur, 2)
+
+	if metric.CPUPercent != 150 {
+		t.Errorf("Expected 150%% CPU, got %f", metric.CPUPercent)
+	}
+	if metric.ReadBytesPerSec != 2000 || metric.WriteBytesPerSec != 1000 {
+		t.Errorf("Unexpected I/O rates: read=%f write=%f", metric.ReadBytesPerSec, metric.WriteBytesPerSec)
+	}
+}
+
+func TestCollectProcesses(t *testing.T) {
+	c := NewCollector()
+
+	processes, err := c.CollectProcesses(ProcessOptions{Limit: 5, SortBy: SortByMemory})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(processes) == 0 {
+		t.Fatal("Expected at least one process")
+	}
+
+	if len(processes) > 5 {
+		t.Errorf("Expected at most 5 processes, got %d", len(processes))
+	}
+
+	for i := 1; i < len(processes); i++ {
+		if processes[i].RSS > processes[i-1].RSS {
+			t.Error("Expected processes to be sorted by RSS descending")
+		}
+	}
+}
+
+func TestCollectProcessesBaseline(t *testing.T) {
+	c := NewCollector()
+
+	if _, err := c.collectProcesses(ProcessOptions{Limit: 1}, &c.procBase); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	embedded := c.procBase.time
+
+	// API calls must not reset the window of the embedded process table
+	if _, err := c.CollectProcesses(ProcessOptions{Limit: 1}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !c.procBase.time.Equal(embedded) || c.apiProcBase.time.IsZero() {
+		t.Error("Expected CollectProcesses to keep a baseline of its own")
+	}
+}
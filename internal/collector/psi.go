@@ -0,0 +1,114 @@
+package collector
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/kennethfeh/system-monitor/internal/models"
+)
+
+// errPSIUnavailable is returned when the kernel exposes no pressure files,
+// either because it predates 4.20 or was booted without psi=1
+var errPSIUnavailable = fmt.Errorf("pressure stall information: %w", ErrNotSupported)
+
+// collectPSI reads /proc/pressure/{cpu,memory,io}. Resources whose file is
+// missing are left zero; only when none can be read is an error returned.
+func (c *Collector) collectPSI() (*models.PSIMetrics, error) {
+	paths, _ := c.hostPaths()
+	psi := &models.PSIMetrics{}
+	resources := []struct {
+		name string
+		dst  *models.PSIResource
+	}{
+		{"cpu", &psi.CPU},
+		{"memory", &psi.Memory},
+		{"io", &psi.IO},
+	}
+
+	found := 0
+	for _, res := range resources {
+		resource, err := readPSIFile(filepath.Join(paths.Proc, "pressure", res.name))
+		if err != nil {
+			continue
+		}
+		*res.dst = resource
+		found++
+	}
+
+	if found == 0 {
+		return nil, errPSIUnavailable
+	}
+	return psi, nil
+}
+
+func readPSIFile(path string) (models.PSIResource, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return models.PSIResource{}, err
+	}
+	defer f.Close()
+
+	return parsePSI(f)
+}
+
+// parsePSI parses the "some" and "full" lines of a pressure file, as found
+// both in /proc/pressure and in cgroup v2 *.pressure files:
+//
+//	some avg10=0.00 avg60=0.00 avg300=0.00 total=0
+//	full avg10=0.00 avg60=0.00 avg300=0.00 total=0
+func parsePSI(r io.Reader) (models.PSIResource, error) {
+	var resource models.PSIResource
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		stats, err := parsePSIStats(fields[1:])
+		if err != nil {
+			return resource, fmt.Errorf("psi %s line: %w", fields[0], err)
+		}
+
+		switch fields[0] {
+		case "some":
+			resource.Some = stats
+		case "full":
+			resource.Full = &stats
+		}
+	}
+
+	return resource, scanner.Err()
+}
+
+func parsePSIStats(fields []string) (models.PSIStats, error) {
+	var stats models.PSIStats
+	for _, field := range fields {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return stats, fmt.Errorf("malformed field %q", field)
+		}
+
+		var err error
+		switch key {
+		case "avg10":
+			stats.Avg10, err = strconv.ParseFloat(value, 64)
+		case "avg60":
+			stats.Avg60, err = strconv.ParseFloat(value, 64)
+		case "avg300":
+			stats.Avg300, err = strconv.ParseFloat(value, 64)
+		case "total":
+			stats.TotalMicros, err = strconv.ParseUint(value, 10, 64)
+		}
+		if err != nil {
+			return stats, fmt.Errorf("field %s: %w", key, err)
+		}
+	}
+	return stats, nil
+}
@@ -0,0 +1,70 @@
+package collector
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParsePSI(t *testing.T) {
+	input := "some avg10=1.36 avg60=1.35 avg300=1.45 total=14557808\n" +
+		"full avg10=0.50 avg60=0.25 avg300=0.10 total=1490981\n"
+
+	resource, err := parsePSI(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if resource.Some.Avg10 != 1.36 || resource.Some.Avg60 != 1.35 || resource.Some.Avg300 != 1.45 {
+		t.Errorf("Unexpected some averages: %+v", resource.Some)
+	}
+	if resource.Some.TotalMicros != 14557808 {
+		t.Errorf("Expected some total 14557808, got %d", resource.Some.TotalMicros)
+	}
+
+	if resource.Full == nil {
+		t.Fatal("Expected full line to be parsed")
+	}
+	if resource.Full.Avg10 != 0.5 || resource.Full.TotalMicros != 1490981 {
+		t.Errorf("Unexpected full stats: %+v", *resource.Full)
+	}
+}
+
+func TestParsePSISomeOnly(t *testing.T) {
+	// Kernels before 5.13 have no "full" line for cpu
+	resource, err := parsePSI(strings.NewReader("some avg10=0.00 avg60=0.00 avg300=0.00 total=42\n"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if resource.Full != nil {
+		t.Error("Expected no full stats")
+	}
+	if resource.Some.TotalMicros != 42 {
+		t.Errorf("Expected some total 42, got %d", resource.Some.TotalMicros)
+	}
+}
+
+func TestParsePSIMalformed(t *testing.T) {
+	if _, err := parsePSI(strings.NewReader("some avg10=abc\n")); err == nil {
+		t.Error("Expected error for malformed value")
+	}
+	if _, err := parsePSI(strings.NewReader("some avg10\n")); err == nil {
+		t.Error("Expected error for missing value")
+	}
+}
+
+func TestCollectPSI(t *testing.T) {
+	c := NewCollector()
+
+	psi, err := c.collectPSI()
+	if err == errPSIUnavailable {
+		t.Skip("Kernel does not expose PSI")
+	}
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if psi.CPU.Some.Avg10 < 0 || psi.CPU.Some.Avg10 > 100 {
+		t.Errorf("Expected cpu some avg10 within [0, 100], got %f", psi.CPU.Some.Avg10)
+	}
+}
@@ -0,0 +1,157 @@
+package collector
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/kennethfeh/system-monitor/internal/models"
+)
+
+// MetricSource is a subsystem that contributes to a SystemMetrics snapshot.
+// Collect fills in its part of metrics; sources run in registration order,
+// so a source may read sections written by sources registered before it.
+// Sources outside this package should store their data in metrics.Custom
+// under their own name.
+type MetricSource interface {
+	Name() string
+	Describe() string
+	Collect(metrics *models.SystemMetrics) error
+}
+
+// SourceInfo describes a registered source. An empty Interval means the
+// source runs at the collector's default interval.
+type SourceInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Enabled     bool   `json:"enabled"`
+	Interval    string `json:"interval,omitempty"`
+}
+
+// funcSource adapts a function to the MetricSource interface
+type funcSource struct {
+	name        string
+	description string
+	collect     func(metrics *models.SystemMetrics) error
+}
+
+// NewSource returns a MetricSource backed by a collect function
+func NewSource(name, description string, collect func(metrics *models.SystemMetrics) error) MetricSource {
+	return &funcSource{name: name, description: description, collect: collect}
+}
+
+func (s *funcSource) Name() string                                { return s.name }
+func (s *funcSource) Describe() string                            { return s.description }
+func (s *funcSource) Collect(metrics *models.SystemMetrics) error { return s.collect(metrics) }
+
+type registryEntry struct {
+	source   MetricSource
+	enabled  bool
+	interval time.Duration
+}
+
+// Registry holds the metric sources of a Collector in registration order
+type Registry struct {
+	mu      sync.RWMutex
+	entries []*registryEntry
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register adds an enabled source. Names must be unique.
+func (r *Registry) Register(source MetricSource) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, e := range r.entries {
+		if e.source.Name() == source.Name() {
+			return fmt.Errorf("metric source %q already registered", source.Name())
+		}
+	}
+	r.entries = append(r.entries, &registryEntry{source: source, enabled: true})
+	return nil
+}
+
+// SetEnabled turns a registered source on or off
+func (r *Registry) SetEnabled(name string, enabled bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, e := range r.entries {
+		if e.source.Name() == name {
+			e.enabled = enabled
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown metric source %q", name)
+}
+
+// SetInterval sets how often a registered source is collected. Zero
+// restores the collector's default interval.
+func (r *Registry) SetInterval(name string, interval time.Duration) error {
+	if interval < 0 {
+		return fmt.Errorf("negative interval %v for metric source %q", interval, name)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, e := range r.entries {
+		if e.source.Name() == name {
+			e.interval = interval
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown metric source %q", name)
+}
+
+// Interval returns the interval configured for a source, or zero if it
+// uses the collector's default
+func (r *Registry) Interval(name string) time.Duration {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, e := range r.entries {
+		if e.source.Name() == name {
+			return e.interval
+		}
+	}
+	return 0
+}
+
+// Enabled returns the enabled sources in registration order
+func (r *Registry) Enabled() []MetricSource {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var sources []MetricSource
+	for _, e := range r.entries {
+		if e.enabled {
+			sources = append(sources, e.source)
+		}
+	}
+	return sources
+}
+
+// Describe lists every registered source with its state
+func (r *Registry) Describe() []SourceInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	infos := make([]SourceInfo, 0, len(r.entries))
+	for _, e := range r.entries {
+		info := SourceInfo{
+			Name:        e.source.Name(),
+			Description: e.source.Describe(),
+			Enabled:     e.enabled,
+		}
+		if e.interval > 0 {
+			info.Interval = e.interval.String()
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
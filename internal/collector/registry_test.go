@@ -0,0 +1,107 @@
+package collector
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kennethfeh/system-monitor/internal/models"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	noop := func(*models.SystemMetrics) error { return nil }
+
+	if err := r.Register(NewSource("a", "first", noop)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := r.Register(NewSource("b", "second", noop)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := r.Register(NewSource("a", "duplicate", noop)); err == nil {
+		t.Error("Expected error registering a duplicate name")
+	}
+
+	if err := r.SetEnabled("a", false); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := r.SetEnabled("missing", true); err == nil {
+		t.Error("Expected error for unknown source")
+	}
+
+	enabled := r.Enabled()
+	if len(enabled) != 1 || enabled[0].Name() != "b" {
+		t.Errorf("Expected only b to be enabled, got %d sources", len(enabled))
+	}
+
+	if err := r.SetInterval("b", 30*time.Second); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := r.SetInterval("b", -time.Second); err == nil {
+		t.Error("Expected error for a negative interval")
+	}
+	if err := r.SetInterval("missing", time.Second); err == nil {
+		t.Error("Expected error for unknown source")
+	}
+
+	infos := r.Describe()
+	if len(infos) != 2 || infos[0].Name != "a" || infos[0].Enabled || infos[1].Description != "second" {
+		t.Errorf("Unexpected descriptions: %+v", infos)
+	}
+	if infos[0].Interval != "" || infos[1].Interval != "30s" {
+		t.Errorf("Unexpected intervals: %q, %q", infos[0].Interval, infos[1].Interval)
+	}
+}
+
+func TestBuiltinSources(t *testing.T) {
+	c := NewCollector()
+
+	names := make(map[string]bool)
+	for _, info := range c.Registry().Describe() {
+		names[info.Name] = info.Enabled
+	}
+
+	for _, name := range []string{SourceCPU, SourceMemory, SourceDisk, SourceDiskIO, SourceNetwork, SourceSystem, SourcePSI, SourceCgroups, SourceTemperature} {
+		if enabled, ok := names[name]; !ok || !enabled {
+			t.Errorf("Expected built-in source %q to be registered and enabled", name)
+		}
+	}
+	if names[SourceProcesses] {
+		t.Error("Expected processes source to be disabled by default")
+	}
+}
+
+func TestCollectWithCustomSource(t *testing.T) {
+	c := NewCollector()
+
+	err := c.Register(NewSource("queue", "Example queue depth", func(m *models.SystemMetrics) error {
+		m.Custom["queue"] = 42
+		return nil
+	}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := c.Register(NewSource("broken", "Always fails", func(*models.SystemMetrics) error {
+		return errors.New("boom")
+	})); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := c.Registry().SetEnabled(SourceMemory, false); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	metrics, err := c.Collect()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if metrics.Custom["queue"] != 42 {
+		t.Errorf("Expected custom source data, got %v", metrics.Custom)
+	}
+	if metrics.Memory.Total != 0 {
+		t.Error("Expected disabled memory source to leave memory empty")
+	}
+	if metrics.CPU.Cores == 0 {
+		t.Error("Expected enabled CPU source to run")
+	}
+}
@@ -0,0 +1,180 @@
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kennethfeh/system-monitor/internal/models"
+)
+
+// DefaultInterval is how often sources without an interval of their own
+// are collected
+const DefaultInterval = 2 * time.Second
+
+// sourceState is the outcome of the latest run of one source
+type sourceState struct {
+	lastRun     time.Time
+	lastSuccess time.Time
+	duration    time.Duration
+	err         error
+}
+
+// SetDefaultInterval sets the interval of sources that have none configured
+// in the registry
+func (c *Collector) SetDefaultInterval(interval time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	c.defaultInterval = interval
+}
+
+// sourceInterval returns the effective interval of a source
+func (c *Collector) sourceInterval(name string) time.Duration {
+	if interval := c.registry.Interval(name); interval > 0 {
+		return interval
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.defaultInterval
+}
+
+// TickInterval is the shortest interval of any enabled source, i.e. how
+// often CollectDue needs to be called to keep every source on schedule
+func (c *Collector) TickInterval() time.Duration {
+	var tick time.Duration
+	for _, source := range c.registry.Enabled() {
+		if interval := c.sourceInterval(source.Name()); tick == 0 || interval < tick {
+			tick = interval
+		}
+	}
+	if tick == 0 {
+		tick = c.sourceInterval("")
+	}
+	return tick
+}
+
+// Collect runs every enabled source and returns the resulting snapshot. A
+// failing source is listed in metrics.Errors and keeps the section from
+// its last successful run; an error is only returned when every source
+// failed.
+func (c *Collector) Collect() (models.SystemMetrics, error) {
+	return c.collect(true)
+}
+
+// CollectDue runs only the sources whose interval has elapsed since their
+// last run, and returns a snapshot assembled from the latest data of every
+// source. SectionTimestamps tells how fresh each section is.
+func (c *Collector) CollectDue() (models.SystemMetrics, error) {
+	return c.collect(false)
+}
+
+func (c *Collector) collect(all bool) (models.SystemMetrics, error) {
+	c.collectMu.Lock()
+	defer c.collectMu.Unlock()
+
+	now := time.Now()
+	tick := c.TickInterval()
+	sources := c.registry.Enabled()
+
+	ran, failed := 0, 0
+	for _, source := range sources {
+		name := source.Name()
+		state, ok := c.sourceStates[name]
+		if !ok {
+			state = &sourceState{}
+			c.sourceStates[name] = state
+		}
+		if !all && !isDue(state.lastRun, c.sourceInterval(name), tick, now) {
+			continue
+		}
+
+		start := time.Now()
+		err := source.Collect(&c.snapshot)
+		duration := time.Since(start)
+
+		c.status.record(name, start, duration, err)
+		state.lastRun = start
+		state.duration = duration
+		state.err = err
+		ran++
+		if err != nil {
+			failed++
+		} else {
+			state.lastSuccess = start
+		}
+	}
+
+	c.mu.Lock()
+	c.lastCollectTime = time.Now()
+	c.mu.Unlock()
+
+	metrics := c.assemble(sources, now)
+	if ran > 0 && failed == ran {
+		return metrics, fmt.Errorf("all %d metric sources failed", failed)
+	}
+	return metrics, nil
+}
+
+// isDue reports whether a source last run at lastRun should run again.
+// Half a tick of slack keeps ticker jitter from pushing a source back by a
+// whole tick.
+func isDue(lastRun time.Time, interval, tick time.Duration, now time.Time) bool {
+	if lastRun.IsZero() {
+		return true
+	}
+	return now.Sub(lastRun)+tick/2 >= interval
+}
+
+// assemble copies the latest snapshot and annotates it with the duration,
+// error and collection time of each enabled source. Called with collectMu
+// held.
+func (c *Collector) assemble(sources []MetricSource, now time.Time) models.SystemMetrics {
+	metrics := c.snapshot
+	metrics.Timestamp = now
+	metrics.Errors = nil
+	metrics.CollectDurationMs = make(map[string]float64, len(sources))
+	metrics.SectionTimestamps = make(map[string]time.Time, len(sources))
+
+	// Sources keep writing to the snapshot's Custom map, so hand out a copy
+	metrics.Custom = make(map[string]interface{}, len(c.snapshot.Custom))
+	for k, v := range c.snapshot.Custom {
+		metrics.Custom[k] = v
+	}
+
+	for _, source := range sources {
+		name := source.Name()
+		state, ok := c.sourceStates[name]
+		if !ok || state.lastRun.IsZero() {
+			continue
+		}
+
+		metrics.CollectDurationMs[name] = float64(state.duration) / float64(time.Millisecond)
+		if !state.lastSuccess.IsZero() {
+			metrics.SectionTimestamps[name] = state.lastSuccess
+		}
+		if state.err != nil && !errors.Is(state.err, ErrNotSupported) {
+			metrics.Errors = append(metrics.Errors, models.CollectionError{
+				Source:    name,
+				Error:     state.err.Error(),
+				Timestamp: state.lastRun,
+			})
+		}
+	}
+
+	return metrics
+}
+
+// resetSnapshot discards the assembled snapshot and the schedule, so every
+// source runs on the next collection
+func (c *Collector) resetSnapshot() {
+	c.collectMu.Lock()
+	defer c.collectMu.Unlock()
+
+	c.snapshot = models.SystemMetrics{Custom: make(map[string]interface{})}
+	c.sourceStates = make(map[string]*sourceState)
+}
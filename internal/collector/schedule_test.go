@@ -0,0 +1,91 @@
+package collector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kennethfeh/system-monitor/internal/models"
+)
+
+func TestIsDue(t *testing.T) {
+	now := time.Now()
+	tick := time.Second
+
+	tests := []struct {
+		name     string
+		lastRun  time.Time
+		interval time.Duration
+		want     bool
+	}{
+		{"never run", time.Time{}, time.Minute, true},
+		{"interval elapsed", now.Add(-2 * time.Second), time.Second, true},
+		{"within jitter", now.Add(-990 * time.Millisecond), time.Second, true},
+		{"not yet due", now.Add(-10 * time.Second), 30 * time.Second, false},
+		{"due at half a tick", now.Add(-29600 * time.Millisecond), 30 * time.Second, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isDue(tt.lastRun, tt.interval, tick, now); got != tt.want {
+				t.Errorf("isDue() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCollectDue(t *testing.T) {
+	c := NewCollector()
+	for _, info := range c.Registry().Describe() {
+		c.Registry().SetEnabled(info.Name, false)
+	}
+
+	fastRuns, slowRuns := 0, 0
+	c.Register(NewSource("fast", "Runs every collection", func(m *models.SystemMetrics) error {
+		fastRuns++
+		m.Custom["fast"] = fastRuns
+		return nil
+	}))
+	c.Register(NewSource("slow", "Runs rarely", func(m *models.SystemMetrics) error {
+		slowRuns++
+		m.Custom["slow"] = slowRuns
+		return nil
+	}))
+	c.SetDefaultInterval(time.Millisecond)
+	if err := c.Registry().SetInterval("slow", time.Hour); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	first, err := c.CollectDue()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	second, err := c.CollectDue()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if fastRuns != 2 || slowRuns != 1 {
+		t.Errorf("Expected fast to run twice and slow once, got %d and %d", fastRuns, slowRuns)
+	}
+	if second.Custom["slow"] != 1 {
+		t.Errorf("Expected the slow section to be carried over, got %v", second.Custom["slow"])
+	}
+	if first.Custom["fast"] != 1 {
+		t.Errorf("Expected earlier snapshots to be unaffected by later runs, got %v", first.Custom["fast"])
+	}
+	if !second.SectionTimestamps["slow"].Before(second.SectionTimestamps["fast"]) {
+		t.Errorf("Expected the slow section to be older, got %v", second.SectionTimestamps)
+	}
+	if c.TickInterval() != time.Millisecond {
+		t.Errorf("Expected tick interval of the fastest source, got %v", c.TickInterval())
+	}
+
+	// Collect ignores the schedule
+	if _, err := c.Collect(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if slowRuns != 2 {
+		t.Errorf("Expected Collect to run every source, slow ran %d times", slowRuns)
+	}
+}
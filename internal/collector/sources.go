@@ -0,0 +1,127 @@
+package collector
+
+import (
+	"runtime"
+
+	"github.com/kennethfeh/system-monitor/internal/models"
+)
+
+// Names of the built-in metric sources
+const (
+	SourceCPU         = "cpu"
+	SourceMemory      = "memory"
+	SourceDisk        = "disk"
+	SourceDiskIO      = "diskio"
+	SourceNetwork     = "network"
+	SourceSystem      = "system"
+	SourcePSI         = "psi"
+	SourceCgroups     = "cgroups"
+	SourceProcesses   = "processes"
+	SourceTemperature = "temperature"
+)
+
+// registerBuiltinSources registers the collectors shipped with the package.
+// The process table is registered disabled as it is comparatively costly.
+func (c *Collector) registerBuiltinSources() {
+	builtins := []MetricSource{
+		NewSource(SourceCPU, "Per-core and total CPU utilisation, time by mode and load average", func(m *models.SystemMetrics) error {
+			cpuMetrics, err := c.collectCPU()
+			if err != nil {
+				// Provide fallback CPU metrics, flagged so consumers do
+				// not mistake the missing reading for an idle machine
+				m.CPU = models.CPUMetrics{
+					Cores:       runtime.NumCPU(),
+					Unavailable: true,
+				}
+				return err
+			}
+			m.CPU = cpuMetrics
+			return nil
+		}),
+		NewSource(SourceMemory, "Virtual memory and swap usage", func(m *models.SystemMetrics) error {
+			memMetrics, err := c.collectMemory()
+			if err != nil {
+				return err
+			}
+			m.Memory = memMetrics
+			return nil
+		}),
+		NewSource(SourceDisk, "Filesystem capacity per mounted partition", func(m *models.SystemMetrics) error {
+			// Partitions that could be read are kept when others fail
+			diskMetrics, err := c.collectDisk()
+			if err != nil && len(diskMetrics) == 0 {
+				return err
+			}
+			m.Disk = diskMetrics
+			return err
+		}),
+		NewSource(SourceDiskIO, "Block device throughput, IOPS, latency and utilisation from /proc/diskstats", func(m *models.SystemMetrics) error {
+			diskIOMetrics, err := c.collectDiskIO(m.Disk)
+			if err != nil {
+				return err
+			}
+			m.DiskIO = diskIOMetrics
+			return nil
+		}),
+		NewSource(SourceNetwork, "Network interface counters and rates", func(m *models.SystemMetrics) error {
+			netMetrics, err := c.collectNetwork()
+			if err != nil {
+				return err
+			}
+			m.Network = netMetrics
+			return nil
+		}),
+		NewSource(SourceSystem, "Host, OS, uptime and process count", func(m *models.SystemMetrics) error {
+			sysInfo, err := c.collectSystem()
+			if err != nil {
+				return err
+			}
+			m.System = sysInfo
+			return nil
+		}),
+		NewSource(SourcePSI, "Linux pressure stall information from /proc/pressure", func(m *models.SystemMetrics) error {
+			psiMetrics, err := c.collectPSI()
+			if err != nil {
+				return err
+			}
+			m.PSI = psiMetrics
+			return nil
+		}),
+		NewSource(SourceCgroups, "Per-cgroup CPU, memory, I/O and pids accounting", func(m *models.SystemMetrics) error {
+			cgroupMetrics, err := c.collectCgroups(&c.cgroupBase)
+			if err != nil {
+				return err
+			}
+			m.Cgroups = cgroupMetrics
+			return nil
+		}),
+		NewSource(SourceProcesses, "Top processes by CPU, memory or I/O", func(m *models.SystemMetrics) error {
+			c.mu.Lock()
+			opts := c.processOptions
+			c.mu.Unlock()
+
+			procMetrics, err := c.collectProcesses(opts, &c.procBase)
+			if err != nil {
+				return err
+			}
+			m.Processes = procMetrics
+			return nil
+		}),
+		NewSource(SourceTemperature, "Hardware temperature sensors", func(m *models.SystemMetrics) error {
+			tempMetrics, err := c.collectTemperature()
+			if err != nil {
+				return err
+			}
+			if len(tempMetrics) > 0 {
+				m.Temperature = tempMetrics
+			}
+			return nil
+		}),
+	}
+
+	for _, source := range builtins {
+		// Names are unique constants, so registration cannot fail
+		_ = c.registry.Register(source)
+	}
+	_ = c.registry.SetEnabled(SourceProcesses, false)
+}
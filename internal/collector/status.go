@@ -0,0 +1,105 @@
+package collector
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/kennethfeh/system-monitor/internal/models"
+)
+
+// ErrNotSupported marks a source that cannot run on this host, such as PSI
+// on an old kernel. Such failures are tracked in the source status but are
+// not reported as errors in every snapshot.
+var ErrNotSupported = errors.New("not supported on this system")
+
+// maxRecentErrors bounds the error history kept per source
+const maxRecentErrors = 10
+
+// SourceStatus summarises the recent health of one metric source. LastRun
+// and LastErrorTime are nil until the source has run or failed.
+type SourceStatus struct {
+	Name                string                   `json:"name"`
+	Enabled             bool                     `json:"enabled"`
+	Interval            string                   `json:"interval,omitempty"`
+	Supported           bool                     `json:"supported"`
+	Runs                uint64                   `json:"runs"`
+	Failures            uint64                   `json:"failures"`
+	ConsecutiveFailures uint64                   `json:"consecutive_failures"`
+	LastRun             *time.Time               `json:"last_run,omitempty"`
+	LastDurationMs      float64                  `json:"last_duration_ms"`
+	LastError           string                   `json:"last_error,omitempty"`
+	LastErrorTime       *time.Time               `json:"last_error_time,omitempty"`
+	RecentErrors        []models.CollectionError `json:"recent_errors,omitempty"`
+}
+
+// statusTracker records the outcome of every source run
+type statusTracker struct {
+	mu      sync.Mutex
+	sources map[string]*SourceStatus
+}
+
+func newStatusTracker() *statusTracker {
+	return &statusTracker{sources: make(map[string]*SourceStatus)}
+}
+
+// record stores the outcome of one run of a source
+func (t *statusTracker) record(name string, start time.Time, duration time.Duration, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	status, ok := t.sources[name]
+	if !ok {
+		status = &SourceStatus{Name: name}
+		t.sources[name] = status
+	}
+
+	status.Runs++
+	status.LastRun = &start
+	status.LastDurationMs = float64(duration) / float64(time.Millisecond)
+	status.Supported = !errors.Is(err, ErrNotSupported)
+
+	if err == nil {
+		status.ConsecutiveFailures = 0
+		return
+	}
+
+	status.Failures++
+	status.ConsecutiveFailures++
+	status.LastError = err.Error()
+	status.LastErrorTime = &start
+
+	status.RecentErrors = append(status.RecentErrors, models.CollectionError{
+		Source:    name,
+		Error:     err.Error(),
+		Timestamp: start,
+	})
+	if len(status.RecentErrors) > maxRecentErrors {
+		status.RecentErrors = status.RecentErrors[len(status.RecentErrors)-maxRecentErrors:]
+	}
+}
+
+// snapshot returns a copy of the status of the given sources, in order.
+// Sources that have never run are reported with zero counters.
+func (t *statusTracker) snapshot(infos []SourceInfo) []SourceStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	result := make([]SourceStatus, 0, len(infos))
+	for _, info := range infos {
+		status := SourceStatus{Name: info.Name, Supported: true}
+		if s, ok := t.sources[info.Name]; ok {
+			status = *s
+			status.RecentErrors = append([]models.CollectionError(nil), s.RecentErrors...)
+		}
+		status.Enabled = info.Enabled
+		status.Interval = info.Interval
+		result = append(result, status)
+	}
+	return result
+}
+
+// Status reports the recent health of every registered source
+func (c *Collector) Status() []SourceStatus {
+	return c.status.snapshot(c.registry.Describe())
+}
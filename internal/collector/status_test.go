@@ -0,0 +1,127 @@
+package collector
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kennethfeh/system-monitor/internal/models"
+)
+
+func TestStatusTracker(t *testing.T) {
+	tracker := newStatusTracker()
+	now := time.Now()
+
+	tracker.record("disk", now, 5*time.Millisecond, nil)
+	tracker.record("disk", now, 5*time.Millisecond, errors.New("statfs failed"))
+	tracker.record("disk", now, 5*time.Millisecond, errors.New("statfs failed again"))
+
+	for i := 0; i < maxRecentErrors+5; i++ {
+		tracker.record("sensor", now, time.Millisecond, errors.New("read failed"))
+	}
+
+	tracker.record("psi", now, time.Millisecond, fmt.Errorf("psi: %w", ErrNotSupported))
+
+	statuses := tracker.snapshot([]SourceInfo{
+		{Name: "disk", Enabled: true},
+		{Name: "sensor", Enabled: true},
+		{Name: "psi", Enabled: true},
+		{Name: "never", Enabled: false},
+	})
+
+	disk := statuses[0]
+	if disk.Runs != 3 || disk.Failures != 2 || disk.ConsecutiveFailures != 2 {
+		t.Errorf("Unexpected disk counters: %+v", disk)
+	}
+	if disk.LastError != "statfs failed again" || disk.LastDurationMs != 5 || disk.LastRun == nil || !disk.LastErrorTime.Equal(now) {
+		t.Errorf("Unexpected disk last run: %+v", disk)
+	}
+
+	if len(statuses[1].RecentErrors) != maxRecentErrors {
+		t.Errorf("Expected recent errors to be capped at %d, got %d", maxRecentErrors, len(statuses[1].RecentErrors))
+	}
+
+	if statuses[2].Supported {
+		t.Error("Expected psi to be marked unsupported")
+	}
+
+	if never := statuses[3]; never.Runs != 0 || never.Enabled || !never.Supported {
+		t.Errorf("Unexpected status for source that never ran: %+v", never)
+	}
+	data, err := json.Marshal(statuses[3])
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if strings.Contains(string(data), "last_run") || strings.Contains(string(data), "last_error_time") {
+		t.Errorf("Expected no times for a source that never ran, got %s", data)
+	}
+}
+
+func TestCollectReportsErrors(t *testing.T) {
+	c := NewCollector()
+	c.Register(NewSource("broken", "Always fails", func(*models.SystemMetrics) error {
+		return errors.New("boom")
+	}))
+	c.Register(NewSource("unsupported", "Never available", func(*models.SystemMetrics) error {
+		return fmt.Errorf("feature: %w", ErrNotSupported)
+	}))
+
+	metrics, err := c.Collect()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var found bool
+	for _, e := range metrics.Errors {
+		if e.Source == "unsupported" {
+			t.Error("Expected unsupported sources not to be reported as errors")
+		}
+		if e.Source == "broken" && e.Error == "boom" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Expected broken source in errors, got %+v", metrics.Errors)
+	}
+
+	if _, ok := metrics.CollectDurationMs[SourceCPU]; !ok {
+		t.Error("Expected a duration for the cpu source")
+	}
+
+	for _, status := range c.Status() {
+		if status.Name == "broken" && status.Failures != 1 {
+			t.Errorf("Expected one recorded failure, got %d", status.Failures)
+		}
+	}
+}
+
+func TestCollectAllSourcesFailed(t *testing.T) {
+	c := NewCollector()
+	for _, info := range c.Registry().Describe() {
+		c.Registry().SetEnabled(info.Name, false)
+	}
+	c.Register(NewSource("broken", "Always fails", func(*models.SystemMetrics) error {
+		return errors.New("boom")
+	}))
+
+	if _, err := c.Collect(); err == nil {
+		t.Error("Expected an error when every source fails")
+	}
+}
+
+func TestCPUFallbackFlaggedUnavailable(t *testing.T) {
+	c := NewCollector()
+	c.SetPaths(Paths{Proc: t.TempDir()})
+
+	metrics, _ := c.Collect()
+
+	if !metrics.CPU.Unavailable {
+		t.Error("Expected CPU to be flagged unavailable when /proc/stat is missing")
+	}
+	if metrics.CPU.Cores == 0 {
+		t.Error("Expected fallback core count")
+	}
+}
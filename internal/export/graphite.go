@@ -0,0 +1,156 @@
+package export
+
+import (
+	"bytes"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kennethfeh/system-monitor/internal/models"
+)
+
+// GraphiteOptions configures a GraphiteWriter
+type GraphiteOptions struct {
+	// Address is the host:port of the plaintext listener, usually 2003
+	Address string
+	// Prefix replaces the "sysmon" namespace as the first path node
+	Prefix string
+	// Tags are added to every metric, e.g. host
+	Tags []Label
+	// Tagged sends labels and tags as Graphite 1.1 tags. Otherwise their
+	// values become path nodes: tags after the prefix, labels after the
+	// metric name.
+	Tagged bool
+
+	Timeout   time.Duration
+	QueueSize int
+}
+
+// GraphiteWriter sends snapshots to Graphite over the plaintext protocol.
+// The connection is kept open and re-established after a failure.
+type GraphiteWriter struct {
+	*queuedSink
+	opts GraphiteOptions
+	conn net.Conn
+}
+
+// NewGraphiteWriter validates opts and starts writing in the background.
+// The first connection is made on the first write.
+func NewGraphiteWriter(opts GraphiteOptions) (*GraphiteWriter, error) {
+	if _, _, err := net.SplitHostPort(opts.Address); err != nil {
+		return nil, err
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+
+	w := &GraphiteWriter{opts: opts}
+	w.queuedSink = newQueuedSink("Graphite", opts.QueueSize, w.write, w.closeConn)
+	return w, nil
+}
+
+func (w *GraphiteWriter) closeConn() error {
+	if w.conn != nil {
+		return w.conn.Close()
+	}
+	return nil
+}
+
+// write sends a snapshot, reconnecting once if the connection was lost
+func (w *GraphiteWriter) write(m models.SystemMetrics) error {
+	lines := encodeGraphite(m, w.opts)
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if w.conn == nil {
+			if w.conn, err = net.DialTimeout("tcp", w.opts.Address, w.opts.Timeout); err != nil {
+				w.conn = nil
+				return err
+			}
+		}
+		w.conn.SetWriteDeadline(time.Now().Add(w.opts.Timeout))
+		if _, err = w.conn.Write(lines); err == nil {
+			return nil
+		}
+		w.conn.Close()
+		w.conn = nil
+	}
+	return err
+}
+
+// graphiteNode replaces the characters that separate or break path nodes
+func graphiteNode(s string) string {
+	if s == "" {
+		return "_"
+	}
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-', r == ':':
+			return r
+		default:
+			return '_'
+		}
+	}, s)
+}
+
+// graphiteTagValue replaces the characters tag values may not contain
+func graphiteTagValue(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == ';' || r == '~' || r == ' ' || r == '\n' {
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+// encodeGraphite serialises a snapshot as plaintext lines with second
+// timestamps. NaN and infinite values are skipped.
+func encodeGraphite(m models.SystemMetrics, opts GraphiteOptions) []byte {
+	ts := strconv.FormatInt(m.Timestamp.Unix(), 10)
+
+	prefix := opts.Prefix
+	if !opts.Tagged {
+		for _, tag := range opts.Tags {
+			if tag.Value != "" {
+				prefix = joinPath(prefix, graphiteNode(tag.Value))
+			}
+		}
+	}
+
+	var b bytes.Buffer
+	for _, f := range Families(m) {
+		name := joinPath(prefix, strings.TrimPrefix(sampleName(f), Namespace+"_"))
+		for _, s := range f.Samples {
+			if math.IsNaN(s.Value) || math.IsInf(s.Value, 0) {
+				continue
+			}
+
+			b.WriteString(name)
+			if opts.Tagged {
+				for _, l := range sortLabels(append(append([]Label(nil), opts.Tags...), s.Labels...)) {
+					if l.Value != "" {
+						b.WriteString(";" + l.Name + "=" + graphiteTagValue(l.Value))
+					}
+				}
+			} else {
+				for _, l := range s.Labels {
+					b.WriteString("." + graphiteNode(l.Value))
+				}
+			}
+			b.WriteByte(' ')
+			b.WriteString(strconv.FormatFloat(s.Value, 'g', -1, 64))
+			b.WriteByte(' ')
+			b.WriteString(ts)
+			b.WriteByte('\n')
+		}
+	}
+	return b.Bytes()
+}
+
+func joinPath(prefix, node string) string {
+	if prefix == "" {
+		return node
+	}
+	return prefix + "." + node
+}
@@ -0,0 +1,90 @@
+package export
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncodeGraphite(t *testing.T) {
+	opts := GraphiteOptions{Prefix: "sysmon", Tags: []Label{{"host", "web.1"}}}
+	out := string(encodeGraphite(testSnapshot(), opts))
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	for _, w := range []string{
+		"sysmon.web_1.memory_total_bytes 1.073741824e+09 1704067200",
+		"sysmon.web_1.filesystem_size_bytes._dev_sda1._.ext4 100 1704067200",
+	} {
+		if !containsLine(lines, w) {
+			t.Errorf("Expected line %q in:\n%s", w, out)
+		}
+	}
+
+	opts.Tagged = true
+	out = string(encodeGraphite(testSnapshot(), opts))
+	lines = strings.Split(strings.TrimSpace(out), "\n")
+	for _, w := range []string{
+		"sysmon.memory_total_bytes;host=web.1 1.073741824e+09 1704067200",
+		"sysmon.filesystem_size_bytes;device=/dev/sda1;fstype=ext4;host=web.1;mountpoint=/ 100 1704067200",
+	} {
+		if !containsLine(lines, w) {
+			t.Errorf("Expected line %q in:\n%s", w, out)
+		}
+	}
+}
+
+func TestGraphiteReconnect(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer ln.Close()
+
+	lines := make(chan string, 1000)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			// Read one line and hang up, so each write needs a fresh
+			// connection
+			go func(conn net.Conn) {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				if line, err := r.ReadString('\n'); err == nil {
+					lines <- line
+				}
+			}(conn)
+		}
+	}()
+
+	w, err := NewGraphiteWriter(GraphiteOptions{Address: ln.Addr().String(), Prefix: "sysmon"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	w.Push(testSnapshot())
+	waitFor(t, "the first snapshot", func() bool { return len(lines) == 1 })
+
+	// The server closed the connection; give the writer time to notice
+	time.Sleep(20 * time.Millisecond)
+	for i := 0; i < 3 && len(lines) < 2; i++ {
+		w.Push(testSnapshot())
+		time.Sleep(20 * time.Millisecond)
+	}
+	w.Close()
+
+	if len(lines) < 2 {
+		t.Fatalf("Expected the writer to reconnect, got %d lines", len(lines))
+	}
+	if line := <-lines; !strings.HasPrefix(line, "sysmon.") {
+		t.Errorf("Unexpected line %q", line)
+	}
+}
+
+func TestGraphiteInvalidAddress(t *testing.T) {
+	if _, err := NewGraphiteWriter(GraphiteOptions{Address: "graphite"}); err == nil {
+		t.Error("Expected an address without a port to be rejected")
+	}
+}
@@ -0,0 +1,198 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kennethfeh/system-monitor/internal/models"
+)
+
+// DefaultInfluxPacketSize keeps UDP datagrams within a typical MTU
+const DefaultInfluxPacketSize = 1400
+
+// InfluxOptions configures an InfluxWriter
+type InfluxOptions struct {
+	// URL is the HTTP write endpoint including its query, e.g.
+	// http://influx:8086/write?db=metrics for InfluxDB 1.x or
+	// http://influx:8086/api/v2/write?org=o&bucket=b for 2.x, or
+	// udp://influx:8089 for the UDP listener
+	URL string
+	// Token is sent as "Authorization: Token <token>" over HTTP
+	Token string
+	// Tags are added to every point, e.g. host
+	Tags []Label
+	// Prefix replaces the "sysmon" namespace of measurement names
+	Prefix string
+
+	Timeout time.Duration
+	// PacketSize bounds UDP datagrams; points are never split
+	PacketSize int
+	QueueSize  int
+}
+
+// InfluxWriter sends snapshots to InfluxDB in line protocol, one point per
+// series with the value in the "value" field
+type InfluxWriter struct {
+	*queuedSink
+	opts   InfluxOptions
+	client *http.Client
+	conn   net.Conn
+}
+
+// NewInfluxWriter validates opts and starts writing in the background
+func NewInfluxWriter(opts InfluxOptions) (*InfluxWriter, error) {
+	u, err := url.Parse(opts.URL)
+	if err != nil {
+		return nil, fmt.Errorf("influx URL: %w", err)
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	if opts.PacketSize <= 0 {
+		opts.PacketSize = DefaultInfluxPacketSize
+	}
+
+	w := &InfluxWriter{opts: opts}
+	switch u.Scheme {
+	case "http", "https":
+		w.client = &http.Client{Timeout: opts.Timeout}
+	case "udp":
+		if w.conn, err = net.Dial("udp", u.Host); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("influx URL %q must be http, https or udp", opts.URL)
+	}
+
+	w.queuedSink = newQueuedSink("Influx", opts.QueueSize, w.write, w.closeConn)
+	return w, nil
+}
+
+func (w *InfluxWriter) closeConn() error {
+	if w.conn != nil {
+		return w.conn.Close()
+	}
+	return nil
+}
+
+func (w *InfluxWriter) write(m models.SystemMetrics) error {
+	lines := encodeInflux(m, w.opts.Prefix, w.opts.Tags)
+	if w.conn != nil {
+		return w.writeUDP(lines)
+	}
+	return w.writeHTTP(lines)
+}
+
+func (w *InfluxWriter) writeHTTP(body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), w.opts.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.opts.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if w.opts.Token != "" {
+		req.Header.Set("Authorization", "Token "+w.opts.Token)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("write returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// writeUDP sends the lines in datagrams of up to PacketSize bytes, split
+// at line boundaries
+func (w *InfluxWriter) writeUDP(lines []byte) error {
+	return splitPackets(lines, w.opts.PacketSize, func(packet []byte) error {
+		_, err := w.conn.Write(packet)
+		return err
+	})
+}
+
+// splitPackets calls send with consecutive runs of whole lines of at most
+// size bytes. A line longer than size is sent on its own.
+func splitPackets(lines []byte, size int, send func([]byte) error) error {
+	for len(lines) > 0 {
+		n := 0
+		for n < len(lines) {
+			end := bytes.IndexByte(lines[n:], '\n')
+			if end < 0 {
+				end = len(lines) - n - 1
+			}
+			if n > 0 && n+end+1 > size {
+				break
+			}
+			n += end + 1
+		}
+		if err := send(lines[:n]); err != nil {
+			return err
+		}
+		lines = lines[n:]
+	}
+	return nil
+}
+
+// prefixed returns a family's sample name with the namespace replaced by
+// prefix, joined with sep; an empty prefix drops the namespace
+func prefixed(f Family, prefix, sep string) string {
+	name := strings.TrimPrefix(sampleName(f), Namespace+"_")
+	if prefix == "" {
+		return name
+	}
+	return prefix + sep + name
+}
+
+var (
+	influxMeasurementEscaper = strings.NewReplacer(`,`, `\,`, ` `, `\ `, "\n", `\n`)
+	influxTagEscaper         = strings.NewReplacer(`,`, `\,`, `=`, `\=`, ` `, `\ `, "\n", `\n`)
+)
+
+// encodeInflux serialises a snapshot as line protocol with nanosecond
+// timestamps. Line protocol has no NaN or infinity, so such values are
+// skipped, as are empty tag values.
+func encodeInflux(m models.SystemMetrics, prefix string, tags []Label) []byte {
+	ts := strconv.FormatInt(m.Timestamp.UnixNano(), 10)
+	var b bytes.Buffer
+	for _, f := range Families(m) {
+		measurement := influxMeasurementEscaper.Replace(prefixed(f, prefix, "_"))
+		for _, s := range f.Samples {
+			if math.IsNaN(s.Value) || math.IsInf(s.Value, 0) {
+				continue
+			}
+
+			b.WriteString(measurement)
+			for _, l := range sortLabels(append(append([]Label(nil), tags...), s.Labels...)) {
+				if l.Value == "" {
+					continue
+				}
+				b.WriteByte(',')
+				b.WriteString(influxTagEscaper.Replace(l.Name))
+				b.WriteByte('=')
+				b.WriteString(influxTagEscaper.Replace(l.Value))
+			}
+			b.WriteString(" value=")
+			b.WriteString(strconv.FormatFloat(s.Value, 'g', -1, 64))
+			b.WriteByte(' ')
+			b.WriteString(ts)
+			b.WriteByte('\n')
+		}
+	}
+	return b.Bytes()
+}
@@ -0,0 +1,138 @@
+package export
+
+import (
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kennethfeh/system-monitor/internal/models"
+)
+
+func TestEncodeInflux(t *testing.T) {
+	m := models.SystemMetrics{
+		Timestamp: time.Unix(1700000000, 5),
+		Memory:    models.MemoryMetrics{Total: 1024},
+		Disk:      []models.DiskMetrics{{Device: "/dev/sda1", Mountpoint: "/mnt/my disk", Total: 100}},
+		Custom:    map[string]interface{}{"app": map[string]interface{}{"nan": math.NaN(), "ok": 1.0}},
+	}
+	out := string(encodeInflux(m, "host", []Label{{"host", "web,1"}, {"device", "configured"}}))
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+
+	// The device label of a filesystem overrides the configured tag
+	want := []string{
+		`host_memory_total_bytes,device=configured,host=web\,1 value=1024 1700000000000000005`,
+		`host_filesystem_size_bytes,device=/dev/sda1,host=web\,1,mountpoint=/mnt/my\ disk value=100 1700000000000000005`,
+	}
+	for _, w := range want {
+		if !containsLine(lines, w) {
+			t.Errorf("Expected line %q in:\n%s", w, out)
+		}
+	}
+	for _, line := range lines {
+		if strings.Contains(line, "field=nan") {
+			t.Errorf("Expected NaN values to be skipped, got %q", line)
+		}
+	}
+
+	// An empty prefix drops the namespace
+	out = string(encodeInflux(m, "", nil))
+	if !strings.HasPrefix(out, "memory_total_bytes value=1024 ") && !strings.Contains(out, "\nmemory_total_bytes value=1024 ") {
+		t.Errorf("Expected unprefixed measurement names, got:\n%s", out)
+	}
+}
+
+func containsLine(lines []string, want string) bool {
+	for _, line := range lines {
+		if line == want {
+			return true
+		}
+	}
+	return false
+}
+
+func TestSplitPackets(t *testing.T) {
+	lines := []byte("aaaa\nbbbb\ncccccccccccc\ndd\n")
+	var packets []string
+	err := splitPackets(lines, 10, func(p []byte) error {
+		packets = append(packets, string(p))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := []string{"aaaa\nbbbb\n", "cccccccccccc\n", "dd\n"}
+	if strings.Join(packets, "|") != strings.Join(want, "|") {
+		t.Errorf("Expected packets %q, got %q", want, packets)
+	}
+}
+
+func TestInfluxHTTP(t *testing.T) {
+	var mu sync.Mutex
+	var auth, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		auth, body = r.Header.Get("Authorization"), string(b)
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	w, err := NewInfluxWriter(InfluxOptions{URL: server.URL + "/api/v2/write?org=o&bucket=b", Token: "secret", Prefix: "sysmon"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	w.Push(remoteTestMetric(1))
+	w.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if auth != "Token secret" {
+		t.Errorf("Expected the token to be sent, got %q", auth)
+	}
+	if !strings.Contains(body, "sysmon_network_receive_bytes_total,interface=eth0 value=1 ") {
+		t.Errorf("Unexpected body:\n%s", body)
+	}
+}
+
+func TestInfluxUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer conn.Close()
+
+	w, err := NewInfluxWriter(InfluxOptions{URL: "udp://" + conn.LocalAddr().String(), PacketSize: 200})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	w.Push(remoteTestMetric(1))
+	w.Close()
+
+	want := len(encodeInflux(remoteTestMetric(1), "", nil))
+	got := 0
+	buf := make([]byte, 2048)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	for got < want {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("Expected %d bytes, got %d: %v", want, got, err)
+		}
+		if n > 200 && strings.Count(string(buf[:n]), "\n") > 1 {
+			t.Errorf("Expected datagrams of at most 200 bytes, got %d", n)
+		}
+		got += n
+	}
+}
+
+func TestInfluxInvalidURL(t *testing.T) {
+	if _, err := NewInfluxWriter(InfluxOptions{URL: "tcp://localhost:8086"}); err == nil {
+		t.Error("Expected an unsupported scheme to be rejected")
+	}
+}
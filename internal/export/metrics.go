@@ -0,0 +1,404 @@
+// Package export maps metric snapshots to named, labelled metric families
+// and encodes them for external monitoring systems
+package export
+
+import (
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/kennethfeh/system-monitor/internal/models"
+)
+
+// Namespace prefixes every metric name
+const Namespace = "sysmon"
+
+// MetricType distinguishes values that only ever increase from those that
+// go up and down
+type MetricType string
+
+const (
+	Gauge   MetricType = "gauge"
+	Counter MetricType = "counter"
+)
+
+// Label is one dimension of a sample
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Sample is one value of a family
+type Sample struct {
+	Labels []Label
+	Value  float64
+}
+
+// Family is a set of samples sharing a name, type and meaning. Name
+// includes the unit suffix but, for counters, not the "_total" suffix.
+// Values are in base units: bytes, seconds and ratios from 0 to 1.
+type Family struct {
+	Name    string
+	Help    string
+	Type    MetricType
+	Unit    string
+	Samples []Sample
+}
+
+// familySet builds families in the order they are first used
+type familySet struct {
+	families []*Family
+	byName   map[string]*Family
+}
+
+func newFamilySet() *familySet {
+	return &familySet{byName: make(map[string]*Family)}
+}
+
+// add appends a sample to the family name, creating it on first use
+func (fs *familySet) add(name string, typ MetricType, unit, help string, value float64, labels ...Label) {
+	name = Namespace + "_" + name
+	f, ok := fs.byName[name]
+	if !ok {
+		f = &Family{Name: name, Help: help, Type: typ, Unit: unit}
+		fs.byName[name] = f
+		fs.families = append(fs.families, f)
+	}
+	f.Samples = append(f.Samples, Sample{Labels: labels, Value: value})
+}
+
+func (fs *familySet) gauge(name, unit, help string, value float64, labels ...Label) {
+	fs.add(name, Gauge, unit, help, value, labels...)
+}
+
+func (fs *familySet) counter(name, unit, help string, value float64, labels ...Label) {
+	fs.add(name, Counter, unit, help, value, labels...)
+}
+
+// ratio converts a percentage to a ratio
+func ratio(percent float64) float64 {
+	return percent / 100
+}
+
+// Families maps every numeric field of a snapshot to a metric family
+func Families(m models.SystemMetrics) []Family {
+	fs := newFamilySet()
+
+	addCPU(fs, m.CPU)
+	addMemory(fs, m.Memory)
+	addDisks(fs, m.Disk, m.DiskIO)
+	addNetwork(fs, m.Network)
+	addSystem(fs, m.System)
+	addProcesses(fs, m.Processes)
+	if m.PSI != nil {
+		addPressure(fs, "pressure", *m.PSI)
+	}
+	addCgroups(fs, m.Cgroups)
+	for _, t := range m.Temperature {
+		labels := []Label{{"sensor", t.SensorKey}}
+		if t.Label != "" {
+			labels = append(labels, Label{"label", t.Label})
+		}
+		fs.gauge("temperature_celsius", "celsius", "Temperature sensor reading.", t.Temperature, labels...)
+	}
+	addCustom(fs, m.Custom)
+	addCollection(fs, m)
+
+	families := make([]Family, len(fs.families))
+	for i, f := range fs.families {
+		families[i] = *f
+	}
+	return families
+}
+
+func addCPU(fs *familySet, cpu models.CPUMetrics) {
+	fs.gauge("cpu_cores", "", "Number of logical CPU cores.", float64(cpu.Cores))
+	unavailable := 0.0
+	if cpu.Unavailable {
+		unavailable = 1
+	}
+	fs.gauge("cpu_unavailable", "", "Whether CPU utilisation could not be read (1) or not (0).", unavailable)
+
+	if len(cpu.LoadAvg) == 3 {
+		fs.gauge("load1", "", "1-minute load average.", cpu.LoadAvg[0])
+		fs.gauge("load5", "", "5-minute load average.", cpu.LoadAvg[1])
+		fs.gauge("load15", "", "15-minute load average.", cpu.LoadAvg[2])
+	}
+	if cpu.Unavailable {
+		// The percentages are not meaningful
+		return
+	}
+
+	fs.gauge("cpu_usage_ratio", "ratio", "Share of time all CPUs were busy over the last interval.", ratio(cpu.TotalPercent))
+	for core, percent := range cpu.UsagePercent {
+		fs.gauge("cpu_core_usage_ratio", "ratio", "Share of time a CPU core was busy over the last interval.", ratio(percent), Label{"core", strconv.Itoa(core)})
+	}
+	for _, mode := range cpuModes(cpu.Modes) {
+		fs.gauge("cpu_mode_ratio", "ratio", "Share of CPU time spent in each mode over the last interval.", ratio(mode.value), Label{"mode", mode.name})
+	}
+	for core, modes := range cpu.CoreModes {
+		for _, mode := range cpuModes(modes) {
+			fs.gauge("cpu_core_mode_ratio", "ratio", "Share of a CPU core's time spent in each mode over the last interval.", ratio(mode.value), Label{"core", strconv.Itoa(core)}, Label{"mode", mode.name})
+		}
+	}
+}
+
+type namedValue struct {
+	name  string
+	value float64
+}
+
+func cpuModes(m models.CPUModeMetrics) []namedValue {
+	return []namedValue{
+		{"user", m.User}, {"nice", m.Nice}, {"system", m.System}, {"idle", m.Idle},
+		{"iowait", m.Iowait}, {"irq", m.Irq}, {"softirq", m.Softirq}, {"steal", m.Steal},
+		{"guest", m.Guest},
+	}
+}
+
+func addMemory(fs *familySet, mem models.MemoryMetrics) {
+	fs.gauge("memory_total_bytes", "bytes", "Total physical memory.", float64(mem.Total))
+	fs.gauge("memory_used_bytes", "bytes", "Physical memory in use.", float64(mem.Used))
+	fs.gauge("memory_free_bytes", "bytes", "Unused physical memory.", float64(mem.Free))
+	fs.gauge("memory_available_bytes", "bytes", "Memory available to new processes without swapping.", float64(mem.Available))
+	fs.gauge("memory_used_ratio", "ratio", "Share of physical memory in use.", ratio(mem.UsedPercent))
+	fs.gauge("swap_total_bytes", "bytes", "Total swap space.", float64(mem.SwapTotal))
+	fs.gauge("swap_used_bytes", "bytes", "Swap space in use.", float64(mem.SwapUsed))
+	fs.gauge("swap_free_bytes", "bytes", "Unused swap space.", float64(mem.SwapFree))
+	fs.gauge("swap_used_ratio", "ratio", "Share of swap space in use.", ratio(mem.SwapPercent))
+}
+
+func addDisks(fs *familySet, disks []models.DiskMetrics, io []models.DiskIOMetrics) {
+	for _, d := range disks {
+		labels := []Label{{"device", d.Device}, {"mountpoint", d.Mountpoint}, {"fstype", d.Fstype}}
+		fs.gauge("filesystem_size_bytes", "bytes", "Filesystem size.", float64(d.Total), labels...)
+		fs.gauge("filesystem_used_bytes", "bytes", "Filesystem space in use.", float64(d.Used), labels...)
+		fs.gauge("filesystem_free_bytes", "bytes", "Filesystem space free.", float64(d.Free), labels...)
+		fs.gauge("filesystem_used_ratio", "ratio", "Share of filesystem space in use.", ratio(d.UsedPercent), labels...)
+	}
+
+	for _, d := range io {
+		device := Label{"device", d.Device}
+		fs.gauge("disk_read_bytes_per_second", "bytes_per_second", "Bytes read from a block device per second over the last interval.", d.ReadBytesPerSec, device)
+		fs.gauge("disk_written_bytes_per_second", "bytes_per_second", "Bytes written to a block device per second over the last interval.", d.WriteBytesPerSec, device)
+		fs.gauge("disk_reads_per_second", "", "Read operations completed per second over the last interval.", d.ReadOpsPerSec, device)
+		fs.gauge("disk_writes_per_second", "", "Write operations completed per second over the last interval.", d.WriteOpsPerSec, device)
+		fs.gauge("disk_read_await_seconds", "seconds", "Average time a read took over the last interval.", d.ReadAwaitMs/1000, device)
+		fs.gauge("disk_write_await_seconds", "seconds", "Average time a write took over the last interval.", d.WriteAwaitMs/1000, device)
+		fs.gauge("disk_await_seconds", "seconds", "Average time an operation took over the last interval.", d.AwaitMs/1000, device)
+		fs.gauge("disk_queue_depth", "", "Average number of queued operations over the last interval.", d.QueueDepth, device)
+		fs.gauge("disk_io_in_progress", "", "Operations in flight.", float64(d.InProgress), device)
+		fs.gauge("disk_busy_ratio", "ratio", "Share of time a block device was busy over the last interval.", ratio(d.BusyPercent), device)
+	}
+}
+
+func addNetwork(fs *familySet, interfaces []models.NetworkMetrics) {
+	for _, n := range interfaces {
+		iface := Label{"interface", n.Name}
+		fs.counter("network_transmit_bytes", "bytes", "Bytes sent.", float64(n.BytesSent), iface)
+		fs.counter("network_receive_bytes", "bytes", "Bytes received.", float64(n.BytesRecv), iface)
+		fs.counter("network_transmit_packets", "", "Packets sent.", float64(n.PacketsSent), iface)
+		fs.counter("network_receive_packets", "", "Packets received.", float64(n.PacketsRecv), iface)
+		fs.counter("network_receive_errors", "", "Receive errors.", float64(n.Errin), iface)
+		fs.counter("network_transmit_errors", "", "Transmit errors.", float64(n.Errout), iface)
+		fs.counter("network_receive_drops", "", "Incoming packets dropped.", float64(n.Dropin), iface)
+		fs.counter("network_transmit_drops", "", "Outgoing packets dropped.", float64(n.Dropout), iface)
+
+		fs.gauge("network_transmit_bytes_per_second", "bytes_per_second", "Bytes sent per second over the last interval.", n.BytesSentRate, iface)
+		fs.gauge("network_receive_bytes_per_second", "bytes_per_second", "Bytes received per second over the last interval.", n.BytesRecvRate, iface)
+		fs.gauge("network_transmit_packets_per_second", "", "Packets sent per second over the last interval.", n.PacketsSentRate, iface)
+		fs.gauge("network_receive_packets_per_second", "", "Packets received per second over the last interval.", n.PacketsRecvRate, iface)
+		fs.gauge("network_receive_errors_per_second", "", "Receive errors per second over the last interval.", n.ErrinRate, iface)
+		fs.gauge("network_transmit_errors_per_second", "", "Transmit errors per second over the last interval.", n.ErroutRate, iface)
+		fs.gauge("network_receive_drops_per_second", "", "Incoming packets dropped per second over the last interval.", n.DropinRate, iface)
+		fs.gauge("network_transmit_drops_per_second", "", "Outgoing packets dropped per second over the last interval.", n.DropoutRate, iface)
+	}
+}
+
+func addSystem(fs *familySet, sys models.SystemInfo) {
+	fs.gauge("system_info", "", "Host information, always 1.", 1,
+		Label{"hostname", sys.Hostname},
+		Label{"os", sys.OS},
+		Label{"platform", sys.Platform},
+		Label{"platform_version", sys.PlatformVersion},
+		Label{"kernel_version", sys.KernelVersion})
+	fs.gauge("uptime_seconds", "seconds", "Time since boot.", float64(sys.Uptime))
+	fs.gauge("boot_time_seconds", "seconds", "Boot time as a Unix timestamp.", float64(sys.BootTime))
+	fs.gauge("processes", "", "Number of processes.", float64(sys.Processes))
+}
+
+func addProcesses(fs *familySet, processes []models.ProcessMetrics) {
+	for _, p := range processes {
+		labels := []Label{{"pid", strconv.Itoa(int(p.PID))}, {"name", p.Name}}
+		fs.gauge("process_cpu_usage_ratio", "ratio", "CPU use of a top process over the last interval, 1 being one core.", ratio(p.CPUPercent), labels...)
+		fs.gauge("process_resident_memory_bytes", "bytes", "Resident memory of a top process.", float64(p.RSS), labels...)
+		fs.gauge("process_threads", "", "Threads of a top process.", float64(p.Threads), labels...)
+		fs.gauge("process_open_fds", "", "Open file descriptors of a top process.", float64(p.OpenFDs), labels...)
+		fs.gauge("process_read_bytes_per_second", "bytes_per_second", "Bytes read by a top process per second over the last interval.", p.ReadBytesPerSec, labels...)
+		fs.gauge("process_written_bytes_per_second", "bytes_per_second", "Bytes written by a top process per second over the last interval.", p.WriteBytesPerSec, labels...)
+	}
+}
+
+// addPressure adds pressure stall information under prefix, with labels
+// identifying its owner appended to every sample
+func addPressure(fs *familySet, prefix string, psi models.PSIMetrics, owner ...Label) {
+	resources := []struct {
+		name string
+		res  models.PSIResource
+	}{{"cpu", psi.CPU}, {"memory", psi.Memory}, {"io", psi.IO}}
+
+	for _, r := range resources {
+		kinds := []struct {
+			name  string
+			stats *models.PSIStats
+		}{{"some", &r.res.Some}, {"full", r.res.Full}}
+
+		for _, k := range kinds {
+			if k.stats == nil {
+				continue
+			}
+			labels := append(append([]Label(nil), owner...), Label{"resource", r.name}, Label{"kind", k.name})
+			for _, w := range []namedValue{{"10s", k.stats.Avg10}, {"60s", k.stats.Avg60}, {"300s", k.stats.Avg300}} {
+				// Every sample needs its own label slice
+				windowed := append(append([]Label(nil), labels...), Label{"window", w.name})
+				fs.gauge(prefix+"_ratio", "ratio", "Share of time tasks were stalled on a resource, averaged over a window.", ratio(w.value), windowed...)
+			}
+			fs.counter(prefix+"_stalled_seconds", "seconds", "Time tasks were stalled on a resource.", float64(k.stats.TotalMicros)/1e6, labels...)
+		}
+	}
+}
+
+func addCgroups(fs *familySet, cgroups []models.CgroupMetrics) {
+	for _, cg := range cgroups {
+		path := Label{"cgroup", cg.Path}
+		fs.gauge("cgroup_cpu_usage_ratio", "ratio", "CPU use of a cgroup over the last interval, 1 being one core.", ratio(cg.CPU.UsagePercent), path)
+		fs.counter("cgroup_cpu_usage_seconds", "seconds", "CPU time used by a cgroup.", float64(cg.CPU.UsageMicros)/1e6, path)
+		fs.counter("cgroup_cpu_periods", "", "CFS enforcement periods of a cgroup.", float64(cg.CPU.Periods), path)
+		fs.counter("cgroup_cpu_throttled_periods", "", "CFS periods in which a cgroup was throttled.", float64(cg.CPU.ThrottledPeriods), path)
+		fs.counter("cgroup_cpu_throttled_seconds", "seconds", "Time a cgroup was throttled.", float64(cg.CPU.ThrottledMicros)/1e6, path)
+
+		fs.gauge("cgroup_memory_usage_bytes", "bytes", "Memory used by a cgroup.", float64(cg.Memory.Current), path)
+		if cg.Memory.Max > 0 {
+			fs.gauge("cgroup_memory_limit_bytes", "bytes", "Memory limit of a cgroup.", float64(cg.Memory.Max), path)
+		}
+		events := cg.Memory.Events
+		for _, e := range []namedValue{
+			{"low", float64(events.Low)}, {"high", float64(events.High)}, {"max", float64(events.Max)},
+			{"oom", float64(events.OOM)}, {"oom_kill", float64(events.OOMKill)},
+		} {
+			fs.counter("cgroup_memory_events", "", "Memory events of a cgroup.", e.value, path, Label{"event", e.name})
+		}
+
+		fs.counter("cgroup_io_read_bytes", "bytes", "Bytes read by a cgroup.", float64(cg.IO.ReadBytes), path)
+		fs.counter("cgroup_io_written_bytes", "bytes", "Bytes written by a cgroup.", float64(cg.IO.WriteBytes), path)
+		fs.counter("cgroup_io_reads", "", "Read operations of a cgroup.", float64(cg.IO.ReadOps), path)
+		fs.counter("cgroup_io_writes", "", "Write operations of a cgroup.", float64(cg.IO.WriteOps), path)
+		fs.gauge("cgroup_io_read_bytes_per_second", "bytes_per_second", "Bytes read by a cgroup per second over the last interval.", cg.IO.ReadBytesPerSec, path)
+		fs.gauge("cgroup_io_written_bytes_per_second", "bytes_per_second", "Bytes written by a cgroup per second over the last interval.", cg.IO.WriteBytesPerSec, path)
+
+		fs.gauge("cgroup_pids", "", "Tasks in a cgroup.", float64(cg.Pids.Current), path)
+		if cg.Pids.Max > 0 {
+			fs.gauge("cgroup_pids_limit", "", "Task limit of a cgroup.", float64(cg.Pids.Max), path)
+		}
+		if cg.Pressure != nil {
+			addPressure(fs, "cgroup_pressure", *cg.Pressure, path)
+		}
+	}
+}
+
+// addCustom exports the numeric leaves of third-party source data, named
+// by their dotted path within the source
+func addCustom(fs *familySet, custom map[string]interface{}) {
+	sources := make([]string, 0, len(custom))
+	for source := range custom {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+
+	for _, source := range sources {
+		var leaves []namedValue
+		collectLeaves("", custom[source], &leaves)
+		sort.Slice(leaves, func(i, j int) bool { return leaves[i].name < leaves[j].name })
+		for _, leaf := range leaves {
+			fs.gauge("custom_value", "", "Numeric value reported by a third-party metric source.", leaf.value, Label{"source", source}, Label{"field", leaf.name})
+		}
+	}
+}
+
+func collectLeaves(prefix string, v interface{}, leaves *[]namedValue) {
+	join := func(key string) string {
+		if prefix == "" {
+			return key
+		}
+		return prefix + "." + key
+	}
+
+	switch v := v.(type) {
+	case float64:
+		*leaves = append(*leaves, namedValue{prefix, v})
+	case float32:
+		*leaves = append(*leaves, namedValue{prefix, float64(v)})
+	case int:
+		*leaves = append(*leaves, namedValue{prefix, float64(v)})
+	case int64:
+		*leaves = append(*leaves, namedValue{prefix, float64(v)})
+	case uint64:
+		*leaves = append(*leaves, namedValue{prefix, float64(v)})
+	case bool:
+		b := 0.0
+		if v {
+			b = 1
+		}
+		*leaves = append(*leaves, namedValue{prefix, b})
+	case map[string]interface{}:
+		for key, child := range v {
+			collectLeaves(join(key), child, leaves)
+		}
+	case []interface{}:
+		for i, child := range v {
+			collectLeaves(join(strconv.Itoa(i)), child, leaves)
+		}
+	}
+}
+
+// addCollection describes the collection itself: per-source durations,
+// failures and the age of each section
+func addCollection(fs *familySet, m models.SystemMetrics) {
+	if !m.Timestamp.IsZero() {
+		fs.gauge("collection_timestamp_seconds", "seconds", "When the snapshot was assembled, as a Unix timestamp.", unixSeconds(m.Timestamp.UnixNano()))
+	}
+
+	failed := make(map[string]bool, len(m.Errors))
+	for _, e := range m.Errors {
+		failed[e.Source] = true
+	}
+	sources := make([]string, 0, len(m.CollectDurationMs))
+	for source := range m.CollectDurationMs {
+		sources = append(sources, source)
+	}
+	for source := range failed {
+		if _, ok := m.CollectDurationMs[source]; !ok {
+			sources = append(sources, source)
+		}
+	}
+	sort.Strings(sources)
+
+	for _, source := range sources {
+		label := Label{"source", source}
+		up := 1.0
+		if failed[source] {
+			up = 0
+		}
+		fs.gauge("collector_up", "", "Whether the latest run of a metric source succeeded (1) or failed (0).", up, label)
+		if ms, ok := m.CollectDurationMs[source]; ok {
+			fs.gauge("collector_duration_seconds", "seconds", "How long the latest run of a metric source took.", ms/1000, label)
+		}
+		if ts, ok := m.SectionTimestamps[source]; ok {
+			fs.gauge("collector_last_success_timestamp_seconds", "seconds", "When a metric source last contributed data, as a Unix timestamp.", unixSeconds(ts.UnixNano()), label)
+		}
+	}
+}
+
+func unixSeconds(ns int64) float64 {
+	return math.Round(float64(ns)/1e6) / 1e3
+}
@@ -0,0 +1,146 @@
+package export
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kennethfeh/system-monitor/internal/models"
+)
+
+func testSnapshot() models.SystemMetrics {
+	ts := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	full := models.PSIStats{Avg10: 1, Avg60: 2, Avg300: 3, TotalMicros: 4000000}
+	return models.SystemMetrics{
+		Timestamp: ts,
+		CPU: models.CPUMetrics{
+			UsagePercent: []float64{10, 30},
+			TotalPercent: 20,
+			CoreModes:    []models.CPUModeMetrics{{User: 10}, {User: 30}},
+			Cores:        2,
+			LoadAvg:      []float64{0.5, 0.25, 0.125},
+		},
+		Memory:  models.MemoryMetrics{Total: 1 << 30, UsedPercent: 50},
+		Disk:    []models.DiskMetrics{{Device: "/dev/sda1", Mountpoint: "/", Fstype: "ext4", Total: 100, UsedPercent: 25}},
+		DiskIO:  []models.DiskIOMetrics{{Device: "sda", ReadAwaitMs: 5}},
+		Network: []models.NetworkMetrics{{Name: "eth0", BytesRecv: 1234}},
+		System:  models.SystemInfo{Hostname: "host", Uptime: 60},
+		PSI: &models.PSIMetrics{
+			CPU:    models.PSIResource{Some: full},
+			Memory: models.PSIResource{Some: full, Full: &full},
+		},
+		Cgroups: []models.CgroupMetrics{{
+			Path:     "/system.slice",
+			Memory:   models.CgroupMemory{Current: 10},
+			Pressure: &models.PSIMetrics{IO: models.PSIResource{Some: full}},
+		}},
+		Temperature:       []models.TempMetrics{{SensorKey: "coretemp_core0", Temperature: 45, Label: "Core 0"}},
+		Custom:            map[string]interface{}{"app": map[string]interface{}{"queue": map[string]interface{}{"depth": 7.0}, "name": "x"}},
+		Errors:            []models.CollectionError{{Source: "disk", Error: "boom"}},
+		CollectDurationMs: map[string]float64{"cpu": 2, "disk": 500},
+		SectionTimestamps: map[string]time.Time{"cpu": ts},
+	}
+}
+
+// find returns the value of the sample of family name with the given
+// labels, formatted as name=value pairs
+func find(t *testing.T, families []Family, name string, labels ...string) float64 {
+	t.Helper()
+	for _, f := range families {
+		if f.Name != name {
+			continue
+		}
+		for _, s := range f.Samples {
+			var pairs []string
+			for _, l := range s.Labels {
+				pairs = append(pairs, l.Name+"="+l.Value)
+			}
+			if strings.Join(pairs, ",") == strings.Join(labels, ",") {
+				return s.Value
+			}
+		}
+	}
+	t.Fatalf("No sample %s%v", name, labels)
+	return 0
+}
+
+func TestFamilies(t *testing.T) {
+	families := Families(testSnapshot())
+
+	tests := []struct {
+		name   string
+		labels []string
+		want   float64
+	}{
+		{"sysmon_cpu_usage_ratio", nil, 0.2},
+		{"sysmon_cpu_core_usage_ratio", []string{"core=1"}, 0.3},
+		{"sysmon_cpu_core_mode_ratio", []string{"core=1", "mode=user"}, 0.3},
+		{"sysmon_load15", nil, 0.125},
+		{"sysmon_memory_used_ratio", nil, 0.5},
+		{"sysmon_filesystem_used_ratio", []string{"device=/dev/sda1", "mountpoint=/", "fstype=ext4"}, 0.25},
+		{"sysmon_disk_read_await_seconds", []string{"device=sda"}, 0.005},
+		{"sysmon_network_receive_bytes", []string{"interface=eth0"}, 1234},
+		{"sysmon_uptime_seconds", nil, 60},
+		{"sysmon_pressure_ratio", []string{"resource=memory", "kind=full", "window=300s"}, 0.03},
+		{"sysmon_pressure_stalled_seconds", []string{"resource=cpu", "kind=some"}, 4},
+		{"sysmon_cgroup_memory_usage_bytes", []string{"cgroup=/system.slice"}, 10},
+		{"sysmon_cgroup_pressure_ratio", []string{"cgroup=/system.slice", "resource=io", "kind=some", "window=10s"}, 0.01},
+		{"sysmon_temperature_celsius", []string{"sensor=coretemp_core0", "label=Core 0"}, 45},
+		{"sysmon_custom_value", []string{"source=app", "field=queue.depth"}, 7},
+		{"sysmon_collector_up", []string{"source=cpu"}, 1},
+		{"sysmon_collector_up", []string{"source=disk"}, 0},
+		{"sysmon_collector_duration_seconds", []string{"source=disk"}, 0.5},
+		{"sysmon_collection_timestamp_seconds", nil, 1704067200},
+	}
+	for _, tt := range tests {
+		if got := find(t, families, tt.name, tt.labels...); got != tt.want {
+			t.Errorf("%s%v = %v, want %v", tt.name, tt.labels, got, tt.want)
+		}
+	}
+}
+
+func TestFamiliesNaming(t *testing.T) {
+	seen := make(map[string]bool)
+	for _, f := range Families(testSnapshot()) {
+		if seen[f.Name] {
+			t.Errorf("Family %s appears twice", f.Name)
+		}
+		seen[f.Name] = true
+
+		if f.Unit != "" && !strings.HasSuffix(f.Name, "_"+f.Unit) {
+			t.Errorf("Family %s does not end with its unit %s", f.Name, f.Unit)
+		}
+		if strings.HasSuffix(f.Name, "_total") {
+			t.Errorf("Family %s must not carry the counter suffix", f.Name)
+		}
+		if f.Help == "" || len(f.Samples) == 0 {
+			t.Errorf("Family %s lacks help or samples", f.Name)
+		}
+
+		labelSets := make(map[string]bool)
+		for _, s := range f.Samples {
+			var pairs []string
+			for _, l := range s.Labels {
+				pairs = append(pairs, l.Name+"="+l.Value)
+			}
+			key := strings.Join(pairs, ",")
+			if labelSets[key] {
+				t.Errorf("Family %s has duplicate samples for {%s}", f.Name, key)
+			}
+			labelSets[key] = true
+		}
+	}
+}
+
+func TestFamiliesCPUUnavailable(t *testing.T) {
+	m := testSnapshot()
+	m.CPU.Unavailable = true
+	for _, f := range Families(m) {
+		if f.Name == "sysmon_cpu_usage_ratio" {
+			t.Error("Expected no utilisation while the CPU is unavailable")
+		}
+	}
+	if got := find(t, Families(m), "sysmon_cpu_unavailable"); got != 1 {
+		t.Errorf("Expected sysmon_cpu_unavailable 1, got %v", got)
+	}
+}
@@ -0,0 +1,360 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"runtime"
+	"strings"
+	"time"
+
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/kennethfeh/system-monitor/internal/models"
+)
+
+// OTLP transport protocols
+const (
+	OTLPGRPC         = "grpc"
+	OTLPHTTPProtobuf = "http/protobuf"
+)
+
+// otlpScope names the instrumentation scope of exported metrics
+const otlpScope = "github.com/kennethfeh/system-monitor"
+
+// OTLPOptions configures an OTLPWriter
+type OTLPOptions struct {
+	// Protocol is OTLPGRPC or OTLPHTTPProtobuf
+	Protocol string
+	// Endpoint is host:port or a URL for gRPC, e.g. collector:4317, and
+	// the full metrics URL for HTTP, e.g. http://collector:4318/v1/metrics
+	Endpoint string
+	// Insecure disables TLS for a gRPC endpoint given as host:port; URLs
+	// choose by their scheme
+	Insecure bool
+	// Headers are sent with every export, e.g. for authentication
+	Headers map[string]string
+	// Attributes are added to the resource, after the ones describing the
+	// host
+	Attributes []Label
+
+	Timeout   time.Duration
+	QueueSize int
+}
+
+// OTLPWriter sends snapshots to an OpenTelemetry collector as host metrics
+// following the semantic conventions, one export request per snapshot
+type OTLPWriter struct {
+	*queuedSink
+	opts   OTLPOptions
+	client *http.Client
+	conn   *grpc.ClientConn
+	grpc   colmetricspb.MetricsServiceClient
+}
+
+// NewOTLPWriter validates opts and starts exporting in the background
+func NewOTLPWriter(opts OTLPOptions) (*OTLPWriter, error) {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+
+	w := &OTLPWriter{opts: opts}
+	switch opts.Protocol {
+	case OTLPGRPC, "":
+		target, creds, err := grpcTarget(opts.Endpoint, opts.Insecure)
+		if err != nil {
+			return nil, err
+		}
+		if w.conn, err = grpc.NewClient(target, grpc.WithTransportCredentials(creds)); err != nil {
+			return nil, err
+		}
+		w.grpc = colmetricspb.NewMetricsServiceClient(w.conn)
+	case OTLPHTTPProtobuf:
+		u, err := url.Parse(opts.Endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("OTLP endpoint: %w", err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return nil, fmt.Errorf("OTLP endpoint %q must be an http or https URL", opts.Endpoint)
+		}
+		w.client = &http.Client{Timeout: opts.Timeout}
+	default:
+		return nil, fmt.Errorf("unknown OTLP protocol %q (want %s or %s)", opts.Protocol, OTLPGRPC, OTLPHTTPProtobuf)
+	}
+
+	w.queuedSink = newQueuedSink("OTLP", opts.QueueSize, w.write, w.closeConn)
+	return w, nil
+}
+
+// grpcTarget splits a gRPC endpoint into a dial target and credentials
+func grpcTarget(endpoint string, plaintext bool) (string, credentials.TransportCredentials, error) {
+	if u, err := url.Parse(endpoint); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		endpoint, plaintext = u.Host, u.Scheme == "http"
+	}
+	if _, _, err := net.SplitHostPort(endpoint); err != nil {
+		return "", nil, fmt.Errorf("OTLP endpoint: %w", err)
+	}
+	if plaintext {
+		return endpoint, insecure.NewCredentials(), nil
+	}
+	return endpoint, credentials.NewTLS(&tls.Config{}), nil
+}
+
+func (w *OTLPWriter) closeConn() error {
+	if w.conn != nil {
+		return w.conn.Close()
+	}
+	return nil
+}
+
+func (w *OTLPWriter) write(m models.SystemMetrics) error {
+	ctx, cancel := context.WithTimeout(context.Background(), w.opts.Timeout)
+	defer cancel()
+
+	req := otlpRequest(m, w.opts.Attributes)
+	if w.grpc != nil {
+		if len(w.opts.Headers) > 0 {
+			ctx = metadata.NewOutgoingContext(ctx, metadata.New(w.opts.Headers))
+		}
+		resp, err := w.grpc.Export(ctx, req)
+		if err != nil {
+			return err
+		}
+		return partialSuccess(resp)
+	}
+	return w.writeHTTP(ctx, req)
+}
+
+func (w *OTLPWriter) writeHTTP(ctx context.Context, req *colmetricspb.ExportMetricsServiceRequest) error {
+	body, err := proto.Marshal(req)
+	if err != nil {
+		return err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, w.opts.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/x-protobuf")
+	for name, value := range w.opts.Headers {
+		httpReq.Header.Set(name, value)
+	}
+
+	resp, err := w.client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("export returned %s", resp.Status)
+	}
+
+	var exportResp colmetricspb.ExportMetricsServiceResponse
+	if err := proto.Unmarshal(respBody, &exportResp); err != nil {
+		// The body is optional in practice; a 2xx means it was accepted
+		return nil
+	}
+	return partialSuccess(&exportResp)
+}
+
+// partialSuccess reports data points the collector accepted the request
+// but dropped
+func partialSuccess(resp *colmetricspb.ExportMetricsServiceResponse) error {
+	ps := resp.GetPartialSuccess()
+	if ps.GetRejectedDataPoints() == 0 {
+		return nil
+	}
+	if ps.GetErrorMessage() == "" {
+		return fmt.Errorf("collector rejected %d data points", ps.GetRejectedDataPoints())
+	}
+	return fmt.Errorf("collector rejected %d data points: %s", ps.GetRejectedDataPoints(), ps.GetErrorMessage())
+}
+
+// otlpRequest maps a snapshot onto the OpenTelemetry host metrics semantic
+// conventions. Utilisations are ratios, sizes bytes and durations seconds;
+// monotonic counters are cumulative since boot.
+func otlpRequest(m models.SystemMetrics, attrs []Label) *colmetricspb.ExportMetricsServiceRequest {
+	b := &otlpBuilder{
+		now:   uint64(m.Timestamp.UnixNano()),
+		start: m.System.BootTime * uint64(time.Second),
+		index: make(map[string]*metricspb.Metric),
+	}
+
+	if !m.CPU.Unavailable {
+		for _, mode := range []struct {
+			name  string
+			value float64
+		}{
+			{"user", m.CPU.Modes.User},
+			{"nice", m.CPU.Modes.Nice},
+			{"system", m.CPU.Modes.System},
+			{"idle", m.CPU.Modes.Idle},
+			{"iowait", m.CPU.Modes.Iowait},
+			{"interrupt", m.CPU.Modes.Irq + m.CPU.Modes.Softirq},
+			{"steal", m.CPU.Modes.Steal},
+		} {
+			b.gauge("system.cpu.utilization", "1", "Share of CPU time spent in each mode over the last interval.", ratio(mode.value), Label{"cpu.mode", mode.name})
+		}
+	}
+	if m.CPU.Cores > 0 {
+		b.sum("system.cpu.logical.count", "{cpu}", "Number of logical CPUs.", float64(m.CPU.Cores), false)
+	}
+	for i, window := range []string{"1m", "5m", "15m"} {
+		if i < len(m.CPU.LoadAvg) {
+			b.gauge("system.cpu.load_average."+window, "{thread}", "Average number of runnable threads over "+window+".", m.CPU.LoadAvg[i])
+		}
+	}
+
+	mem := m.Memory
+	if mem.Total > 0 {
+		b.sum("system.memory.limit", "By", "Total memory.", float64(mem.Total), false)
+		for _, state := range []struct {
+			name  string
+			value uint64
+		}{{"used", mem.Used}, {"free", mem.Free}} {
+			label := Label{"system.memory.state", state.name}
+			b.sum("system.memory.usage", "By", "Memory in use and free.", float64(state.value), false, label)
+			b.gauge("system.memory.utilization", "1", "Share of memory in use and free.", float64(state.value)/float64(mem.Total), label)
+		}
+		b.sum("system.linux.memory.available", "By", "Memory available for starting new applications without swapping.", float64(mem.Available), false)
+	}
+	if mem.SwapTotal > 0 {
+		for _, state := range []struct {
+			name  string
+			value uint64
+		}{{"used", mem.SwapUsed}, {"free", mem.SwapFree}} {
+			label := Label{"system.paging.state", state.name}
+			b.sum("system.paging.usage", "By", "Swap space in use and free.", float64(state.value), false, label)
+			b.gauge("system.paging.utilization", "1", "Share of swap space in use and free.", float64(state.value)/float64(mem.SwapTotal), label)
+		}
+	}
+
+	for _, d := range m.Disk {
+		labels := []Label{{"system.device", d.Device}, {"system.filesystem.mountpoint", d.Mountpoint}, {"system.filesystem.type", d.Fstype}}
+		b.sum("system.filesystem.usage", "By", "Filesystem space in use and free.", float64(d.Used), false, append(labels, Label{"system.filesystem.state", "used"})...)
+		b.sum("system.filesystem.usage", "By", "Filesystem space in use and free.", float64(d.Free), false, append(labels, Label{"system.filesystem.state", "free"})...)
+		b.gauge("system.filesystem.utilization", "1", "Share of filesystem space in use.", ratio(d.UsedPercent), labels...)
+	}
+
+	for _, n := range m.Network {
+		for _, c := range []struct {
+			name, unit, help  string
+			receive, transmit uint64
+		}{
+			{"system.network.io", "By", "Bytes received and transmitted.", n.BytesRecv, n.BytesSent},
+			{"system.network.packets", "{packet}", "Packets received and transmitted.", n.PacketsRecv, n.PacketsSent},
+			{"system.network.errors", "{error}", "Receive and transmit errors.", n.Errin, n.Errout},
+			{"system.network.dropped", "{packet}", "Packets dropped on receive and transmit.", n.Dropin, n.Dropout},
+		} {
+			iface := Label{"network.interface.name", n.Name}
+			b.sum(c.name, c.unit, c.help, float64(c.receive), true, iface, Label{"network.io.direction", "receive"})
+			b.sum(c.name, c.unit, c.help, float64(c.transmit), true, iface, Label{"network.io.direction", "transmit"})
+		}
+	}
+
+	if m.System.BootTime > 0 {
+		b.gauge("system.uptime", "s", "Time since the system booted.", float64(m.System.Uptime))
+		b.sum("system.process.count", "{process}", "Number of processes.", float64(m.System.Processes), false)
+	}
+
+	return &colmetricspb.ExportMetricsServiceRequest{
+		ResourceMetrics: []*metricspb.ResourceMetrics{{
+			Resource: &resourcepb.Resource{Attributes: otlpResource(m.System, attrs)},
+			ScopeMetrics: []*metricspb.ScopeMetrics{{
+				Scope:   &commonpb.InstrumentationScope{Name: otlpScope},
+				Metrics: b.metrics,
+			}},
+		}},
+	}
+}
+
+// otlpResource describes the host with the semantic convention resource
+// attributes, followed by attrs
+func otlpResource(sys models.SystemInfo, attrs []Label) []*commonpb.KeyValue {
+	labels := []Label{
+		{"service.name", "system-monitor"},
+		{"host.name", sys.Hostname},
+		{"host.arch", runtime.GOARCH},
+		{"os.type", sys.OS},
+		{"os.name", sys.Platform},
+		{"os.version", sys.PlatformVersion},
+		{"os.description", strings.TrimSpace(sys.Platform + " " + sys.PlatformVersion + " " + sys.KernelVersion)},
+	}
+	return otlpAttributes(sortLabels(append(labels, attrs...)))
+}
+
+func otlpAttributes(labels []Label) []*commonpb.KeyValue {
+	var kvs []*commonpb.KeyValue
+	for _, l := range labels {
+		if l.Value == "" {
+			continue
+		}
+		kvs = append(kvs, &commonpb.KeyValue{
+			Key:   l.Name,
+			Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: l.Value}},
+		})
+	}
+	return kvs
+}
+
+// otlpBuilder collects data points into metrics in the order they are
+// first seen
+type otlpBuilder struct {
+	now, start uint64
+	metrics    []*metricspb.Metric
+	index      map[string]*metricspb.Metric
+}
+
+func (b *otlpBuilder) metric(name, unit, help string, data func() *metricspb.Metric) *metricspb.Metric {
+	if metric, ok := b.index[name]; ok {
+		return metric
+	}
+	metric := data()
+	metric.Name, metric.Unit, metric.Description = name, unit, help
+	b.index[name] = metric
+	b.metrics = append(b.metrics, metric)
+	return metric
+}
+
+func (b *otlpBuilder) point(value float64, start uint64, labels []Label) *metricspb.NumberDataPoint {
+	return &metricspb.NumberDataPoint{
+		Attributes:        otlpAttributes(labels),
+		StartTimeUnixNano: start,
+		TimeUnixNano:      b.now,
+		Value:             &metricspb.NumberDataPoint_AsDouble{AsDouble: value},
+	}
+}
+
+func (b *otlpBuilder) gauge(name, unit, help string, value float64, labels ...Label) {
+	metric := b.metric(name, unit, help, func() *metricspb.Metric {
+		return &metricspb.Metric{Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{}}}
+	})
+	gauge := metric.GetGauge()
+	gauge.DataPoints = append(gauge.DataPoints, b.point(value, 0, labels))
+}
+
+// sum adds a cumulative sum point. Monotonic sums are counters; the others
+// are up-down counters such as usage.
+func (b *otlpBuilder) sum(name, unit, help string, value float64, monotonic bool, labels ...Label) {
+	metric := b.metric(name, unit, help, func() *metricspb.Metric {
+		return &metricspb.Metric{Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+			AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+			IsMonotonic:            monotonic,
+		}}}
+	})
+	sum := metric.GetSum()
+	sum.DataPoints = append(sum.DataPoints, b.point(value, b.start, labels))
+}
@@ -0,0 +1,222 @@
+package export
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/kennethfeh/system-monitor/internal/models"
+)
+
+// otlpReceiver is an in-process OTLP metrics receiver for both protocols
+type otlpReceiver struct {
+	colmetricspb.UnimplementedMetricsServiceServer
+
+	mu       sync.Mutex
+	requests []*colmetricspb.ExportMetricsServiceRequest
+	headers  []string
+}
+
+func (r *otlpReceiver) Export(ctx context.Context, req *colmetricspb.ExportMetricsServiceRequest) (*colmetricspb.ExportMetricsServiceResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	r.record(req, md.Get("authorization"))
+	return &colmetricspb.ExportMetricsServiceResponse{}, nil
+}
+
+func (r *otlpReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	var export colmetricspb.ExportMetricsServiceRequest
+	if req.Header.Get("Content-Type") != "application/x-protobuf" || proto.Unmarshal(body, &export) != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	r.record(&export, req.Header.Values("Authorization"))
+	resp, _ := proto.Marshal(&colmetricspb.ExportMetricsServiceResponse{})
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.Write(resp)
+}
+
+func (r *otlpReceiver) record(req *colmetricspb.ExportMetricsServiceRequest, auth []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = append(r.requests, req)
+	r.headers = append(r.headers, auth...)
+}
+
+// otlpTestMetric returns testSnapshot with the fields the OTLP mapping
+// splits by state filled in
+func otlpTestMetric() models.SystemMetrics {
+	m := testSnapshot()
+	m.CPU.Cores = 4
+	m.CPU.Modes = models.CPUModeMetrics{User: 25, Idle: 70, Irq: 2, Softirq: 3}
+	m.CPU.LoadAvg = []float64{1, 2, 3}
+	m.Memory = models.MemoryMetrics{Total: 1000, Used: 250, Free: 750, Available: 800}
+	m.Disk[0].Used, m.Disk[0].Free, m.Disk[0].UsedPercent = 40, 60, 40
+	m.Network[0].BytesRecv, m.Network[0].BytesSent = 100, 200
+	m.System = models.SystemInfo{Hostname: "web-1", OS: "linux", Platform: "ubuntu", PlatformVersion: "22.04", BootTime: 1600000000, Uptime: 100000000, Processes: 120}
+	return m
+}
+
+// otlpPoint returns the value of the data point of the named metric whose
+// attributes include attrs
+func otlpPoint(t *testing.T, req *colmetricspb.ExportMetricsServiceRequest, name string, attrs map[string]string) *metricspb.NumberDataPoint {
+	t.Helper()
+	for _, metric := range req.ResourceMetrics[0].ScopeMetrics[0].Metrics {
+		if metric.Name != name {
+			continue
+		}
+		points := metric.GetGauge().GetDataPoints()
+		if sum := metric.GetSum(); sum != nil {
+			points = sum.DataPoints
+		}
+	points:
+		for _, p := range points {
+			got := make(map[string]string)
+			for _, kv := range p.Attributes {
+				got[kv.Key] = kv.Value.GetStringValue()
+			}
+			for k, v := range attrs {
+				if got[k] != v {
+					continue points
+				}
+			}
+			return p
+		}
+	}
+	t.Fatalf("No %s point with %v", name, attrs)
+	return nil
+}
+
+func TestOTLPRequest(t *testing.T) {
+	req := otlpRequest(otlpTestMetric(), []Label{{"deployment.environment", "prod"}})
+
+	resource := make(map[string]string)
+	for _, kv := range req.ResourceMetrics[0].Resource.Attributes {
+		resource[kv.Key] = kv.Value.GetStringValue()
+	}
+	for k, v := range map[string]string{"host.name": "web-1", "os.type": "linux", "os.version": "22.04", "service.name": "system-monitor", "deployment.environment": "prod"} {
+		if resource[k] != v {
+			t.Errorf("Expected resource attribute %s=%q, got %q", k, v, resource[k])
+		}
+	}
+
+	tests := []struct {
+		name  string
+		attrs map[string]string
+		want  float64
+	}{
+		{"system.cpu.utilization", map[string]string{"cpu.mode": "user"}, 0.25},
+		{"system.cpu.utilization", map[string]string{"cpu.mode": "interrupt"}, 0.05},
+		{"system.cpu.logical.count", nil, 4},
+		{"system.cpu.load_average.15m", nil, 3},
+		{"system.memory.usage", map[string]string{"system.memory.state": "used"}, 250},
+		{"system.memory.utilization", map[string]string{"system.memory.state": "free"}, 0.75},
+		{"system.filesystem.usage", map[string]string{"system.filesystem.mountpoint": "/", "system.filesystem.state": "free"}, 60},
+		{"system.filesystem.utilization", map[string]string{"system.device": "/dev/sda1"}, 0.4},
+		{"system.network.io", map[string]string{"network.interface.name": "eth0", "network.io.direction": "transmit"}, 200},
+		{"system.process.count", nil, 120},
+	}
+	for _, tt := range tests {
+		p := otlpPoint(t, req, tt.name, tt.attrs)
+		if got := p.GetAsDouble(); got < tt.want-1e-9 || got > tt.want+1e-9 {
+			t.Errorf("%s %v: expected %v, got %v", tt.name, tt.attrs, tt.want, got)
+		}
+	}
+
+	// Counters are cumulative since boot
+	for _, metric := range req.ResourceMetrics[0].ScopeMetrics[0].Metrics {
+		if metric.Name == "system.network.io" {
+			sum := metric.GetSum()
+			if !sum.IsMonotonic || sum.AggregationTemporality != metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE {
+				t.Errorf("Expected a cumulative monotonic sum, got %v", sum)
+			}
+			if p := sum.DataPoints[0]; p.StartTimeUnixNano != 1600000000*uint64(time.Second) || p.TimeUnixNano != uint64(testSnapshot().Timestamp.UnixNano()) {
+				t.Errorf("Unexpected point times %d..%d", p.StartTimeUnixNano, p.TimeUnixNano)
+			}
+		}
+	}
+}
+
+func TestOTLPGRPC(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	receiver := &otlpReceiver{}
+	server := grpc.NewServer()
+	colmetricspb.RegisterMetricsServiceServer(server, receiver)
+	go server.Serve(ln)
+	defer server.Stop()
+
+	w, err := NewOTLPWriter(OTLPOptions{
+		Protocol: OTLPGRPC,
+		Endpoint: ln.Addr().String(),
+		Insecure: true,
+		Headers:  map[string]string{"Authorization": "Bearer secret"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	w.Push(otlpTestMetric())
+	w.Close()
+
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+	if len(receiver.requests) != 1 {
+		t.Fatalf("Expected 1 export, got %d", len(receiver.requests))
+	}
+	if len(receiver.headers) != 1 || receiver.headers[0] != "Bearer secret" {
+		t.Errorf("Expected the headers as metadata, got %v", receiver.headers)
+	}
+	otlpPoint(t, receiver.requests[0], "system.memory.usage", map[string]string{"system.memory.state": "used"})
+}
+
+func TestOTLPHTTP(t *testing.T) {
+	receiver := &otlpReceiver{}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	w, err := NewOTLPWriter(OTLPOptions{
+		Protocol: OTLPHTTPProtobuf,
+		Endpoint: server.URL + "/v1/metrics",
+		Headers:  map[string]string{"Authorization": "Bearer secret"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	w.Push(otlpTestMetric())
+	w.Close()
+
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+	if len(receiver.requests) != 1 {
+		t.Fatalf("Expected 1 export, got %d", len(receiver.requests))
+	}
+	if len(receiver.headers) != 1 || receiver.headers[0] != "Bearer secret" {
+		t.Errorf("Expected the headers to be sent, got %v", receiver.headers)
+	}
+	otlpPoint(t, receiver.requests[0], "system.network.io", map[string]string{"network.io.direction": "receive"})
+}
+
+func TestOTLPInvalidOptions(t *testing.T) {
+	for _, opts := range []OTLPOptions{
+		{Protocol: "http/json", Endpoint: "http://collector:4318/v1/metrics"},
+		{Protocol: OTLPGRPC, Endpoint: "collector"},
+		{Protocol: OTLPHTTPProtobuf, Endpoint: "collector:4318"},
+	} {
+		if _, err := NewOTLPWriter(opts); err == nil {
+			t.Errorf("Expected %+v to be rejected", opts)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package export
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"mime"
+	"strconv"
+	"strings"
+)
+
+// Format is an exposition format understood by Prometheus
+type Format string
+
+const (
+	// FormatText is the Prometheus text exposition format 0.0.4
+	FormatText Format = "text"
+	// FormatOpenMetrics is OpenMetrics 1.0.0
+	FormatOpenMetrics Format = "openmetrics"
+)
+
+// ContentType returns the media type a format is served with
+func (f Format) ContentType() string {
+	if f == FormatOpenMetrics {
+		return "application/openmetrics-text; version=1.0.0; charset=utf-8"
+	}
+	return "text/plain; version=0.0.4; charset=utf-8"
+}
+
+// NegotiateFormat picks the format for an Accept header. OpenMetrics is
+// only served when asked for explicitly and preferred at least as much as
+// the text format; anything else gets the text format.
+func NegotiateFormat(accept string) Format {
+	var openMetrics, text float64
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if s, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(s, 64); err != nil {
+				continue
+			}
+		}
+
+		switch mediaType {
+		case "application/openmetrics-text":
+			if v, ok := params["version"]; ok && v != "1.0.0" {
+				continue
+			}
+			openMetrics = math.Max(openMetrics, q)
+		case "text/plain", "text/*", "*/*":
+			text = math.Max(text, q)
+		}
+	}
+	if openMetrics > 0 && openMetrics >= text {
+		return FormatOpenMetrics
+	}
+	return FormatText
+}
+
+// Encode writes families in the given format
+func Encode(w io.Writer, families []Family, format Format) error {
+	bw := bufio.NewWriter(w)
+	for _, f := range families {
+		if format == FormatOpenMetrics {
+			writeOpenMetricsFamily(bw, f)
+		} else {
+			writeTextFamily(bw, f)
+		}
+	}
+	if format == FormatOpenMetrics {
+		bw.WriteString("# EOF\n")
+	}
+	return bw.Flush()
+}
+
+// sampleName returns the name a family's samples are exposed under
+func sampleName(f Family) string {
+	if f.Type == Counter {
+		return f.Name + "_total"
+	}
+	return f.Name
+}
+
+func writeTextFamily(w *bufio.Writer, f Family) {
+	name := sampleName(f)
+	w.WriteString("# HELP " + name + " " + escapeHelp(f.Help, false) + "\n")
+	w.WriteString("# TYPE " + name + " " + string(f.Type) + "\n")
+	writeSamples(w, name, f.Samples)
+}
+
+func writeOpenMetricsFamily(w *bufio.Writer, f Family) {
+	w.WriteString("# TYPE " + f.Name + " " + string(f.Type) + "\n")
+	if f.Unit != "" {
+		w.WriteString("# UNIT " + f.Name + " " + f.Unit + "\n")
+	}
+	w.WriteString("# HELP " + f.Name + " " + escapeHelp(f.Help, true) + "\n")
+	writeSamples(w, sampleName(f), f.Samples)
+}
+
+func writeSamples(w *bufio.Writer, name string, samples []Sample) {
+	for _, s := range samples {
+		w.WriteString(name)
+		if len(s.Labels) > 0 {
+			w.WriteByte('{')
+			for i, l := range s.Labels {
+				if i > 0 {
+					w.WriteByte(',')
+				}
+				w.WriteString(l.Name + `="` + escapeLabelValue(l.Value) + `"`)
+			}
+			w.WriteByte('}')
+		}
+		w.WriteByte(' ')
+		w.WriteString(formatValue(s.Value))
+		w.WriteByte('\n')
+	}
+}
+
+var (
+	labelValueEscaper      = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	textHelpEscaper        = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	openMetricsHelpEscaper = labelValueEscaper
+)
+
+func escapeLabelValue(s string) string {
+	return labelValueEscaper.Replace(s)
+}
+
+// escapeHelp escapes a HELP text; OpenMetrics also escapes double quotes
+func escapeHelp(s string, openMetrics bool) string {
+	if openMetrics {
+		return openMetricsHelpEscaper.Replace(s)
+	}
+	return textHelpEscaper.Replace(s)
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
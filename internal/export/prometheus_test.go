@@ -0,0 +1,89 @@
+package export
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+var testFamilies = []Family{
+	{
+		Name: "sysmon_network_receive_bytes", Help: "Bytes received.", Type: Counter, Unit: "bytes",
+		Samples: []Sample{{Labels: []Label{{"interface", "eth0"}}, Value: 1234}},
+	},
+	{
+		Name: "sysmon_load1", Help: `Load "average"` + "\n" + `with \ backslash.`, Type: Gauge,
+		Samples: []Sample{{Value: math.Inf(1)}},
+	},
+	{
+		Name: "sysmon_temperature_celsius", Help: "Temperature.", Type: Gauge, Unit: "celsius",
+		Samples: []Sample{{Labels: []Label{{"sensor", "a\"b\\c\nd"}}, Value: 45.5}},
+	},
+}
+
+func TestEncodeText(t *testing.T) {
+	var b strings.Builder
+	if err := Encode(&b, testFamilies, FormatText); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	want := `# HELP sysmon_network_receive_bytes_total Bytes received.
+# TYPE sysmon_network_receive_bytes_total counter
+sysmon_network_receive_bytes_total{interface="eth0"} 1234
+# HELP sysmon_load1 Load "average"\nwith \\ backslash.
+# TYPE sysmon_load1 gauge
+sysmon_load1 +Inf
+# HELP sysmon_temperature_celsius Temperature.
+# TYPE sysmon_temperature_celsius gauge
+sysmon_temperature_celsius{sensor="a\"b\\c\nd"} 45.5
+`
+	if b.String() != want {
+		t.Errorf("Unexpected text exposition:\n%s\nwant:\n%s", b.String(), want)
+	}
+}
+
+func TestEncodeOpenMetrics(t *testing.T) {
+	var b strings.Builder
+	if err := Encode(&b, testFamilies, FormatOpenMetrics); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	want := `# TYPE sysmon_network_receive_bytes counter
+# UNIT sysmon_network_receive_bytes bytes
+# HELP sysmon_network_receive_bytes Bytes received.
+sysmon_network_receive_bytes_total{interface="eth0"} 1234
+# TYPE sysmon_load1 gauge
+# HELP sysmon_load1 Load \"average\"\nwith \\ backslash.
+sysmon_load1 +Inf
+# TYPE sysmon_temperature_celsius gauge
+# UNIT sysmon_temperature_celsius celsius
+# HELP sysmon_temperature_celsius Temperature.
+sysmon_temperature_celsius{sensor="a\"b\\c\nd"} 45.5
+# EOF
+`
+	if b.String() != want {
+		t.Errorf("Unexpected OpenMetrics exposition:\n%s\nwant:\n%s", b.String(), want)
+	}
+}
+
+func TestNegotiateFormat(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   Format
+	}{
+		{"", FormatText},
+		{"*/*", FormatText},
+		{"text/plain", FormatText},
+		{"application/openmetrics-text", FormatOpenMetrics},
+		{"application/openmetrics-text;version=1.0.0,application/openmetrics-text;version=0.0.1;q=0.75,text/plain;version=0.0.4;q=0.5,*/*;q=0.1", FormatOpenMetrics},
+		{"application/openmetrics-text;version=0.0.1", FormatText},
+		{"text/plain;q=1,application/openmetrics-text;q=0.5", FormatText},
+		{"application/openmetrics-text;q=0", FormatText},
+		{"garbage;;;", FormatText},
+	}
+	for _, tt := range tests {
+		if got := NegotiateFormat(tt.accept); got != tt.want {
+			t.Errorf("NegotiateFormat(%q) = %s, want %s", tt.accept, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,508 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/kennethfeh/system-monitor/internal/models"
+)
+
+// Remote write defaults
+const (
+	DefaultRemoteWriteBatch    = 50
+	DefaultRemoteWriteFlush    = 10 * time.Second
+	DefaultRemoteWriteTimeout  = 10 * time.Second
+	DefaultRemoteWriteRetries  = 3
+	DefaultRemoteWriteSpillMax = 64 << 20
+)
+
+// RemoteWriteOptions configures a RemoteWriter. Zero values select the
+// defaults; an empty SpillDir keeps failed batches in memory only.
+type RemoteWriteOptions struct {
+	URL string
+	// Labels are added to every series, e.g. job and instance
+	Labels []Label
+	// Headers are sent with every request, e.g. Authorization
+	Headers map[string]string
+
+	// BatchSize is the most snapshots sent in one request. A batch is sent
+	// when full or FlushInterval after its first snapshot.
+	BatchSize     int
+	FlushInterval time.Duration
+	Timeout       time.Duration
+
+	// A failing request is retried MaxRetries times, waiting MinBackoff
+	// and doubling up to MaxBackoff, before its batch is spilled
+	MaxRetries int
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// SpillDir holds the batches that could not be sent, up to
+	// MaxSpillBytes; beyond that the oldest are dropped
+	SpillDir      string
+	MaxSpillBytes int64
+
+	// Client defaults to an http.Client with Timeout
+	Client *http.Client
+}
+
+// RemoteWriter pushes snapshots to a Prometheus remote_write endpoint as
+// snappy-compressed protobuf. Batches that cannot be delivered are queued,
+// on disk when a spill directory is set, and resent in order once the
+// endpoint recovers; new data waits behind them so every series stays in
+// timestamp order.
+type RemoteWriter struct {
+	opts  RemoteWriteOptions
+	spill *spillQueue
+
+	mu      sync.Mutex
+	pending []models.SystemMetrics
+	dropped int
+
+	full   chan struct{}
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	// nextRetry is when the spill queue is next tried, during an outage
+	nextRetry time.Time
+	backoff   time.Duration
+}
+
+// NewRemoteWriter validates opts, loads any batches spilled by a previous
+// run and starts sending in the background
+func NewRemoteWriter(opts RemoteWriteOptions) (*RemoteWriter, error) {
+	if !strings.HasPrefix(opts.URL, "http://") && !strings.HasPrefix(opts.URL, "https://") {
+		return nil, fmt.Errorf("remote write URL %q must be http or https", opts.URL)
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultRemoteWriteBatch
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = DefaultRemoteWriteFlush
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultRemoteWriteTimeout
+	}
+	if opts.MaxRetries < 0 {
+		opts.MaxRetries = 0
+	} else if opts.MaxRetries == 0 {
+		opts.MaxRetries = DefaultRemoteWriteRetries
+	}
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = 500 * time.Millisecond
+	}
+	if opts.MaxBackoff < opts.MinBackoff {
+		opts.MaxBackoff = 30 * time.Second
+	}
+	if opts.MaxSpillBytes <= 0 {
+		opts.MaxSpillBytes = DefaultRemoteWriteSpillMax
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: opts.Timeout}
+	}
+	for _, l := range opts.Labels {
+		if !validLabelName(l.Name) || strings.HasPrefix(l.Name, "__") {
+			return nil, fmt.Errorf("invalid remote write label %q", l.Name)
+		}
+	}
+
+	spill, err := openSpillQueue(opts.SpillDir, opts.MaxSpillBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &RemoteWriter{
+		opts:    opts,
+		spill:   spill,
+		full:    make(chan struct{}, 1),
+		cancel:  cancel,
+		done:    make(chan struct{}),
+		backoff: opts.MinBackoff,
+	}
+	go w.run(ctx)
+	return w, nil
+}
+
+// Push queues a snapshot for the next batch. While a request is being
+// retried, at most ten batches worth of snapshots wait; older ones are
+// dropped.
+func (w *RemoteWriter) Push(m models.SystemMetrics) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.pending = append(w.pending, m)
+	if limit := 10 * w.opts.BatchSize; len(w.pending) > limit {
+		w.dropped += len(w.pending) - limit
+		w.pending = w.pending[len(w.pending)-limit:]
+	}
+	if len(w.pending) >= w.opts.BatchSize {
+		select {
+		case w.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Close sends what is pending, once, spilling it on failure
+func (w *RemoteWriter) Close() error {
+	w.cancel()
+	<-w.done
+	return nil
+}
+
+func (w *RemoteWriter) run(ctx context.Context) {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.opts.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			w.flush(ctx, true, true)
+			return
+		case <-ticker.C:
+			w.flush(ctx, true, false)
+		case <-w.full:
+			w.flush(ctx, false, false)
+		}
+	}
+}
+
+// takeBatch removes up to a batch of pending snapshots, or only a full
+// batch unless partial is set
+func (w *RemoteWriter) takeBatch(partial bool) []models.SystemMetrics {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.dropped > 0 {
+		log.Printf("Remote write: dropped %d snapshots while the endpoint was unavailable", w.dropped)
+		w.dropped = 0
+	}
+	n := len(w.pending)
+	if n > w.opts.BatchSize {
+		n = w.opts.BatchSize
+	} else if n < w.opts.BatchSize && !partial {
+		return nil
+	}
+	batch := append([]models.SystemMetrics(nil), w.pending[:n]...)
+	w.pending = w.pending[n:]
+	return batch
+}
+
+// flush sends the spill queue, then the pending snapshots: all of them
+// when partial is set, otherwise only full batches. On the final flush
+// nothing is retried.
+func (w *RemoteWriter) flush(ctx context.Context, partial, final bool) {
+	w.drainSpill(ctx)
+
+	for {
+		batch := w.takeBatch(partial)
+		if len(batch) == 0 {
+			return
+		}
+		body, err := encodeWriteRequest(batch, w.opts.Labels)
+		if err != nil {
+			log.Printf("Remote write: %v", err)
+			continue
+		}
+
+		if w.spill.len() > 0 {
+			// Keep behind the batches already waiting
+			w.spillBatch(body)
+			continue
+		}
+		retries := w.opts.MaxRetries
+		if final {
+			retries = 0
+		}
+		if err := w.sendWithRetry(ctx, body, retries); err != nil {
+			if isPermanent(err) {
+				log.Printf("Remote write: dropping %d snapshots: %v", len(batch), err)
+				continue
+			}
+			log.Printf("Remote write: spilling %d snapshots: %v", len(batch), err)
+			w.spillBatch(body)
+			w.nextRetry = time.Now().Add(w.backoff)
+		}
+	}
+}
+
+// drainSpill resends spilled batches, oldest first, until one fails. During
+// an outage the queue is only tried once the backoff has elapsed.
+func (w *RemoteWriter) drainSpill(ctx context.Context) {
+	if w.spill.len() == 0 || time.Now().Before(w.nextRetry) {
+		return
+	}
+
+	for w.spill.len() > 0 {
+		body, err := w.spill.peek()
+		if err != nil {
+			log.Printf("Remote write: discarding unreadable spilled batch: %v", err)
+			w.spill.pop()
+			continue
+		}
+		err = w.send(ctx, body)
+		if err != nil && !isPermanent(err) {
+			w.backoff = minDuration(2*w.backoff, w.opts.MaxBackoff)
+			w.nextRetry = time.Now().Add(w.backoff)
+			log.Printf("Remote write: endpoint still unavailable, %d batches queued, next attempt in %v: %v", w.spill.len(), w.backoff, err)
+			return
+		}
+		if err != nil {
+			log.Printf("Remote write: dropping spilled batch: %v", err)
+		}
+		if err := w.spill.pop(); err != nil {
+			log.Printf("Remote write: %v", err)
+		}
+	}
+	w.backoff = w.opts.MinBackoff
+	log.Printf("Remote write: spill queue drained")
+}
+
+func (w *RemoteWriter) spillBatch(body []byte) {
+	dropped, err := w.spill.push(body)
+	if err != nil {
+		log.Printf("Remote write: cannot spill batch: %v", err)
+	}
+	if dropped > 0 {
+		log.Printf("Remote write: spill queue full, dropped the %d oldest batches", dropped)
+	}
+}
+
+// sendWithRetry sends body, retrying temporary failures with exponential
+// backoff
+func (w *RemoteWriter) sendWithRetry(ctx context.Context, body []byte, retries int) error {
+	backoff := w.opts.MinBackoff
+	for attempt := 0; ; attempt++ {
+		err := w.send(ctx, body)
+		if err == nil || isPermanent(err) || attempt >= retries {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff = minDuration(2*backoff, w.opts.MaxBackoff)
+	}
+}
+
+// permanentError is a rejection that retrying cannot fix
+type permanentError struct{ error }
+
+func isPermanent(err error) bool {
+	var p permanentError
+	return errors.As(err, &p)
+}
+
+// send posts one request. Server errors and 429 are temporary; any other
+// non-2xx status is permanent.
+func (w *RemoteWriter) send(ctx context.Context, body []byte) error {
+	// The final flush happens after ctx is cancelled, so requests are
+	// bounded by the timeout alone
+	reqCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), w.opts.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodPost, w.opts.URL, bytes.NewReader(body))
+	if err != nil {
+		return permanentError{err}
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	req.Header.Set("User-Agent", "system-monitor")
+	for k, v := range w.opts.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := w.opts.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+
+	switch {
+	case resp.StatusCode/100 == 2:
+		return nil
+	case resp.StatusCode/100 == 5 || resp.StatusCode == http.StatusTooManyRequests:
+		return fmt.Errorf("server returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	default:
+		return permanentError{fmt.Errorf("server rejected batch with %s: %s", resp.Status, bytes.TrimSpace(msg))}
+	}
+}
+
+func minDuration(a, b time.Duration) time.Duration {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// remoteSeries is one time series of a write request
+type remoteSeries struct {
+	labels  []Label
+	samples []remoteSample
+}
+
+type remoteSample struct {
+	value     float64
+	timestamp int64
+}
+
+// Remote write metric types, as in the prompb MetricMetadata enum
+const (
+	remoteCounter = 1
+	remoteGauge   = 2
+)
+
+// encodeWriteRequest builds the snappy-compressed WriteRequest for a batch
+// of snapshots. Series carry their samples in timestamp order and labels
+// sorted by name, as the protocol requires.
+func encodeWriteRequest(batch []models.SystemMetrics, extra []Label) ([]byte, error) {
+	sort.SliceStable(batch, func(i, j int) bool { return batch[i].Timestamp.Before(batch[j].Timestamp) })
+
+	byKey := make(map[string]*remoteSeries)
+	var order []*remoteSeries
+	metadata := make(map[string]Family)
+	var names []string
+
+	for _, m := range batch {
+		ts := m.Timestamp.UnixMilli()
+		for _, f := range Families(m) {
+			if _, ok := metadata[f.Name]; !ok {
+				metadata[f.Name] = f
+				names = append(names, f.Name)
+			}
+			name := sampleName(f)
+			for _, s := range f.Samples {
+				labels := make([]Label, 0, len(s.Labels)+len(extra)+1)
+				labels = append(labels, Label{"__name__", name})
+				labels = append(labels, extra...)
+				labels = append(labels, s.Labels...)
+				labels = sortLabels(labels)
+
+				key := labelKey(labels)
+				series, ok := byKey[key]
+				if !ok {
+					series = &remoteSeries{labels: labels}
+					byKey[key] = series
+					order = append(order, series)
+				}
+				series.samples = append(series.samples, remoteSample{value: s.Value, timestamp: ts})
+			}
+		}
+	}
+	if len(order) == 0 {
+		return nil, errors.New("nothing to send")
+	}
+
+	var req []byte
+	for _, series := range order {
+		req = protowire.AppendTag(req, 1, protowire.BytesType)
+		req = protowire.AppendBytes(req, encodeSeries(series))
+	}
+	for _, name := range names {
+		req = protowire.AppendTag(req, 3, protowire.BytesType)
+		req = protowire.AppendBytes(req, encodeMetadata(metadata[name]))
+	}
+	return snappy.Encode(nil, req), nil
+}
+
+// validLabelName reports whether name matches [a-zA-Z_][a-zA-Z0-9_]*
+func validLabelName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		switch {
+		case c == '_', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// sortLabels sorts labels by name; a label given twice keeps its last value
+func sortLabels(labels []Label) []Label {
+	sort.SliceStable(labels, func(i, j int) bool { return labels[i].Name < labels[j].Name })
+	out := labels[:0]
+	for _, l := range labels {
+		if n := len(out); n > 0 && out[n-1].Name == l.Name {
+			out[n-1] = l
+			continue
+		}
+		out = append(out, l)
+	}
+	return out
+}
+
+func labelKey(labels []Label) string {
+	var b strings.Builder
+	for _, l := range labels {
+		b.WriteString(l.Name)
+		b.WriteByte(0)
+		b.WriteString(l.Value)
+		b.WriteByte(0)
+	}
+	return b.String()
+}
+
+func encodeSeries(series *remoteSeries) []byte {
+	var b []byte
+	for _, l := range series.labels {
+		var label []byte
+		label = protowire.AppendTag(label, 1, protowire.BytesType)
+		label = protowire.AppendString(label, l.Name)
+		label = protowire.AppendTag(label, 2, protowire.BytesType)
+		label = protowire.AppendString(label, l.Value)
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, label)
+	}
+	for _, s := range series.samples {
+		var sample []byte
+		sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+		sample = protowire.AppendFixed64(sample, math.Float64bits(s.value))
+		sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+		sample = protowire.AppendVarint(sample, uint64(s.timestamp))
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendBytes(b, sample)
+	}
+	return b
+}
+
+func encodeMetadata(f Family) []byte {
+	typ := uint64(remoteGauge)
+	if f.Type == Counter {
+		typ = remoteCounter
+	}
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.VarintType)
+	b = protowire.AppendVarint(b, typ)
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	b = protowire.AppendString(b, sampleName(f))
+	b = protowire.AppendTag(b, 4, protowire.BytesType)
+	b = protowire.AppendString(b, f.Help)
+	if f.Unit != "" {
+		b = protowire.AppendTag(b, 5, protowire.BytesType)
+		b = protowire.AppendString(b, f.Unit)
+	}
+	return b
+}
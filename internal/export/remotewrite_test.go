@@ -0,0 +1,409 @@
+package export
+
+import (
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/kennethfeh/system-monitor/internal/models"
+)
+
+// receivedSeries is a series as decoded by the stand-in receiver
+type receivedSeries struct {
+	labels  map[string]string
+	samples []remoteSample
+}
+
+// receiver is a stand-in remote_write endpoint. status, when set, decides
+// the response to each request by its index.
+type receiver struct {
+	t      *testing.T
+	server *httptest.Server
+
+	mu       sync.Mutex
+	requests int
+	status   func(i int) int
+	series   []receivedSeries
+	metadata map[string]uint64
+}
+
+func newReceiver(t *testing.T) *receiver {
+	r := &receiver{t: t, metadata: make(map[string]uint64)}
+	r.server = httptest.NewServer(http.HandlerFunc(r.handle))
+	t.Cleanup(r.server.Close)
+	return r
+}
+
+func (r *receiver) handle(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.requests
+	r.requests++
+	if r.status != nil {
+		if code := r.status(i); code != http.StatusOK {
+			http.Error(w, "unavailable", code)
+			return
+		}
+	}
+
+	if req.Header.Get("Content-Encoding") != "snappy" || req.Header.Get("Content-Type") != "application/x-protobuf" {
+		r.t.Errorf("Unexpected headers %v", req.Header)
+	}
+	compressed, _ := io.ReadAll(req.Body)
+	body, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		r.t.Errorf("Invalid snappy body: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := r.decode(body); err != nil {
+		r.t.Errorf("Invalid WriteRequest: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+}
+
+// fields calls fn for each field of a protobuf message
+func fields(b []byte, fn func(num protowire.Number, typ protowire.Type, v []byte, u uint64) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		var v []byte
+		var u uint64
+		switch typ {
+		case protowire.BytesType:
+			v, n = protowire.ConsumeBytes(b)
+		case protowire.VarintType:
+			u, n = protowire.ConsumeVarint(b)
+		case protowire.Fixed64Type:
+			u, n = protowire.ConsumeFixed64(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		if err := fn(num, typ, v, u); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *receiver) decode(body []byte) error {
+	return fields(body, func(num protowire.Number, _ protowire.Type, v []byte, _ uint64) error {
+		switch num {
+		case 1:
+			s := receivedSeries{labels: make(map[string]string)}
+			err := fields(v, func(num protowire.Number, _ protowire.Type, v []byte, _ uint64) error {
+				switch num {
+				case 1:
+					var name, value string
+					err := fields(v, func(num protowire.Number, _ protowire.Type, v []byte, _ uint64) error {
+						if num == 1 {
+							name = string(v)
+						} else {
+							value = string(v)
+						}
+						return nil
+					})
+					s.labels[name] = value
+					return err
+				case 2:
+					var sample remoteSample
+					err := fields(v, func(num protowire.Number, _ protowire.Type, _ []byte, u uint64) error {
+						if num == 1 {
+							sample.value = math.Float64frombits(u)
+						} else {
+							sample.timestamp = int64(u)
+						}
+						return nil
+					})
+					s.samples = append(s.samples, sample)
+					return err
+				}
+				return nil
+			})
+			r.series = append(r.series, s)
+			return err
+		case 3:
+			var name string
+			var typ uint64
+			err := fields(v, func(num protowire.Number, _ protowire.Type, v []byte, u uint64) error {
+				switch num {
+				case 1:
+					typ = u
+				case 2:
+					name = string(v)
+				}
+				return nil
+			})
+			r.metadata[name] = typ
+			return err
+		}
+		return nil
+	})
+}
+
+// timestamps returns the sample times received for the series with name and
+// interface label
+func (r *receiver) timestamps(name, iface string) []int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var ts []int64
+	for _, s := range r.series {
+		if s.labels["__name__"] == name && s.labels["interface"] == iface {
+			for _, sample := range s.samples {
+				ts = append(ts, sample.timestamp)
+			}
+		}
+	}
+	return ts
+}
+
+func (r *receiver) requestCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.requests
+}
+
+// remoteTestMetric returns testSnapshot i seconds on, with i bytes received
+func remoteTestMetric(i int) models.SystemMetrics {
+	m := testSnapshot()
+	m.Timestamp = m.Timestamp.Add(time.Duration(i) * time.Second)
+	m.Network[0].BytesRecv = uint64(i)
+	return m
+}
+
+func remoteTestOptions(url string) RemoteWriteOptions {
+	return RemoteWriteOptions{
+		URL:           url,
+		Labels:        []Label{{"job", "system-monitor"}, {"instance", "host1"}},
+		BatchSize:     5,
+		FlushInterval: time.Hour,
+		MinBackoff:    time.Millisecond,
+		MaxBackoff:    5 * time.Millisecond,
+		MaxRetries:    2,
+	}
+}
+
+// waitFor polls cond until it holds or a second passes
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRemoteWriteBatches(t *testing.T) {
+	r := newReceiver(t)
+	w, err := NewRemoteWriter(remoteTestOptions(r.server.URL))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for i := 0; i < 12; i++ {
+		w.Push(remoteTestMetric(i))
+	}
+	waitFor(t, "two full batches", func() bool { return r.requestCount() == 2 })
+
+	// Close sends the partial batch
+	w.Close()
+	if n := r.requestCount(); n != 3 {
+		t.Errorf("Expected 3 requests, got %d", n)
+	}
+
+	ts := r.timestamps("sysmon_network_receive_bytes_total", "eth0")
+	if len(ts) != 12 {
+		t.Fatalf("Expected 12 samples, got %d", len(ts))
+	}
+	for i, got := range ts {
+		if want := remoteTestMetric(i).Timestamp.UnixMilli(); got != want {
+			t.Errorf("Sample %d: expected timestamp %d, got %d", i, want, got)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := r.series[0]
+	if s.labels["job"] != "system-monitor" || s.labels["instance"] != "host1" {
+		t.Errorf("Expected the extra labels on every series, got %v", s.labels)
+	}
+	if r.metadata["sysmon_network_receive_bytes_total"] != remoteCounter || r.metadata["sysmon_memory_total_bytes"] != remoteGauge {
+		t.Errorf("Unexpected metadata %v", r.metadata)
+	}
+}
+
+func TestRemoteWriteRetry(t *testing.T) {
+	r := newReceiver(t)
+	r.status = func(i int) int {
+		if i < 2 {
+			return http.StatusServiceUnavailable
+		}
+		return http.StatusOK
+	}
+	w, err := NewRemoteWriter(remoteTestOptions(r.server.URL))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		w.Push(remoteTestMetric(i))
+	}
+	waitFor(t, "the batch to be retried", func() bool { return r.requestCount() == 3 })
+	w.Close()
+
+	if n := r.requestCount(); n != 3 {
+		t.Errorf("Expected two failures and a success, got %d requests", n)
+	}
+	if ts := r.timestamps("sysmon_network_receive_bytes_total", "eth0"); len(ts) != 5 {
+		t.Errorf("Expected the batch to arrive after retrying, got %d samples", len(ts))
+	}
+}
+
+func TestRemoteWriteLabelNames(t *testing.T) {
+	for _, name := range []string{"", "__name__", "__meta", "1job", "job-name", "jöb", "job name"} {
+		opts := remoteTestOptions("http://localhost:9090/api/v1/write")
+		opts.Labels = append(opts.Labels, Label{name, "x"})
+		if w, err := NewRemoteWriter(opts); err == nil {
+			w.Close()
+			t.Errorf("Expected label %q to be rejected", name)
+		}
+	}
+	for _, name := range []string{"job", "_dc", "Region2"} {
+		opts := remoteTestOptions("http://localhost:9090/api/v1/write")
+		opts.Labels = []Label{{name, "x"}}
+		w, err := NewRemoteWriter(opts)
+		if err != nil {
+			t.Errorf("Expected label %q to be accepted, got %v", name, err)
+			continue
+		}
+		w.Close()
+	}
+}
+
+func TestRemoteWriteRejected(t *testing.T) {
+	r := newReceiver(t)
+	r.status = func(i int) int { return http.StatusBadRequest }
+	w, err := NewRemoteWriter(remoteTestOptions(r.server.URL))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		w.Push(remoteTestMetric(i))
+	}
+	waitFor(t, "the batch to be sent", func() bool { return r.requestCount() == 1 })
+	w.Close()
+
+	if n := r.requestCount(); n != 1 {
+		t.Errorf("Expected a rejected batch not to be retried, got %d requests", n)
+	}
+	if w.spill.len() != 0 {
+		t.Errorf("Expected a rejected batch not to be spilled, got %d", w.spill.len())
+	}
+}
+
+func TestRemoteWriteSpill(t *testing.T) {
+	dir := t.TempDir()
+	r := newReceiver(t)
+
+	var mu sync.Mutex
+	down := true
+	r.status = func(int) int {
+		mu.Lock()
+		defer mu.Unlock()
+		if down {
+			return http.StatusServiceUnavailable
+		}
+		return http.StatusOK
+	}
+
+	opts := remoteTestOptions(r.server.URL)
+	opts.SpillDir = dir
+	w, err := NewRemoteWriter(opts)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for i := 0; i < 15; i++ {
+		w.Push(remoteTestMetric(i))
+	}
+	w.Close()
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 spilled batches, got %d", len(entries))
+	}
+
+	// The next run resends the spilled batches before new data
+	mu.Lock()
+	down = false
+	mu.Unlock()
+	w, err = NewRemoteWriter(opts)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for i := 15; i < 20; i++ {
+		w.Push(remoteTestMetric(i))
+	}
+	w.Close()
+
+	ts := r.timestamps("sysmon_network_receive_bytes_total", "eth0")
+	if len(ts) != 20 {
+		t.Fatalf("Expected 20 samples, got %d", len(ts))
+	}
+	for i := 1; i < len(ts); i++ {
+		if ts[i] <= ts[i-1] {
+			t.Fatalf("Samples out of order: %v", ts)
+		}
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("Expected the spill queue to be empty, got %d files", len(entries))
+	}
+}
+
+func TestSpillQueueBound(t *testing.T) {
+	q, err := openSpillQueue(t.TempDir(), 25)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for i := 0; i < 4; i++ {
+		if _, err := q.push([]byte{byte(i), 0, 0, 0, 0, 0, 0, 0, 0, 0}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if q.len() != 2 {
+		t.Fatalf("Expected the oldest batches to be dropped, got %d", q.len())
+	}
+	if body, _ := q.peek(); body[0] != 2 {
+		t.Errorf("Expected batch 2 to be the oldest, got %d", body[0])
+	}
+
+	// Reopening finds the same batches in order
+	q, err = openSpillQueue(q.dir, 25)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if q.len() != 2 || q.size != 20 {
+		t.Errorf("Expected 2 batches of 20 bytes after reopening, got %d of %d", q.len(), q.size)
+	}
+	q.pop()
+	if body, _ := q.peek(); body[0] != 3 {
+		t.Errorf("Expected batch 3 next, got %d", body[0])
+	}
+}
@@ -0,0 +1,85 @@
+package export
+
+import (
+	"log"
+	"sync/atomic"
+
+	"github.com/kennethfeh/system-monitor/internal/models"
+)
+
+// Sink receives every collected snapshot. Push must not block the
+// collection loop and must not be called after Close.
+type Sink interface {
+	Push(m models.SystemMetrics)
+	Close() error
+}
+
+// DefaultQueueSize is how many snapshots a sink buffers while its
+// destination is slow; further snapshots are dropped
+const DefaultQueueSize = 100
+
+// queuedSink writes snapshots on its own goroutine from a bounded queue.
+// A failing destination is logged when it starts and stops failing rather
+// than on every snapshot.
+type queuedSink struct {
+	name    string
+	queue   chan models.SystemMetrics
+	write   func(models.SystemMetrics) error
+	close   func() error
+	dropped atomic.Int64
+	done    chan struct{}
+}
+
+func newQueuedSink(name string, size int, write func(models.SystemMetrics) error, close func() error) *queuedSink {
+	if size <= 0 {
+		size = DefaultQueueSize
+	}
+	s := &queuedSink{
+		name:  name,
+		queue: make(chan models.SystemMetrics, size),
+		write: write,
+		close: close,
+		done:  make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// Push queues a snapshot, dropping it when the queue is full
+func (s *queuedSink) Push(m models.SystemMetrics) {
+	select {
+	case s.queue <- m:
+	default:
+		s.dropped.Add(1)
+	}
+}
+
+// Close writes the queued snapshots and releases the destination
+func (s *queuedSink) Close() error {
+	close(s.queue)
+	<-s.done
+	if s.close != nil {
+		return s.close()
+	}
+	return nil
+}
+
+func (s *queuedSink) run() {
+	defer close(s.done)
+
+	failing := false
+	for m := range s.queue {
+		if n := s.dropped.Swap(0); n > 0 {
+			log.Printf("%s: dropped %d snapshots, the destination is too slow", s.name, n)
+		}
+		err := s.write(m)
+		switch {
+		case err != nil && !failing:
+			log.Printf("%s: %v (further errors are not logged until it recovers)", s.name, err)
+			failing = true
+		case err == nil && failing:
+			log.Printf("%s: recovered", s.name)
+			failing = false
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package export
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	spillExt = ".batch"
+	spillTmp = ".tmp"
+)
+
+// spillQueue is a FIFO of encoded batches awaiting delivery, bounded in
+// bytes. With a directory, each batch is a file named by its sequence
+// number, written to a temporary file and renamed so a crash never leaves
+// a partial batch; otherwise batches are held in memory.
+type spillQueue struct {
+	dir   string
+	max   int64
+	seqs  []uint64
+	sizes []int64
+	mem   [][]byte
+	size  int64
+	next  uint64
+}
+
+// openSpillQueue opens the queue in dir, picking up the batches left by a
+// previous run
+func openSpillQueue(dir string, max int64) (*spillQueue, error) {
+	q := &spillQueue{dir: dir, max: max}
+	if dir == "" {
+		return q, nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	sizes := make(map[uint64]int64)
+	for _, entry := range entries {
+		name := entry.Name()
+		switch {
+		case strings.HasSuffix(name, spillTmp):
+			os.Remove(filepath.Join(dir, name))
+		case strings.HasSuffix(name, spillExt):
+			seq, err := strconv.ParseUint(strings.TrimSuffix(name, spillExt), 10, 64)
+			if err != nil {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil {
+				return nil, err
+			}
+			sizes[seq] = info.Size()
+			q.seqs = append(q.seqs, seq)
+		}
+	}
+
+	sort.Slice(q.seqs, func(i, j int) bool { return q.seqs[i] < q.seqs[j] })
+	for _, seq := range q.seqs {
+		q.sizes = append(q.sizes, sizes[seq])
+		q.size += sizes[seq]
+	}
+	if n := len(q.seqs); n > 0 {
+		q.next = q.seqs[n-1] + 1
+	}
+	return q, nil
+}
+
+func (q *spillQueue) len() int {
+	return len(q.seqs)
+}
+
+func (q *spillQueue) path(seq uint64) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%020d%s", seq, spillExt))
+}
+
+// push appends a batch, dropping the oldest ones to stay within the size
+// bound, and returns how many were dropped
+func (q *spillQueue) push(body []byte) (int, error) {
+	seq := q.next
+	if q.dir != "" {
+		path := q.path(seq)
+		if err := os.WriteFile(path+spillTmp, body, 0o644); err != nil {
+			os.Remove(path + spillTmp)
+			return 0, err
+		}
+		if err := os.Rename(path+spillTmp, path); err != nil {
+			os.Remove(path + spillTmp)
+			return 0, err
+		}
+	} else {
+		q.mem = append(q.mem, body)
+	}
+	q.next++
+	q.seqs = append(q.seqs, seq)
+	q.sizes = append(q.sizes, int64(len(body)))
+	q.size += int64(len(body))
+
+	dropped := 0
+	for q.size > q.max && len(q.seqs) > 1 {
+		if err := q.pop(); err != nil {
+			return dropped, err
+		}
+		dropped++
+	}
+	return dropped, nil
+}
+
+// peek returns the oldest batch
+func (q *spillQueue) peek() ([]byte, error) {
+	if q.dir == "" {
+		return q.mem[0], nil
+	}
+	return os.ReadFile(q.path(q.seqs[0]))
+}
+
+// pop removes the oldest batch
+func (q *spillQueue) pop() error {
+	seq := q.seqs[0]
+	q.size -= q.sizes[0]
+	q.seqs, q.sizes = q.seqs[1:], q.sizes[1:]
+	if q.dir == "" {
+		q.mem = q.mem[1:]
+		return nil
+	}
+	if err := os.Remove(q.path(seq)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+package export
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kennethfeh/system-monitor/internal/models"
+)
+
+// StatsD packet size defaults. UDP datagrams stay within a typical
+// Ethernet MTU; Unix sockets take the larger buffer the DogStatsD agent
+// reads by default.
+const (
+	DefaultStatsDPacketSize     = 1432
+	DefaultStatsDUnixPacketSize = 8192
+)
+
+// StatsDOptions configures a StatsDWriter
+type StatsDOptions struct {
+	// Address is host:port or udp://host:port for UDP, or unix:///path for
+	// a Unix datagram socket
+	Address string
+	// Prefix replaces the "sysmon" namespace as the first name segment
+	Prefix string
+	// Tags are added to every metric, e.g. host
+	Tags []Label
+	// DogStatsD sends labels and tags in the |#name:value extension.
+	// Otherwise their values become name segments: tags after the prefix,
+	// labels after the metric name.
+	DogStatsD bool
+	// SampleRate is the share of metrics sent, in (0, 1]. Each metric is
+	// sent with this probability and marked so the aggregator scales
+	// counters back up.
+	SampleRate float64
+
+	PacketSize int
+	QueueSize  int
+}
+
+// StatsDWriter sends snapshots to a StatsD or DogStatsD aggregator. Gauges
+// are sent as they are; counters as the increase since the previous
+// snapshot, since StatsD counters are deltas.
+type StatsDWriter struct {
+	*queuedSink
+	opts    StatsDOptions
+	network string
+	addr    string
+	conn    net.Conn
+
+	counters map[string]float64
+	random   func() float64
+}
+
+// NewStatsDWriter validates opts and starts writing in the background.
+// The socket is opened on the first write, so the aggregator may start
+// later.
+func NewStatsDWriter(opts StatsDOptions) (*StatsDWriter, error) {
+	w := &StatsDWriter{opts: opts, network: "udp", addr: opts.Address, random: rand.Float64}
+	switch {
+	case strings.HasPrefix(opts.Address, "unix://"):
+		w.network, w.addr = "unixgram", strings.TrimPrefix(opts.Address, "unix://")
+		if w.opts.PacketSize <= 0 {
+			w.opts.PacketSize = DefaultStatsDUnixPacketSize
+		}
+	case strings.HasPrefix(opts.Address, "udp://"):
+		w.addr = strings.TrimPrefix(opts.Address, "udp://")
+	}
+	if w.network == "udp" {
+		if _, _, err := net.SplitHostPort(w.addr); err != nil {
+			return nil, err
+		}
+	} else if w.addr == "" {
+		return nil, fmt.Errorf("statsd address %q has no socket path", opts.Address)
+	}
+	if w.opts.PacketSize <= 0 {
+		w.opts.PacketSize = DefaultStatsDPacketSize
+	}
+	if w.opts.SampleRate <= 0 || w.opts.SampleRate > 1 {
+		w.opts.SampleRate = 1
+	}
+
+	w.queuedSink = newQueuedSink("StatsD", opts.QueueSize, w.write, w.closeConn)
+	return w, nil
+}
+
+func (w *StatsDWriter) closeConn() error {
+	if w.conn != nil {
+		return w.conn.Close()
+	}
+	return nil
+}
+
+// write sends a snapshot in packets of whole lines. After a failure the
+// socket is reopened on the next write.
+func (w *StatsDWriter) write(m models.SystemMetrics) error {
+	lines := w.encode(m)
+	if w.conn == nil {
+		conn, err := net.DialTimeout(w.network, w.addr, 10*time.Second)
+		if err != nil {
+			return err
+		}
+		w.conn = conn
+	}
+	err := splitPackets(lines, w.opts.PacketSize, func(packet []byte) error {
+		_, err := w.conn.Write(bytes.TrimSuffix(packet, []byte("\n")))
+		return err
+	})
+	if err != nil {
+		w.conn.Close()
+		w.conn = nil
+	}
+	return err
+}
+
+var (
+	statsdNameReplacer  = strings.NewReplacer(":", "_", "|", "_", "@", "_", "#", "_", ",", "_", "\n", "_", " ", "_")
+	statsdValueReplacer = strings.NewReplacer(",", "_", "|", "_", "\n", "_")
+)
+
+// statsdSegment makes a label value safe as a name segment
+func statsdSegment(s string) string {
+	if s == "" {
+		return "_"
+	}
+	return strings.ReplaceAll(statsdNameReplacer.Replace(s), ".", "_")
+}
+
+func statsdTag(l Label) string {
+	return statsdValueReplacer.Replace(l.Name) + ":" + statsdValueReplacer.Replace(l.Value)
+}
+
+// encode serialises a snapshot as newline-separated StatsD lines and
+// records the counter values for the next snapshot. A counter's first
+// value, and any NaN or infinite value, is not sent.
+func (w *StatsDWriter) encode(m models.SystemMetrics) []byte {
+	prefix := w.opts.Prefix
+	var tags []string
+	for _, tag := range w.opts.Tags {
+		if tag.Value == "" {
+			continue
+		}
+		if w.opts.DogStatsD {
+			tags = append(tags, statsdTag(tag))
+		} else {
+			prefix = joinPath(prefix, statsdSegment(tag.Value))
+		}
+	}
+
+	rate := ""
+	if w.opts.SampleRate < 1 {
+		rate = "|@" + strconv.FormatFloat(w.opts.SampleRate, 'g', -1, 64)
+	}
+
+	counters := make(map[string]float64)
+	var b bytes.Buffer
+	for _, f := range Families(m) {
+		name := statsdNameReplacer.Replace(joinPath(prefix, strings.TrimPrefix(f.Name, Namespace+"_")))
+		for _, s := range f.Samples {
+			if math.IsNaN(s.Value) || math.IsInf(s.Value, 0) {
+				continue
+			}
+
+			value, typ := s.Value, "g"
+			if f.Type == Counter {
+				key := f.Name + "\x00" + labelKey(s.Labels)
+				prev, ok := w.counters[key]
+				counters[key] = s.Value
+				if !ok {
+					continue
+				}
+				typ = "c"
+				if value = s.Value - prev; value < 0 {
+					// Reset, e.g. an interface that came back up
+					value = s.Value
+				}
+			}
+			if w.opts.SampleRate < 1 && w.random() >= w.opts.SampleRate {
+				continue
+			}
+
+			line := name
+			sampleTags := append([]string(nil), tags...)
+			for _, l := range s.Labels {
+				switch {
+				case !w.opts.DogStatsD:
+					line += "." + statsdSegment(l.Value)
+				case l.Value != "":
+					sampleTags = append(sampleTags, statsdTag(l))
+				}
+			}
+			suffix := "|" + typ + rate
+			if len(sampleTags) > 0 {
+				suffix += "|#" + strings.Join(sampleTags, ",")
+			}
+
+			formatted := strconv.FormatFloat(value, 'f', -1, 64)
+			if typ == "g" && value < 0 && !w.opts.DogStatsD {
+				// A signed gauge value is a relative change in StatsD, so
+				// a negative value is set by zeroing the gauge first
+				b.WriteString(line + ":0" + suffix + "\n")
+			}
+			b.WriteString(line + ":" + formatted + suffix + "\n")
+		}
+	}
+	w.counters = counters
+	return b.Bytes()
+}
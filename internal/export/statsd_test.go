@@ -0,0 +1,143 @@
+package export
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kennethfeh/system-monitor/internal/models"
+)
+
+// statsdTestMetric returns testSnapshot with recv bytes received and a
+// negative custom gauge
+func statsdTestMetric(recv uint64) models.SystemMetrics {
+	m := testSnapshot()
+	m.Network[0].BytesRecv = recv
+	m.Custom = map[string]interface{}{"app": map[string]interface{}{"temp": -5.0}}
+	return m
+}
+
+func statsdLines(b []byte) []string {
+	return strings.Split(strings.TrimSpace(string(b)), "\n")
+}
+
+func TestEncodeStatsD(t *testing.T) {
+	w := &StatsDWriter{opts: StatsDOptions{Prefix: "sysmon", Tags: []Label{{"host", "web.1"}}, SampleRate: 1}}
+
+	lines := statsdLines(w.encode(statsdTestMetric(100)))
+	for _, want := range []string{
+		"sysmon.web_1.memory_total_bytes:1073741824|g",
+		"sysmon.web_1.custom_value.app.temp:0|g",
+		"sysmon.web_1.custom_value.app.temp:-5|g",
+	} {
+		if !containsLine(lines, want) {
+			t.Errorf("Expected line %q in %q", want, lines)
+		}
+	}
+	for _, line := range lines {
+		if strings.Contains(line, "network_receive_bytes.") {
+			t.Errorf("Expected a counter's first value not to be sent, got %q", line)
+		}
+	}
+
+	// Counters are sent as the increase since the previous snapshot
+	lines = statsdLines(w.encode(statsdTestMetric(250)))
+	if want := "sysmon.web_1.network_receive_bytes.eth0:150|c"; !containsLine(lines, want) {
+		t.Errorf("Expected line %q in %q", want, lines)
+	}
+	lines = statsdLines(w.encode(statsdTestMetric(30)))
+	if want := "sysmon.web_1.network_receive_bytes.eth0:30|c"; !containsLine(lines, want) {
+		t.Errorf("Expected a reset counter to send its value, got %q", lines)
+	}
+}
+
+func TestEncodeDogStatsD(t *testing.T) {
+	w := &StatsDWriter{opts: StatsDOptions{Prefix: "sysmon", Tags: []Label{{"host", "web-1"}}, DogStatsD: true, SampleRate: 0.5}}
+	draw := 0.1
+	w.random = func() float64 { return draw }
+
+	w.encode(statsdTestMetric(100))
+	lines := statsdLines(w.encode(statsdTestMetric(250)))
+	for _, want := range []string{
+		"sysmon.network_receive_bytes:150|c|@0.5|#host:web-1,interface:eth0",
+		"sysmon.custom_value:-5|g|@0.5|#host:web-1,source:app,field:temp",
+	} {
+		if !containsLine(lines, want) {
+			t.Errorf("Expected line %q in %q", want, lines)
+		}
+	}
+
+	// Draws above the sample rate are not sent
+	draw = 0.9
+	if out := w.encode(statsdTestMetric(400)); len(out) != 0 {
+		t.Errorf("Expected every metric to be sampled out, got %q", out)
+	}
+}
+
+func TestStatsDUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer conn.Close()
+
+	w, err := NewStatsDWriter(StatsDOptions{Address: "udp://" + conn.LocalAddr().String(), PacketSize: 100})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	w.Push(statsdTestMetric(100))
+	w.Close()
+
+	buf := make([]byte, 2048)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if n > 100 || strings.HasSuffix(string(buf[:n]), "\n") {
+		t.Errorf("Expected a packet of whole lines within 100 bytes, got %q", buf[:n])
+	}
+}
+
+func TestStatsDUnix(t *testing.T) {
+	dir, err := os.MkdirTemp("", "statsd")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "dsd.sock")
+
+	conn, err := net.ListenPacket("unixgram", path)
+	if err != nil {
+		t.Skipf("Unix datagram sockets unavailable: %v", err)
+	}
+	defer conn.Close()
+
+	w, err := NewStatsDWriter(StatsDOptions{Address: "unix://" + path, DogStatsD: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	w.Push(statsdTestMetric(100))
+	w.Close()
+
+	buf := make([]byte, DefaultStatsDUnixPacketSize)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(string(buf[:n]), "memory_total_bytes:1073741824|g") {
+		t.Errorf("Unexpected packet %q", buf[:n])
+	}
+}
+
+func TestStatsDInvalidAddress(t *testing.T) {
+	for _, addr := range []string{"statsd", "unix://"} {
+		if _, err := NewStatsDWriter(StatsDOptions{Address: addr}); err == nil {
+			t.Errorf("Expected %q to be rejected", addr)
+		}
+	}
+}
@@ -8,17 +8,64 @@ type SystemMetrics struct {
 	CPU         CPUMetrics       `json:"cpu"`
 	Memory      MemoryMetrics    `json:"memory"`
 	Disk        []DiskMetrics    `json:"disk"`
+	DiskIO      []DiskIOMetrics  `json:"disk_io,omitempty"`
+	// DiskForecast is derived from the stored history of Disk rather than
+	// collected
+	DiskForecast []DiskForecast `json:"disk_forecast,omitempty"`
 	Network     []NetworkMetrics `json:"network"`
 	System      SystemInfo       `json:"system"`
+	Processes   []ProcessMetrics `json:"processes,omitempty"`
+	PSI         *PSIMetrics      `json:"psi,omitempty"`
+	Cgroups     []CgroupMetrics  `json:"cgroups,omitempty"`
 	Temperature []TempMetrics    `json:"temperature,omitempty"`
+
+	// Custom holds data from third-party metric sources, keyed by source name
+	Custom map[string]interface{} `json:"custom,omitempty"`
+
+	// Errors lists the sources whose latest run failed and
+	// CollectDurationMs how long the latest run of each source took
+	Errors            []CollectionError  `json:"errors,omitempty"`
+	CollectDurationMs map[string]float64 `json:"collect_duration_ms,omitempty"`
+
+	// SectionTimestamps records, per source, when the data it contributed
+	// to this snapshot was collected. Sources run at their own intervals,
+	// so sections can be older than Timestamp.
+	SectionTimestamps map[string]time.Time `json:"section_timestamps,omitempty"`
+}
+
+// CollectionError represents a metric source failure
+type CollectionError struct {
+	Source    string    `json:"source"`
+	Error     string    `json:"error"`
+	Timestamp time.Time `json:"timestamp"`
 }
 
-// CPUMetrics represents CPU usage information
+// CPUMetrics represents CPU usage information. Unavailable is set when
+// utilisation could not be read, in which case the percentages are not
+// meaningful.
 type CPUMetrics struct {
-	UsagePercent []float64 `json:"usage_percent"`
-	TotalPercent float64   `json:"total_percent"`
-	Cores        int       `json:"cores"`
-	LoadAvg      []float64 `json:"load_avg,omitempty"`
+	UsagePercent []float64        `json:"usage_percent"`
+	TotalPercent float64          `json:"total_percent"`
+	Modes        CPUModeMetrics   `json:"modes"`
+	CoreModes    []CPUModeMetrics `json:"core_modes,omitempty"`
+	Cores        int              `json:"cores"`
+	LoadAvg      []float64        `json:"load_avg,omitempty"`
+	Unavailable  bool             `json:"unavailable,omitempty"`
+}
+
+// CPUModeMetrics represents the percentage of CPU time spent in each mode
+// over the last collection interval. Guest time is included in User on
+// Linux and is reported separately for information only.
+type CPUModeMetrics struct {
+	User    float64 `json:"user"`
+	Nice    float64 `json:"nice"`
+	System  float64 `json:"system"`
+	Idle    float64 `json:"idle"`
+	Iowait  float64 `json:"iowait"`
+	Irq     float64 `json:"irq"`
+	Softirq float64 `json:"softirq"`
+	Steal   float64 `json:"steal"`
+	Guest   float64 `json:"guest"`
 }
 
 // MemoryMetrics represents memory usage information
@@ -45,17 +92,62 @@ type DiskMetrics struct {
 	UsedPercent float64 `json:"used_percent"`
 }
 
-// NetworkMetrics represents network interface statistics
+// DiskForecast is the usage trend of a filesystem fitted over its recent
+// history, which spans SpanSeconds. Confidence is the R² of the fit, from
+// 0 to 1. HoursToFull is how long until Free, the space left to
+// unprivileged users, runs out; it is only set for a filesystem that is
+// filling up with enough confidence.
+type DiskForecast struct {
+	Mountpoint         string   `json:"mountpoint"`
+	Total              uint64   `json:"total"`
+	Used               uint64   `json:"used"`
+	Free               uint64   `json:"free"`
+	GrowthBytesPerHour float64  `json:"growth_bytes_per_hour"`
+	Confidence         float64  `json:"confidence"`
+	Samples            int      `json:"samples"`
+	SpanSeconds        float64  `json:"span_seconds"`
+	HoursToFull        *float64 `json:"hours_to_full,omitempty"`
+}
+
+// DiskIOMetrics represents block device activity over the last collection
+// interval, in the spirit of iostat -x. Mountpoints lists the partitions
+// from DiskMetrics that live on this device.
+type DiskIOMetrics struct {
+	Device           string   `json:"device"`
+	Mountpoints      []string `json:"mountpoints,omitempty"`
+	ReadBytesPerSec  float64  `json:"read_bytes_per_sec"`
+	WriteBytesPerSec float64  `json:"write_bytes_per_sec"`
+	ReadOpsPerSec    float64  `json:"read_ops_per_sec"`
+	WriteOpsPerSec   float64  `json:"write_ops_per_sec"`
+	ReadAwaitMs      float64  `json:"read_await_ms"`
+	WriteAwaitMs     float64  `json:"write_await_ms"`
+	AwaitMs          float64  `json:"await_ms"`
+	QueueDepth       float64  `json:"queue_depth"`
+	InProgress       uint64   `json:"in_progress"`
+	BusyPercent      float64  `json:"busy_percent"`
+}
+
+// NetworkMetrics represents network interface statistics.
+// Rate fields are per-second values derived from the previous sample and
+// are zero until the collector has seen the interface twice.
 type NetworkMetrics struct {
-	Name        string `json:"name"`
-	BytesSent   uint64 `json:"bytes_sent"`
-	BytesRecv   uint64 `json:"bytes_recv"`
-	PacketsSent uint64 `json:"packets_sent"`
-	PacketsRecv uint64 `json:"packets_recv"`
-	Errin       uint64 `json:"errin"`
-	Errout      uint64 `json:"errout"`
-	Dropin      uint64 `json:"dropin"`
-	Dropout     uint64 `json:"dropout"`
+	Name            string  `json:"name"`
+	BytesSent       uint64  `json:"bytes_sent"`
+	BytesRecv       uint64  `json:"bytes_recv"`
+	PacketsSent     uint64  `json:"packets_sent"`
+	PacketsRecv     uint64  `json:"packets_recv"`
+	Errin           uint64  `json:"errin"`
+	Errout          uint64  `json:"errout"`
+	Dropin          uint64  `json:"dropin"`
+	Dropout         uint64  `json:"dropout"`
+	BytesSentRate   float64 `json:"bytes_sent_rate"`
+	BytesRecvRate   float64 `json:"bytes_recv_rate"`
+	PacketsSentRate float64 `json:"packets_sent_rate"`
+	PacketsRecvRate float64 `json:"packets_recv_rate"`
+	ErrinRate       float64 `json:"errin_rate"`
+	ErroutRate      float64 `json:"errout_rate"`
+	DropinRate      float64 `json:"dropin_rate"`
+	DropoutRate     float64 `json:"dropout_rate"`
 }
 
 // SystemInfo represents general system information
@@ -70,6 +162,148 @@ type SystemInfo struct {
 	Processes       uint64 `json:"processes"`
 }
 
+// ProcessMetrics represents one entry of the top-N process table. CPU
+// percent is relative to a single core; rates are per second over the
+// last collection interval.
+type ProcessMetrics struct {
+	PID              int32   `json:"pid"`
+	PPID             int32   `json:"ppid"`
+	Name             string  `json:"name"`
+	Cmdline          string  `json:"cmdline"`
+	Username         string  `json:"username"`
+	State            string  `json:"state"`
+	Threads          int32   `json:"threads"`
+	OpenFDs          int32   `json:"open_fds"`
+	CPUPercent       float64 `json:"cpu_percent"`
+	RSS              uint64  `json:"rss"`
+	ReadBytesPerSec  float64 `json:"read_bytes_per_sec"`
+	WriteBytesPerSec float64 `json:"write_bytes_per_sec"`
+}
+
+// ProcessDetail represents everything the monitor reports about a single
+// process. The environment is intentionally omitted as it commonly holds
+// secrets.
+type ProcessDetail struct {
+	PID              int32             `json:"pid"`
+	PPID             int32             `json:"ppid"`
+	Name             string            `json:"name"`
+	Cmdline          string            `json:"cmdline"`
+	Exe              string            `json:"exe"`
+	Cwd              string            `json:"cwd"`
+	Username         string            `json:"username"`
+	State            string            `json:"state"`
+	StartTime        time.Time         `json:"start_time"`
+	Threads          int32             `json:"threads"`
+	OpenFiles        int32             `json:"open_files"`
+	Cgroups          []string          `json:"cgroups,omitempty"`
+	Limits           []ProcessLimit    `json:"limits,omitempty"`
+	ListeningSockets []ListeningSocket `json:"listening_sockets,omitempty"`
+	Children         []int32           `json:"children"`
+}
+
+// ProcessLimit represents one resource limit of a process. Unlimited values
+// are reported as the maximum uint64 (RLIM_INFINITY).
+type ProcessLimit struct {
+	Resource string `json:"resource"`
+	Soft     uint64 `json:"soft"`
+	Hard     uint64 `json:"hard"`
+}
+
+// ListeningSocket represents a socket a process accepts traffic on
+type ListeningSocket struct {
+	Protocol string `json:"protocol"`
+	Address  string `json:"address"`
+	Port     uint32 `json:"port"`
+}
+
+// ProcessNode represents a process in the parent/child hierarchy
+type ProcessNode struct {
+	PID      int32          `json:"pid"`
+	Name     string         `json:"name"`
+	Children []*ProcessNode `json:"children,omitempty"`
+}
+
+// PSIMetrics represents Linux pressure stall information. It is omitted
+// entirely when the kernel does not support PSI.
+type PSIMetrics struct {
+	CPU    PSIResource `json:"cpu"`
+	Memory PSIResource `json:"memory"`
+	IO     PSIResource `json:"io"`
+}
+
+// PSIResource represents the pressure on one resource. Some is the share of
+// time at least one task was stalled, Full the share of time all non-idle
+// tasks were stalled at once; Full is nil where the kernel does not report it.
+type PSIResource struct {
+	Some PSIStats  `json:"some"`
+	Full *PSIStats `json:"full,omitempty"`
+}
+
+// PSIStats represents stall percentages averaged over 10s, 60s and 300s
+// windows plus the cumulative stall time in microseconds
+type PSIStats struct {
+	Avg10       float64 `json:"avg10"`
+	Avg60       float64 `json:"avg60"`
+	Avg300      float64 `json:"avg300"`
+	TotalMicros uint64  `json:"total_us"`
+}
+
+// CgroupMetrics represents resource accounting for one control group.
+// Path is relative to the cgroup filesystem root, "/" being the root cgroup.
+type CgroupMetrics struct {
+	Path     string       `json:"path"`
+	CPU      CgroupCPU    `json:"cpu"`
+	Memory   CgroupMemory `json:"memory"`
+	IO       CgroupIO     `json:"io"`
+	Pids     CgroupPids   `json:"pids"`
+	Pressure *PSIMetrics  `json:"pressure,omitempty"`
+}
+
+// CgroupCPU represents CPU usage and CFS throttling of a cgroup. Usage
+// percent is relative to a single core.
+type CgroupCPU struct {
+	UsagePercent     float64 `json:"usage_percent"`
+	UsageMicros      uint64  `json:"usage_us"`
+	Periods          uint64  `json:"nr_periods"`
+	ThrottledPeriods uint64  `json:"nr_throttled"`
+	ThrottledMicros  uint64  `json:"throttled_us"`
+}
+
+// CgroupMemory represents memory usage of a cgroup. Max is zero when the
+// cgroup has no limit.
+type CgroupMemory struct {
+	Current uint64             `json:"current"`
+	Max     uint64             `json:"max"`
+	Events  CgroupMemoryEvents `json:"events"`
+}
+
+// CgroupMemoryEvents represents the cumulative memory.events counters. On
+// cgroup v1 only Max (limit hits) and OOMKill are available.
+type CgroupMemoryEvents struct {
+	Low     uint64 `json:"low"`
+	High    uint64 `json:"high"`
+	Max     uint64 `json:"max"`
+	OOM     uint64 `json:"oom"`
+	OOMKill uint64 `json:"oom_kill"`
+}
+
+// CgroupIO represents block I/O of a cgroup summed over all devices
+type CgroupIO struct {
+	ReadBytes        uint64  `json:"read_bytes"`
+	WriteBytes       uint64  `json:"write_bytes"`
+	ReadOps          uint64  `json:"read_ops"`
+	WriteOps         uint64  `json:"write_ops"`
+	ReadBytesPerSec  float64 `json:"read_bytes_per_sec"`
+	WriteBytesPerSec float64 `json:"write_bytes_per_sec"`
+}
+
+// CgroupPids represents the task count of a cgroup. Max is zero when the
+// cgroup has no limit.
+type CgroupPids struct {
+	Current uint64 `json:"current"`
+	Max     uint64 `json:"max"`
+}
+
 // TempMetrics represents temperature sensor readings
 type TempMetrics struct {
 	SensorKey   string  `json:"sensor_key"`
@@ -0,0 +1,302 @@
+package storage
+
+import (
+	"fmt"
+	"math/rand"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kennethfeh/system-monitor/internal/models"
+)
+
+// The benchmarks compare the slice of whole snapshots the in-memory storage
+// used to keep with MetricsStorage, for an hour of 2s samples of a host
+// with 8 cores, 3 disks and 3 network interfaces. Adding and reading the
+// history use the default configuration, which keeps the snapshots whole
+// as the slice did; memory and series reads compare holding the hour in
+// the slice with holding it as columns under a raw retention:
+//
+//	go test ./internal/storage -run '^$' -bench . -benchmem
+
+const (
+	benchSize    = 1800
+	benchHistory = 60
+)
+
+// sliceStorage is the slice of whole snapshots the in-memory storage used
+// to keep
+type sliceStorage struct {
+	mu      sync.RWMutex
+	metrics []models.SystemMetrics
+	maxSize int
+}
+
+func (s *sliceStorage) Add(metric models.SystemMetrics) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.metrics = append(s.metrics, metric)
+	if len(s.metrics) > s.maxSize {
+		s.metrics = s.metrics[len(s.metrics)-s.maxSize:]
+	}
+}
+
+func (s *sliceStorage) GetHistory() []models.SystemMetrics {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	history := make([]models.SystemMetrics, len(s.metrics))
+	copy(history, s.metrics)
+	return history
+}
+
+// retentionStorage returns a storage keeping the default history whole and
+// an hour of series
+func retentionStorage(b *testing.B) *MetricsStorage {
+	s := NewMetricsStorage(benchHistory)
+	if err := s.SetRetention(RetentionPolicy{Raw: time.Hour}); err != nil {
+		b.Fatal(err)
+	}
+	return s
+}
+
+// benchSnapshot returns snapshot i of a slowly changing host. Noise is
+// seeded per snapshot so every run sees the same data.
+func benchSnapshot(i int) models.SystemMetrics {
+	rng := rand.New(rand.NewSource(int64(i)))
+	noise := func(base, spread float64) float64 {
+		return base + spread*(rng.Float64()-0.5)
+	}
+
+	m := models.SystemMetrics{
+		Timestamp: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(i) * 2 * time.Second),
+		CPU: models.CPUMetrics{
+			TotalPercent: noise(25, 10),
+			Cores:        8,
+			LoadAvg:      []float64{noise(1.5, 0.2), 1.4, 1.2},
+			Modes:        models.CPUModeMetrics{User: noise(18, 5), System: noise(6, 2), Idle: noise(75, 10)},
+		},
+		Memory: models.MemoryMetrics{
+			Total:       16 << 30,
+			Used:        uint64(8<<30 + i*4096),
+			Available:   uint64(8<<30 - i*4096),
+			UsedPercent: 50 + float64(i)/1000,
+			SwapTotal:   2 << 30,
+		},
+		System: models.SystemInfo{Hostname: "bench", Uptime: uint64(86400 + 2*i)},
+	}
+	for c := 0; c < 8; c++ {
+		m.CPU.UsagePercent = append(m.CPU.UsagePercent, noise(25, 20))
+		m.CPU.CoreModes = append(m.CPU.CoreModes, models.CPUModeMetrics{User: noise(18, 10), System: noise(6, 4), Idle: noise(75, 20)})
+	}
+	for d, mount := range []string{"/", "/home", "/var"} {
+		used := uint64(100<<30 + d<<30 + i*512)
+		m.Disk = append(m.Disk, models.DiskMetrics{
+			Device:      fmt.Sprintf("/dev/sda%d", d+1),
+			Mountpoint:  mount,
+			Fstype:      "ext4",
+			Total:       500 << 30,
+			Used:        used,
+			Free:        500<<30 - used,
+			UsedPercent: float64(used) / float64(500<<30) * 100,
+		})
+		m.DiskIO = append(m.DiskIO, models.DiskIOMetrics{
+			Device:           fmt.Sprintf("sd%c", 'a'+d),
+			ReadBytesPerSec:  noise(1<<20, 1<<19),
+			WriteBytesPerSec: noise(2<<20, 1<<20),
+			ReadOpsPerSec:    noise(40, 20),
+			WriteOpsPerSec:   noise(80, 30),
+			BusyPercent:      noise(5, 4),
+		})
+	}
+	for n, name := range []string{"eth0", "eth1", "lo"} {
+		m.Network = append(m.Network, models.NetworkMetrics{
+			Name:          name,
+			BytesSent:     uint64(1<<30 + n<<20 + i*150000),
+			BytesRecv:     uint64(4<<30 + n<<20 + i*600000),
+			PacketsSent:   uint64(1e6 + i*120),
+			PacketsRecv:   uint64(3e6 + i*450),
+			BytesSentRate: noise(75000, 20000),
+			BytesRecvRate: noise(300000, 80000),
+		})
+	}
+	return m
+}
+
+func benchSnapshots(b *testing.B) []models.SystemMetrics {
+	b.Helper()
+	snapshots := make([]models.SystemMetrics, benchSize)
+	for i := range snapshots {
+		snapshots[i] = benchSnapshot(i)
+	}
+	return snapshots
+}
+
+// heapInUse returns the live heap after a collection
+func heapInUse() uint64 {
+	runtime.GC()
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	return ms.HeapAlloc
+}
+
+func BenchmarkMemorySlice(b *testing.B) {
+	var bytes uint64
+	for n := 0; n < b.N; n++ {
+		before := heapInUse()
+		held := make([]models.SystemMetrics, 0, benchSize)
+		for i := 0; i < benchSize; i++ {
+			held = append(held, benchSnapshot(i))
+		}
+		bytes += heapInUse() - before
+		runtime.KeepAlive(held)
+	}
+	b.ReportMetric(float64(bytes)/float64(b.N)/benchSize, "bytes/snapshot")
+}
+
+func BenchmarkMemoryStorage(b *testing.B) {
+	snapshots := benchSnapshots(b)
+
+	var bytes uint64
+	for n := 0; n < b.N; n++ {
+		before := heapInUse()
+		s := retentionStorage(b)
+		for _, m := range snapshots {
+			s.Add(m)
+		}
+		bytes += heapInUse() - before
+		runtime.KeepAlive(s)
+	}
+	b.ReportMetric(float64(bytes)/float64(b.N)/benchSize, "bytes/snapshot")
+}
+
+func BenchmarkAddSlice(b *testing.B) {
+	snapshots := benchSnapshots(b)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		s := &sliceStorage{maxSize: benchHistory}
+		for _, m := range snapshots {
+			s.Add(m)
+		}
+	}
+	b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N)/benchSize, "ns/snapshot")
+}
+
+func BenchmarkAddStorage(b *testing.B) {
+	snapshots := benchSnapshots(b)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		s := NewMetricsStorage(benchHistory)
+		for _, m := range snapshots {
+			s.Add(m)
+		}
+	}
+	b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N)/benchSize, "ns/snapshot")
+}
+
+// BenchmarkAddStorageRetention measures Add when the snapshots are also
+// encoded into the columns
+func BenchmarkAddStorageRetention(b *testing.B) {
+	snapshots := benchSnapshots(b)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		s := retentionStorage(b)
+		for _, m := range snapshots {
+			s.Add(m)
+		}
+	}
+	b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N)/benchSize, "ns/snapshot")
+}
+
+// BenchmarkReadSeriesSlice reads one series the way the slice of snapshots
+// has to: by flattening every snapshot in range
+func BenchmarkReadSeriesSlice(b *testing.B) {
+	snapshots := benchSnapshots(b)
+	start, end := snapshots[0].Timestamp, snapshots[len(snapshots)-1].Timestamp
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		series := make(map[string][]SeriesPoint)
+		for _, m := range snapshots {
+			if inRange(m.Timestamp, start, end) {
+				rawSeries(series, m.Timestamp, flatten(m), []string{"cpu.total_percent"})
+			}
+		}
+		if len(series["cpu.total_percent"]) != benchSize {
+			b.Fatal("Missing points")
+		}
+	}
+}
+
+func BenchmarkReadSeriesStorage(b *testing.B) {
+	snapshots := benchSnapshots(b)
+	s := retentionStorage(b)
+	for _, m := range snapshots {
+		s.Add(m)
+	}
+	start, end := snapshots[0].Timestamp, snapshots[len(snapshots)-1].Timestamp
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		result, err := s.Query(start, end, []string{"cpu.total_percent"})
+		if err != nil || len(result.Series["cpu.total_percent"]) != benchSize {
+			b.Fatal("Missing points")
+		}
+	}
+}
+
+// BenchmarkGetHistorySlice measures the copy the slice of snapshots made
+// for every history request and WebSocket connection
+func BenchmarkGetHistorySlice(b *testing.B) {
+	s := &sliceStorage{maxSize: benchHistory}
+	for _, m := range benchSnapshots(b) {
+		s.Add(m)
+	}
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if len(s.GetHistory()) != benchHistory {
+			b.Fatal("Unexpected history size")
+		}
+	}
+}
+
+func BenchmarkGetHistoryStorage(b *testing.B) {
+	s := retentionStorage(b)
+	for _, m := range benchSnapshots(b) {
+		s.Add(m)
+	}
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if len(s.GetHistory()) != benchHistory {
+			b.Fatal("Unexpected history size")
+		}
+	}
+}
+
+// BenchmarkQueryDiskStorage reads the disk series the forecast is fitted
+// from out of an hour of segments, each snapshot holding a process table
+func BenchmarkQueryDiskStorage(b *testing.B) {
+	s, err := OpenDiskStorage(DiskOptions{Dir: b.TempDir(), SegmentSize: 1 << 20})
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer s.Close()
+	snapshots := benchSnapshots(b)
+	for _, m := range snapshots {
+		for p := 0; p < 20; p++ {
+			m.Processes = append(m.Processes, models.ProcessMetrics{PID: int32(p), Name: "worker", Cmdline: "/usr/bin/worker --serve", CPUPercent: float64(p), RSS: 64 << 20})
+		}
+		if err := s.Add(m); err != nil {
+			b.Fatal(err)
+		}
+	}
+	start, end := snapshots[0].Timestamp, snapshots[len(snapshots)-1].Timestamp
+	fields := []string{"disk.*.used", "disk.*.free", "disk.*.total"}
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		result, err := s.Query(start, end, fields)
+		if err != nil || len(result.Series["disk./.used"]) != benchSize {
+			b.Fatal("Missing points")
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"time"
+)
+
+// column is one compressed series, split into chunks so expired data can
+// be dropped and range reads can skip what they do not need
+type column struct {
+	chunks []*xorChunk
+}
+
+func (c *column) append(t int64, v float64) {
+	n := len(c.chunks)
+	if n == 0 || c.chunks[n-1].count >= chunkPoints {
+		if n > 0 {
+			c.chunks[n-1].close()
+		}
+		c.chunks = append(c.chunks, &xorChunk{})
+		n++
+	}
+	c.chunks[n-1].append(t, v)
+}
+
+// prune drops the chunks holding only points before cutoff
+func (c *column) prune(cutoff int64) {
+	n := 0
+	for n < len(c.chunks) && c.chunks[n].maxT < cutoff {
+		n++
+	}
+	if n > 0 {
+		c.chunks = append([]*xorChunk(nil), c.chunks[n:]...)
+	}
+}
+
+// each calls fn for every point with start <= t <= end
+func (c *column) each(start, end int64, fn func(t int64, v float64)) {
+	for _, chunk := range c.chunks {
+		if chunk.maxT < start || chunk.minT > end {
+			continue
+		}
+		it := chunk.iterator()
+		for it.next() {
+			if t, v := it.at(); t >= start && t <= end {
+				fn(t, v)
+			}
+		}
+	}
+}
+
+// count returns the number of points at or after cutoff. Only chunks
+// straddling the cutoff need decoding.
+func (c *column) count(cutoff int64) int {
+	n := 0
+	for _, chunk := range c.chunks {
+		if chunk.minT >= cutoff {
+			n += chunk.count
+			continue
+		}
+		it := chunk.iterator()
+		for it.next() {
+			if t, _ := it.at(); t >= cutoff {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// first returns the earliest point at or after cutoff
+func (c *column) first(cutoff int64) (int64, bool) {
+	for _, chunk := range c.chunks {
+		if chunk.maxT < cutoff {
+			continue
+		}
+		it := chunk.iterator()
+		for it.next() {
+			if t, _ := it.at(); t >= cutoff {
+				return t, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// columnStore keeps snapshots as one compressed column per series, plus
+// a column of snapshot timestamps. Timestamps are kept to the millisecond.
+type columnStore struct {
+	times  column
+	series map[string]*column
+	cutoff int64
+}
+
+func newColumnStore() *columnStore {
+	return &columnStore{series: make(map[string]*column)}
+}
+
+// add appends the flattened values of one snapshot
+func (cs *columnStore) add(ts time.Time, values map[string]float64) {
+	t := ts.UnixMilli()
+	cs.times.append(t, 0)
+	for name, v := range values {
+		col, ok := cs.series[name]
+		if !ok {
+			col = &column{}
+			cs.series[name] = col
+		}
+		col.append(t, v)
+	}
+}
+
+// prune expires the points before cutoff. Chunks are dropped once all
+// their points have expired; until then the expired points are skipped.
+func (cs *columnStore) prune(cutoff time.Time) {
+	cs.cutoff = cutoff.UnixMilli()
+	cs.times.prune(cs.cutoff)
+	for name, col := range cs.series {
+		col.prune(cs.cutoff)
+		if len(col.chunks) == 0 {
+			delete(cs.series, name)
+		}
+	}
+}
+
+// size returns the number of snapshots held
+func (cs *columnStore) size() int {
+	return cs.times.count(cs.cutoff)
+}
+
+// oldest returns the timestamp of the oldest snapshot held
+func (cs *columnStore) oldest() (time.Time, bool) {
+	t, ok := cs.times.first(cs.cutoff)
+	return time.UnixMilli(t), ok
+}
+
+// query returns the points of the series matching fields between start
+// and end. Only the matching columns are decoded.
+func (cs *columnStore) query(start, end time.Time, fields []string) map[string][]SeriesPoint {
+	from, to := start.UnixMilli(), end.UnixMilli()
+	if from < cs.cutoff {
+		from = cs.cutoff
+	}
+
+	result := make(map[string][]SeriesPoint)
+	for name, col := range cs.series {
+		if !matchFields(fields, name) {
+			continue
+		}
+		var points []SeriesPoint
+		col.each(from, to, func(t int64, v float64) {
+			points = append(points, rawPoint(time.UnixMilli(t), v))
+		})
+		if len(points) > 0 {
+			result[name] = points
+		}
+	}
+	return result
+}
+
+// reset discards every series
+func (cs *columnStore) reset() {
+	*cs = *newColumnStore()
+}
@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestColumnStore(t *testing.T) {
+	cs := newColumnStore()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 3*chunkPoints; i++ {
+		values := map[string]float64{"cpu.total_percent": float64(i)}
+		if i < 10 {
+			values["disk./mnt.used_percent"] = 50
+		}
+		cs.add(start.Add(time.Duration(i)*time.Second), values)
+	}
+
+	if cs.size() != 3*chunkPoints {
+		t.Errorf("Expected %d snapshots, got %d", 3*chunkPoints, cs.size())
+	}
+
+	result := cs.query(start.Add(100*time.Second), start.Add(109*time.Second), []string{"cpu.*"})
+	points := result["cpu.total_percent"]
+	if len(result) != 1 || len(points) != 10 {
+		t.Fatalf("Expected 10 points of one series, got %+v", result)
+	}
+	if !points[0].Timestamp.Equal(start.Add(100*time.Second)) || points[9].Last != 109 {
+		t.Errorf("Unexpected points %+v", points)
+	}
+
+	// Pruning inside the second chunk drops the first chunk and the series
+	// that ended there, and hides the expired half of the second chunk
+	cs.prune(start.Add(time.Duration(chunkPoints+60) * time.Second))
+	if len(cs.times.chunks) != 2 {
+		t.Errorf("Expected the first chunk to be dropped, got %d chunks", len(cs.times.chunks))
+	}
+	if _, ok := cs.series["disk./mnt.used_percent"]; ok {
+		t.Error("Expected the expired series to be dropped")
+	}
+	if cs.size() != 2*chunkPoints-60 {
+		t.Errorf("Expected %d snapshots after pruning, got %d", 2*chunkPoints-60, cs.size())
+	}
+	if oldest, _ := cs.oldest(); !oldest.Equal(start.Add(time.Duration(chunkPoints+60) * time.Second)) {
+		t.Errorf("Unexpected oldest snapshot %v", oldest)
+	}
+	if n := len(cs.query(start, start.Add(time.Hour), nil)["cpu.total_percent"]); n != 2*chunkPoints-60 {
+		t.Errorf("Expected expired points to be skipped, got %d points", n)
+	}
+
+	cs.reset()
+	if cs.size() != 0 {
+		t.Errorf("Expected empty store after reset, got %d", cs.size())
+	}
+	if _, ok := cs.oldest(); ok {
+		t.Error("Expected no oldest snapshot after reset")
+	}
+}
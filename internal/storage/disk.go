@@ -0,0 +1,817 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kennethfeh/system-monitor/internal/models"
+)
+
+// DefaultSegmentSize is the write-ahead log size at which it is sealed
+// into a segment
+const DefaultSegmentSize = 8 << 20
+
+const (
+	walFileName   = "wal.log"
+	walMagic      = "SMWAL001"
+	walHeader     = len(walMagic) + 8
+	segmentExt    = ".seg"
+	tmpExt        = ".tmp"
+	corruptExt    = ".corrupt"
+	segmentMagic  = "SMSEG001"
+	segmentHeader = len(segmentMagic) + 8 + 4 + 8 + 8 + 4
+)
+
+// ErrClosed is returned when writing to a closed DiskStorage
+var ErrClosed = errors.New("storage closed")
+
+// DiskOptions configures a DiskStorage. Zero values fall back to
+// DefaultSegmentSize and the in-memory storage's default history size.
+type DiskOptions struct {
+	// Dir holds the write-ahead log and segments; it is created if missing
+	Dir string
+	// SegmentSize is the write-ahead log size in bytes that triggers sealing
+	SegmentSize int64
+	// HistorySize is the number of recent snapshots served by GetHistory
+	HistorySize int
+	// Retention expires old segments and configures the rollup tiers
+	Retention RetentionPolicy
+}
+
+// segmentInfo is the header of a sealed segment
+type segmentInfo struct {
+	path    string
+	seq     uint64
+	count   int
+	minTime time.Time
+	maxTime time.Time
+}
+
+// DiskStorage is a durable, append-only Storage. Every snapshot is written
+// to a write-ahead log and synced before Add returns. When the log grows
+// past the segment size its records are sealed into an immutable,
+// gzip-compressed segment file and the log starts over.
+//
+// The data directory contains:
+//
+//	wal.log      the active write-ahead log
+//	<seq>.seg    sealed segments, numbered in the order they were written
+//	rollup-*.log one log of finished buckets per rollup tier
+//	*.tmp        files being written, discarded on open
+//
+// The log and each segment carry a sequence number, and every record a
+// CRC-32C checksum. On open, a torn or corrupt record at the end of the
+// log is truncated away, and a log whose sequence number was already
+// sealed (a crash between sealing and emptying the log) is discarded.
+type DiskStorage struct {
+	mu       sync.RWMutex
+	opts     DiskOptions
+	wal      *os.File
+	walSeq   uint64
+	walSize  int64
+	pending  []models.SystemMetrics
+	segments []segmentInfo
+	recent   []models.SystemMetrics
+
+	// corrupt holds the segments a range read found damaged, to be set
+	// aside by the next Add
+	corruptMu sync.Mutex
+	corrupt   map[string]bool
+	rollups   *rollupSet
+	tierLogs  []*os.File
+}
+
+// OpenDiskStorage opens or creates a disk storage in opts.Dir and recovers
+// its contents
+func OpenDiskStorage(opts DiskOptions) (*DiskStorage, error) {
+	if opts.Dir == "" {
+		return nil, errors.New("storage directory not set")
+	}
+	if opts.SegmentSize <= 0 {
+		opts.SegmentSize = DefaultSegmentSize
+	}
+	if opts.HistorySize <= 0 {
+		opts.HistorySize = 60
+	}
+	if err := opts.Retention.Validate(); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(opts.Dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	s := &DiskStorage{opts: opts, rollups: newRollupSet(opts.Retention.Tiers)}
+	if err := s.loadSegments(); err != nil {
+		return nil, err
+	}
+	err := s.replayWAL()
+	if err == nil {
+		err = s.loadRecent()
+	}
+	if err == nil && len(s.recent) > 0 {
+		err = s.expireSegments(s.recent[len(s.recent)-1].Timestamp)
+	}
+	if err == nil {
+		err = s.loadRollups()
+	}
+	if err != nil {
+		s.closeFiles()
+		return nil, err
+	}
+	return s, nil
+}
+
+// loadSegments removes leftover temporary files and reads the header of
+// every sealed segment. A segment whose header cannot be read is renamed
+// aside with corruptExt, losing its data but not the rest of the store;
+// one whose records are damaged is set aside once they are read.
+func (s *DiskStorage) loadSegments() error {
+	entries, err := os.ReadDir(s.opts.Dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		path := filepath.Join(s.opts.Dir, entry.Name())
+		switch {
+		case strings.HasSuffix(entry.Name(), tmpExt):
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+		case strings.HasSuffix(entry.Name(), segmentExt):
+			info, err := readSegmentInfo(path)
+			if err != nil {
+				if err := setAsideSegment(path, err); err != nil {
+					return err
+				}
+				continue
+			}
+			s.segments = append(s.segments, info)
+		}
+	}
+
+	sort.Slice(s.segments, func(i, j int) bool {
+		return s.segments[i].seq < s.segments[j].seq
+	})
+	return nil
+}
+
+// lastSealed returns the sequence number of the newest segment
+func (s *DiskStorage) lastSealed() uint64 {
+	if n := len(s.segments); n > 0 {
+		return s.segments[n-1].seq
+	}
+	return 0
+}
+
+// replayWAL loads the write-ahead log into pending, truncating a damaged
+// tail. A log that was already sealed is emptied instead.
+func (s *DiskStorage) replayWAL() error {
+	path := filepath.Join(s.opts.Dir, walFileName)
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	s.wal = f
+
+	header := make([]byte, walHeader)
+	if _, err := io.ReadFull(f, header); err != nil || string(header[:len(walMagic)]) != walMagic {
+		// New log, or one torn while writing its header
+		return s.resetWAL(s.lastSealed() + 1)
+	}
+	seq := binary.LittleEndian.Uint64(header[len(walMagic):])
+	if seq <= s.lastSealed() {
+		return s.resetWAL(s.lastSealed() + 1)
+	}
+
+	var records []models.SystemMetrics
+	valid, err := readRecords(f, func(payload []byte) error {
+		var m models.SystemMetrics
+		if err := json.Unmarshal(payload, &m); err != nil {
+			return fmt.Errorf("%w: %v", ErrCorrupt, err)
+		}
+		records = append(records, m)
+		return nil
+	})
+	if err != nil && !errors.Is(err, ErrCorrupt) {
+		return err
+	}
+	if err != nil {
+		log.Printf("Storage: truncating write-ahead log after %d records: %v", len(records), err)
+	}
+
+	size := int64(walHeader) + valid
+	if err := f.Truncate(size); err != nil {
+		return err
+	}
+	if _, err := f.Seek(size, io.SeekStart); err != nil {
+		return err
+	}
+	s.walSeq = seq
+	s.walSize = size
+	s.pending = records
+	return nil
+}
+
+// resetWAL empties the write-ahead log and starts it with sequence seq
+func (s *DiskStorage) resetWAL(seq uint64) error {
+	if err := s.wal.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := s.wal.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	header := make([]byte, walHeader)
+	copy(header, walMagic)
+	binary.LittleEndian.PutUint64(header[len(walMagic):], seq)
+	if _, err := s.wal.Write(header); err != nil {
+		return err
+	}
+	s.walSeq = seq
+	s.walSize = int64(walHeader)
+	return s.wal.Sync()
+}
+
+// loadRecent fills the GetHistory buffer from the newest records
+func (s *DiskStorage) loadRecent() error {
+	recent := s.pending
+	for i := len(s.segments) - 1; i >= 0 && len(recent) < s.opts.HistorySize; i-- {
+		records, err := readSegment(s.segments[i].path, decodeRecord)
+		if errors.Is(err, ErrCorrupt) {
+			if err := setAsideSegment(s.segments[i].path, err); err != nil {
+				return err
+			}
+			s.segments = append(s.segments[:i], s.segments[i+1:]...)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		recent = append(records, recent...)
+	}
+	if len(recent) > s.opts.HistorySize {
+		recent = recent[len(recent)-s.opts.HistorySize:]
+	}
+	s.recent = append([]models.SystemMetrics(nil), recent...)
+	return nil
+}
+
+// Add appends a snapshot to the write-ahead log and syncs it to disk
+func (s *DiskStorage) Add(metric models.SystemMetrics) error {
+	payload, err := json.Marshal(metric)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.wal == nil {
+		return ErrClosed
+	}
+
+	n, err := writeRecord(s.wal, payload)
+	if err == nil {
+		err = s.wal.Sync()
+	}
+	if err != nil {
+		// Drop the partial record so later appends stay readable
+		if terr := s.wal.Truncate(s.walSize); terr == nil {
+			s.wal.Seek(s.walSize, io.SeekStart)
+		}
+		return err
+	}
+	s.walSize += int64(n)
+
+	s.pending = append(s.pending, metric)
+	s.recent = append(s.recent, metric)
+	if len(s.recent) > s.opts.HistorySize {
+		s.recent = s.recent[len(s.recent)-s.opts.HistorySize:]
+	}
+
+	if s.walSize >= s.opts.SegmentSize {
+		if err := s.seal(); err != nil {
+			return err
+		}
+	}
+	if err := s.updateRollups(metric); err != nil {
+		return err
+	}
+	if err := s.setAsideCorrupt(); err != nil {
+		return err
+	}
+	return s.expireSegments(metric.Timestamp)
+}
+
+// expireSegments deletes segments whose newest snapshot is older than the
+// raw retention
+func (s *DiskStorage) expireSegments(now time.Time) error {
+	cutoff := s.opts.Retention.retentionCutoff(now)
+	for len(s.segments) > 0 && s.segments[0].maxTime.Before(cutoff) {
+		if err := os.Remove(s.segments[0].path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		s.segments = s.segments[1:]
+	}
+	return nil
+}
+
+// seal writes the pending records to a new segment and empties the log.
+// The segment is fully durable before the log is truncated, so a crash at
+// any point leaves every record in at least one of the two.
+func (s *DiskStorage) seal() error {
+	if len(s.pending) == 0 {
+		return nil
+	}
+
+	info, err := writeSegment(s.opts.Dir, s.walSeq, s.pending)
+	if err != nil {
+		return fmt.Errorf("sealing segment: %w", err)
+	}
+	s.segments = append(s.segments, info)
+	s.pending = nil
+	return s.resetWAL(info.seq + 1)
+}
+
+// GetHistory returns the most recent snapshots, up to the history size
+func (s *DiskStorage) GetHistory() []models.SystemMetrics {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	history := make([]models.SystemMetrics, len(s.recent))
+	copy(history, s.recent)
+	return history
+}
+
+// GetLatest returns the most recent snapshot
+func (s *DiskStorage) GetLatest() *models.SystemMetrics {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if len(s.recent) == 0 {
+		return nil
+	}
+	latest := s.recent[len(s.recent)-1]
+	return &latest
+}
+
+// Range returns the snapshots with timestamps between start and end,
+// reading only the segments that overlap the range
+func (s *DiskStorage) Range(start, end time.Time) ([]models.SystemMetrics, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.rangeLocked(start, end, decodeRecord)
+}
+
+func (s *DiskStorage) rangeLocked(start, end time.Time, decode recordDecoder) ([]models.SystemMetrics, error) {
+	var result []models.SystemMetrics
+	for _, seg := range s.segments {
+		if seg.maxTime.Before(start) || seg.minTime.After(end) {
+			continue
+		}
+		records, err := s.readRangeSegment(seg.path, decode)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range records {
+			if inRange(m.Timestamp, start, end) {
+				result = append(result, m)
+			}
+		}
+	}
+	for _, m := range s.pending {
+		if inRange(m.Timestamp, start, end) {
+			result = append(result, m)
+		}
+	}
+	return result, nil
+}
+
+// readRangeSegment reads a segment for a range read. A damaged segment is
+// logged and skipped, and set aside by the next Add, which holds the write
+// lock.
+func (s *DiskStorage) readRangeSegment(path string, decode recordDecoder) ([]models.SystemMetrics, error) {
+	records, err := readSegment(path, decode)
+	if !errors.Is(err, ErrCorrupt) {
+		return records, err
+	}
+
+	s.corruptMu.Lock()
+	defer s.corruptMu.Unlock()
+	if !s.corrupt[path] {
+		log.Printf("Storage: skipping damaged segment %s: %v", filepath.Base(path), err)
+		if s.corrupt == nil {
+			s.corrupt = make(map[string]bool)
+		}
+		s.corrupt[path] = true
+	}
+	return nil, nil
+}
+
+// setAsideCorrupt sets aside the segments range reads found damaged.
+// Called with the write lock held.
+func (s *DiskStorage) setAsideCorrupt() error {
+	s.corruptMu.Lock()
+	defer s.corruptMu.Unlock()
+	if len(s.corrupt) == 0 {
+		return nil
+	}
+
+	kept := s.segments[:0]
+	for _, seg := range s.segments {
+		if !s.corrupt[seg.path] {
+			kept = append(kept, seg)
+			continue
+		}
+		if err := setAsideSegment(seg.path, ErrCorrupt); err != nil {
+			return err
+		}
+	}
+	s.segments = kept
+	s.corrupt = nil
+	return nil
+}
+
+// setAsideSegment renames a damaged segment with corruptExt, keeping it for
+// inspection but out of the store
+func setAsideSegment(path string, reason error) error {
+	log.Printf("Storage: setting aside unreadable segment %s: %v", filepath.Base(path), reason)
+	return os.Rename(path, path+corruptExt)
+}
+
+// Query returns the series matching fields between start and end. Raw
+// snapshots are used while they reach back to start, otherwise the finest
+// rollup tier that does. Segments are immutable, so raw reads happen after
+// the lock is released and do not hold up Add; of each record, only the
+// sections the fields can select are decoded.
+func (s *DiskStorage) Query(start, end time.Time, fields []string) (QueryResult, error) {
+	var raw bool
+	var segments []segmentInfo
+	var pending []models.SystemMetrics
+
+	s.mu.RLock()
+	rawOldest, rawOK := s.oldestRaw()
+	result, err := s.rollups.queryLevels(start, end, fields, rawOldest, rawOK, func() (map[string][]SeriesPoint, error) {
+		raw = true
+		for _, seg := range s.segments {
+			if !seg.maxTime.Before(start) && !seg.minTime.After(end) {
+				segments = append(segments, seg)
+			}
+		}
+		for _, m := range s.pending {
+			if inRange(m.Timestamp, start, end) {
+				pending = append(pending, m)
+			}
+		}
+		return nil, nil
+	})
+	s.mu.RUnlock()
+	if err != nil || !raw {
+		return result, err
+	}
+
+	want := sectionsFor(fields)
+	decode := decodeSections(want)
+	series := make(map[string][]SeriesPoint)
+	for _, seg := range segments {
+		records, err := s.readRangeSegment(seg.path, decode)
+		if errors.Is(err, os.ErrNotExist) {
+			// Expired or cleared since the lock was released
+			continue
+		}
+		if err != nil {
+			return QueryResult{}, err
+		}
+		for _, m := range records {
+			if inRange(m.Timestamp, start, end) {
+				rawSeries(series, m.Timestamp, flattenSections(m, want), fields)
+			}
+		}
+	}
+	for _, m := range pending {
+		rawSeries(series, m.Timestamp, flattenSections(m, want), fields)
+	}
+	result.Series = series
+	return result, nil
+}
+
+// oldestRaw returns the timestamp of the oldest stored snapshot
+func (s *DiskStorage) oldestRaw() (time.Time, bool) {
+	if len(s.segments) > 0 {
+		return s.segments[0].minTime, true
+	}
+	if len(s.pending) > 0 {
+		return s.pending[0].Timestamp, true
+	}
+	return time.Time{}, false
+}
+
+// Size returns the number of stored snapshots
+func (s *DiskStorage) Size() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	size := len(s.pending)
+	for _, seg := range s.segments {
+		size += seg.count
+	}
+	return size
+}
+
+// Clear deletes every segment and empties the write-ahead log
+func (s *DiskStorage) Clear() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.wal == nil {
+		return ErrClosed
+	}
+
+	for len(s.segments) > 0 {
+		if err := os.Remove(s.segments[0].path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		s.segments = s.segments[1:]
+	}
+	s.pending = nil
+	s.recent = nil
+	if err := s.clearRollups(); err != nil {
+		return err
+	}
+	return s.resetWAL(s.walSeq + 1)
+}
+
+// Close syncs and closes the write-ahead log. Pending records stay in the
+// log and are recovered on the next open.
+func (s *DiskStorage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.wal == nil {
+		return nil
+	}
+	err := s.wal.Sync()
+	if cerr := s.closeFiles(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// closeFiles closes the write-ahead log and the rollup logs
+func (s *DiskStorage) closeFiles() error {
+	var err error
+	if s.wal != nil {
+		err = s.wal.Close()
+		s.wal = nil
+	}
+	for _, f := range s.tierLogs {
+		if f == nil {
+			continue
+		}
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	s.tierLogs = nil
+	return err
+}
+
+// writeSegment writes records to a temporary file, syncs it and renames it
+// into place
+func writeSegment(dir string, seq uint64, records []models.SystemMetrics) (segmentInfo, error) {
+	info := segmentInfo{
+		seq:     seq,
+		count:   len(records),
+		minTime: records[0].Timestamp,
+		maxTime: records[len(records)-1].Timestamp,
+	}
+	info.path = filepath.Join(dir, fmt.Sprintf("%020d%s", seq, segmentExt))
+
+	var body bytes.Buffer
+	body.Write(encodeSegmentHeader(info))
+	zw := gzip.NewWriter(&body)
+	for _, m := range records {
+		payload, err := json.Marshal(m)
+		if err != nil {
+			return info, err
+		}
+		if _, err := writeRecord(zw, payload); err != nil {
+			return info, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return info, err
+	}
+
+	tmp := info.path + tmpExt
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return info, err
+	}
+	_, err = f.Write(body.Bytes())
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, info.path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return info, err
+	}
+	return info, syncDir(dir)
+}
+
+// encodeSegmentHeader lays out the segment header:
+//
+//	| magic [8]byte | seq uint64 | count uint32 | min int64 | max int64 | crc32c uint32 |
+//
+// with min and max the first and last timestamps in Unix nanoseconds.
+func encodeSegmentHeader(info segmentInfo) []byte {
+	buf := make([]byte, segmentHeader)
+	copy(buf, segmentMagic)
+	off := len(segmentMagic)
+	binary.LittleEndian.PutUint64(buf[off:], info.seq)
+	binary.LittleEndian.PutUint32(buf[off+8:], uint32(info.count))
+	binary.LittleEndian.PutUint64(buf[off+12:], uint64(info.minTime.UnixNano()))
+	binary.LittleEndian.PutUint64(buf[off+20:], uint64(info.maxTime.UnixNano()))
+	binary.LittleEndian.PutUint32(buf[off+28:], crc32.Checksum(buf[:off+28], castagnoli))
+	return buf
+}
+
+func decodeSegmentHeader(buf []byte) (segmentInfo, error) {
+	var info segmentInfo
+	off := len(segmentMagic)
+	if string(buf[:off]) != segmentMagic {
+		return info, fmt.Errorf("%w: bad segment magic", ErrCorrupt)
+	}
+	if crc32.Checksum(buf[:off+28], castagnoli) != binary.LittleEndian.Uint32(buf[off+28:]) {
+		return info, fmt.Errorf("%w: segment header checksum mismatch", ErrCorrupt)
+	}
+	info.seq = binary.LittleEndian.Uint64(buf[off:])
+	info.count = int(binary.LittleEndian.Uint32(buf[off+8:]))
+	info.minTime = time.Unix(0, int64(binary.LittleEndian.Uint64(buf[off+12:])))
+	info.maxTime = time.Unix(0, int64(binary.LittleEndian.Uint64(buf[off+20:])))
+	return info, nil
+}
+
+// readSegmentInfo reads only the header of a segment
+func readSegmentInfo(path string) (segmentInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return segmentInfo{}, err
+	}
+	defer f.Close()
+
+	buf := make([]byte, segmentHeader)
+	if _, err := io.ReadFull(f, buf); err != nil {
+		return segmentInfo{}, fmt.Errorf("segment %s: %w: %v", path, ErrCorrupt, err)
+	}
+	info, err := decodeSegmentHeader(buf)
+	if err != nil {
+		return info, fmt.Errorf("segment %s: %w", path, err)
+	}
+	info.path = path
+	return info, nil
+}
+
+// recordDecoder turns a stored record into a snapshot
+type recordDecoder func(payload []byte) (models.SystemMetrics, error)
+
+// decodeRecord decodes a whole snapshot
+func decodeRecord(payload []byte) (models.SystemMetrics, error) {
+	var m models.SystemMetrics
+	err := json.Unmarshal(payload, &m)
+	return m, err
+}
+
+// recordSections holds the sections of a stored snapshot that series are
+// flattened from, undecoded. Sections without series, such as the process
+// table, are skipped over.
+type recordSections struct {
+	Timestamp         time.Time       `json:"timestamp"`
+	CPU               json.RawMessage `json:"cpu"`
+	Memory            json.RawMessage `json:"memory"`
+	Disk              json.RawMessage `json:"disk"`
+	DiskIO            json.RawMessage `json:"disk_io"`
+	DiskForecast      json.RawMessage `json:"disk_forecast"`
+	Network           json.RawMessage `json:"network"`
+	System            json.RawMessage `json:"system"`
+	PSI               json.RawMessage `json:"psi"`
+	Cgroups           json.RawMessage `json:"cgroups"`
+	Temperature       json.RawMessage `json:"temperature"`
+	Custom            json.RawMessage `json:"custom"`
+	CollectDurationMs json.RawMessage `json:"collect_duration_ms"`
+}
+
+// decodeSections returns a decoder that fills in only the sections of a
+// snapshot selected by want, leaving the others empty
+func decodeSections(want func(section string) bool) recordDecoder {
+	return func(payload []byte) (models.SystemMetrics, error) {
+		var r recordSections
+		if err := json.Unmarshal(payload, &r); err != nil {
+			return models.SystemMetrics{}, err
+		}
+
+		m := models.SystemMetrics{Timestamp: r.Timestamp}
+		for _, section := range []struct {
+			name string
+			raw  json.RawMessage
+			into interface{}
+		}{
+			{"cpu", r.CPU, &m.CPU},
+			{"memory", r.Memory, &m.Memory},
+			{"disk", r.Disk, &m.Disk},
+			{"disk_io", r.DiskIO, &m.DiskIO},
+			{"disk_forecast", r.DiskForecast, &m.DiskForecast},
+			{"network", r.Network, &m.Network},
+			{"system", r.System, &m.System},
+			{"psi", r.PSI, &m.PSI},
+			{"cgroups", r.Cgroups, &m.Cgroups},
+			{"temperature", r.Temperature, &m.Temperature},
+			{"custom", r.Custom, &m.Custom},
+			{"collect_duration_ms", r.CollectDurationMs, &m.CollectDurationMs},
+		} {
+			if len(section.raw) == 0 || !want(section.name) {
+				continue
+			}
+			if err := json.Unmarshal(section.raw, section.into); err != nil {
+				return m, err
+			}
+		}
+		return m, nil
+	}
+}
+
+// readSegment decodes every record of a segment
+func readSegment(path string, decode recordDecoder) ([]models.SystemMetrics, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	buf := make([]byte, segmentHeader)
+	if _, err := io.ReadFull(f, buf); err != nil {
+		return nil, fmt.Errorf("segment %s: %w: %v", path, ErrCorrupt, err)
+	}
+	info, err := decodeSegmentHeader(buf)
+	if err != nil {
+		return nil, fmt.Errorf("segment %s: %w", path, err)
+	}
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("segment %s: %w: %v", path, ErrCorrupt, err)
+	}
+	defer zr.Close()
+
+	records := make([]models.SystemMetrics, 0, info.count)
+	_, err = readRecords(zr, func(payload []byte) error {
+		m, err := decode(payload)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrCorrupt, err)
+		}
+		records = append(records, m)
+		return nil
+	})
+	if err != nil && !errors.Is(err, ErrCorrupt) {
+		// The file is open, so a failing read is a damaged gzip stream
+		err = fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("segment %s: %w", path, err)
+	}
+	if len(records) != info.count {
+		return nil, fmt.Errorf("segment %s: %w: expected %d records, found %d", path, ErrCorrupt, info.count, len(records))
+	}
+	return records, nil
+}
+
+// syncDir makes a rename in dir durable
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,171 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/kennethfeh/system-monitor/internal/models"
+)
+
+// loadRollups reads the finished buckets of every tier, then rebuilds the
+// buckets in progress from the raw snapshots, so a restart loses no data
+// that is still held at full resolution
+func (s *DiskStorage) loadRollups() error {
+	s.tierLogs = make([]*os.File, len(s.rollups.tiers))
+	for i, t := range s.rollups.tiers {
+		path := filepath.Join(s.opts.Dir, tierFileName(t.Resolution))
+		f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+		if err != nil {
+			return err
+		}
+		s.tierLogs[i] = f
+
+		valid, err := readRecords(f, func(payload []byte) error {
+			var r Rollup
+			if err := json.Unmarshal(payload, &r); err != nil {
+				return fmt.Errorf("%w: %v", ErrCorrupt, err)
+			}
+			t.done = append(t.done, r)
+			return nil
+		})
+		if err != nil && !errors.Is(err, ErrCorrupt) {
+			return err
+		}
+		if err != nil {
+			log.Printf("Storage: truncating %s after %d buckets: %v", filepath.Base(path), len(t.done), err)
+		}
+		if err := f.Truncate(valid); err != nil {
+			return err
+		}
+		if _, err := f.Seek(valid, io.SeekStart); err != nil {
+			return err
+		}
+		if n := len(t.done); n > 0 {
+			t.sealedUntil = t.done[n-1].Timestamp.Add(t.Resolution)
+		}
+	}
+
+	if len(s.rollups.tiers) == 0 || len(s.recent) == 0 {
+		return nil
+	}
+
+	latest := s.recent[len(s.recent)-1].Timestamp
+	from := latest
+	for _, t := range s.rollups.tiers {
+		if t.sealedUntil.IsZero() {
+			// Never rolled up before: start with the current bucket
+			t.sealedUntil = latest.Truncate(t.Resolution)
+		}
+		if t.sealedUntil.Before(from) {
+			from = t.sealedUntil
+		}
+	}
+
+	records, err := s.rangeLocked(from, latest, decodeRecord)
+	if err != nil {
+		return err
+	}
+	for _, m := range records {
+		if err := s.rollups.add(m.Timestamp, flatten(m), s.persistRollup); err != nil {
+			return err
+		}
+	}
+	return s.pruneRollups(latest)
+}
+
+// updateRollups feeds a new snapshot into the rollup tiers
+func (s *DiskStorage) updateRollups(metric models.SystemMetrics) error {
+	if len(s.rollups.tiers) == 0 {
+		return nil
+	}
+	if err := s.rollups.add(metric.Timestamp, flatten(metric), s.persistRollup); err != nil {
+		return err
+	}
+	return s.pruneRollups(metric.Timestamp)
+}
+
+// persistRollup appends a finished bucket to its tier's log
+func (s *DiskStorage) persistRollup(tier int, r Rollup) error {
+	payload, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	f := s.tierLogs[tier]
+	if _, err := writeRecord(f, payload); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// pruneRollups applies the tier retentions, rewriting a tier's log once a
+// quarter of it has expired
+func (s *DiskStorage) pruneRollups(now time.Time) error {
+	s.rollups.prune(now)
+	for i, t := range s.rollups.tiers {
+		if t.dropped == 0 || t.dropped < len(t.done)/4 {
+			continue
+		}
+		if err := s.rewriteTierLog(i); err != nil {
+			return err
+		}
+		t.dropped = 0
+	}
+	return nil
+}
+
+// rewriteTierLog replaces a tier's log with its retained buckets
+func (s *DiskStorage) rewriteTierLog(tier int) error {
+	t := s.rollups.tiers[tier]
+	path := filepath.Join(s.opts.Dir, tierFileName(t.Resolution))
+	tmp := path + tmpExt
+
+	f, err := os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	for _, r := range t.done {
+		payload, err := json.Marshal(r)
+		if err == nil {
+			_, err = writeRecord(f, payload)
+		}
+		if err != nil {
+			f.Close()
+			os.Remove(tmp)
+			return err
+		}
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+
+	s.tierLogs[tier].Close()
+	s.tierLogs[tier] = f
+	return syncDir(s.opts.Dir)
+}
+
+// clearRollups discards every rollup and empties the tier logs
+func (s *DiskStorage) clearRollups() error {
+	s.rollups.reset()
+	for _, f := range s.tierLogs {
+		if err := f.Truncate(0); err != nil {
+			return err
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,368 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kennethfeh/system-monitor/internal/models"
+)
+
+var diskTestStart = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func testMetric(i int) models.SystemMetrics {
+	return models.SystemMetrics{
+		Timestamp: diskTestStart.Add(time.Duration(i) * time.Second),
+		CPU:       models.CPUMetrics{TotalPercent: float64(i)},
+	}
+}
+
+func openTestDisk(t *testing.T, opts DiskOptions) *DiskStorage {
+	t.Helper()
+	s, err := OpenDiskStorage(opts)
+	if err != nil {
+		t.Fatalf("Unexpected error opening storage: %v", err)
+	}
+	return s
+}
+
+func addMetrics(t *testing.T, s Storage, from, to int) {
+	t.Helper()
+	for i := from; i < to; i++ {
+		if err := s.Add(testMetric(i)); err != nil {
+			t.Fatalf("Unexpected error adding metric %d: %v", i, err)
+		}
+	}
+}
+
+func TestDiskStorageReopen(t *testing.T) {
+	opts := DiskOptions{Dir: t.TempDir(), HistorySize: 3}
+
+	s := openTestDisk(t, opts)
+	addMetrics(t, s, 0, 5)
+	if err := s.Close(); err != nil {
+		t.Fatalf("Unexpected error closing storage: %v", err)
+	}
+	if err := s.Add(testMetric(5)); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected ErrClosed after close, got %v", err)
+	}
+
+	s = openTestDisk(t, opts)
+	defer s.Close()
+
+	if s.Size() != 5 {
+		t.Errorf("Expected 5 metrics after reopen, got %d", s.Size())
+	}
+	history := s.GetHistory()
+	if len(history) != 3 || history[0].CPU.TotalPercent != 2 {
+		t.Errorf("Expected the 3 most recent metrics, got %+v", history)
+	}
+	if latest := s.GetLatest(); latest == nil || !latest.Timestamp.Equal(testMetric(4).Timestamp) {
+		t.Errorf("Unexpected latest metric: %+v", latest)
+	}
+}
+
+func TestDiskStorageSegments(t *testing.T) {
+	opts := DiskOptions{Dir: t.TempDir(), SegmentSize: 512, HistorySize: 5}
+
+	s := openTestDisk(t, opts)
+	addMetrics(t, s, 0, 20)
+	s.Close()
+
+	segments, _ := filepath.Glob(filepath.Join(opts.Dir, "*"+segmentExt))
+	if len(segments) < 2 {
+		t.Fatalf("Expected the log to be sealed into several segments, got %d", len(segments))
+	}
+
+	s = openTestDisk(t, opts)
+	defer s.Close()
+
+	if s.Size() != 20 {
+		t.Errorf("Expected 20 metrics, got %d", s.Size())
+	}
+	if history := s.GetHistory(); len(history) != 5 || history[4].CPU.TotalPercent != 19 {
+		t.Errorf("Unexpected history after reopen: %+v", history)
+	}
+
+	result, err := s.Range(testMetric(3).Timestamp, testMetric(12).Timestamp)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(result) != 10 || result[0].CPU.TotalPercent != 3 || result[9].CPU.TotalPercent != 12 {
+		t.Errorf("Expected metrics 3 to 12, got %d metrics", len(result))
+	}
+}
+
+func TestDiskStorageTornWrite(t *testing.T) {
+	opts := DiskOptions{Dir: t.TempDir()}
+
+	s := openTestDisk(t, opts)
+	addMetrics(t, s, 0, 3)
+	s.Close()
+
+	// Simulate a crash halfway through writing a record
+	wal := filepath.Join(opts.Dir, walFileName)
+	f, err := os.OpenFile(wal, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{200, 0, 0, 0, 1, 2, 3, 4, '{', '"'})
+	f.Close()
+
+	s = openTestDisk(t, opts)
+	if s.Size() != 3 {
+		t.Errorf("Expected the torn record to be dropped, got %d metrics", s.Size())
+	}
+	addMetrics(t, s, 3, 4)
+	s.Close()
+
+	s = openTestDisk(t, opts)
+	defer s.Close()
+	if s.Size() != 4 {
+		t.Errorf("Expected writes after recovery to be kept, got %d metrics", s.Size())
+	}
+}
+
+func TestDiskStorageChecksum(t *testing.T) {
+	opts := DiskOptions{Dir: t.TempDir()}
+
+	s := openTestDisk(t, opts)
+	addMetrics(t, s, 0, 3)
+	s.Close()
+
+	// Flip a byte inside the last record's payload
+	wal := filepath.Join(opts.Dir, walFileName)
+	data, err := os.ReadFile(wal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)-5] ^= 0xff
+	if err := os.WriteFile(wal, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	s = openTestDisk(t, opts)
+	defer s.Close()
+	if s.Size() != 2 {
+		t.Errorf("Expected the corrupt record to be dropped, got %d metrics", s.Size())
+	}
+}
+
+func TestDiskStorageSealedLogDiscarded(t *testing.T) {
+	opts := DiskOptions{Dir: t.TempDir()}
+	wal := filepath.Join(opts.Dir, walFileName)
+
+	s := openTestDisk(t, opts)
+	addMetrics(t, s, 0, 3)
+	unsealed, err := os.ReadFile(wal)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.mu.Lock()
+	err = s.seal()
+	s.mu.Unlock()
+	if err != nil {
+		t.Fatalf("Unexpected error sealing: %v", err)
+	}
+	s.Close()
+
+	// Simulate a crash after the segment was written but before the log
+	// was emptied, plus a leftover temporary segment
+	if err := os.WriteFile(wal, unsealed, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tmp := filepath.Join(opts.Dir, "00000000000000000009"+segmentExt+tmpExt)
+	if err := os.WriteFile(tmp, []byte("partial"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	s = openTestDisk(t, opts)
+	defer s.Close()
+
+	if s.Size() != 3 {
+		t.Errorf("Expected sealed records not to be duplicated, got %d metrics", s.Size())
+	}
+	if _, err := os.Stat(tmp); !os.IsNotExist(err) {
+		t.Error("Expected leftover temporary segment to be removed")
+	}
+}
+
+func TestDiskStorageCorruptSegment(t *testing.T) {
+	opts := DiskOptions{Dir: t.TempDir(), SegmentSize: 1}
+
+	s := openTestDisk(t, opts)
+	addMetrics(t, s, 0, 2)
+	s.Close()
+
+	segments, _ := filepath.Glob(filepath.Join(opts.Dir, "*"+segmentExt))
+	data, err := os.ReadFile(segments[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(segmentMagic)] ^= 0xff
+	os.WriteFile(segments[0], data, 0o644)
+
+	s = openTestDisk(t, opts)
+	defer s.Close()
+	if _, err := os.Stat(segments[0] + corruptExt); err != nil {
+		t.Errorf("Expected the damaged segment to be set aside: %v", err)
+	}
+	if history := s.GetHistory(); len(history) != 1 || history[0].CPU.TotalPercent != 1 {
+		t.Errorf("Expected the intact metric to survive, got %+v", history)
+	}
+}
+
+func TestDiskStorageCorruptSegmentBody(t *testing.T) {
+	opts := DiskOptions{Dir: t.TempDir(), SegmentSize: 1, HistorySize: 2}
+
+	s := openTestDisk(t, opts)
+	addMetrics(t, s, 0, 4)
+	s.Close()
+
+	// Flip a byte in the records of the oldest segment, which opening does
+	// not read, and cut the newest, which it does, short
+	segments, _ := filepath.Glob(filepath.Join(opts.Dir, "*"+segmentExt))
+	if len(segments) != 4 {
+		t.Fatalf("Expected 4 segments, got %d", len(segments))
+	}
+	for i, seg := range []string{segments[0], segments[3]} {
+		data, err := os.ReadFile(seg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		middle := segmentHeader + (len(data)-segmentHeader)/2
+		if i == 0 {
+			data[middle] ^= 0xff
+		} else {
+			data = data[:middle]
+		}
+		os.WriteFile(seg, data, 0o644)
+	}
+
+	s = openTestDisk(t, opts)
+	defer s.Close()
+	if _, err := os.Stat(segments[3] + corruptExt); err != nil {
+		t.Errorf("Expected the damaged newest segment to be set aside: %v", err)
+	}
+	if history := s.GetHistory(); len(history) != 2 || history[0].CPU.TotalPercent != 1 || history[1].CPU.TotalPercent != 2 {
+		t.Errorf("Expected the history to come from the intact segments, got %+v", history)
+	}
+
+	result, err := s.Range(testMetric(0).Timestamp, testMetric(3).Timestamp)
+	if err != nil {
+		t.Fatalf("Expected a damaged segment not to fail range reads: %v", err)
+	}
+	if len(result) != 2 {
+		t.Errorf("Expected the 2 intact metrics, got %d", len(result))
+	}
+	if _, err := s.Query(testMetric(0).Timestamp, testMetric(3).Timestamp, []string{"cpu.total_percent"}); err != nil {
+		t.Errorf("Expected a damaged segment not to fail queries: %v", err)
+	}
+
+	// The next write sets aside the segment the range read found damaged
+	addMetrics(t, s, 4, 5)
+	if _, err := os.Stat(segments[0] + corruptExt); err != nil {
+		t.Errorf("Expected the damaged oldest segment to be set aside: %v", err)
+	}
+	if s.Size() != 3 {
+		t.Errorf("Expected 3 stored metrics, got %d", s.Size())
+	}
+}
+
+func TestDiskStorageClear(t *testing.T) {
+	opts := DiskOptions{Dir: t.TempDir(), SegmentSize: 512}
+
+	s := openTestDisk(t, opts)
+	addMetrics(t, s, 0, 10)
+	if err := s.Clear(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if s.Size() != 0 || s.GetLatest() != nil {
+		t.Error("Expected storage to be empty after clear")
+	}
+	addMetrics(t, s, 10, 12)
+	s.Close()
+
+	s = openTestDisk(t, opts)
+	defer s.Close()
+	if s.Size() != 2 {
+		t.Errorf("Expected only metrics added after clear, got %d", s.Size())
+	}
+}
+
+func TestDiskStorageRetention(t *testing.T) {
+	opts := DiskOptions{
+		Dir:         t.TempDir(),
+		SegmentSize: 1024,
+		Retention: RetentionPolicy{
+			Raw:   time.Minute,
+			Tiers: []Tier{{Resolution: 10 * time.Second, Retention: time.Hour}},
+		},
+	}
+
+	s := openTestDisk(t, opts)
+	addMetrics(t, s, 0, 175)
+	s.Close()
+
+	s = openTestDisk(t, opts)
+	addMetrics(t, s, 175, 200)
+	defer s.Close()
+
+	oldest, _ := s.oldestRaw()
+	if age := testMetric(199).Timestamp.Sub(oldest); age > 2*time.Minute {
+		t.Errorf("Expected old segments to expire, oldest raw point is %v old", age)
+	}
+
+	result, err := s.Query(testMetric(0).Timestamp, testMetric(199).Timestamp, []string{"cpu.total_percent"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	points := result.Series["cpu.total_percent"]
+	if result.Resolution != 10*time.Second || len(result.Series) != 1 || len(points) != 20 {
+		t.Fatalf("Expected 20 10s buckets of one series, got resolution %v with %d series", result.Resolution, len(result.Series))
+	}
+
+	// The bucket in progress across the restart was rebuilt from raw data
+	restarted := points[17]
+	if restarted.Count != 10 || restarted.Min != 170 || restarted.Max != 179 {
+		t.Errorf("Unexpected bucket spanning the restart: %+v", restarted)
+	}
+}
+
+func TestDiskStorageQuerySections(t *testing.T) {
+	s := openTestDisk(t, DiskOptions{Dir: t.TempDir(), SegmentSize: 1024})
+	defer s.Close()
+	for i := 0; i < 21; i++ {
+		m := testMetric(i)
+		m.Disk = []models.DiskMetrics{{Mountpoint: "/", Used: uint64(i), UsedPercent: float64(i)}}
+		m.Processes = []models.ProcessMetrics{{PID: 1, CPUPercent: 5}}
+		if err := s.Add(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(s.segments) == 0 || len(s.pending) == 0 {
+		t.Fatalf("Expected records in both segments and the log, got %d segments and %d pending", len(s.segments), len(s.pending))
+	}
+
+	start, end := testMetric(0).Timestamp, testMetric(20).Timestamp
+	result, err := s.Query(start, end, []string{"disk.*.used"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	points := result.Series["disk./.used"]
+	if len(result.Series) != 1 || len(points) != 21 || points[20].Last != 20 {
+		t.Errorf("Expected 21 points of disk./.used, got %+v", result.Series)
+	}
+
+	// A leading wildcard can select series of any section
+	result, err = s.Query(start, end, []string{"*percent"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(result.Series["cpu.total_percent"]) != 21 || len(result.Series["disk./.used_percent"]) != 21 {
+		t.Errorf("Expected CPU and disk percentages, got %d series", len(result.Series))
+	}
+}
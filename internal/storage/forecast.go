@@ -0,0 +1,147 @@
+package storage
+
+import (
+	"math"
+	"strings"
+	"time"
+
+	"github.com/kennethfeh/system-monitor/internal/models"
+)
+
+// Forecast defaults
+const (
+	DefaultForecastWindow        = 24 * time.Hour
+	DefaultForecastMinConfidence = 0.5
+)
+
+// forecastPoints is how many step buckets the window is fitted over
+const forecastPoints = 360
+
+// minForecastPoints is the fewest buckets a trend is fitted to
+const minForecastPoints = 10
+
+// ForecastOptions configures ForecastDisks
+type ForecastOptions struct {
+	// Window is how much history the trend is fitted over. At least a
+	// tenth of it must be stored for a forecast.
+	Window time.Duration
+	// MinConfidence is the R² below which no time until full is given
+	MinConfidence float64
+}
+
+// ForecastDisks fits a linear trend to the used bytes of every filesystem
+// over the window before now and estimates when its free space, which
+// excludes any root reserve, runs out at that rate. Filesystems without
+// enough history are left out.
+func ForecastDisks(s Storage, now time.Time, opts ForecastOptions) ([]models.DiskForecast, error) {
+	if opts.Window <= 0 {
+		opts.Window = DefaultForecastWindow
+	}
+	result, err := QueryHistory(s, HistoryQuery{
+		Start:       now.Add(-opts.Window),
+		End:         now,
+		Step:        opts.Window / forecastPoints,
+		Fields:      []string{"disk.*.used", "disk.*.free", "disk.*.total"},
+		Aggregation: AggAvg,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	totals, frees := latestDiskValues(result, ".total"), latestDiskValues(result, ".free")
+	forecasts := []models.DiskForecast{}
+	for _, series := range result.Series {
+		mount, ok := diskSeriesMount(series.Name, ".used")
+		if !ok || totals[mount] <= 0 {
+			continue
+		}
+		free, ok := frees[mount]
+		if !ok {
+			continue
+		}
+		if f, ok := forecastDisk(mount, series.Points, totals[mount], free, opts); ok {
+			forecasts = append(forecasts, f)
+		}
+	}
+	return forecasts, nil
+}
+
+// diskSeriesMount returns the mountpoint of a series such as
+// "disk./var.used"
+func diskSeriesMount(name, suffix string) (string, bool) {
+	if !strings.HasPrefix(name, "disk.") || !strings.HasSuffix(name, suffix) {
+		return "", false
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(name, "disk."), suffix), true
+}
+
+// latestDiskValues returns the latest value of the disk series ending in
+// suffix, by mountpoint
+func latestDiskValues(result HistoryResult, suffix string) map[string]float64 {
+	values := make(map[string]float64)
+	for _, series := range result.Series {
+		if mount, ok := diskSeriesMount(series.Name, suffix); ok && len(series.Points) > 0 {
+			values[mount] = series.Points[len(series.Points)-1].Value
+		}
+	}
+	return values
+}
+
+func forecastDisk(mount string, points []HistoryPoint, total, free float64, opts ForecastOptions) (models.DiskForecast, bool) {
+	if len(points) < minForecastPoints {
+		return models.DiskForecast{}, false
+	}
+	span := points[len(points)-1].Timestamp.Sub(points[0].Timestamp)
+	if span < opts.Window/10 {
+		return models.DiskForecast{}, false
+	}
+
+	slope, r2 := linearFit(points)
+	used := points[len(points)-1].Value
+	f := models.DiskForecast{
+		Mountpoint:         mount,
+		Total:              uint64(total),
+		Used:               uint64(used),
+		Free:               uint64(free),
+		GrowthBytesPerHour: slope * 3600,
+		Confidence:         r2,
+		Samples:            len(points),
+		SpanSeconds:        span.Seconds(),
+	}
+	if slope > 0 && r2 >= opts.MinConfidence {
+		hours := math.Max(free, 0) / slope / 3600
+		f.HoursToFull = &hours
+	}
+	return f, true
+}
+
+// linearFit fits a least-squares line to the points and returns its slope
+// per second and its coefficient of determination. A flat series fits
+// perfectly.
+func linearFit(points []HistoryPoint) (slope, r2 float64) {
+	n := float64(len(points))
+	origin := points[0].Timestamp
+	var sumX, sumY float64
+	for _, p := range points {
+		sumX += p.Timestamp.Sub(origin).Seconds()
+		sumY += p.Value
+	}
+	meanX, meanY := sumX/n, sumY/n
+
+	var sxx, sxy, syy float64
+	for _, p := range points {
+		dx := p.Timestamp.Sub(origin).Seconds() - meanX
+		dy := p.Value - meanY
+		sxx += dx * dx
+		sxy += dx * dy
+		syy += dy * dy
+	}
+	if sxx == 0 {
+		return 0, 0
+	}
+	slope = sxy / sxx
+	if syy == 0 {
+		return slope, 1
+	}
+	return slope, sxy * sxy / (sxx * syy)
+}
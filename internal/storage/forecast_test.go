@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/kennethfeh/system-monitor/internal/models"
+)
+
+func TestForecastDisks(t *testing.T) {
+	s := NewMetricsStorage(10)
+	if err := s.SetRetention(RetentionPolicy{Raw: 48 * time.Hour}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	const gb = 1e9
+
+	disk := func(mount string, total, used, reserved float64) models.DiskMetrics {
+		return models.DiskMetrics{Mountpoint: mount, Total: uint64(total), Used: uint64(used), Free: uint64(total - reserved - used)}
+	}
+
+	// 12 hours every 5 minutes: / and /var grow by 1GB an hour, /var with
+	// 5GB reserved for root, /data stays put and /tmp swings back and forth
+	var now time.Time
+	for i := 0; i <= 144; i++ {
+		now = start.Add(time.Duration(i) * 5 * time.Minute)
+		hours := now.Sub(start).Hours()
+		s.Add(models.SystemMetrics{
+			Timestamp: now,
+			Disk: []models.DiskMetrics{
+				disk("/", 100*gb, 50*gb+hours*gb, 0),
+				disk("/var", 100*gb, 50*gb+hours*gb, 5*gb),
+				disk("/data", 100*gb, 10*gb, 0),
+				disk("/tmp", 10*gb, 4*gb+float64(i%2)*gb+hours*1e6, 0),
+			},
+		})
+	}
+
+	forecasts, err := ForecastDisks(s, now, ForecastOptions{Window: 24 * time.Hour, MinConfidence: DefaultForecastMinConfidence})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	byMount := make(map[string]models.DiskForecast)
+	for _, f := range forecasts {
+		byMount[f.Mountpoint] = f
+	}
+	if len(byMount) != 4 {
+		t.Fatalf("Expected a forecast per filesystem, got %+v", forecasts)
+	}
+
+	root := byMount["/"]
+	if math.Abs(root.GrowthBytesPerHour-gb) > 1e6 || root.Confidence < 0.999 || root.Used != 62*gb || root.SpanSeconds != 12*3600 {
+		t.Errorf("Unexpected forecast for /: %+v", root)
+	}
+	if root.HoursToFull == nil || math.Abs(*root.HoursToFull-38) > 0.01 {
+		t.Errorf("Expected / to be full in 38h, got %v", root.HoursToFull)
+	}
+	// The reserve is not available to users
+	if v := byMount["/var"]; v.Free != 33*gb || v.HoursToFull == nil || math.Abs(*v.HoursToFull-33) > 0.01 {
+		t.Errorf("Expected /var to be full for users in 33h, got %+v", v)
+	}
+
+	data := byMount["/data"]
+	if data.GrowthBytesPerHour != 0 || data.Confidence != 1 || data.HoursToFull != nil {
+		t.Errorf("Expected /data not to be filling up, got %+v", data)
+	}
+	if tmp := byMount["/tmp"]; tmp.Confidence > 0.1 || tmp.HoursToFull != nil {
+		t.Errorf("Expected no time until full for a noisy /tmp, got %+v", tmp)
+	}
+
+	// 12 hours are more than a tenth of 4 days but less than one of a week
+	for _, tt := range []struct {
+		window    time.Duration
+		forecasts int
+	}{{4 * 24 * time.Hour, 4}, {7 * 24 * time.Hour, 0}} {
+		forecasts, err = ForecastDisks(s, now, ForecastOptions{Window: tt.window})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(forecasts) != tt.forecasts {
+			t.Errorf("Window %v: expected %d forecasts, got %d", tt.window, tt.forecasts, len(forecasts))
+		}
+	}
+	forecasts, err = ForecastDisks(s, start.Add(time.Hour), ForecastOptions{Window: 24 * time.Hour})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(forecasts) != 0 {
+		t.Errorf("Expected no forecast from an hour of history, got %+v", forecasts)
+	}
+}
@@ -0,0 +1,314 @@
+package storage
+
+import (
+	"errors"
+	"math"
+	"math/bits"
+)
+
+// The column chunks use the compression from Facebook's Gorilla paper:
+// timestamps are stored as delta-of-deltas and values as the XOR with the
+// previous value, so a regularly sampled, slowly changing series costs a
+// couple of bits per point instead of sixteen bytes.
+
+// errShortStream is returned when a chunk ends in the middle of a point
+var errShortStream = errors.New("compressed chunk truncated")
+
+// bstream is an append-only stream of bits
+type bstream struct {
+	stream []byte
+	free   uint8 // unused bits in the last byte
+}
+
+func (b *bstream) writeBit(bit bool) {
+	if b.free == 0 {
+		b.stream = append(b.stream, 0)
+		b.free = 8
+	}
+	if bit {
+		b.stream[len(b.stream)-1] |= 1 << (b.free - 1)
+	}
+	b.free--
+}
+
+// writeBits writes the low nbits of u, most significant first
+func (b *bstream) writeBits(u uint64, nbits int) {
+	for nbits > 0 {
+		if b.free == 0 {
+			b.stream = append(b.stream, 0)
+			b.free = 8
+		}
+		n := nbits
+		if n > int(b.free) {
+			n = int(b.free)
+		}
+		chunk := (u >> uint(nbits-n)) & (1<<uint(n) - 1)
+		b.stream[len(b.stream)-1] |= byte(chunk << (b.free - uint8(n)))
+		b.free -= uint8(n)
+		nbits -= n
+	}
+}
+
+// bstreamReader reads a bstream from the start
+type bstreamReader struct {
+	stream []byte
+	pos    int // in bits
+}
+
+func (r *bstreamReader) readBit() (bool, error) {
+	if r.pos >= len(r.stream)*8 {
+		return false, errShortStream
+	}
+	bit := r.stream[r.pos/8]&(1<<(7-uint(r.pos%8))) != 0
+	r.pos++
+	return bit, nil
+}
+
+func (r *bstreamReader) readBits(nbits int) (uint64, error) {
+	if r.pos+nbits > len(r.stream)*8 {
+		return 0, errShortStream
+	}
+	var u uint64
+	for nbits > 0 {
+		offset := r.pos % 8
+		n := 8 - offset
+		if n > nbits {
+			n = nbits
+		}
+		b := uint64(r.stream[r.pos/8]>>uint(8-offset-n)) & (1<<uint(n) - 1)
+		u = u<<uint(n) | b
+		r.pos += n
+		nbits -= n
+	}
+	return u, nil
+}
+
+// chunkPoints is the number of points after which a chunk is closed
+const chunkPoints = 120
+
+// dodBuckets are the widths a delta-of-delta is stored in, each preceded by
+// a prefix of as many one bits as its index plus one and a terminating
+// zero, except for the last which is all ones. A zero delta-of-delta is a
+// single zero bit.
+var dodBuckets = []int{7, 9, 12, 64}
+
+// xorChunk holds up to chunkPoints compressed points of one series.
+// Timestamps are in milliseconds.
+type xorChunk struct {
+	b     bstream
+	count int
+	minT  int64
+	maxT  int64
+
+	// Encoder state
+	t        int64
+	tDelta   int64
+	v        float64
+	leading  uint8
+	trailing uint8
+}
+
+func (c *xorChunk) append(t int64, v float64) {
+	if c.count == 0 {
+		c.b.writeBits(uint64(t), 64)
+		c.b.writeBits(math.Float64bits(v), 64)
+		c.minT, c.maxT = t, t
+		c.leading = 0xff
+	} else {
+		delta := t - c.t
+		c.writeDoD(delta - c.tDelta)
+		c.tDelta = delta
+		c.writeXOR(v)
+	}
+	// The clock may step back, so the bounds do not assume order
+	if t < c.minT {
+		c.minT = t
+	}
+	if t > c.maxT {
+		c.maxT = t
+	}
+	c.t = t
+	c.v = v
+	c.count++
+}
+
+func (c *xorChunk) writeDoD(dod int64) {
+	if dod == 0 {
+		c.b.writeBit(false)
+		return
+	}
+	for i, width := range dodBuckets {
+		last := i == len(dodBuckets)-1
+		if !last && (dod < -(1<<uint(width-1)) || dod >= 1<<uint(width-1)) {
+			continue
+		}
+		// Prefix: i+1 one bits, then a zero unless this is the last bucket
+		c.b.writeBits(1<<uint(i+1)-1, i+1)
+		if !last {
+			c.b.writeBit(false)
+		}
+		c.b.writeBits(uint64(dod), width)
+		return
+	}
+}
+
+func (c *xorChunk) writeXOR(v float64) {
+	xor := math.Float64bits(v) ^ math.Float64bits(c.v)
+	if xor == 0 {
+		c.b.writeBit(false)
+		return
+	}
+	c.b.writeBit(true)
+
+	leading := uint8(bits.LeadingZeros64(xor))
+	trailing := uint8(bits.TrailingZeros64(xor))
+	if leading > 31 {
+		// The leading count is stored in 5 bits
+		leading = 31
+	}
+
+	if c.leading != 0xff && leading >= c.leading && trailing >= c.trailing {
+		// The meaningful bits fit the previous window
+		c.b.writeBit(false)
+		c.b.writeBits(xor>>c.trailing, 64-int(c.leading)-int(c.trailing))
+		return
+	}
+
+	c.leading, c.trailing = leading, trailing
+	sigbits := 64 - int(leading) - int(trailing)
+	c.b.writeBit(true)
+	c.b.writeBits(uint64(leading), 5)
+	// 64 significant bits do not fit in 6 bits and are stored as 0
+	c.b.writeBits(uint64(sigbits), 6)
+	c.b.writeBits(xor>>trailing, sigbits)
+}
+
+// close trims the chunk's buffer once no more points will be appended
+func (c *xorChunk) close() {
+	c.b.stream = append([]byte(nil), c.b.stream...)
+}
+
+// iterator returns an iterator over the points appended so far
+func (c *xorChunk) iterator() *xorIterator {
+	return &xorIterator{r: bstreamReader{stream: c.b.stream}, count: c.count}
+}
+
+// xorIterator decodes the points of a chunk in order
+type xorIterator struct {
+	r        bstreamReader
+	count    int
+	read     int
+	t        int64
+	tDelta   int64
+	v        float64
+	leading  uint8
+	trailing uint8
+	err      error
+}
+
+// next advances to the next point, returning false at the end of the
+// chunk or on error
+func (it *xorIterator) next() bool {
+	if it.err != nil || it.read == it.count {
+		return false
+	}
+
+	if it.read == 0 {
+		t, err := it.r.readBits(64)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		v, err := it.r.readBits(64)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.t = int64(t)
+		it.v = math.Float64frombits(v)
+	} else {
+		dod, err := it.readDoD()
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.tDelta += dod
+		it.t += it.tDelta
+		if err := it.readXOR(); err != nil {
+			it.err = err
+			return false
+		}
+	}
+
+	it.read++
+	return true
+}
+
+// at returns the current point
+func (it *xorIterator) at() (int64, float64) {
+	return it.t, it.v
+}
+
+func (it *xorIterator) readDoD() (int64, error) {
+	// Count the one bits of the prefix
+	ones := 0
+	for ones < len(dodBuckets) {
+		bit, err := it.r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		if !bit {
+			break
+		}
+		ones++
+	}
+	if ones == 0 {
+		return 0, nil
+	}
+
+	width := dodBuckets[ones-1]
+	u, err := it.r.readBits(width)
+	if err != nil {
+		return 0, err
+	}
+	if width < 64 && u >= 1<<uint(width-1) {
+		// Sign-extend
+		return int64(u) - 1<<uint(width), nil
+	}
+	return int64(u), nil
+}
+
+func (it *xorIterator) readXOR() error {
+	changed, err := it.r.readBit()
+	if err != nil || !changed {
+		return err
+	}
+
+	newWindow, err := it.r.readBit()
+	if err != nil {
+		return err
+	}
+	if newWindow {
+		leading, err := it.r.readBits(5)
+		if err != nil {
+			return err
+		}
+		sigbits, err := it.r.readBits(6)
+		if err != nil {
+			return err
+		}
+		if sigbits == 0 {
+			sigbits = 64
+		}
+		it.leading = uint8(leading)
+		it.trailing = uint8(64 - leading - sigbits)
+	}
+
+	sigbits := 64 - int(it.leading) - int(it.trailing)
+	u, err := it.r.readBits(sigbits)
+	if err != nil {
+		return err
+	}
+	it.v = math.Float64frombits(math.Float64bits(it.v) ^ u<<it.trailing)
+	return nil
+}
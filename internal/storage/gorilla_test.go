@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"math"
+	"testing"
+)
+
+func TestBstream(t *testing.T) {
+	var b bstream
+	b.writeBit(true)
+	b.writeBits(0x5, 3)
+	b.writeBits(0xdeadbeef, 32)
+	b.writeBit(false)
+	b.writeBits(math.MaxUint64, 64)
+
+	r := bstreamReader{stream: b.stream}
+	if bit, _ := r.readBit(); !bit {
+		t.Error("Expected a one bit")
+	}
+	if u, _ := r.readBits(3); u != 0x5 {
+		t.Errorf("Expected 0x5, got %#x", u)
+	}
+	if u, _ := r.readBits(32); u != 0xdeadbeef {
+		t.Errorf("Expected 0xdeadbeef, got %#x", u)
+	}
+	if bit, _ := r.readBit(); bit {
+		t.Error("Expected a zero bit")
+	}
+	if u, _ := r.readBits(64); u != math.MaxUint64 {
+		t.Errorf("Expected all ones, got %#x", u)
+	}
+	// 101 bits written: the padding of the last byte is readable, no more
+	if _, err := r.readBits(4); err != errShortStream {
+		t.Errorf("Expected errShortStream, got %v", err)
+	}
+}
+
+func TestXORChunkRoundTrip(t *testing.T) {
+	times := []int64{
+		1700000000000, 1700000002000, 1700000004000, 1700000006000, // regular
+		1700000008003, 1700000009990, // jitter
+		1700000060000,         // gap
+		1700000050000,         // clock stepped back
+		1700000050000,         // repeated
+		1700000050000 + 1<<40, // huge jump
+		1700000052000 + 1<<40,
+	}
+	values := []float64{
+		0, 0, 12.5, 12.5,
+		12.75, -3.25e10,
+		math.Inf(1), math.NaN(),
+		math.SmallestNonzeroFloat64, math.MaxFloat64,
+		1,
+	}
+
+	var c xorChunk
+	for i := range times {
+		c.append(times[i], values[i])
+	}
+	if c.minT != 1700000000000 || c.maxT != 1700000052000+1<<40 {
+		t.Errorf("Unexpected bounds %d..%d", c.minT, c.maxT)
+	}
+
+	it := c.iterator()
+	i := 0
+	for it.next() {
+		ts, v := it.at()
+		if ts != times[i] {
+			t.Errorf("Point %d: expected timestamp %d, got %d", i, times[i], ts)
+		}
+		if math.Float64bits(v) != math.Float64bits(values[i]) {
+			t.Errorf("Point %d: expected value %v, got %v", i, values[i], v)
+		}
+		i++
+	}
+	if it.err != nil {
+		t.Fatalf("Unexpected error: %v", it.err)
+	}
+	if i != len(times) {
+		t.Errorf("Expected %d points, got %d", len(times), i)
+	}
+}
+
+func TestXORChunkCompression(t *testing.T) {
+	var c xorChunk
+	for i := 0; i < chunkPoints; i++ {
+		c.append(int64(i)*2000, 42)
+	}
+	// 16 bytes for the first point, then a bit each for timestamp and value
+	if size := len(c.b.stream); size > 64 {
+		t.Errorf("Expected a constant series to compress to under 64 bytes, got %d", size)
+	}
+}
@@ -0,0 +1,244 @@
+package storage
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Aggregation selects how the values within a step bucket are combined
+type Aggregation string
+
+const (
+	AggAvg  Aggregation = "avg"
+	AggMin  Aggregation = "min"
+	AggMax  Aggregation = "max"
+	AggLast Aggregation = "last"
+	AggP95  Aggregation = "p95"
+)
+
+// MaxQueryPoints bounds the number of step buckets a single query may ask for
+const MaxQueryPoints = 10000
+
+// ParseAggregation validates an aggregation from user input
+func ParseAggregation(s string) (Aggregation, error) {
+	switch agg := Aggregation(strings.ToLower(s)); agg {
+	case AggAvg, AggMin, AggMax, AggLast, AggP95:
+		return agg, nil
+	case "":
+		return AggAvg, nil
+	default:
+		return "", fmt.Errorf("unknown aggregation %q (want avg, min, max, last or p95)", s)
+	}
+}
+
+// HistoryQuery selects series over a time range. Fields are series names
+// as produced by the storage, e.g. "memory.used_percent", where "*"
+// matches any run of characters; no fields selects every series. A zero
+// Step returns the points at the resolution they are stored at.
+type HistoryQuery struct {
+	Start       time.Time
+	End         time.Time
+	Step        time.Duration
+	Fields      []string
+	Aggregation Aggregation
+}
+
+// HistoryPoint is one aggregated value of a series
+type HistoryPoint struct {
+	Timestamp time.Time `json:"timestamp"`
+	Value     float64   `json:"value"`
+}
+
+// HistorySeries is the aggregated data of one series
+type HistorySeries struct {
+	Name   string         `json:"name"`
+	Points []HistoryPoint `json:"points"`
+}
+
+// HistoryResult is the answer to a HistoryQuery. Resolution is that of the
+// stored data the query was answered from, zero for raw snapshots.
+type HistoryResult struct {
+	Start             time.Time       `json:"start"`
+	End               time.Time       `json:"end"`
+	StepSeconds       float64         `json:"step_seconds"`
+	ResolutionSeconds float64         `json:"resolution_seconds"`
+	Aggregation       Aggregation     `json:"aggregation"`
+	Series            []HistorySeries `json:"series"`
+}
+
+// bucketValues collects what falls into one step bucket of one series
+type bucketValues struct {
+	aggs  []Aggregate
+	times []time.Time
+}
+
+// QueryHistory answers a HistoryQuery from s. Each step bucket starts at
+// Start plus a multiple of Step. Values from rollups are combined using
+// their per-bucket aggregates; p95 over rollups is estimated from the
+// bucket averages, weighted by their sample counts.
+func QueryHistory(s Storage, q HistoryQuery) (HistoryResult, error) {
+	if q.Aggregation == "" {
+		q.Aggregation = AggAvg
+	}
+	if !q.End.After(q.Start) {
+		return HistoryResult{}, fmt.Errorf("end must be after start")
+	}
+	if q.Step < 0 {
+		return HistoryResult{}, fmt.Errorf("step must not be negative")
+	}
+	if q.Step > 0 && q.End.Sub(q.Start)/q.Step > MaxQueryPoints {
+		return HistoryResult{}, fmt.Errorf("step %v yields more than %d points for the range", q.Step, MaxQueryPoints)
+	}
+
+	data, err := s.Query(q.Start, q.End, q.Fields)
+	if err != nil {
+		return HistoryResult{}, err
+	}
+
+	result := HistoryResult{
+		Start:             q.Start,
+		End:               q.End,
+		StepSeconds:       q.Step.Seconds(),
+		ResolutionSeconds: data.Resolution.Seconds(),
+		Aggregation:       q.Aggregation,
+		Series:            []HistorySeries{},
+	}
+
+	names := make([]string, 0, len(data.Series))
+	for name := range data.Series {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		buckets := make(map[time.Time]*bucketValues)
+		for _, point := range data.Series[name] {
+			bucket := point.Timestamp
+			if q.Step > 0 {
+				bucket = q.Start.Add(point.Timestamp.Sub(q.Start) / q.Step * q.Step)
+				if point.Timestamp.Before(q.Start) {
+					// A rollup bucket that started before the range
+					bucket = q.Start
+				}
+			}
+			b, ok := buckets[bucket]
+			if !ok {
+				b = &bucketValues{}
+				buckets[bucket] = b
+			}
+			b.aggs = append(b.aggs, point.Aggregate)
+			b.times = append(b.times, point.Timestamp)
+		}
+
+		series := HistorySeries{Name: name}
+		for bucket, b := range buckets {
+			series.Points = append(series.Points, HistoryPoint{
+				Timestamp: bucket,
+				Value:     combine(q.Aggregation, b),
+			})
+		}
+		sort.Slice(series.Points, func(i, j int) bool {
+			return series.Points[i].Timestamp.Before(series.Points[j].Timestamp)
+		})
+		result.Series = append(result.Series, series)
+	}
+	return result, nil
+}
+
+// combine reduces the aggregates within a step bucket to a single value
+func combine(agg Aggregation, b *bucketValues) float64 {
+	switch agg {
+	case AggMin:
+		v := math.Inf(1)
+		for _, a := range b.aggs {
+			v = math.Min(v, a.Min)
+		}
+		return v
+	case AggMax:
+		v := math.Inf(-1)
+		for _, a := range b.aggs {
+			v = math.Max(v, a.Max)
+		}
+		return v
+	case AggLast:
+		last := 0
+		for i := range b.aggs {
+			if !b.times[i].Before(b.times[last]) {
+				last = i
+			}
+		}
+		return b.aggs[last].Last
+	case AggP95:
+		return weightedPercentile(b.aggs, 0.95)
+	default:
+		var sum float64
+		var count int
+		for _, a := range b.aggs {
+			sum += a.Avg * float64(a.Count)
+			count += a.Count
+		}
+		if count == 0 {
+			return 0
+		}
+		return sum / float64(count)
+	}
+}
+
+// weightedPercentile returns the nearest-rank percentile of the aggregate
+// averages, each counted as many times as it has samples. For raw data,
+// where every aggregate is a single sample, this is the exact percentile.
+func weightedPercentile(aggs []Aggregate, p float64) float64 {
+	sorted := append([]Aggregate(nil), aggs...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Avg < sorted[j].Avg })
+
+	total := 0
+	for _, a := range sorted {
+		total += a.Count
+	}
+	rank := int(math.Ceil(p * float64(total)))
+	seen := 0
+	for _, a := range sorted {
+		seen += a.Count
+		if seen >= rank {
+			return a.Avg
+		}
+	}
+	return sorted[len(sorted)-1].Avg
+}
+
+// matchFields reports whether a series is selected by any of the patterns
+func matchFields(patterns []string, name string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if matchWildcard(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchWildcard matches name against a pattern in which "*" stands for any
+// run of characters, including dots and slashes
+func matchWildcard(pattern, name string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == name
+	}
+	if !strings.HasPrefix(name, parts[0]) {
+		return false
+	}
+	name = name[len(parts[0]):]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(name, part)
+		if i < 0 {
+			return false
+		}
+		name = name[i+len(part):]
+	}
+	return strings.HasSuffix(name, parts[len(parts)-1])
+}
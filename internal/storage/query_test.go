@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kennethfeh/system-monitor/internal/models"
+)
+
+func TestQueryHistory(t *testing.T) {
+	s := NewMetricsStorage(100)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// used_percent runs 1..20, one point per second
+	for i := 0; i < 20; i++ {
+		s.Add(models.SystemMetrics{
+			Timestamp: start.Add(time.Duration(i) * time.Second),
+			Memory:    models.MemoryMetrics{UsedPercent: float64(i + 1)},
+			Network:   []models.NetworkMetrics{{Name: "eth0", BytesRecvRate: 10}, {Name: "lo", BytesRecvRate: 1}},
+		})
+	}
+
+	tests := []struct {
+		agg    Aggregation
+		values []float64
+	}{
+		{AggAvg, []float64{5.5, 15.5}},
+		{AggMin, []float64{1, 11}},
+		{AggMax, []float64{10, 20}},
+		{AggLast, []float64{10, 20}},
+		{AggP95, []float64{10, 20}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.agg), func(t *testing.T) {
+			result, err := QueryHistory(s, HistoryQuery{
+				Start:       start,
+				End:         start.Add(20 * time.Second),
+				Step:        10 * time.Second,
+				Fields:      []string{"memory.used_percent"},
+				Aggregation: tt.agg,
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(result.Series) != 1 {
+				t.Fatalf("Expected one series, got %d", len(result.Series))
+			}
+
+			points := result.Series[0].Points
+			if len(points) != len(tt.values) {
+				t.Fatalf("Expected %d points, got %d", len(tt.values), len(points))
+			}
+			for i, want := range tt.values {
+				if points[i].Value != want {
+					t.Errorf("Point %d: expected %v, got %v", i, want, points[i].Value)
+				}
+				if !points[i].Timestamp.Equal(start.Add(time.Duration(i) * 10 * time.Second)) {
+					t.Errorf("Point %d: unexpected bucket %v", i, points[i].Timestamp)
+				}
+			}
+		})
+	}
+
+	result, err := QueryHistory(s, HistoryQuery{
+		Start:  start,
+		End:    start.Add(time.Minute),
+		Fields: []string{"network.*.bytes_recv_rate"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(result.Series) != 2 || result.Series[0].Name != "network.eth0.bytes_recv_rate" || len(result.Series[0].Points) != 20 {
+		t.Errorf("Expected two unaggregated network series, got %+v", result.Series)
+	}
+
+	if _, err := QueryHistory(s, HistoryQuery{Start: start, End: start.Add(time.Hour), Step: time.Millisecond}); err == nil {
+		t.Error("Expected error for too many points")
+	}
+}
+
+func TestCombineRollups(t *testing.T) {
+	b := &bucketValues{
+		aggs: []Aggregate{
+			{Min: 1, Max: 5, Avg: 2, Last: 4, Count: 3},
+			{Min: 0, Max: 9, Avg: 6, Last: 7, Count: 1},
+		},
+		times: []time.Time{time.Unix(0, 0), time.Unix(60, 0)},
+	}
+
+	if v := combine(AggAvg, b); v != 3 {
+		t.Errorf("Expected count-weighted average 3, got %v", v)
+	}
+	if v := combine(AggMin, b); v != 0 {
+		t.Errorf("Expected min 0, got %v", v)
+	}
+	if v := combine(AggMax, b); v != 9 {
+		t.Errorf("Expected max 9, got %v", v)
+	}
+	if v := combine(AggLast, b); v != 7 {
+		t.Errorf("Expected last 7, got %v", v)
+	}
+	if v := combine(AggP95, b); v != 6 {
+		t.Errorf("Expected p95 6, got %v", v)
+	}
+}
+
+func TestMatchWildcard(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"memory.used_percent", "memory.used_percent", true},
+		{"memory.used_percent", "memory.used", false},
+		{"disk.*.used_percent", "disk./var/lib.used_percent", true},
+		{"cpu.*", "cpu.modes.user", true},
+		{"*_rate", "network.eth0.bytes_sent_rate", true},
+		{"ab*b", "ab", false},
+	}
+
+	for _, tt := range tests {
+		if got := matchWildcard(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("matchWildcard(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
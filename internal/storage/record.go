@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// Records in the write-ahead log and in segments are framed as
+//
+//	| length uint32 | crc32c(payload) uint32 | payload |
+//
+// with both integers little-endian.
+const recordHeaderSize = 8
+
+// maxRecordSize bounds the length read from a record header, so a corrupt
+// header cannot trigger a huge allocation
+const maxRecordSize = 64 << 20
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// ErrCorrupt is returned when stored data fails its checksum or is truncated
+var ErrCorrupt = errors.New("corrupt storage record")
+
+// writeRecord frames payload and writes it to w, returning the bytes written
+func writeRecord(w io.Writer, payload []byte) (int, error) {
+	buf := make([]byte, recordHeaderSize+len(payload))
+	binary.LittleEndian.PutUint32(buf[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(buf[4:8], crc32.Checksum(payload, castagnoli))
+	copy(buf[recordHeaderSize:], payload)
+	return w.Write(buf)
+}
+
+// readRecords calls fn for every intact record in r. It returns the offset
+// just past the last intact record; a torn or corrupt record stops the scan
+// with an error wrapping ErrCorrupt, while a clean end of input returns nil.
+func readRecords(r io.Reader, fn func(payload []byte) error) (int64, error) {
+	var offset int64
+	header := make([]byte, recordHeaderSize)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			if err == io.EOF {
+				return offset, nil
+			}
+			if err == io.ErrUnexpectedEOF {
+				return offset, fmt.Errorf("%w: truncated header at offset %d", ErrCorrupt, offset)
+			}
+			return offset, err
+		}
+
+		length := binary.LittleEndian.Uint32(header[0:4])
+		if length > maxRecordSize {
+			return offset, fmt.Errorf("%w: record length %d at offset %d", ErrCorrupt, length, offset)
+		}
+
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return offset, fmt.Errorf("%w: truncated record at offset %d", ErrCorrupt, offset)
+			}
+			return offset, err
+		}
+		if crc32.Checksum(payload, castagnoli) != binary.LittleEndian.Uint32(header[4:8]) {
+			return offset, fmt.Errorf("%w: checksum mismatch at offset %d", ErrCorrupt, offset)
+		}
+
+		if err := fn(payload); err != nil {
+			return offset, err
+		}
+		offset += recordHeaderSize + int64(length)
+	}
+}
@@ -0,0 +1,331 @@
+package storage
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Tier is one level of downsampling: buckets Resolution wide, each holding
+// the min, max, average and last value of every series, kept for Retention
+type Tier struct {
+	Resolution time.Duration
+	Retention  time.Duration
+}
+
+// RetentionPolicy controls how long data is kept. Raw is the age after
+// which individual snapshots are dropped; zero keeps them by count in
+// memory and forever on disk. Tiers are ordered from finest to coarsest.
+type RetentionPolicy struct {
+	Raw   time.Duration
+	Tiers []Tier
+}
+
+// ParseTiers parses a comma-separated list of resolution:retention pairs,
+// e.g. "1m:24h,1h:720h"
+func ParseTiers(s string) ([]Tier, error) {
+	var tiers []Tier
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		res, ret, ok := strings.Cut(entry, ":")
+		if !ok {
+			return nil, fmt.Errorf("rollup tier %q must be in the form resolution:retention", entry)
+		}
+		resolution, err := time.ParseDuration(res)
+		if err != nil {
+			return nil, fmt.Errorf("rollup tier %q: %w", entry, err)
+		}
+		retention, err := time.ParseDuration(ret)
+		if err != nil {
+			return nil, fmt.Errorf("rollup tier %q: %w", entry, err)
+		}
+		tiers = append(tiers, Tier{Resolution: resolution, Retention: retention})
+	}
+	return tiers, nil
+}
+
+// Validate checks that tiers have whole-second resolutions, are ordered
+// from finest to coarsest and keep at least one bucket
+func (p RetentionPolicy) Validate() error {
+	if p.Raw < 0 {
+		return fmt.Errorf("negative raw retention %v", p.Raw)
+	}
+	for i, tier := range p.Tiers {
+		if tier.Resolution < time.Second || tier.Resolution%time.Second != 0 {
+			return fmt.Errorf("rollup resolution %v must be a whole number of seconds", tier.Resolution)
+		}
+		if tier.Retention < tier.Resolution {
+			return fmt.Errorf("rollup retention %v is shorter than its resolution %v", tier.Retention, tier.Resolution)
+		}
+		if i > 0 && tier.Resolution <= p.Tiers[i-1].Resolution {
+			return fmt.Errorf("rollup tiers must be ordered from finest to coarsest resolution")
+		}
+	}
+	return nil
+}
+
+// Aggregate summarises the values of one series within a bucket
+type Aggregate struct {
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	Avg   float64 `json:"avg"`
+	Last  float64 `json:"last"`
+	Count int     `json:"count"`
+}
+
+// Rollup holds the aggregate of every series over one bucket starting at
+// Timestamp
+type Rollup struct {
+	Timestamp time.Time            `json:"timestamp"`
+	Series    map[string]Aggregate `json:"series"`
+}
+
+// SeriesPoint is one point of a series: the aggregate of a rollup bucket
+// starting at Timestamp, or a single raw sample
+type SeriesPoint struct {
+	Timestamp time.Time `json:"timestamp"`
+	Aggregate
+}
+
+// QueryResult is the data of a time range at the finest resolution that
+// covers it, by series name. Resolution is zero for raw snapshots.
+type QueryResult struct {
+	Resolution time.Duration
+	Series     map[string][]SeriesPoint
+}
+
+// rawPoint wraps a single sample as a series point
+func rawPoint(ts time.Time, v float64) SeriesPoint {
+	return SeriesPoint{Timestamp: ts, Aggregate: Aggregate{Min: v, Max: v, Avg: v, Last: v, Count: 1}}
+}
+
+// rawSeries appends a snapshot's values matching fields to series
+func rawSeries(series map[string][]SeriesPoint, ts time.Time, values map[string]float64, fields []string) {
+	for name, v := range values {
+		if matchFields(fields, name) {
+			series[name] = append(series[name], rawPoint(ts, v))
+		}
+	}
+}
+
+// aggregator accumulates one series within the current bucket
+type aggregator struct {
+	min, max, sum, last float64
+	count               int
+}
+
+func (a *aggregator) add(v float64) {
+	if a.count == 0 || v < a.min {
+		a.min = v
+	}
+	if a.count == 0 || v > a.max {
+		a.max = v
+	}
+	a.sum += v
+	a.last = v
+	a.count++
+}
+
+func (a *aggregator) aggregate() Aggregate {
+	return Aggregate{Min: a.min, Max: a.max, Avg: a.sum / float64(a.count), Last: a.last, Count: a.count}
+}
+
+// rollupTier downsamples snapshots into one tier's buckets
+type rollupTier struct {
+	Tier
+	done        []Rollup
+	bucket      time.Time
+	current     map[string]*aggregator
+	sealedUntil time.Time
+	dropped     int
+}
+
+// add feeds one snapshot into the tier. When the snapshot starts a new
+// bucket, the previous one is returned as finished. Samples older than the
+// current bucket are ignored.
+func (t *rollupTier) add(ts time.Time, values map[string]float64) *Rollup {
+	if ts.Before(t.sealedUntil) || (t.current != nil && ts.Before(t.bucket)) {
+		return nil
+	}
+
+	var finished *Rollup
+	bucket := ts.Truncate(t.Resolution)
+	if t.current != nil && !bucket.Equal(t.bucket) {
+		r := t.partial()
+		t.done = append(t.done, r)
+		t.sealedUntil = t.bucket.Add(t.Resolution)
+		finished = &r
+		t.current = nil
+	}
+	if t.current == nil {
+		t.bucket = bucket
+		t.current = make(map[string]*aggregator, len(values))
+	}
+
+	for name, v := range values {
+		agg, ok := t.current[name]
+		if !ok {
+			agg = &aggregator{}
+			t.current[name] = agg
+		}
+		agg.add(v)
+	}
+	return finished
+}
+
+// partial returns the bucket in progress as a rollup
+func (t *rollupTier) partial() Rollup {
+	r := Rollup{Timestamp: t.bucket, Series: make(map[string]Aggregate, len(t.current))}
+	for name, agg := range t.current {
+		r.Series[name] = agg.aggregate()
+	}
+	return r
+}
+
+// prune drops finished buckets older than the retention, relative to now
+func (t *rollupTier) prune(now time.Time) {
+	cutoff := now.Add(-t.Retention)
+	n := sort.Search(len(t.done), func(i int) bool {
+		return !t.done[i].Timestamp.Add(t.Resolution).Before(cutoff)
+	})
+	if n > 0 {
+		t.done = append([]Rollup(nil), t.done[n:]...)
+		t.dropped += n
+	}
+}
+
+// oldest returns the start of the oldest bucket held by the tier
+func (t *rollupTier) oldest() (time.Time, bool) {
+	if len(t.done) > 0 {
+		return t.done[0].Timestamp, true
+	}
+	if t.current != nil {
+		return t.bucket, true
+	}
+	return time.Time{}, false
+}
+
+// query returns the buckets overlapping start to end of the series
+// matching fields, including the bucket in progress
+func (t *rollupTier) query(start, end time.Time, fields []string) map[string][]SeriesPoint {
+	series := make(map[string][]SeriesPoint)
+	add := func(r Rollup) {
+		if !r.Timestamp.Add(t.Resolution).After(start) || r.Timestamp.After(end) {
+			return
+		}
+		for name, agg := range r.Series {
+			if matchFields(fields, name) {
+				series[name] = append(series[name], SeriesPoint{Timestamp: r.Timestamp, Aggregate: agg})
+			}
+		}
+	}
+
+	for _, r := range t.done {
+		add(r)
+	}
+	if t.current != nil {
+		add(t.partial())
+	}
+	return series
+}
+
+// rollupSet maintains every tier of a retention policy
+type rollupSet struct {
+	tiers []*rollupTier
+}
+
+func newRollupSet(tiers []Tier) *rollupSet {
+	rs := &rollupSet{}
+	for _, tier := range tiers {
+		rs.tiers = append(rs.tiers, &rollupTier{Tier: tier})
+	}
+	return rs
+}
+
+// add feeds a snapshot's values into every tier and calls finished for
+// each bucket that was completed
+func (rs *rollupSet) add(ts time.Time, values map[string]float64, finished func(tier int, r Rollup) error) error {
+	for i, t := range rs.tiers {
+		if r := t.add(ts, values); r != nil && finished != nil {
+			if err := finished(i, *r); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// prune applies every tier's retention relative to now
+func (rs *rollupSet) prune(now time.Time) {
+	for _, t := range rs.tiers {
+		t.prune(now)
+	}
+}
+
+// reset discards all rollups
+func (rs *rollupSet) reset() {
+	for _, t := range rs.tiers {
+		*t = rollupTier{Tier: t.Tier}
+	}
+}
+
+// selectLevel picks the finest level holding data back to start. Level 0
+// is the raw data and level i the tier i-1. When no level reaches back far
+// enough, the one with the oldest data wins.
+func selectLevel(oldest []time.Time, ok []bool, start time.Time) int {
+	best := -1
+	for level := range oldest {
+		if !ok[level] {
+			continue
+		}
+		if !oldest[level].After(start) {
+			return level
+		}
+		if best < 0 || oldest[level].Before(oldest[best]) {
+			best = level
+		}
+	}
+	if best < 0 {
+		return 0
+	}
+	return best
+}
+
+// queryLevels answers a query from the raw data or one of the tiers.
+// rawOldest reports the oldest raw snapshot and raw reads the raw range.
+func (rs *rollupSet) queryLevels(start, end time.Time, fields []string, rawOldest time.Time, rawOK bool, raw func() (map[string][]SeriesPoint, error)) (QueryResult, error) {
+	oldest := []time.Time{rawOldest}
+	ok := []bool{rawOK}
+	for _, t := range rs.tiers {
+		ts, has := t.oldest()
+		oldest = append(oldest, ts)
+		ok = append(ok, has)
+	}
+
+	level := selectLevel(oldest, ok, start)
+	if level == 0 {
+		series, err := raw()
+		return QueryResult{Series: series}, err
+	}
+	t := rs.tiers[level-1]
+	return QueryResult{Resolution: t.Resolution, Series: t.query(start, end, fields)}, nil
+}
+
+// retentionCutoff returns the time before which raw data is expired, or
+// the zero time when raw data is not expired by age
+func (p RetentionPolicy) retentionCutoff(now time.Time) time.Time {
+	if p.Raw <= 0 {
+		return time.Time{}
+	}
+	return now.Add(-p.Raw)
+}
+
+// tierFileName names the file a tier is persisted in
+func tierFileName(resolution time.Duration) string {
+	return fmt.Sprintf("rollup-%ds.log", int64(math.Round(resolution.Seconds())))
+}
@@ -0,0 +1,254 @@
+package storage
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kennethfeh/system-monitor/internal/models"
+)
+
+func TestParseTiers(t *testing.T) {
+	tiers, err := ParseTiers("1m:24h, 1h:720h")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(tiers) != 2 || tiers[0].Resolution != time.Minute || tiers[1].Retention != 720*time.Hour {
+		t.Errorf("Unexpected tiers: %+v", tiers)
+	}
+
+	for _, bad := range []string{"1m", "fast:1h", "1m:long"} {
+		if _, err := ParseTiers(bad); err == nil {
+			t.Errorf("Expected error for %q", bad)
+		}
+	}
+}
+
+func TestRetentionPolicyValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy RetentionPolicy
+		valid  bool
+	}{
+		{"Empty", RetentionPolicy{}, true},
+		{"Tiered", RetentionPolicy{Raw: time.Hour, Tiers: []Tier{{time.Minute, 24 * time.Hour}, {time.Hour, 720 * time.Hour}}}, true},
+		{"Sub-second resolution", RetentionPolicy{Tiers: []Tier{{500 * time.Millisecond, time.Hour}}}, false},
+		{"Retention shorter than resolution", RetentionPolicy{Tiers: []Tier{{time.Hour, time.Minute}}}, false},
+		{"Unordered", RetentionPolicy{Tiers: []Tier{{time.Hour, 720 * time.Hour}, {time.Minute, 24 * time.Hour}}}, false},
+		{"Negative raw", RetentionPolicy{Raw: -time.Hour}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.policy.Validate(); (err == nil) != tt.valid {
+				t.Errorf("Validate() error = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestFlatten(t *testing.T) {
+	values := flatten(models.SystemMetrics{
+		Timestamp: time.Now(),
+		CPU:       models.CPUMetrics{TotalPercent: 12.5, UsagePercent: []float64{10, 15}},
+		Memory:    models.MemoryMetrics{UsedPercent: 40},
+		Disk:      []models.DiskMetrics{{Device: "/dev/sda1", Mountpoint: "/", UsedPercent: 70}},
+		Network:   []models.NetworkMetrics{{Name: "eth0", BytesRecvRate: 1024}},
+		Processes: []models.ProcessMetrics{{PID: 1, CPUPercent: 5}},
+	})
+
+	expected := map[string]float64{
+		"cpu.total_percent":            12.5,
+		"cpu.usage_percent.1":          15,
+		"memory.used_percent":          40,
+		"disk./.used_percent":          70,
+		"network.eth0.bytes_recv_rate": 1024,
+	}
+	for name, want := range expected {
+		if got, ok := values[name]; !ok || got != want {
+			t.Errorf("Expected %s = %v, got %v (present %v)", name, want, got, ok)
+		}
+	}
+	for name := range values {
+		if name == "timestamp" || len(name) > 9 && name[:9] == "processes" {
+			t.Errorf("Unexpected series %q", name)
+		}
+	}
+}
+
+func TestSectionsFor(t *testing.T) {
+	tests := []struct {
+		fields   []string
+		section  string
+		expected bool
+	}{
+		{nil, "cpu", true},
+		{[]string{"disk.*.used"}, "disk", true},
+		{[]string{"disk.*.used"}, "disk_io", false},
+		{[]string{"disk*"}, "disk_forecast", true},
+		{[]string{"*percent"}, "memory", true},
+		{[]string{"c*"}, "cgroups", true},
+		{[]string{"c*"}, "memory", false},
+		{[]string{"memory.used", "network.*"}, "network", true},
+	}
+	for _, tt := range tests {
+		if got := sectionsFor(tt.fields)(tt.section); got != tt.expected {
+			t.Errorf("sectionsFor(%q)(%q) = %v, want %v", tt.fields, tt.section, got, tt.expected)
+		}
+	}
+}
+
+// TestFlattenMatchesJSON checks that the series read from the typed fields
+// are named and valued as in the snapshot's JSON form
+func TestFlattenMatchesJSON(t *testing.T) {
+	hours := 12.5
+	m := benchSnapshot(7)
+	m.DiskIO[0].Mountpoints = []string{"/"}
+	m.DiskForecast = []models.DiskForecast{{Mountpoint: "/", Total: 100, Used: 40, Free: 60, GrowthBytesPerHour: 5, Confidence: 0.9, Samples: 30, SpanSeconds: 3600, HoursToFull: &hours}}
+	psi := &models.PSIMetrics{Memory: models.PSIResource{Some: models.PSIStats{Avg10: 1}, Full: &models.PSIStats{Avg60: 2, TotalMicros: 3}}}
+	m.PSI = psi
+	m.Cgroups = []models.CgroupMetrics{{Path: "/docker", CPU: models.CgroupCPU{UsagePercent: 20, ThrottledPeriods: 3}, Memory: models.CgroupMemory{Current: 1 << 20}, Pressure: psi}, {}}
+	m.Temperature = []models.TempMetrics{{SensorKey: "coretemp_core_0", Temperature: 48, Label: "Core 0"}}
+	m.Processes = []models.ProcessMetrics{{PID: 1, CPUPercent: 5}}
+	m.Custom = map[string]interface{}{"app": map[string]interface{}{"queue": 4, "workers": []map[string]interface{}{{"name": "a", "busy": 1}}}}
+	m.Errors = []models.CollectionError{{Source: "disk", Error: "failed"}}
+	m.CollectDurationMs = map[string]float64{"cpu": 1.5}
+	m.SectionTimestamps = map[string]time.Time{"cpu": m.Timestamp}
+
+	var tree map[string]interface{}
+	data, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &tree); err != nil {
+		t.Fatal(err)
+	}
+	expected := make(map[string]float64)
+	flattenValue("", tree, expected)
+
+	if got := flatten(m); !reflect.DeepEqual(got, expected) {
+		for name, want := range expected {
+			if v, ok := got[name]; !ok || v != want {
+				t.Errorf("Expected %s = %v, got %v (present %v)", name, want, v, ok)
+			}
+		}
+		for name := range got {
+			if _, ok := expected[name]; !ok {
+				t.Errorf("Unexpected series %s", name)
+			}
+		}
+	}
+}
+
+func TestRollupTier(t *testing.T) {
+	tier := &rollupTier{Tier: Tier{Resolution: time.Minute, Retention: 3 * time.Minute}}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for i, v := range []float64{4, 2, 6} {
+		if r := tier.add(start.Add(time.Duration(i)*10*time.Second), map[string]float64{"x": v}); r != nil {
+			t.Fatal("Expected no finished bucket within the first minute")
+		}
+	}
+
+	finished := tier.add(start.Add(time.Minute), map[string]float64{"x": 10})
+	if finished == nil {
+		t.Fatal("Expected the first bucket to finish")
+	}
+	agg := finished.Series["x"]
+	if agg.Min != 2 || agg.Max != 6 || agg.Avg != 4 || agg.Last != 6 || agg.Count != 3 {
+		t.Errorf("Unexpected aggregate: %+v", agg)
+	}
+
+	// Late samples for a finished bucket are ignored
+	if r := tier.add(start.Add(30*time.Second), map[string]float64{"x": 100}); r != nil || len(tier.done) != 1 {
+		t.Error("Expected late sample to be ignored")
+	}
+
+	points := tier.query(start, start.Add(2*time.Minute), nil)["x"]
+	if len(points) != 2 || points[1].Last != 10 {
+		t.Errorf("Expected the finished and the in-progress bucket, got %+v", points)
+	}
+
+	tier.prune(start.Add(5 * time.Minute))
+	if len(tier.done) != 0 {
+		t.Errorf("Expected expired bucket to be pruned, got %d", len(tier.done))
+	}
+}
+
+func TestSelectLevel(t *testing.T) {
+	now := time.Now()
+	oldest := []time.Time{now.Add(-time.Hour), now.Add(-24 * time.Hour), now.Add(-720 * time.Hour)}
+	ok := []bool{true, true, true}
+
+	tests := []struct {
+		start time.Time
+		want  int
+	}{
+		{now.Add(-30 * time.Minute), 0},
+		{now.Add(-6 * time.Hour), 1},
+		{now.Add(-7 * 24 * time.Hour), 2},
+		{now.Add(-1000 * time.Hour), 2},
+	}
+	for _, tt := range tests {
+		if got := selectLevel(oldest, ok, tt.start); got != tt.want {
+			t.Errorf("selectLevel(%v) = %d, want %d", now.Sub(tt.start), got, tt.want)
+		}
+	}
+
+	if got := selectLevel(oldest, []bool{false, true, false}, now.Add(-30*time.Minute)); got != 1 {
+		t.Errorf("Expected the only level with data, got %d", got)
+	}
+}
+
+func TestMetricsStorageRetention(t *testing.T) {
+	s := NewMetricsStorage(5)
+	err := s.SetRetention(RetentionPolicy{
+		Raw:   time.Minute,
+		Tiers: []Tier{{Resolution: 10 * time.Second, Retention: 10 * time.Minute}},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 300; i++ {
+		s.Add(models.SystemMetrics{
+			Timestamp: start.Add(time.Duration(i) * time.Second),
+			Memory:    models.MemoryMetrics{UsedPercent: float64(i)},
+		})
+	}
+	end := start.Add(299 * time.Second)
+
+	if s.Size() != 61 {
+		t.Errorf("Expected one minute of raw points, got %d", s.Size())
+	}
+	if len(s.GetHistory()) != 5 {
+		t.Errorf("Expected history to return the last 5 points, got %d", len(s.GetHistory()))
+	}
+
+	recent, err := s.Query(end.Add(-30*time.Second), end, []string{"memory.*"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	raw := recent.Series["memory.used_percent"]
+	if recent.Resolution != 0 || len(raw) != 31 || raw[30].Last != 299 {
+		t.Errorf("Expected 31 raw points, got resolution %v with %d points", recent.Resolution, len(raw))
+	}
+	if _, ok := recent.Series["cpu.total_percent"]; ok {
+		t.Error("Expected only the selected series")
+	}
+
+	older, err := s.Query(start, end, []string{"memory.used_percent"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	buckets := older.Series["memory.used_percent"]
+	if older.Resolution != 10*time.Second || len(buckets) != 30 {
+		t.Fatalf("Expected 30 10s buckets, got resolution %v with %d points", older.Resolution, len(buckets))
+	}
+	first := buckets[0]
+	if first.Min != 0 || first.Max != 9 || first.Avg != 4.5 {
+		t.Errorf("Unexpected first bucket: %+v", first)
+	}
+}
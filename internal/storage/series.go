@@ -0,0 +1,316 @@
+package storage
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/kennethfeh/system-monitor/internal/models"
+)
+
+// flattenSkip lists snapshot fields that are not turned into series: they
+// are not numeric, change identity every sample, or describe the
+// collection rather than the system
+var flattenSkip = map[string]bool{
+	"timestamp":          true,
+	"errors":             true,
+	"section_timestamps": true,
+	"processes":          true,
+	"mountpoints":        true,
+}
+
+// seriesKeys are the fields that identify an element of a list, in order of
+// preference. Elements without one are keyed by their index.
+var seriesKeys = []string{"mountpoint", "device", "name", "path", "sensor_key"}
+
+// flatten turns a snapshot into numeric series named by their JSON path,
+// e.g. "cpu.total_percent", "disk./.used_percent" or
+// "network.eth0.bytes_recv_rate". The typed fields are read directly; only
+// Custom, whose shape is up to its source, goes through its JSON form.
+func flatten(m models.SystemMetrics) map[string]float64 {
+	return flattenSections(m, allSections)
+}
+
+// flattenSections flattens the top-level sections of a snapshot selected
+// by want, such as "cpu" or "disk"
+func flattenSections(m models.SystemMetrics, want func(section string) bool) map[string]float64 {
+	values := make(map[string]float64, 256)
+
+	if want("cpu") {
+		flattenCPU(values, "cpu", m.CPU)
+	}
+	if want("memory") {
+		flattenMemory(values, "memory", m.Memory)
+	}
+	if want("disk") {
+		for i, d := range m.Disk {
+			p := joinSeries("disk", listKey(i, d.Mountpoint, d.Device))
+			values[p+".total"] = float64(d.Total)
+			values[p+".used"] = float64(d.Used)
+			values[p+".free"] = float64(d.Free)
+			values[p+".used_percent"] = d.UsedPercent
+		}
+	}
+	if want("disk_io") {
+		for i, d := range m.DiskIO {
+			flattenDiskIO(values, joinSeries("disk_io", listKey(i, d.Device)), d)
+		}
+	}
+	if want("disk_forecast") {
+		for i, f := range m.DiskForecast {
+			flattenForecast(values, joinSeries("disk_forecast", listKey(i, f.Mountpoint)), f)
+		}
+	}
+	if want("network") {
+		for i, n := range m.Network {
+			flattenNetwork(values, joinSeries("network", listKey(i, n.Name)), n)
+		}
+	}
+	if want("system") {
+		values["system.uptime"] = float64(m.System.Uptime)
+		values["system.boot_time"] = float64(m.System.BootTime)
+	}
+	if want("psi") && m.PSI != nil {
+		flattenPSI(values, "psi", *m.PSI)
+	}
+	if want("cgroups") {
+		for i, c := range m.Cgroups {
+			flattenCgroup(values, joinSeries("cgroups", listKey(i, c.Path)), c)
+		}
+	}
+	if want("temperature") {
+		for i, t := range m.Temperature {
+			values[joinSeries("temperature", listKey(i, t.SensorKey))+".temperature"] = t.Temperature
+		}
+	}
+	if want("collect_duration_ms") {
+		for source, ms := range m.CollectDurationMs {
+			values[joinSeries("collect_duration_ms", source)] = ms
+		}
+	}
+
+	if want("custom") && len(m.Custom) > 0 {
+		var tree interface{}
+		data, err := json.Marshal(m.Custom)
+		if err == nil {
+			err = json.Unmarshal(data, &tree)
+		}
+		if err == nil {
+			flattenValue("custom", tree, values)
+		}
+	}
+	return values
+}
+
+func allSections(string) bool { return true }
+
+// sectionsFor returns which top-level sections can hold series selected
+// by fields, judged by the part of each pattern before its first dot. A
+// "*" there may span dots, so it admits every section sharing the text
+// before it.
+func sectionsFor(fields []string) func(section string) bool {
+	if len(fields) == 0 {
+		return allSections
+	}
+	return func(section string) bool {
+		for _, pattern := range fields {
+			head, _, _ := strings.Cut(pattern, ".")
+			if star := strings.IndexByte(head, '*'); star >= 0 {
+				if strings.HasPrefix(section, head[:star]) {
+					return true
+				}
+			} else if head == section {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func flattenCPU(values map[string]float64, p string, c models.CPUMetrics) {
+	for i, v := range c.UsagePercent {
+		values[p+".usage_percent."+strconv.Itoa(i)] = v
+	}
+	values[p+".total_percent"] = c.TotalPercent
+	flattenModes(values, p+".modes", c.Modes)
+	for i, modes := range c.CoreModes {
+		flattenModes(values, p+".core_modes."+strconv.Itoa(i), modes)
+	}
+	values[p+".cores"] = float64(c.Cores)
+	for i, v := range c.LoadAvg {
+		values[p+".load_avg."+strconv.Itoa(i)] = v
+	}
+}
+
+func flattenModes(values map[string]float64, p string, m models.CPUModeMetrics) {
+	values[p+".user"] = m.User
+	values[p+".nice"] = m.Nice
+	values[p+".system"] = m.System
+	values[p+".idle"] = m.Idle
+	values[p+".iowait"] = m.Iowait
+	values[p+".irq"] = m.Irq
+	values[p+".softirq"] = m.Softirq
+	values[p+".steal"] = m.Steal
+	values[p+".guest"] = m.Guest
+}
+
+func flattenMemory(values map[string]float64, p string, m models.MemoryMetrics) {
+	values[p+".total"] = float64(m.Total)
+	values[p+".used"] = float64(m.Used)
+	values[p+".free"] = float64(m.Free)
+	values[p+".available"] = float64(m.Available)
+	values[p+".used_percent"] = m.UsedPercent
+	values[p+".swap_total"] = float64(m.SwapTotal)
+	values[p+".swap_used"] = float64(m.SwapUsed)
+	values[p+".swap_free"] = float64(m.SwapFree)
+	values[p+".swap_percent"] = m.SwapPercent
+}
+
+func flattenDiskIO(values map[string]float64, p string, d models.DiskIOMetrics) {
+	values[p+".read_bytes_per_sec"] = d.ReadBytesPerSec
+	values[p+".write_bytes_per_sec"] = d.WriteBytesPerSec
+	values[p+".read_ops_per_sec"] = d.ReadOpsPerSec
+	values[p+".write_ops_per_sec"] = d.WriteOpsPerSec
+	values[p+".read_await_ms"] = d.ReadAwaitMs
+	values[p+".write_await_ms"] = d.WriteAwaitMs
+	values[p+".await_ms"] = d.AwaitMs
+	values[p+".queue_depth"] = d.QueueDepth
+	values[p+".in_progress"] = float64(d.InProgress)
+	values[p+".busy_percent"] = d.BusyPercent
+}
+
+func flattenForecast(values map[string]float64, p string, f models.DiskForecast) {
+	values[p+".total"] = float64(f.Total)
+	values[p+".used"] = float64(f.Used)
+	values[p+".free"] = float64(f.Free)
+	values[p+".growth_bytes_per_hour"] = f.GrowthBytesPerHour
+	values[p+".confidence"] = f.Confidence
+	values[p+".samples"] = float64(f.Samples)
+	values[p+".span_seconds"] = f.SpanSeconds
+	if f.HoursToFull != nil {
+		values[p+".hours_to_full"] = *f.HoursToFull
+	}
+}
+
+func flattenNetwork(values map[string]float64, p string, n models.NetworkMetrics) {
+	values[p+".bytes_sent"] = float64(n.BytesSent)
+	values[p+".bytes_recv"] = float64(n.BytesRecv)
+	values[p+".packets_sent"] = float64(n.PacketsSent)
+	values[p+".packets_recv"] = float64(n.PacketsRecv)
+	values[p+".errin"] = float64(n.Errin)
+	values[p+".errout"] = float64(n.Errout)
+	values[p+".dropin"] = float64(n.Dropin)
+	values[p+".dropout"] = float64(n.Dropout)
+	values[p+".bytes_sent_rate"] = n.BytesSentRate
+	values[p+".bytes_recv_rate"] = n.BytesRecvRate
+	values[p+".packets_sent_rate"] = n.PacketsSentRate
+	values[p+".packets_recv_rate"] = n.PacketsRecvRate
+	values[p+".errin_rate"] = n.ErrinRate
+	values[p+".errout_rate"] = n.ErroutRate
+	values[p+".dropin_rate"] = n.DropinRate
+	values[p+".dropout_rate"] = n.DropoutRate
+}
+
+func flattenPSI(values map[string]float64, p string, psi models.PSIMetrics) {
+	flattenPSIResource(values, p+".cpu", psi.CPU)
+	flattenPSIResource(values, p+".memory", psi.Memory)
+	flattenPSIResource(values, p+".io", psi.IO)
+}
+
+func flattenPSIResource(values map[string]float64, p string, r models.PSIResource) {
+	flattenPSIStats(values, p+".some", r.Some)
+	if r.Full != nil {
+		flattenPSIStats(values, p+".full", *r.Full)
+	}
+}
+
+func flattenPSIStats(values map[string]float64, p string, s models.PSIStats) {
+	values[p+".avg10"] = s.Avg10
+	values[p+".avg60"] = s.Avg60
+	values[p+".avg300"] = s.Avg300
+	values[p+".total_us"] = float64(s.TotalMicros)
+}
+
+func flattenCgroup(values map[string]float64, p string, c models.CgroupMetrics) {
+	values[p+".cpu.usage_percent"] = c.CPU.UsagePercent
+	values[p+".cpu.usage_us"] = float64(c.CPU.UsageMicros)
+	values[p+".cpu.nr_periods"] = float64(c.CPU.Periods)
+	values[p+".cpu.nr_throttled"] = float64(c.CPU.ThrottledPeriods)
+	values[p+".cpu.throttled_us"] = float64(c.CPU.ThrottledMicros)
+	values[p+".memory.current"] = float64(c.Memory.Current)
+	values[p+".memory.max"] = float64(c.Memory.Max)
+	values[p+".memory.events.low"] = float64(c.Memory.Events.Low)
+	values[p+".memory.events.high"] = float64(c.Memory.Events.High)
+	values[p+".memory.events.max"] = float64(c.Memory.Events.Max)
+	values[p+".memory.events.oom"] = float64(c.Memory.Events.OOM)
+	values[p+".memory.events.oom_kill"] = float64(c.Memory.Events.OOMKill)
+	values[p+".io.read_bytes"] = float64(c.IO.ReadBytes)
+	values[p+".io.write_bytes"] = float64(c.IO.WriteBytes)
+	values[p+".io.read_ops"] = float64(c.IO.ReadOps)
+	values[p+".io.write_ops"] = float64(c.IO.WriteOps)
+	values[p+".io.read_bytes_per_sec"] = c.IO.ReadBytesPerSec
+	values[p+".io.write_bytes_per_sec"] = c.IO.WriteBytesPerSec
+	values[p+".pids.current"] = float64(c.Pids.Current)
+	values[p+".pids.max"] = float64(c.Pids.Max)
+	if c.Pressure != nil {
+		flattenPSI(values, p+".pressure", *c.Pressure)
+	}
+}
+
+// listKey returns the key of list element i in series names: the first of
+// its identifying fields that is set, or its index
+func listKey(i int, ids ...string) string {
+	for _, id := range ids {
+		if id != "" {
+			return id
+		}
+	}
+	return strconv.Itoa(i)
+}
+
+func flattenValue(prefix string, v interface{}, values map[string]float64) {
+	switch v := v.(type) {
+	case float64:
+		values[prefix] = v
+	case map[string]interface{}:
+		for key, child := range v {
+			if flattenSkip[key] {
+				continue
+			}
+			flattenValue(joinSeries(prefix, key), child, values)
+		}
+	case []interface{}:
+		for i, child := range v {
+			flattenValue(joinSeries(prefix, elementKey(i, child)), child, values)
+		}
+	}
+}
+
+// elementKey returns the key of list element i in series names
+func elementKey(i int, v interface{}) string {
+	if _, id, ok := SeriesKey(v); ok {
+		return id
+	}
+	return strconv.Itoa(i)
+}
+
+// SeriesKey returns the field identifying a list element of a snapshot's
+// JSON tree and its value, e.g. "mountpoint" and "/" for a filesystem. It
+// reports false for elements without one, which are told apart by index.
+func SeriesKey(element interface{}) (field, id string, ok bool) {
+	if obj, isObj := element.(map[string]interface{}); isObj {
+		for _, idKey := range seriesKeys {
+			if id, ok := obj[idKey].(string); ok && id != "" {
+				return idKey, id, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+func joinSeries(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
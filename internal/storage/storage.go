@@ -2,15 +2,44 @@ package storage
 
 import (
 	"sync"
+	"time"
 
 	"github.com/kennethfeh/system-monitor/internal/models"
 )
 
-// MetricsStorage stores historical metrics data
+// Storage is a store of metric snapshots in timestamp order
+type Storage interface {
+	// Add appends a snapshot
+	Add(metric models.SystemMetrics) error
+	// GetHistory returns the most recent snapshots, oldest first
+	GetHistory() []models.SystemMetrics
+	// GetLatest returns the most recent snapshot, or nil if there is none
+	GetLatest() *models.SystemMetrics
+	// Range returns the snapshots with start <= Timestamp <= end
+	Range(start, end time.Time) ([]models.SystemMetrics, error)
+	// Query returns the series matching fields between start and end, from
+	// the raw snapshots or the finest rollup tier that reaches back to
+	// start. Fields may contain "*" wildcards; none selects every series.
+	Query(start, end time.Time, fields []string) (QueryResult, error)
+	// Size returns the number of stored snapshots
+	Size() int
+	// Clear removes all stored snapshots
+	Clear() error
+	// Close releases the resources held by the store
+	Close() error
+}
+
+// MetricsStorage stores historical metrics data in memory. The most recent
+// maxSize snapshots are kept whole for GetHistory and Range. With a raw
+// retention set, every snapshot is also stored as compressed per-series
+// columns, which Query reads from and which can reach much further back.
 type MetricsStorage struct {
-	mu       sync.RWMutex
-	metrics  []models.SystemMetrics
-	maxSize  int
+	mu        sync.RWMutex
+	metrics   []models.SystemMetrics
+	maxSize   int
+	retention RetentionPolicy
+	columns   *columnStore
+	rollups   *rollupSet
 }
 
 // NewMetricsStorage creates a new metrics storage with specified history size
@@ -21,11 +50,36 @@ func NewMetricsStorage(maxSize int) *MetricsStorage {
 	return &MetricsStorage{
 		metrics: make([]models.SystemMetrics, 0, maxSize),
 		maxSize: maxSize,
+		columns: newColumnStore(),
+		rollups: newRollupSet(nil),
 	}
 }
 
+// SetRetention switches the storage to time-based retention. With a raw
+// retention set, the series are kept for that long rather than by count,
+// while GetHistory and Range cover the most recent maxSize snapshots.
+// Existing rollups are discarded.
+func (s *MetricsStorage) SetRetention(policy RetentionPolicy) error {
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.retention = policy
+	s.rollups = newRollupSet(policy.Tiers)
+	s.columns.reset()
+	if policy.Raw > 0 {
+		for _, m := range s.metrics {
+			s.columns.add(m.Timestamp, flatten(m))
+		}
+	}
+	return nil
+}
+
 // Add adds a new metric to the storage
-func (s *MetricsStorage) Add(metric models.SystemMetrics) {
+func (s *MetricsStorage) Add(metric models.SystemMetrics) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -35,9 +89,31 @@ func (s *MetricsStorage) Add(metric models.SystemMetrics) {
 	if len(s.metrics) > s.maxSize {
 		s.metrics = s.metrics[len(s.metrics)-s.maxSize:]
 	}
+	
+	var values map[string]float64
+	if cutoff := s.retention.retentionCutoff(metric.Timestamp); !cutoff.IsZero() {
+		values = flatten(metric)
+		s.columns.add(metric.Timestamp, values)
+		s.columns.prune(cutoff)
+		
+		n := 0
+		for n < len(s.metrics) && s.metrics[n].Timestamp.Before(cutoff) {
+			n++
+		}
+		s.metrics = s.metrics[n:]
+	}
+	
+	if len(s.rollups.tiers) > 0 {
+		if values == nil {
+			values = flatten(metric)
+		}
+		s.rollups.add(metric.Timestamp, values, nil)
+		s.rollups.prune(metric.Timestamp)
+	}
+	return nil
 }
 
-// GetHistory returns all stored metrics
+// GetHistory returns the most recent maxSize snapshots
 func (s *MetricsStorage) GetHistory() []models.SystemMetrics {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -61,18 +137,81 @@ func (s *MetricsStorage) GetLatest() *models.SystemMetrics {
 	return &latest
 }
 
+// Range returns the stored metrics with timestamps between start and end.
+// It covers the most recent maxSize snapshots; use Query for longer
+// ranges.
+func (s *MetricsStorage) Range(start, end time.Time) ([]models.SystemMetrics, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var result []models.SystemMetrics
+	for _, m := range s.metrics {
+		if inRange(m.Timestamp, start, end) {
+			result = append(result, m)
+		}
+	}
+	return result, nil
+}
+
+// Query returns the series matching fields between start and end. Raw
+// points are used while they reach back to start, otherwise the finest
+// rollup tier that does. With a raw retention only the selected columns
+// are decoded; without one the raw points are those of the snapshots.
+func (s *MetricsStorage) Query(start, end time.Time, fields []string) (QueryResult, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.retention.Raw > 0 {
+		rawOldest, rawOK := s.columns.oldest()
+		return s.rollups.queryLevels(start, end, fields, rawOldest, rawOK, func() (map[string][]SeriesPoint, error) {
+			return s.columns.query(start, end, fields), nil
+		})
+	}
+
+	var rawOldest time.Time
+	if len(s.metrics) > 0 {
+		rawOldest = s.metrics[0].Timestamp
+	}
+	return s.rollups.queryLevels(start, end, fields, rawOldest, len(s.metrics) > 0, func() (map[string][]SeriesPoint, error) {
+		series := make(map[string][]SeriesPoint)
+		for _, m := range s.metrics {
+			if inRange(m.Timestamp, start, end) {
+				rawSeries(series, m.Timestamp, flatten(m), fields)
+			}
+		}
+		return series, nil
+	})
+}
+
 // Clear removes all stored metrics
-func (s *MetricsStorage) Clear() {
+func (s *MetricsStorage) Clear() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	s.metrics = s.metrics[:0]
+	s.columns.reset()
+	s.rollups.reset()
+	return nil
+}
+
+// Close is a no-op for the in-memory storage
+func (s *MetricsStorage) Close() error {
+	return nil
 }
 
-// Size returns the current number of stored metrics
+// Size returns the current number of stored metrics, which with a raw
+// retention includes those older than the history
 func (s *MetricsStorage) Size() int {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
+	if s.retention.Raw > 0 {
+		return s.columns.size()
+	}
 	return len(s.metrics)
-}
\ No newline at end of file
+}
+
+// inRange reports whether start <= t <= end
+func inRange(t, start, end time.Time) bool {
+	return !t.Before(start) && !t.After(end)
+}
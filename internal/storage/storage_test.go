@@ -30,8 +30,8 @@ func TestNewMetricsStorage(t *testing.T) {
 				t.Errorf("Expected maxSize to be %d, got %d", tt.expected, storage.maxSize)
 			}
 			
-			if storage.metrics == nil {
-				t.Error("Expected metrics slice to be initialized")
+			if storage.columns == nil {
+				t.Error("Expected columns to be initialized")
 			}
 		})
 	}
@@ -202,6 +202,25 @@ func TestClear(t *testing.T) {
 	}
 }
 
+func TestRange(t *testing.T) {
+	storage := NewMetricsStorage(10)
+	start := time.Now()
+	
+	for i := 0; i < 5; i++ {
+		storage.Add(models.SystemMetrics{
+			Timestamp: start.Add(time.Duration(i) * time.Second),
+		})
+	}
+	
+	result, err := storage.Range(start.Add(1*time.Second), start.Add(3*time.Second))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(result) != 3 {
+		t.Errorf("Expected 3 metrics in range, got %d", len(result))
+	}
+}
+
 func TestConcurrentAccess(t *testing.T) {
 	storage := NewMetricsStorage(100)
 	done := make(chan bool)
@@ -248,4 +267,57 @@ func TestConcurrentAccess(t *testing.T) {
 	if len(history) != size {
 		t.Errorf("Inconsistent state: size=%d, history length=%d", size, len(history))
 	}
-}
\ No newline at end of file
+}
+
+func TestHistoryWithRetention(t *testing.T) {
+	storage := NewMetricsStorage(3)
+	if err := storage.SetRetention(RetentionPolicy{Raw: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	
+	for i := 0; i < 6; i++ {
+		m := models.SystemMetrics{
+			Timestamp: start.Add(time.Duration(i) * time.Second),
+			CPU:       models.CPUMetrics{TotalPercent: float64(10 * i)},
+			Disk: []models.DiskMetrics{
+				{Device: "/dev/sda1", Mountpoint: "/", Fstype: "ext4", Total: 100 << 30, Used: uint64(i) << 30},
+			},
+			System:    models.SystemInfo{Hostname: "host"},
+			Processes: []models.ProcessMetrics{{PID: int32(i), Name: "worker"}},
+		}
+		if i < 4 {
+			// A filesystem unmounted after the fourth snapshot
+			m.Disk = append(m.Disk, models.DiskMetrics{Device: "/dev/sdb1", Mountpoint: "/mnt", Fstype: "xfs", Used: 1 << 30})
+		}
+		storage.Add(m)
+	}
+	
+	if storage.Size() != 6 {
+		t.Errorf("Expected the retention to hold 6 snapshots, got %d", storage.Size())
+	}
+	
+	// The history is the latest snapshots as they were added
+	history := storage.GetHistory()
+	if len(history) != 3 {
+		t.Fatalf("Expected 3 items in history, got %d", len(history))
+	}
+	if len(history[0].Disk) != 2 || history[0].Disk[1].Fstype != "xfs" || len(history[0].Processes) != 1 {
+		t.Errorf("Expected the snapshot to be kept whole, got %+v", history[0])
+	}
+	if len(history[2].Disk) != 1 || history[2].CPU.TotalPercent != 50 {
+		t.Errorf("Unexpected latest snapshot %+v", history[2])
+	}
+	
+	// Query reaches back past the history
+	result, err := storage.Query(start, start.Add(time.Minute), []string{"cpu.total_percent", "disk./mnt.used"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if n := len(result.Series["cpu.total_percent"]); n != 6 {
+		t.Errorf("Expected 6 CPU points, got %d", n)
+	}
+	if n := len(result.Series["disk./mnt.used"]); n != 4 {
+		t.Errorf("Expected 4 points of the unmounted filesystem, got %d", n)
+	}
+}
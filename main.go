@@ -4,19 +4,27 @@ import (
 	"context"
 	"embed"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"html/template"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
+	"github.com/kennethfeh/system-monitor/internal/alert"
 	"github.com/kennethfeh/system-monitor/internal/collector"
+	"github.com/kennethfeh/system-monitor/internal/export"
 	"github.com/kennethfeh/system-monitor/internal/models"
 	"github.com/kennethfeh/system-monitor/internal/storage"
 )
@@ -29,8 +37,67 @@ var templateFiles embed.FS
 
 var (
 	port     = flag.String("port", "8080", "Port to run the server on")
-	interval = flag.Duration("interval", 2*time.Second, "Metrics collection interval")
+	interval = flag.Duration("interval", collector.DefaultInterval, "Default metrics collection interval")
 	history  = flag.Int("history", 60, "Number of historical data points to keep")
+	
+	storageBackend = flag.String("storage", "memory", "Metrics storage backend: memory or disk")
+	storageDir     = flag.String("storage-dir", "data", "Directory of the disk storage backend")
+	retention      = flag.Duration("retention", 0, "How long to keep raw data points (default: keep -history points in memory, everything on disk)")
+	rollupTiers    = flag.String("rollups", "", "Comma-separated rollup tiers as resolution:retention, e.g. 1m:24h,1h:720h")
+
+	processLimit   = flag.Int("process-limit", collector.DefaultProcessLimit, "Number of processes returned by /api/processes")
+	processSort    = flag.String("process-sort", string(collector.SortByCPU), "Default process sort key: cpu, memory or io")
+	embedProcesses = flag.Bool("embed-processes", false, "Include the top process table in every metrics snapshot")
+
+	cgroupRoot   = flag.String("cgroup-root", "", "Mount point of the cgroup filesystem (default <host-sys>/fs/cgroup)")
+	cgroupDepth  = flag.Int("cgroup-depth", collector.DefaultCgroupDepth, "How many levels below the cgroup root to report")
+	embedCgroups = flag.Bool("embed-cgroups", true, "Include cgroup accounting in every metrics snapshot")
+
+	enableSources  = flag.String("enable-collectors", "", "Comma-separated metric sources to enable (see /api/collectors)")
+	disableSources = flag.String("disable-collectors", "", "Comma-separated metric sources to disable")
+	sourceIntervals = flag.String("collector-intervals", "", "Comma-separated per-source intervals overriding -interval, e.g. cpu=1s,disk=30s,system=5m")
+
+	remoteWriteURL      = flag.String("remote-write-url", "", "Prometheus remote_write URL to push every snapshot to (disabled when empty)")
+	remoteWriteLabels   = flag.String("remote-write-labels", "", "Comma-separated name=value labels added to pushed series (default job=system-monitor,instance=<hostname>)")
+	remoteWriteBatch    = flag.Int("remote-write-batch", export.DefaultRemoteWriteBatch, "Most snapshots sent in one remote_write request")
+	remoteWriteFlush    = flag.Duration("remote-write-flush", export.DefaultRemoteWriteFlush, "Longest a snapshot waits before being pushed")
+	remoteWriteSpillDir = flag.String("remote-write-spill-dir", "", "Directory queueing undelivered batches during outages (default <storage-dir>/remote-write)")
+	remoteWriteSpillMax = flag.Int64("remote-write-spill-max", export.DefaultRemoteWriteSpillMax, "Most bytes of undelivered batches to queue")
+
+	influxURL    = flag.String("influx-url", "", "InfluxDB write URL to push line protocol to: http(s)://host:8086/write?db=..., http(s)://host:8086/api/v2/write?org=...&bucket=... or udp://host:8089")
+	influxToken  = flag.String("influx-token", "", "InfluxDB API token (env INFLUX_TOKEN)")
+	influxTags   = flag.String("influx-tags", "", "Comma-separated name=value tags added to every point (default host=<hostname>)")
+	influxPrefix = flag.String("influx-prefix", export.Namespace, "Prefix of measurement names")
+
+	graphiteAddress = flag.String("graphite-address", "", "Graphite plaintext listener to push to, as host:port")
+	graphitePrefix  = flag.String("graphite-prefix", export.Namespace, "First node of metric paths")
+	graphiteTags    = flag.String("graphite-tags", "", "Comma-separated name=value tags added to every metric (default host=<hostname>)")
+	graphiteTagged  = flag.Bool("graphite-tagged", false, "Send labels as Graphite tags instead of path nodes")
+
+	statsdAddress    = flag.String("statsd-address", "", "StatsD aggregator to push to, as host:port for UDP or unix:///path for a Unix datagram socket")
+	statsdPrefix     = flag.String("statsd-prefix", export.Namespace, "First segment of metric names")
+	statsdTags       = flag.String("statsd-tags", "", "Comma-separated name=value tags added to every metric (default host=<hostname>)")
+	statsdDogStatsD  = flag.Bool("statsd-dogstatsd", false, "Send labels as DogStatsD tags instead of name segments")
+	statsdSampleRate = flag.Float64("statsd-sample-rate", 1, "Share of metrics sent, between 0 and 1")
+	statsdPacketSize = flag.Int("statsd-packet-size", 0, "Largest packet sent (default 1432 bytes over UDP, 8192 over a Unix socket)")
+
+	otlpEndpoint   = flag.String("otlp-endpoint", "", "OpenTelemetry collector to export to: host:port for gRPC, or the metrics URL for HTTP, e.g. http://collector:4318/v1/metrics")
+	otlpProtocol   = flag.String("otlp-protocol", export.OTLPGRPC, "OTLP transport: grpc or http/protobuf")
+	otlpInsecure   = flag.Bool("otlp-insecure", false, "Connect to a host:port gRPC endpoint without TLS")
+	otlpHeaders    = flag.String("otlp-headers", "", "Comma-separated name=value headers sent with every export (env OTEL_EXPORTER_OTLP_HEADERS)")
+	otlpAttributes = flag.String("otlp-attributes", "", "Comma-separated name=value resource attributes, e.g. deployment.environment=prod")
+
+	alertRules    = flag.String("alert-rules", "", "JSON file of alerting rules evaluated against every snapshot")
+	alertStateDir = flag.String("alert-state-dir", "", "Directory persisting alert silences and history (default <storage-dir>/alerts)")
+	
+	forecastWindow        = flag.Duration("forecast-window", storage.DefaultForecastWindow, "History that disk usage trends are fitted over")
+	forecastMinConfidence = flag.Float64("forecast-min-confidence", storage.DefaultForecastMinConfidence, "Least R² of a disk usage trend for a time until full to be given")
+
+	hostPaths = collector.PathsFromEnv()
+	hostProc  = flag.String("host-proc", hostPaths.Proc, "Path of the host's /proc (env HOST_PROC)")
+	hostSys   = flag.String("host-sys", hostPaths.Sys, "Path of the host's /sys (env HOST_SYS)")
+	hostEtc   = flag.String("host-etc", hostPaths.Etc, "Path of the host's /etc (env HOST_ETC)")
+	hostRoot  = flag.String("host-root", hostPaths.Root, "Path of the host's root filesystem (env HOST_ROOT)")
 )
 
 var upgrader = websocket.Upgrader{
@@ -41,15 +108,33 @@ var upgrader = websocket.Upgrader{
 
 type Server struct {
 	collector *collector.Collector
-	storage   *storage.MetricsStorage
+	storage   storage.Storage
 	clients   map[*websocket.Conn]bool
 	broadcast chan models.SystemMetrics
 	register  chan *websocket.Conn
 	unregister chan *websocket.Conn
+	sinks     []export.Sink
+	alerts    *alert.Engine
+	notifier  *alert.Dispatcher
+	silences  *alert.Silences
+	history   *alert.History
+	forecastMu sync.Mutex
+	forecasts  []models.DiskForecast
 }
 
-func NewServer(collector *collector.Collector, storage *storage.MetricsStorage) *Server {
+// forecastInterval is how often the disk forecasts attached to snapshots
+// are refitted
+const forecastInterval = time.Minute
+
+func NewServer(collector *collector.Collector, storage storage.Storage) *Server {
+	alerts, _ := alert.NewEngine(nil)
+	silences, _ := alert.OpenSilences("")
+	history, _ := alert.OpenHistory("", alert.DefaultHistoryLimit)
+	alerts.Silences = silences
 	return &Server{
+		alerts:     alerts,
+		silences:   silences,
+		history:    history,
 		collector:  collector,
 		storage:    storage,
 		clients:    make(map[*websocket.Conn]bool),
@@ -140,7 +225,7 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) handleAPIMetrics(w http.ResponseWriter, r *http.Request) {
-	metrics, err := s.collector.Collect()
+	metrics, err := s.collector.CollectDue()
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -150,15 +235,396 @@ func (s *Server) handleAPIMetrics(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(metrics)
 }
 
+// handleMetrics serves the current snapshot in the Prometheus text format,
+// or OpenMetrics when the scraper asks for it
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	metrics, err := s.collector.CollectDue()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	
+	format := export.NegotiateFormat(r.Header.Get("Accept"))
+	w.Header().Set("Content-Type", format.ContentType())
+	if err := export.Encode(w, export.Families(metrics), format); err != nil {
+		log.Printf("Error writing /metrics: %v", err)
+	}
+}
+
+// handleAPIHistory returns the recent snapshots, or with any of the start,
+// end, step, fields or agg parameters the aggregated series of a range
 func (s *Server) handleAPIHistory(w http.ResponseWriter, r *http.Request) {
-	history := s.storage.GetHistory()
+	query := r.URL.Query()
+	if len(query) == 0 {
+		history := s.storage.GetHistory()
+		
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(history)
+		return
+	}
+	
+	q, err := parseHistoryQuery(query, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	
+	result, err := storage.QueryHistory(s.storage, q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 	
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(history)
+	json.NewEncoder(w).Encode(result)
 }
 
+// parseHistoryQuery reads the /api/history parameters. Times are RFC 3339,
+// Unix seconds, or a duration relative to now such as "-6h"; end defaults
+// to now and start to one hour before end.
+func parseHistoryQuery(query url.Values, now time.Time) (storage.HistoryQuery, error) {
+	q := storage.HistoryQuery{End: now}
+	
+	if end := query.Get("end"); end != "" {
+		t, err := parseQueryTime(end, now)
+		if err != nil {
+			return q, fmt.Errorf("invalid end: %w", err)
+		}
+		q.End = t
+	}
+	q.Start = q.End.Add(-time.Hour)
+	if start := query.Get("start"); start != "" {
+		t, err := parseQueryTime(start, now)
+		if err != nil {
+			return q, fmt.Errorf("invalid start: %w", err)
+		}
+		q.Start = t
+	}
+	if !q.End.After(q.Start) {
+		return q, errors.New("end must be after start")
+	}
+	
+	if step := query.Get("step"); step != "" {
+		d, err := time.ParseDuration(step)
+		if err != nil || d <= 0 {
+			return q, fmt.Errorf("invalid step %q", step)
+		}
+		if q.End.Sub(q.Start)/d > storage.MaxQueryPoints {
+			return q, fmt.Errorf("step %v yields more than %d points for the range", d, storage.MaxQueryPoints)
+		}
+		q.Step = d
+	}
+	
+	agg, err := storage.ParseAggregation(query.Get("agg"))
+	if err != nil {
+		return q, err
+	}
+	q.Aggregation = agg
+	
+	for _, field := range strings.Split(query.Get("fields"), ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			q.Fields = append(q.Fields, field)
+		}
+	}
+	return q, nil
+}
+
+func parseQueryTime(s string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		if d > 0 {
+			d = -d
+		}
+		return now.Add(d), nil
+	}
+	if secs, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.Unix(0, int64(secs*float64(time.Second))), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+func (s *Server) handleAPIProcesses(w http.ResponseWriter, r *http.Request) {
+	opts := collector.ProcessOptions{
+		Limit:  *processLimit,
+		SortBy: collector.ProcessSortKey(*processSort),
+	}
+	
+	query := r.URL.Query()
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		opts.Limit = n
+	}
+	if sortBy := query.Get("sort"); sortBy != "" {
+		key, err := collector.ParseProcessSortKey(sortBy)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		opts.SortBy = key
+	}
+	
+	processes, err := s.collector.CollectProcesses(opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(processes)
+}
+
+func (s *Server) handleAPIProcessDetail(w http.ResponseWriter, r *http.Request) {
+	pid, err := strconv.ParseInt(mux.Vars(r)["pid"], 10, 32)
+	if err != nil {
+		http.Error(w, "invalid pid", http.StatusBadRequest)
+		return
+	}
+	
+	detail, err := s.collector.ProcessDetail(int32(pid))
+	if errors.Is(err, collector.ErrProcessNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(detail)
+}
+
+func (s *Server) handleAPIProcessTree(w http.ResponseWriter, r *http.Request) {
+	tree, err := s.collector.ProcessTree()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tree)
+}
+
+func (s *Server) handleAPICgroups(w http.ResponseWriter, r *http.Request) {
+	cgroups, err := s.collector.CollectCgroups()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cgroups)
+}
+
+func (s *Server) handleAPICollectors(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.collector.Registry().Describe())
+}
+
+// handleAPIAlerts lists the pending and firing alerts, or with state those
+// in the given comma-separated states, including recently resolved ones.
+// silenced=true or false keeps only the muted or unmuted alerts.
+func (s *Server) handleAPIAlerts(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var silenced *bool
+	if v := query.Get("silenced"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			http.Error(w, "silenced must be true or false", http.StatusBadRequest)
+			return
+		}
+		silenced = &b
+	}
+	
+	states := map[alert.State]bool{alert.StatePending: true, alert.StateFiring: true}
+	if list := query.Get("state"); list != "" {
+		states = make(map[alert.State]bool)
+		for _, state := range strings.Split(list, ",") {
+			switch st := alert.State(strings.TrimSpace(state)); st {
+			case alert.StatePending, alert.StateFiring, alert.StateResolved:
+				states[st] = true
+			default:
+				http.Error(w, fmt.Sprintf("unknown state %q (want pending, firing or resolved)", state), http.StatusBadRequest)
+				return
+			}
+		}
+	}
+	
+	alerts := []alert.Alert{}
+	for _, a := range s.alerts.Alerts() {
+		if states[a.State] && (silenced == nil || a.Silenced() == *silenced) {
+			alerts = append(alerts, a)
+		}
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(alerts)
+}
+
+// handleAPIAlertHistory returns the recorded alert and silence events,
+// optionally since a time and for one rule
+func (s *Server) handleAPIAlertHistory(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var since time.Time
+	if v := query.Get("since"); v != "" {
+		t, err := parseQueryTime(v, time.Now())
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid since %q", v), http.StatusBadRequest)
+			return
+		}
+		since = t
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.history.Entries(since, query.Get("rule")))
+}
+
+func (s *Server) handleAPISilences(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.silences.List(time.Now()))
+}
+
+// handleAPICreateSilence adds a silence from a JSON body with matchers,
+// created_by, an optional comment and starts_at, and either ends_at or a
+// duration
+func (s *Server) handleAPICreateSilence(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		alert.Silence
+		Duration alert.Duration `json:"duration"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	
+	now := time.Now()
+	if req.EndsAt.IsZero() && req.Duration > 0 {
+		start := req.StartsAt
+		if start.IsZero() {
+			start = now
+		}
+		req.EndsAt = start.Add(time.Duration(req.Duration))
+	}
+	silence, err := s.silences.Add(req.Silence, now)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.history.RecordSilence(alert.EventSilenceCreated, silence, now); err != nil {
+		log.Printf("Error recording alert history: %v", err)
+	}
+	log.Printf("Silence %s created by %s: %s until %s", silence.ID, silence.CreatedBy, silence.Matchers, silence.EndsAt.Format(time.RFC3339))
+	
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(silence)
+}
+
+// handleAPIExpireSilence ends a silence, recording who did from the by
+// parameter
+func (s *Server) handleAPIExpireSilence(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	silence, err := s.silences.Expire(mux.Vars(r)["id"], r.URL.Query().Get("by"), now)
+	if errors.Is(err, alert.ErrSilenceNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.history.RecordSilence(alert.EventSilenceExpired, silence, now); err != nil {
+		log.Printf("Error recording alert history: %v", err)
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(silence)
+}
+
+// handleAPIDiskForecast fits the disk usage trends over -forecast-window,
+// or the window parameter, up to now
+func (s *Server) handleAPIDiskForecast(w http.ResponseWriter, r *http.Request) {
+	opts := storage.ForecastOptions{Window: *forecastWindow, MinConfidence: *forecastMinConfidence}
+	if v := r.URL.Query().Get("window"); v != "" {
+		window, err := time.ParseDuration(v)
+		if err != nil || window <= 0 {
+			http.Error(w, "window must be a positive duration", http.StatusBadRequest)
+			return
+		}
+		opts.Window = window
+	}
+	
+	forecasts, err := storage.ForecastDisks(s.storage, time.Now(), opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(forecasts)
+}
+
+func (s *Server) handleAPICollectorStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.collector.Status())
+}
+
+// configureSources applies the collector enable/disable and interval flags.
+// The -embed-* flags are shorthands for the processes and cgroups sources;
+// explicit -enable/-disable-collectors lists are applied after them.
+func configureSources(registry *collector.Registry) error {
+	if err := registry.SetEnabled(collector.SourceProcesses, *embedProcesses); err != nil {
+		return err
+	}
+	if err := registry.SetEnabled(collector.SourceCgroups, *embedCgroups); err != nil {
+		return err
+	}
+	
+	for _, list := range []struct {
+		names   string
+		enabled bool
+	}{
+		{*enableSources, true},
+		{*disableSources, false},
+	} {
+		for _, name := range strings.Split(list.names, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			if err := registry.SetEnabled(name, list.enabled); err != nil {
+				return err
+			}
+		}
+	}
+	
+	for _, entry := range strings.Split(*sourceIntervals, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			return fmt.Errorf("collector interval %q must be in the form name=duration", entry)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid interval for collector %q: %q", name, value)
+		}
+		if err := registry.SetInterval(strings.TrimSpace(name), d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// startMetricsCollection ticks at the shortest source interval; each tick
+// runs the sources that are due and publishes the assembled snapshot.
 func (s *Server) startMetricsCollection(ctx context.Context) {
-	ticker := time.NewTicker(*interval)
+	ticker := time.NewTicker(s.collector.TickInterval())
 	defer ticker.Stop()
 	
 	for {
@@ -166,18 +632,258 @@ func (s *Server) startMetricsCollection(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			metrics, err := s.collector.Collect()
+			metrics, err := s.collector.CollectDue()
 			if err != nil {
 				log.Printf("Error collecting metrics: %v", err)
 				continue
 			}
 			
-			s.storage.Add(metrics)
+			if err := s.storage.Add(metrics); err != nil {
+				log.Printf("Error storing metrics: %v", err)
+			}
+			metrics.DiskForecast = s.diskForecast()
+			for _, sink := range s.sinks {
+				sink.Push(metrics)
+			}
+			for _, a := range s.alerts.Evaluate(metrics) {
+				log.Printf("Alert %s %s: %s %v", a.Rule, a.State, a.Summary, a.Labels)
+				if err := s.history.RecordAlert(a); err != nil {
+					log.Printf("Error recording alert history: %v", err)
+				}
+			}
+			if s.notifier != nil {
+				s.notifier.Update(metrics.Timestamp, s.alerts.Alerts())
+			}
 			s.broadcast <- metrics
 		}
 	}
 }
 
+// startDiskForecasts refits the disk forecasts from the stored history
+// every forecastInterval. Fitting can read a day of history, so it runs
+// apart from collection, which attaches the latest fit to each snapshot.
+func (s *Server) startDiskForecasts(ctx context.Context) {
+	ticker := time.NewTicker(forecastInterval)
+	defer ticker.Stop()
+	
+	s.refitDiskForecasts(time.Now())
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.refitDiskForecasts(now)
+		}
+	}
+}
+
+// refitDiskForecasts fits the disk forecasts as of now. On failure the
+// previous fit is kept.
+func (s *Server) refitDiskForecasts(now time.Time) {
+	forecasts, err := storage.ForecastDisks(s.storage, now, storage.ForecastOptions{Window: *forecastWindow, MinConfidence: *forecastMinConfidence})
+	if err != nil {
+		log.Printf("Error forecasting disk usage: %v", err)
+		return
+	}
+	
+	s.forecastMu.Lock()
+	s.forecasts = forecasts
+	s.forecastMu.Unlock()
+}
+
+// diskForecast returns the latest disk forecasts
+func (s *Server) diskForecast() []models.DiskForecast {
+	s.forecastMu.Lock()
+	defer s.forecastMu.Unlock()
+	
+	return s.forecasts
+}
+
+// openStorage creates the storage backend selected by -storage with the
+// retention given by -retention and -rollups
+func openStorage() (storage.Storage, error) {
+	tiers, err := storage.ParseTiers(*rollupTiers)
+	if err != nil {
+		return nil, err
+	}
+	policy := storage.RetentionPolicy{Raw: *retention, Tiers: tiers}
+	
+	switch *storageBackend {
+	case "memory":
+		s := storage.NewMetricsStorage(*history)
+		if err := s.SetRetention(policy); err != nil {
+			return nil, err
+		}
+		return s, nil
+	case "disk":
+		return storage.OpenDiskStorage(storage.DiskOptions{
+			Dir:         *storageDir,
+			HistorySize: *history,
+			Retention:   policy,
+		})
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q (want memory or disk)", *storageBackend)
+	}
+}
+
+// openSinks creates the exporters that metrics are pushed to
+func openSinks() ([]export.Sink, error) {
+	var sinks []export.Sink
+	
+	if *remoteWriteURL != "" {
+		labels, err := parseLabels(*remoteWriteLabels, export.Label{Name: "job", Value: "system-monitor"}, hostLabel("instance"))
+		if err != nil {
+			return nil, fmt.Errorf("-remote-write-labels: %w", err)
+		}
+		spillDir := *remoteWriteSpillDir
+		if spillDir == "" {
+			spillDir = filepath.Join(*storageDir, "remote-write")
+		}
+		w, err := export.NewRemoteWriter(export.RemoteWriteOptions{
+			URL:           *remoteWriteURL,
+			Labels:        labels,
+			BatchSize:     *remoteWriteBatch,
+			FlushInterval: *remoteWriteFlush,
+			SpillDir:      spillDir,
+			MaxSpillBytes: *remoteWriteSpillMax,
+		})
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Pushing metrics to %s", *remoteWriteURL)
+		sinks = append(sinks, w)
+	}
+	
+	if *influxURL != "" {
+		tags, err := parseLabels(*influxTags, hostLabel("host"))
+		if err != nil {
+			return nil, fmt.Errorf("-influx-tags: %w", err)
+		}
+		token := *influxToken
+		if token == "" {
+			token = os.Getenv("INFLUX_TOKEN")
+		}
+		w, err := export.NewInfluxWriter(export.InfluxOptions{
+			URL:    *influxURL,
+			Token:  token,
+			Tags:   tags,
+			Prefix: *influxPrefix,
+		})
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Pushing metrics to InfluxDB at %s", *influxURL)
+		sinks = append(sinks, w)
+	}
+	
+	if *graphiteAddress != "" {
+		tags, err := parseLabels(*graphiteTags, hostLabel("host"))
+		if err != nil {
+			return nil, fmt.Errorf("-graphite-tags: %w", err)
+		}
+		w, err := export.NewGraphiteWriter(export.GraphiteOptions{
+			Address: *graphiteAddress,
+			Prefix:  *graphitePrefix,
+			Tags:    tags,
+			Tagged:  *graphiteTagged,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("-graphite-address: %w", err)
+		}
+		log.Printf("Pushing metrics to Graphite at %s", *graphiteAddress)
+		sinks = append(sinks, w)
+	}
+	
+	if *statsdAddress != "" {
+		if *statsdSampleRate <= 0 || *statsdSampleRate > 1 {
+			return nil, errors.New("-statsd-sample-rate must be greater than 0 and at most 1")
+		}
+		tags, err := parseLabels(*statsdTags, hostLabel("host"))
+		if err != nil {
+			return nil, fmt.Errorf("-statsd-tags: %w", err)
+		}
+		w, err := export.NewStatsDWriter(export.StatsDOptions{
+			Address:    *statsdAddress,
+			Prefix:     *statsdPrefix,
+			Tags:       tags,
+			DogStatsD:  *statsdDogStatsD,
+			SampleRate: *statsdSampleRate,
+			PacketSize: *statsdPacketSize,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("-statsd-address: %w", err)
+		}
+		log.Printf("Pushing metrics to StatsD at %s", *statsdAddress)
+		sinks = append(sinks, w)
+	}
+	
+	if *otlpEndpoint != "" {
+		headerList := *otlpHeaders
+		if headerList == "" {
+			headerList = os.Getenv("OTEL_EXPORTER_OTLP_HEADERS")
+		}
+		parsed, err := parseLabels(headerList)
+		if err != nil {
+			return nil, fmt.Errorf("-otlp-headers: %w", err)
+		}
+		headers := make(map[string]string, len(parsed))
+		for _, h := range parsed {
+			headers[h.Name] = h.Value
+		}
+		attributes, err := parseLabels(*otlpAttributes)
+		if err != nil {
+			return nil, fmt.Errorf("-otlp-attributes: %w", err)
+		}
+		w, err := export.NewOTLPWriter(export.OTLPOptions{
+			Protocol:   *otlpProtocol,
+			Endpoint:   *otlpEndpoint,
+			Insecure:   *otlpInsecure,
+			Headers:    headers,
+			Attributes: attributes,
+		})
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Exporting metrics over OTLP (%s) to %s", *otlpProtocol, *otlpEndpoint)
+		sinks = append(sinks, w)
+	}
+	return sinks, nil
+}
+
+// hostLabel returns a label with the given name holding the hostname, or
+// with no value when it cannot be determined
+func hostLabel(name string) export.Label {
+	hostname, _ := os.Hostname()
+	return export.Label{Name: name, Value: hostname}
+}
+
+// parseLabels parses comma-separated name=value pairs, then appends each of
+// the defaults whose name was not given and whose value is not empty
+func parseLabels(s string, defaults ...export.Label) ([]export.Label, error) {
+	var labels []export.Label
+	seen := make(map[string]bool)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(entry, "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("label %q must be in the form name=value", entry)
+		}
+		name = strings.TrimSpace(name)
+		labels = append(labels, export.Label{Name: name, Value: strings.TrimSpace(value)})
+		seen[name] = true
+	}
+	
+	for _, l := range defaults {
+		if !seen[l.Name] && l.Value != "" {
+			labels = append(labels, l)
+		}
+	}
+	return labels, nil
+}
+
 func main() {
 	flag.Parse()
 	
@@ -185,10 +891,81 @@ func main() {
 	log.Printf("Collection interval: %v", *interval)
 	log.Printf("History size: %d data points", *history)
 	
+	sortKey, err := collector.ParseProcessSortKey(*processSort)
+	if err != nil {
+		log.Fatalf("Invalid -process-sort: %v", err)
+	}
+	processOptions := collector.ProcessOptions{Limit: *processLimit, SortBy: sortKey}
+	cgroupOptions := collector.CgroupOptions{
+		Root:     *cgroupRoot,
+		MaxDepth: *cgroupDepth,
+	}
+	
+	paths := collector.Paths{
+		Proc: *hostProc,
+		Sys:  *hostSys,
+		Etc:  *hostEtc,
+		Root: *hostRoot,
+	}
+	if paths != collector.DefaultPaths() {
+		log.Printf("Host paths: proc=%s sys=%s etc=%s root=%s", paths.Proc, paths.Sys, paths.Etc, paths.Root)
+	}
+	
 	// Initialize components
 	collector := collector.NewCollector()
-	storage := storage.NewMetricsStorage(*history)
+	collector.SetPaths(paths)
+	collector.SetProcessOptions(processOptions)
+	collector.SetCgroupOptions(cgroupOptions)
+	collector.SetDefaultInterval(*interval)
+	if err := configureSources(collector.Registry()); err != nil {
+		log.Fatalf("Invalid collector configuration: %v", err)
+	}
+	storage, err := openStorage()
+	if err != nil {
+		log.Fatalf("Error opening storage: %v", err)
+	}
+	if *storageBackend == "disk" {
+		log.Printf("Storing metrics in %s (%d data points)", *storageDir, storage.Size())
+	}
 	server := NewServer(collector, storage)
+	server.sinks, err = openSinks()
+	if err != nil {
+		log.Fatalf("Error configuring exporters: %v", err)
+	}
+	if *alertRules != "" {
+		file, err := alert.LoadFile(*alertRules)
+		if err != nil {
+			log.Fatalf("Error loading alert rules: %v", err)
+		}
+		if server.alerts, err = alert.NewEngine(file.Rules); err != nil {
+			log.Fatalf("Error loading alert rules: %v", err)
+		}
+		if err := server.alerts.SetMaintenance(file.Maintenance); err != nil {
+			log.Fatalf("Error loading alert rules: %v", err)
+		}
+		log.Printf("Evaluating %d alert rules from %s", len(file.Rules), *alertRules)
+		
+		stateDir := *alertStateDir
+		if stateDir == "" {
+			stateDir = filepath.Join(*storageDir, "alerts")
+		}
+		if err := os.MkdirAll(stateDir, 0o755); err != nil {
+			log.Fatalf("Error creating alert state directory: %v", err)
+		}
+		if server.silences, err = alert.OpenSilences(filepath.Join(stateDir, "silences.json")); err != nil {
+			log.Fatalf("Error loading silences: %v", err)
+		}
+		if server.history, err = alert.OpenHistory(filepath.Join(stateDir, "history.jsonl"), alert.DefaultHistoryLimit); err != nil {
+			log.Fatalf("Error loading alert history: %v", err)
+		}
+		server.alerts.Silences = server.silences
+		if file.Notify != nil {
+			if server.notifier, err = alert.NewDispatcher(*file.Notify, file.Rules); err != nil {
+				log.Fatalf("Error configuring alert notifications: %v", err)
+			}
+			log.Printf("Sending alert notifications to %d receivers", len(file.Notify.Receivers))
+		}
+	}
 	
 	// Start WebSocket handler
 	go server.run()
@@ -196,7 +973,12 @@ func main() {
 	// Start metrics collection
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
-	go server.startMetricsCollection(ctx)
+	collectionDone := make(chan struct{})
+	go func() {
+		server.startMetricsCollection(ctx)
+		close(collectionDone)
+	}()
+	go server.startDiskForecasts(ctx)
 	
 	// Setup routes
 	router := mux.NewRouter()
@@ -204,8 +986,23 @@ func main() {
 	// API routes
 	router.HandleFunc("/api/metrics", server.handleAPIMetrics).Methods("GET")
 	router.HandleFunc("/api/history", server.handleAPIHistory).Methods("GET")
+	router.HandleFunc("/api/processes", server.handleAPIProcesses).Methods("GET")
+	router.HandleFunc("/api/processes/tree", server.handleAPIProcessTree).Methods("GET")
+	router.HandleFunc("/api/processes/{pid:[0-9]+}", server.handleAPIProcessDetail).Methods("GET")
+	router.HandleFunc("/api/cgroups", server.handleAPICgroups).Methods("GET")
+	router.HandleFunc("/api/collectors", server.handleAPICollectors).Methods("GET")
+	router.HandleFunc("/api/collector/status", server.handleAPICollectorStatus).Methods("GET")
+	router.HandleFunc("/api/disk/forecast", server.handleAPIDiskForecast).Methods("GET")
+	router.HandleFunc("/api/alerts", server.handleAPIAlerts).Methods("GET")
+	router.HandleFunc("/api/alerts/history", server.handleAPIAlertHistory).Methods("GET")
+	router.HandleFunc("/api/silences", server.handleAPISilences).Methods("GET")
+	router.HandleFunc("/api/silences", server.handleAPICreateSilence).Methods("POST")
+	router.HandleFunc("/api/silences/{id}", server.handleAPIExpireSilence).Methods("DELETE")
 	router.HandleFunc("/ws", server.handleWebSocket)
 	
+	// Prometheus scrape endpoint
+	router.HandleFunc("/metrics", server.handleMetrics).Methods("GET")
+	
 	// Static files
 	router.PathPrefix("/static/").Handler(http.FileServer(http.FS(staticFiles)))
 	
@@ -246,5 +1043,23 @@ func main() {
 		log.Fatalf("Server error: %v", err)
 	}
 	
+	// Let an in-flight collection finish before closing the storage
+	cancel()
+	<-collectionDone
+	if err := storage.Close(); err != nil {
+		log.Printf("Error closing storage: %v", err)
+	}
+	for _, sink := range server.sinks {
+		if err := sink.Close(); err != nil {
+			log.Printf("Error closing exporter: %v", err)
+		}
+	}
+	if server.notifier != nil {
+		server.notifier.Close()
+	}
+	if err := server.history.Close(); err != nil {
+		log.Printf("Error closing alert history: %v", err)
+	}
+	
 	log.Println("Server stopped")
 }
\ No newline at end of file
@@ -2,13 +2,20 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/kennethfeh/system-monitor/internal/alert"
 	"github.com/kennethfeh/system-monitor/internal/collector"
+	"github.com/kennethfeh/system-monitor/internal/export"
+	"github.com/kennethfeh/system-monitor/internal/models"
 	"github.com/kennethfeh/system-monitor/internal/storage"
 )
 
@@ -62,6 +69,165 @@ func TestHandleAPIMetrics(t *testing.T) {
 	}
 }
 
+func TestHandleMetrics(t *testing.T) {
+	col := collector.NewCollector()
+	stor := storage.NewMetricsStorage(10)
+	server := NewServer(col, stor)
+	
+	tests := []struct {
+		accept      string
+		contentType string
+		eof         bool
+	}{
+		{"", "text/plain; version=0.0.4; charset=utf-8", false},
+		{"application/openmetrics-text;version=1.0.0,text/plain;version=0.0.4;q=0.5,*/*;q=0.1", "application/openmetrics-text; version=1.0.0; charset=utf-8", true},
+	}
+	
+	for _, tt := range tests {
+		req, err := http.NewRequest("GET", "/metrics", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Accept", tt.accept)
+		
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(server.handleMetrics).ServeHTTP(rr, req)
+		
+		if rr.Code != http.StatusOK {
+			t.Errorf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+		}
+		if got := rr.Header().Get("Content-Type"); got != tt.contentType {
+			t.Errorf("Accept %q: got content type %q, want %q", tt.accept, got, tt.contentType)
+		}
+		body := rr.Body.String()
+		if !strings.Contains(body, "sysmon_memory_total_bytes ") {
+			t.Errorf("Expected memory metrics in the exposition, got:\n%s", body)
+		}
+		if got := strings.HasSuffix(body, "# EOF\n"); got != tt.eof {
+			t.Errorf("Accept %q: expected EOF marker %v", tt.accept, tt.eof)
+		}
+	}
+}
+
+func TestHandleAPIAlerts(t *testing.T) {
+	col := collector.NewCollector()
+	stor := storage.NewMetricsStorage(10)
+	server := NewServer(col, stor)
+	
+	engine, err := alert.NewEngine([]alert.Rule{
+		{Name: "Full", Expr: "disk.used_percent > 90"},
+		{Name: "Filling", Expr: "disk.used_percent > 50 for 1h"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	server.alerts = engine
+	engine.Evaluate(models.SystemMetrics{
+		Timestamp: time.Now(),
+		Disk:      []models.DiskMetrics{{Device: "/dev/sda1", Mountpoint: "/", UsedPercent: 95}},
+	})
+	
+	tests := []struct {
+		query    string
+		expected int
+		alerts   int
+	}{
+		{"", http.StatusOK, 2},
+		{"?state=firing", http.StatusOK, 1},
+		{"?state=resolved", http.StatusOK, 0},
+		{"?state=silenced", http.StatusBadRequest, 0},
+		{"?silenced=true", http.StatusOK, 0},
+		{"?silenced=false", http.StatusOK, 2},
+		{"?silenced=maybe", http.StatusBadRequest, 0},
+	}
+	
+	for _, tt := range tests {
+		req, err := http.NewRequest("GET", "/api/alerts"+tt.query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(server.handleAPIAlerts).ServeHTTP(rr, req)
+		
+		if rr.Code != tt.expected {
+			t.Errorf("Query %q: got status %v want %v", tt.query, rr.Code, tt.expected)
+			continue
+		}
+		if rr.Code != http.StatusOK {
+			continue
+		}
+		var alerts []alert.Alert
+		if err := json.Unmarshal(rr.Body.Bytes(), &alerts); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+		if len(alerts) != tt.alerts {
+			t.Errorf("Query %q: expected %d alerts, got %d", tt.query, tt.alerts, len(alerts))
+		}
+	}
+}
+
+func TestHandleAPISilences(t *testing.T) {
+	router := mux.NewRouter()
+	
+	col := collector.NewCollector()
+	stor := storage.NewMetricsStorage(10)
+	server := NewServer(col, stor)
+	
+	router.HandleFunc("/api/alerts/history", server.handleAPIAlertHistory).Methods("GET")
+	router.HandleFunc("/api/silences", server.handleAPISilences).Methods("GET")
+	router.HandleFunc("/api/silences", server.handleAPICreateSilence).Methods("POST")
+	router.HandleFunc("/api/silences/{id}", server.handleAPIExpireSilence).Methods("DELETE")
+	
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+	
+	if rr := do("POST", "/api/silences", `{"matchers": "mountpoint=\"/\"", "duration": "1h"}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected a silence without created_by to be rejected, got %v", rr.Code)
+	}
+	
+	rr := do("POST", "/api/silences", `{"matchers": "{rule=\"DiskFull\"}", "duration": "1h", "created_by": "alice", "comment": "deploy"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %v: %s", rr.Code, rr.Body.String())
+	}
+	var created alert.Silence
+	if err := json.Unmarshal(rr.Body.Bytes(), &created); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if created.ID == "" || created.State != alert.SilenceActive || created.EndsAt.Sub(created.StartsAt) != time.Hour {
+		t.Errorf("Unexpected silence %+v", created)
+	}
+	
+	var silences []alert.Silence
+	json.Unmarshal(do("GET", "/api/silences", "").Body.Bytes(), &silences)
+	if len(silences) != 1 || silences[0].ID != created.ID {
+		t.Errorf("Expected the created silence to be listed, got %+v", silences)
+	}
+	
+	if rr := do("DELETE", "/api/silences/unknown?by=bob", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown silence, got %v", rr.Code)
+	}
+	if rr := do("DELETE", "/api/silences/"+created.ID, ""); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 without by, got %v", rr.Code)
+	}
+	if rr := do("DELETE", "/api/silences/"+created.ID+"?by=bob", ""); rr.Code != http.StatusOK {
+		t.Errorf("Expected 200 expiring the silence, got %v", rr.Code)
+	}
+	
+	var entries []alert.HistoryEntry
+	json.Unmarshal(do("GET", "/api/alerts/history?since=1h", "").Body.Bytes(), &entries)
+	if len(entries) != 2 || entries[0].Event != alert.EventSilenceCreated || entries[1].Event != alert.EventSilenceExpired || entries[1].Silence.ExpiredBy != "bob" {
+		t.Errorf("Expected the silence to be created then expired by bob, got %+v", entries)
+	}
+	if rr := do("GET", "/api/alerts/history?since=yesterday", ""); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected an invalid since to be rejected, got %v", rr.Code)
+	}
+}
+
 func TestHandleAPIHistory(t *testing.T) {
 	col := collector.NewCollector()
 	stor := storage.NewMetricsStorage(10)
@@ -93,6 +259,192 @@ func TestHandleAPIHistory(t *testing.T) {
 	}
 }
 
+func TestHandleAPIHistoryQuery(t *testing.T) {
+	col := collector.NewCollector()
+	stor := storage.NewMetricsStorage(10)
+	server := NewServer(col, stor)
+	
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		stor.Add(models.SystemMetrics{
+			Timestamp: now.Add(time.Duration(i-5) * time.Second),
+			Memory:    models.MemoryMetrics{UsedPercent: 50},
+		})
+	}
+	
+	tests := []struct {
+		name   string
+		query  string
+		status int
+	}{
+		{"Range", "?start=-1m&step=10s&fields=memory.used_percent&agg=max", http.StatusOK},
+		{"Bad step", "?step=soon", http.StatusBadRequest},
+		{"Bad aggregation", "?agg=median", http.StatusBadRequest},
+		{"End before start", "?start=-1m&end=-2m", http.StatusBadRequest},
+		{"Too many points", "?start=-24h&step=1ms", http.StatusBadRequest},
+	}
+	
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/history"+tt.query, nil)
+			rr := httptest.NewRecorder()
+			server.handleAPIHistory(rr, req)
+			
+			if rr.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d: %s", tt.status, rr.Code, rr.Body.String())
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			
+			var result storage.HistoryResult
+			if err := json.NewDecoder(rr.Body).Decode(&result); err != nil {
+				t.Fatalf("Invalid JSON: %v", err)
+			}
+			if len(result.Series) != 1 || result.Series[0].Name != "memory.used_percent" {
+				t.Errorf("Expected the memory series, got %+v", result.Series)
+			}
+		})
+	}
+}
+
+func TestParseQueryTime(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	
+	tests := []struct {
+		input string
+		want  time.Time
+	}{
+		{"-6h", now.Add(-6 * time.Hour)},
+		{"30m", now.Add(-30 * time.Minute)},
+		{"1704067200", time.Unix(1704067200, 0)},
+		{"2024-01-01T06:00:00Z", now.Add(-6 * time.Hour)},
+	}
+	
+	for _, tt := range tests {
+		got, err := parseQueryTime(tt.input, now)
+		if err != nil {
+			t.Errorf("parseQueryTime(%q) error: %v", tt.input, err)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("parseQueryTime(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+	
+	if _, err := parseQueryTime("yesterday", now); err == nil {
+		t.Error("Expected error for invalid time")
+	}
+}
+
+func TestParseLabels(t *testing.T) {
+	hostname, _ := os.Hostname()
+	defaults := []export.Label{{Name: "job", Value: "system-monitor"}, hostLabel("instance"), {Name: "empty"}}
+	
+	labels, err := parseLabels("", defaults...)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(labels) != 2 || labels[0].Value != "system-monitor" || labels[1].Value != hostname {
+		t.Errorf("Expected default job and instance labels, got %v", labels)
+	}
+	
+	labels, err = parseLabels("instance=web-1, dc = eu", defaults...)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := []export.Label{{Name: "instance", Value: "web-1"}, {Name: "dc", Value: "eu"}, {Name: "job", Value: "system-monitor"}}
+	if len(labels) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, labels)
+	}
+	for i := range want {
+		if labels[i] != want[i] {
+			t.Errorf("Label %d: expected %v, got %v", i, want[i], labels[i])
+		}
+	}
+	
+	if _, err := parseLabels("novalue"); err == nil {
+		t.Error("Expected error for a label without a value")
+	}
+}
+
+func TestHandleAPIProcesses(t *testing.T) {
+	col := collector.NewCollector()
+	stor := storage.NewMetricsStorage(10)
+	server := NewServer(col, stor)
+	
+	tests := []struct {
+		name     string
+		query    string
+		expected int
+	}{
+		{"Defaults", "", http.StatusOK},
+		{"Limit and sort", "?limit=3&sort=memory", http.StatusOK},
+		{"Invalid sort", "?sort=bogus", http.StatusBadRequest},
+		{"Invalid limit", "?limit=-1", http.StatusBadRequest},
+	}
+	
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", "/api/processes"+tt.query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(server.handleAPIProcesses).ServeHTTP(rr, req)
+			
+			if status := rr.Code; status != tt.expected {
+				t.Errorf("Handler returned wrong status code: got %v want %v",
+					status, tt.expected)
+			}
+		})
+	}
+}
+
+func TestConfigureSources(t *testing.T) {
+	col := collector.NewCollector()
+	
+	*disableSources = "psi, temperature"
+	defer func() { *disableSources = "" }()
+	
+	if err := configureSources(col.Registry()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	
+	for _, info := range col.Registry().Describe() {
+		if (info.Name == "psi" || info.Name == "temperature") && info.Enabled {
+			t.Errorf("Expected %s to be disabled", info.Name)
+		}
+	}
+	
+	*disableSources = "nonexistent"
+	if err := configureSources(col.Registry()); err == nil {
+		t.Error("Expected error for unknown source")
+	}
+	*disableSources = ""
+	
+	*sourceIntervals = "cpu=1s, disk=30s"
+	defer func() { *sourceIntervals = "" }()
+	
+	if err := configureSources(col.Registry()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := col.Registry().Interval("disk"); got != 30*time.Second {
+		t.Errorf("Expected disk interval 30s, got %v", got)
+	}
+	if got := col.TickInterval(); got != time.Second {
+		t.Errorf("Expected tick interval 1s, got %v", got)
+	}
+	
+	for _, bad := range []string{"cpu", "cpu=fast", "cpu=-1s", "nonexistent=1s"} {
+		*sourceIntervals = bad
+		if err := configureSources(col.Registry()); err == nil {
+			t.Errorf("Expected error for interval %q", bad)
+		}
+	}
+}
+
 func TestMetricsCollection(t *testing.T) {
 	col := collector.NewCollector()
 	stor := storage.NewMetricsStorage(10)
@@ -112,6 +464,45 @@ func TestMetricsCollection(t *testing.T) {
 	}
 }
 
+func TestDiskForecast(t *testing.T) {
+	col := collector.NewCollector()
+	stor := storage.NewMetricsStorage(10)
+	stor.SetRetention(storage.RetentionPolicy{Raw: 48 * time.Hour})
+	server := NewServer(col, stor)
+	
+	// / grows by 1GB an hour over 12 hours
+	start := time.Now().Add(-12 * time.Hour)
+	for i := 0; i <= 144; i++ {
+		ts := start.Add(time.Duration(i) * 5 * time.Minute)
+		stor.Add(models.SystemMetrics{
+			Timestamp: ts,
+			Disk:      []models.DiskMetrics{{Mountpoint: "/", Total: 100e9, Used: uint64(50e9 + ts.Sub(start).Hours()*1e9), Free: uint64(50e9 - ts.Sub(start).Hours()*1e9)}},
+		})
+	}
+	
+	now := start.Add(12 * time.Hour)
+	server.refitDiskForecasts(now)
+	forecasts := server.diskForecast()
+	if len(forecasts) != 1 || forecasts[0].HoursToFull == nil {
+		t.Fatalf("Expected a time until / is full, got %+v", forecasts)
+	}
+	stor.Clear()
+	if cached := server.diskForecast(); len(cached) != 1 {
+		t.Errorf("Expected the forecast to be kept until refitted, got %+v", cached)
+	}
+	server.refitDiskForecasts(now.Add(forecastInterval))
+	if refitted := server.diskForecast(); len(refitted) != 0 {
+		t.Errorf("Expected the refitted forecast to be empty, got %+v", refitted)
+	}
+	
+	req := httptest.NewRequest("GET", "/api/disk/forecast?window=1h", nil)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(server.handleAPIDiskForecast).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || strings.TrimSpace(rr.Body.String()) != "[]" {
+		t.Errorf("Expected an empty list, got %v %s", rr.Code, rr.Body.String())
+	}
+}
+
 func TestRoutes(t *testing.T) {
 	router := mux.NewRouter()
 	
@@ -121,7 +512,17 @@ func TestRoutes(t *testing.T) {
 	
 	router.HandleFunc("/api/metrics", server.handleAPIMetrics).Methods("GET")
 	router.HandleFunc("/api/history", server.handleAPIHistory).Methods("GET")
+	router.HandleFunc("/api/processes", server.handleAPIProcesses).Methods("GET")
+	router.HandleFunc("/api/processes/tree", server.handleAPIProcessTree).Methods("GET")
+	router.HandleFunc("/api/processes/{pid:[0-9]+}", server.handleAPIProcessDetail).Methods("GET")
+	router.HandleFunc("/api/collectors", server.handleAPICollectors).Methods("GET")
+	router.HandleFunc("/api/collector/status", server.handleAPICollectorStatus).Methods("GET")
+	router.HandleFunc("/api/disk/forecast", server.handleAPIDiskForecast).Methods("GET")
+	router.HandleFunc("/api/alerts", server.handleAPIAlerts).Methods("GET")
+	router.HandleFunc("/api/alerts/history", server.handleAPIAlertHistory).Methods("GET")
+	router.HandleFunc("/api/silences", server.handleAPISilences).Methods("GET")
 	router.HandleFunc("/ws", server.handleWebSocket)
+	router.HandleFunc("/metrics", server.handleMetrics).Methods("GET")
 	
 	tests := []struct {
 		name     string
@@ -131,6 +532,18 @@ func TestRoutes(t *testing.T) {
 	}{
 		{"API Metrics", "GET", "/api/metrics", http.StatusOK},
 		{"API History", "GET", "/api/history", http.StatusOK},
+		{"API Processes", "GET", "/api/processes", http.StatusOK},
+		{"API Process Tree", "GET", "/api/processes/tree", http.StatusOK},
+		{"API Process Detail", "GET", fmt.Sprintf("/api/processes/%d", os.Getpid()), http.StatusOK},
+		{"API Process Not Found", "GET", "/api/processes/2147483647", http.StatusNotFound},
+		{"API Collectors", "GET", "/api/collectors", http.StatusOK},
+		{"API Collector Status", "GET", "/api/collector/status", http.StatusOK},
+		{"API Disk Forecast", "GET", "/api/disk/forecast", http.StatusOK},
+		{"API Disk Forecast Bad Window", "GET", "/api/disk/forecast?window=-1h", http.StatusBadRequest},
+		{"API Alerts", "GET", "/api/alerts", http.StatusOK},
+		{"API Alert History", "GET", "/api/alerts/history", http.StatusOK},
+		{"API Silences", "GET", "/api/silences", http.StatusOK},
+		{"Prometheus Metrics", "GET", "/metrics", http.StatusOK},
 	}
 	
 	for _, tt := range tests {
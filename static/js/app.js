@@ -4,8 +4,6 @@ class SystemMonitor {
         this.cpuHistory = [];
         this.memoryHistory = [];
         this.maxHistoryPoints = 30;
-        this.networkPrevious = {};
-        this.lastUpdate = Date.now();
         
         this.initWebSocket();
         this.initCharts();
@@ -73,7 +71,7 @@ class SystemMonitor {
         this.updateMemory(data.memory);
         
         // Update Disk metrics
-        this.updateDisk(data.disk);
+        this.updateDisk(data.disk, data.disk_io);
         
         // Update Network metrics
         this.updateNetwork(data.network);
@@ -95,7 +93,8 @@ class SystemMonitor {
         if (!cpu) return;
         
         const percent = cpu.total_percent || 0;
-        document.getElementById('cpu-percent').textContent = `${percent.toFixed(1)}%`;
+        document.getElementById('cpu-percent').textContent =
+            cpu.unavailable ? 'n/a' : `${percent.toFixed(1)}%`;
         document.getElementById('cpu-cores').textContent = `${cpu.cores || 0} cores`;
         document.getElementById('cpu-bar').style.width = `${percent}%`;
         
@@ -105,6 +104,14 @@ class SystemMonitor {
             this.cpuHistory.shift();
         }
         
+        // Update CPU mode breakdown
+        const modes = cpu.modes;
+        if (modes) {
+            document.getElementById('cpu-modes').textContent =
+                `user ${modes.user.toFixed(1)}% · sys ${modes.system.toFixed(1)}% · ` +
+                `iowait ${modes.iowait.toFixed(1)}% · steal ${modes.steal.toFixed(1)}%`;
+        }
+        
         // Update CPU cores grid
         this.updateCPUCores(cpu.usage_percent);
     }
@@ -144,9 +151,15 @@ class SystemMonitor {
         }
     }
 
-    updateDisk(disks) {
+    updateDisk(disks, diskIO) {
         if (!disks) return;
         
+        // Index device activity by mountpoint
+        const ioByMount = {};
+        (diskIO || []).forEach(io => {
+            (io.mountpoints || []).forEach(mp => { ioByMount[mp] = io; });
+        });
+        
         const diskList = document.getElementById('disk-list');
         diskList.innerHTML = '';
         
@@ -154,6 +167,13 @@ class SystemMonitor {
             const usedGB = (disk.used / 1024 / 1024 / 1024).toFixed(1);
             const totalGB = (disk.total / 1024 / 1024 / 1024).toFixed(1);
             
+            const io = ioByMount[disk.mountpoint];
+            const ioLine = io ? `
+                <div class="disk-usage">
+                    <span>R ${this.formatBytes(io.read_bytes_per_sec)}/s · W ${this.formatBytes(io.write_bytes_per_sec)}/s</span>
+                    <span>${io.busy_percent.toFixed(0)}% busy</span>
+                </div>` : '';
+            
             const diskItem = document.createElement('div');
             diskItem.className = 'disk-item';
             diskItem.innerHTML = `
@@ -167,7 +187,7 @@ class SystemMonitor {
                 </div>
                 <div class="disk-bar">
                     <div class="disk-bar-fill" style="width: ${disk.used_percent}%"></div>
-                </div>
+                </div>${ioLine}
             `;
             diskList.appendChild(diskItem);
         });
@@ -179,15 +199,9 @@ class SystemMonitor {
         const networkList = document.getElementById('network-list');
         networkList.innerHTML = '';
         
-        const currentTime = Date.now();
-        const timeDiff = (currentTime - this.lastUpdate) / 1000; // seconds
-        
         networks.forEach(network => {
-            const prevNetwork = this.networkPrevious[network.name] || {};
-            const sentRate = prevNetwork.bytes_sent ? 
-                ((network.bytes_sent - prevNetwork.bytes_sent) / timeDiff) : 0;
-            const recvRate = prevNetwork.bytes_recv ? 
-                ((network.bytes_recv - prevNetwork.bytes_recv) / timeDiff) : 0;
+            const sentRate = network.bytes_sent_rate || 0;
+            const recvRate = network.bytes_recv_rate || 0;
             
             const networkItem = document.createElement('div');
             networkItem.className = 'network-item';
@@ -215,15 +229,7 @@ class SystemMonitor {
                 </div>
             `;
             networkList.appendChild(networkItem);
-            
-            // Store current values for next update
-            this.networkPrevious[network.name] = {
-                bytes_sent: network.bytes_sent,
-                bytes_recv: network.bytes_recv
-            };
         });
-        
-        this.lastUpdate = currentTime;
     }
 
     updateCharts() {
@@ -284,7 +290,7 @@ class SystemMonitor {
     }
 
     formatBytes(bytes) {
-        if (bytes === 0) return '0 B';
+        if (!bytes || bytes < 1) return '0 B';
         const k = 1024;
         const sizes = ['B', 'KB', 'MB', 'GB', 'TB'];
         const i = Math.floor(Math.log(bytes) / Math.log(k));